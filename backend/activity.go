@@ -0,0 +1,34 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleListActivity lists the current user's recent activity, newest first. Older pages
+// are fetched by passing the next_before of a response as before; action and
+// resource_type filter the entries.
+func (s *Server) handleListActivity(c *gin.Context) {
+	ctx := context.Background()
+	userID := c.GetString("user_id")
+
+	_, limit := parsePagination(c, 50, 200)
+	filter := ActivityLogFilter{
+		Action:       c.Query("action"),
+		ResourceType: c.Query("resource_type"),
+	}
+
+	activities, err := s.store.ListActivityLogs(ctx, userID, limit, c.Query("before"), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list activity"})
+		return
+	}
+
+	resp := ActivityResponse{Activities: activities, Limit: limit}
+	if len(activities) == limit {
+		resp.NextBefore = activities[len(activities)-1].ID
+	}
+	c.JSON(http.StatusOK, resp)
+}
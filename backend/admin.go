@@ -0,0 +1,200 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+// isAdminEmail reports whether email belongs to a configured administrator
+func isAdminEmail(cfg Config, email string) bool {
+	if email == "" {
+		return false
+	}
+	for _, admin := range cfg.AdminEmails {
+		if strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAdmin reports whether the user is an administrator
+func (s *Server) isAdmin(ctx context.Context, userID string) bool {
+	return isAdminUser(ctx, s.cfg, s.store.Store, userID)
+}
+
+// isAdminUser reports whether the user is an administrator, see userIsAdmin
+func isAdminUser(ctx context.Context, cfg Config, store *Store, userID string) bool {
+	if userID == "" {
+		return false
+	}
+	user, err := store.GetUser(ctx, userID)
+	if err != nil {
+		return false
+	}
+	return userIsAdmin(cfg, user)
+}
+
+// userIsAdmin reports whether a user is listed in ADMIN_EMAILS. The stored is_admin flag
+// is only refreshed on login and is shown to clients, but access is decided from the
+// current list so removing an address takes effect at once.
+func userIsAdmin(cfg Config, user *User) bool {
+	return isAdminEmail(cfg, user.Email)
+}
+
+// handleListUsers lists all users with their notebook and source counts and last login
+func (s *Server) handleListUsers(c *gin.Context) {
+	users, err := s.store.ListUsersWithUsage(context.Background())
+	if err != nil {
+		golog.Errorf("failed to list users: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list users"})
+		return
+	}
+	respondList(c, users)
+}
+
+// eraseUser deletes a user's database records, then removes their uploaded and generated
+// files and their notebooks' vectors
+func (s *Server) eraseUser(ctx context.Context, userID string) (*UserErasure, error) {
+	receipt, err := s.store.EraseUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256([]byte(userID))
+	receipt.SubjectHash = hex.EncodeToString(hash[:])
+	receipt.ErasedAt = time.Now()
+
+	s.vectorMutex.Lock()
+	for _, notebookID := range receipt.NotebookIDs {
+		receipt.VectorChunks += s.vectorStore.DeleteSourceChunks(ctx, notebookID, "")
+		delete(s.loadedNotebooks, notebookID)
+	}
+	s.vectorMutex.Unlock()
+
+	// Per-user uploads and generated images
+	removed, err := s.storage.DeletePrefix(ctx, userID+"/")
+	receipt.Files += removed
+	if err != nil {
+		golog.Errorf("failed to remove uploads of erased user: %v", err)
+	}
+
+	for _, name := range receipt.BlobFiles {
+		if err := s.storage.Delete(ctx, uploadKey("", name)); err == nil {
+			receipt.Files++
+		} else if !errors.Is(err, os.ErrNotExist) {
+			golog.Errorf("failed to remove blob %s of erased user: %v", name, err)
+		}
+	}
+
+	return receipt, nil
+}
+
+// handleEraseUser permanently deletes a user and all of their data (GDPR erasure). The
+// deletion is recorded in the admin's activity log by the user's hash only.
+func (s *Server) handleEraseUser(c *gin.Context) {
+	ctx := context.Background()
+	adminID := c.GetString("user_id")
+	userID := c.Param("userId")
+
+	receipt, err := s.eraseUser(ctx, userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+			return
+		}
+		golog.Errorf("failed to erase user: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to erase user"})
+		return
+	}
+
+	// Log erasure activity, without anything that identifies the erased user
+	details, _ := json.Marshal(receipt)
+	activityLog := &ActivityLog{
+		UserID:       adminID,
+		Action:       "erase_user",
+		ResourceType: "user",
+		ResourceID:   receipt.SubjectHash,
+		Details:      string(details),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log user erasure activity: %v", err)
+	}
+
+	c.JSON(http.StatusOK, receipt)
+}
+
+// unloadNotebookIndex removes a notebook's chunks from the vector store and marks it
+// unloaded, so the next request loads it again from the database. The caller must hold
+// vectorMutex. It returns the number of chunks removed.
+func (s *Server) unloadNotebookIndex(ctx context.Context, notebookID string) int {
+	removed := s.vectorStore.Unload(ctx, notebookID)
+	delete(s.loadedNotebooks, notebookID)
+	return removed
+}
+
+// notebookIndexStats returns a notebook's index stats including whether it is loaded.
+// The stored chunk count tells how large the index is before it is loaded.
+func (s *Server) notebookIndexStats(ctx context.Context, notebookID string) IndexMemoryStats {
+	stats := s.vectorStore.GetNotebookStats(ctx, notebookID)
+	s.vectorMutex.RLock()
+	_, stats.Loaded = s.loadedNotebooks[notebookID]
+	s.vectorMutex.RUnlock()
+
+	var err error
+	stats.Sources, stats.StoredChunks, err = s.store.CountNotebookChunks(ctx, notebookID)
+	if err != nil {
+		golog.Errorf("failed to count chunks of notebook %s: %v", notebookID, err)
+	}
+	return stats
+}
+
+// handleUnloadNotebookIndex drops a notebook's in-memory vector index without restarting
+// the server. It also works for notebooks that no longer exist, to clear leftover chunks.
+func (s *Server) handleUnloadNotebookIndex(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+
+	s.vectorMutex.Lock()
+	removed := s.unloadNotebookIndex(ctx, notebookID)
+	s.vectorMutex.Unlock()
+
+	golog.Infof("admin %s unloaded the vector index of notebook %s (%d chunks)", c.GetString("user_id"), notebookID, removed)
+	c.JSON(http.StatusOK, s.notebookIndexStats(ctx, notebookID))
+}
+
+// handleReloadNotebookIndex rebuilds a notebook's in-memory vector index from its sources
+func (s *Server) handleReloadNotebookIndex(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+
+	if _, err := s.store.Store.GetNotebook(ctx, notebookID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Notebook not found"})
+		return
+	}
+
+	s.vectorMutex.Lock()
+	removed := s.unloadNotebookIndex(ctx, notebookID)
+	err := s.ingestNotebookSources(ctx, notebookID)
+	s.vectorMutex.Unlock()
+	if err != nil {
+		golog.Errorf("failed to reload vector index of notebook %s: %v", notebookID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reload index"})
+		return
+	}
+
+	golog.Infof("admin %s reloaded the vector index of notebook %s (%d chunks replaced)", c.GetString("user_id"), notebookID, removed)
+	c.JSON(http.StatusOK, s.notebookIndexStats(ctx, notebookID))
+}
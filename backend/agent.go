@@ -3,8 +3,10 @@ package backend
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os/exec"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -13,19 +15,29 @@ import (
 	ollamallm "github.com/tmc/langchaingo/llms/ollama"
 	"github.com/tmc/langchaingo/llms/openai"
 	"github.com/tmc/langchaingo/prompts"
+	"github.com/tmc/langchaingo/schema"
 )
 
+// pptTextModel is the Gemini model that writes slide decks
+const pptTextModel = "gemini-3-flash-preview"
+
 // Agent handles AI operations for generating notes and chat responses
 type Agent struct {
 	vectorStore *VectorStore
-	llm         llms.Model
+	llm         llms.Model // text generation, selected by TEXT_PROVIDER
+	pptLLM      llms.Model // Gemini for slide decks, nil without a Google API key
 	cfg         Config
-	provider    LLMProvider
+	provider    LLMProvider // image generation
+	speech      *SpeechClient
+	transcriber *TranscriptionClient
 }
 
 // NewAgent creates a new agent
-func NewAgent(cfg Config, vectorStore *VectorStore) (*Agent, error) {
-	llm, err := createLLM(cfg)
+func NewAgent(cfg Config, vectorStore *VectorStore, storage Storage) (*Agent, error) {
+	// One pooled transport for every provider client
+	transport := newProviderTransport(cfg)
+
+	llm, err := createLLM(cfg, transport)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create LLM: %w", err)
 	}
@@ -37,38 +49,84 @@ func NewAgent(cfg Config, vectorStore *VectorStore) (*Agent, error) {
 		if cfg.GLMAPIKey == "" {
 			return nil, fmt.Errorf("glm_api_key is required when image_provider is 'glm'")
 		}
-		provider = NewGLMImageClient(cfg.GLMAPIKey)
+		provider = NewGLMImageClient(cfg.GLMAPIKey, transport, storage)
 	case "zimage":
 		if cfg.ZImageAPIKey == "" {
 			return nil, fmt.Errorf("zimage_api_key is required when image_provider is 'zimage'")
 		}
-		provider = NewZImageClient(cfg.ZImageAPIKey)
+		provider = NewZImageClient(cfg.ZImageAPIKey, transport, storage)
+	case "openai":
+		baseURL := cfg.OpenAIImageBaseURL
+		if baseURL == "" {
+			baseURL = cfg.OpenAIBaseURL
+		}
+		provider = NewOpenAIImageClient(cfg.OpenAIAPIKey, baseURL, transport, storage)
 	case "gemini":
-		provider = NewGeminiClient(cfg.GoogleAPIKey, llm)
+		provider = NewGeminiClient(cfg.GoogleAPIKey, llm, transport, newImageRetryPolicy(cfg), storage)
 	default:
-		return nil, fmt.Errorf("unknown image provider: %s (supported: gemini, glm, zimage)", cfg.ImageProvider)
+		return nil, fmt.Errorf("unknown image provider: %s (supported: gemini, glm, zimage, openai)", cfg.ImageProvider)
+	}
+
+	// Speech endpoints default to the OpenAI-compatible server used for text
+	ttsBaseURL, transcriptionBaseURL := cfg.TTSBaseURL, cfg.TranscriptionBaseURL
+	if cfg.TextProvider == TextProviderOpenAI {
+		if ttsBaseURL == "" {
+			ttsBaseURL = cfg.OpenAIBaseURL
+		}
+		if transcriptionBaseURL == "" {
+			transcriptionBaseURL = cfg.OpenAIBaseURL
+		}
+	}
+
+	var pptLLM llms.Model
+	if cfg.TextProvider == TextProviderGemini {
+		pptLLM = llm
+	} else if cfg.GoogleAPIKey != "" {
+		pptLLM = newRetryingModel(NewGeminiTextModel(cfg.GoogleAPIKey, pptTextModel, transport), cfg)
 	}
 
 	return &Agent{
 		vectorStore: vectorStore,
 		llm:         llm,
+		pptLLM:      pptLLM,
 		cfg:         cfg,
 		provider:    provider,
+		speech:      NewSpeechClient(cfg.OpenAIAPIKey, ttsBaseURL, cfg.TTSModel, transport, storage),
+		transcriber: NewTranscriptionClient(cfg.OpenAIAPIKey, transcriptionBaseURL, cfg.TranscriptionModel, transport),
 	}, nil
 }
 
-// createLLM creates an LLM based on configuration
-func createLLM(cfg Config) (llms.Model, error) {
+// createLLM creates the text generation LLM selected by TEXT_PROVIDER, wrapped with the
+// configured retry and timeout handling
+func createLLM(cfg Config, transport http.RoundTripper) (llms.Model, error) {
+	llm, err := createProviderLLM(cfg, transport)
+	if err != nil {
+		return nil, err
+	}
+	return newRetryingModel(llm, cfg), nil
+}
+
+// createProviderLLM creates the underlying LLM client for the configured provider
+func createProviderLLM(cfg Config, transport http.RoundTripper) (llms.Model, error) {
+	if cfg.TextProvider == TextProviderGemini {
+		return NewGeminiTextModel(cfg.GoogleAPIKey, cfg.GeminiTextModel, transport), nil
+	}
+
+	// Timeouts come from the retrying wrapper, per attempt
+	httpClient := providerHTTPClient(transport, 0)
+
 	if cfg.IsOllama() {
 		return ollamallm.New(
 			ollamallm.WithModel(cfg.OllamaModel),
 			ollamallm.WithServerURL(cfg.OllamaBaseURL),
+			ollamallm.WithHTTPClient(httpClient),
 		)
 	}
 
 	opts := []openai.Option{
 		openai.WithToken(cfg.OpenAIAPIKey),
 		openai.WithModel(cfg.OpenAIModel),
+		openai.WithHTTPClient(httpClient),
 	}
 	if cfg.OpenAIBaseURL != "" {
 		opts = append(opts, openai.WithBaseURL(cfg.OpenAIBaseURL))
@@ -77,66 +135,156 @@ func createLLM(cfg Config) (llms.Model, error) {
 	return openai.New(opts...)
 }
 
-// GenerateTransformation generates a note based on transformation type
-func (a *Agent) GenerateTransformation(ctx context.Context, req *TransformationRequest, sources []Source) (*TransformationResponse, error) {
-	// Build context from sources
-	var sourceContext strings.Builder
-	for i, src := range sources {
-		sourceContext.WriteString(fmt.Sprintf("\n## Source %d: %s\n", i+1, src.Name))
+// retryingModel retries failed LLM calls and bounds each attempt with a timeout, so every
+// text provider behaves the same way when the upstream API is slow or flaky
+type retryingModel struct {
+	llms.Model
+	attempts int
+	timeout  time.Duration
+}
 
-		// Use MaxContextLength from config, or default to a safe large value if not set (or too small)
-		limit := a.cfg.MaxContextLength
-		if limit <= 0 {
-			limit = 100000 // Default to 100k chars if config is invalid
-		}
+// newRetryingModel wraps llm with the retry and timeout settings from cfg
+func newRetryingModel(llm llms.Model, cfg Config) *retryingModel {
+	return &retryingModel{
+		Model:    llm,
+		attempts: cfg.LLMMaxRetries + 1,
+		timeout:  time.Duration(cfg.LLMTimeout) * time.Second,
+	}
+}
 
-		if src.Content != "" {
-			if len(src.Content) <= limit {
-				sourceContext.WriteString(src.Content)
-			} else {
-				// Truncate content instead of replacing it entirely
-				sourceContext.WriteString(src.Content[:limit])
-				sourceContext.WriteString(fmt.Sprintf("\n... [Content truncated, total length: %d]", len(src.Content)))
+// GenerateContent implements llms.Model
+func (m *retryingModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	// A streamed attempt that already sent output is not retried, the client would see
+	// the answer twice
+	var callOptions llms.CallOptions
+	for _, opt := range options {
+		opt(&callOptions)
+	}
+	streamed := false
+	if stream := callOptions.StreamingFunc; stream != nil {
+		options = append(options, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			streamed = true
+			return stream(ctx, chunk)
+		}))
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= m.attempts; attempt++ {
+		if attempt > 1 {
+			golog.Infof("retrying text generation (attempt %d/%d)...", attempt, m.attempts)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Duration(attempt-1) * 2 * time.Second):
 			}
-		} else {
-			sourceContext.WriteString(fmt.Sprintf("[Source content: %s, type: %s]", src.Name, src.Type))
 		}
-		sourceContext.WriteString("\n")
+
+		attemptCtx, cancel := context.WithTimeout(ctx, m.timeout)
+		resp, err := m.Model.GenerateContent(attemptCtx, messages, options...)
+		cancel()
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			// The caller gave up, don't retry
+			return nil, ctx.Err()
+		}
+		if streamed {
+			return nil, err
+		}
+		golog.Errorf("text generation failed (attempt %d/%d): %v", attempt, m.attempts, err)
+		lastErr = err
 	}
+	if m.attempts == 1 {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("text generation failed after %d attempts: %w", m.attempts, lastErr)
+}
+
+// Call implements llms.Model
+func (m *retryingModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// GenerateTransformation generates a note based on transformation type
+func (a *Agent) GenerateTransformation(ctx context.Context, req *TransformationRequest, sources []Source) (*TransformationResponse, error) {
+	sources, contextTruncated := a.fitSourcesToContext(sources)
 
 	// Build prompt using f-string format (no Go template reserved names issue)
 	promptTemplate := getTransformationPrompt(req.Type)
 
 	prompt := prompts.NewPromptTemplate(
 		promptTemplate,
-		[]string{"sources", "type", "length", "format", "prompt"},
+		[]string{"sources", "type", "length", "format", "prompt", "speakers", "duration", "style", "language"},
 	)
 	prompt.TemplateFormat = prompts.TemplateFormatFString
 
-	promptValue, err := prompt.Format(map[string]any{
-		"sources": sourceContext.String(),
-		"type":    req.Type,
-		"length":  req.Length,
-		"format":  req.Format,
-		"prompt":  req.Prompt,
-	})
+	podcast := PodcastSettings{Speakers: defaultPodcastSpeakers, TargetLength: defaultPodcastTargetLength, Style: defaultPodcastStyle}
+	if req.Podcast != nil {
+		podcast = req.Podcast.withDefaults(podcast)
+	}
+	values := map[string]any{
+		"sources":  a.buildSourceContext(sources),
+		"type":     req.Type,
+		"length":   req.Length,
+		"format":   req.Format,
+		"prompt":   req.Prompt,
+		"speakers": podcast.Speakers,
+		"duration": podcast.TargetLength,
+		"style":    podcast.Style,
+		"language": translate(req.OutputLanguage, "language.name"),
+	}
+	promptValue, err := prompt.Format(values)
 	if err != nil {
 		return nil, fmt.Errorf("failed to format prompt: %w", err)
 	}
 
+	// When the sources do not fit into the model's context window, condense them in
+	// batches first instead of sending a prompt the model would reject
+	promptModel := a.requestModel(req.Model)
+	if req.Type == "ppt" && a.pptLLM != nil {
+		promptModel = pptTextModel
+	}
+	mapReduceCalls := 0
+	if budget := promptBudget(a.cfg, promptModel, promptValue); estimateTokens(promptValue) > budget {
+		golog.Infof("%s prompt for %d sources is ~%d tokens, over the %d token budget of %s; using map-reduce",
+			req.Type, len(sources), estimateTokens(promptValue), budget, promptModel)
+		condensed, calls, err := a.mapReduceSources(ctx, req.Type, sources, budget)
+		if err != nil {
+			return nil, fmt.Errorf("failed to condense sources: %w", err)
+		}
+		mapReduceCalls = calls
+		values["sources"] = a.buildSourceContext(condensed)
+		if promptValue, err = prompt.Format(values); err != nil {
+			return nil, fmt.Errorf("failed to format prompt: %w", err)
+		}
+	}
+
 	// Generate response
 	var response string
+	var finishReason string
+	var structured map[string]interface{}
 	var genErr error
+	model := a.requestModel(req.Model)
+	modelOptions := a.modelOptions(req.Model)
 
 	if req.Type == "ppt" {
-		response, genErr = a.provider.GenerateTextWithModel(ctx, promptValue, "gemini-3-flash-preview")
+		// Slide decks are written by Gemini whenever a Google API key is available
+		llm := a.llm
+		options := modelOptions
+		if a.pptLLM != nil {
+			llm = a.pptLLM
+			model = pptTextModel
+			options = append(options, llms.WithModel(model))
+		}
+		response, finishReason, genErr = a.generateWithFinishReason(ctx, llm, promptValue, options...)
 	} else if req.Type == "insight" {
 		// For insight type: first generate a summary, then call DeepInsight
 		ctx, cancel := context.WithTimeout(ctx, 300*time.Second)
 		defer cancel()
 
 		// Step 1: Generate summary
-		summary, err := a.provider.GenerateFromSinglePrompt(ctx, a.llm, promptValue)
+		summary, err := llms.GenerateFromSinglePrompt(ctx, a.llm, promptValue, modelOptions...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate summary: %w", err)
 		}
@@ -146,10 +294,12 @@ func (a *Agent) GenerateTransformation(ctx context.Context, req *TransformationR
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate deep insight: %w", err)
 		}
+	} else if req.ResponseFormat == ResponseFormatJSON {
+		response, structured, finishReason, genErr = a.generateStructured(ctx, req.Type, promptValue, modelOptions...)
 	} else {
 		ctx, cancel := context.WithTimeout(ctx, 300*time.Second)
 		defer cancel()
-		response, genErr = a.provider.GenerateFromSinglePrompt(ctx, a.llm, promptValue)
+		response, finishReason, genErr = a.generateWithFinishReason(ctx, a.llm, promptValue, modelOptions...)
 	}
 
 	if genErr != nil {
@@ -166,24 +316,274 @@ func (a *Agent) GenerateTransformation(ctx context.Context, req *TransformationR
 		}
 	}
 
+	metadata := map[string]interface{}{
+		"length":            req.Length,
+		"format":            req.Format,
+		"model":             model,
+		"prompt_tokens":     estimateTokens(promptValue),
+		"completion_tokens": estimateTokens(response),
+	}
+	if finishReason != "" {
+		metadata["finish_reason"] = finishReason
+		metadata["truncated"] = isTruncatedFinish(finishReason)
+	}
+	if contextTruncated {
+		metadata["context_truncated"] = true
+	}
+	if mapReduceCalls > 0 {
+		metadata["map_reduce"] = true
+		metadata["map_reduce_summaries"] = mapReduceCalls
+	}
+	if structured != nil {
+		metadata["response_format"] = ResponseFormatJSON
+		metadata["structured"] = structured
+	}
+
 	return &TransformationResponse{
 		Type:      req.Type,
 		Content:   response,
 		Sources:   sourceSummaries,
 		CreatedAt: time.Now(),
-		Metadata: map[string]interface{}{
-			"length": req.Length,
-			"format": req.Format,
-		},
+		Metadata:  metadata,
 	}, nil
 }
 
+// ContinueNote asks the model to continue a note that was cut off at the output limit.
+// It returns the continuation and the finish reason reported by the model.
+func (a *Agent) ContinueNote(ctx context.Context, note *Note, sources []Source) (string, string, error) {
+	prompt := prompts.NewPromptTemplate(continuationPrompt(), []string{"type", "sources", "content"})
+	prompt.TemplateFormat = prompts.TemplateFormatFString
+
+	promptValue, err := prompt.Format(map[string]any{
+		"type":    note.Type,
+		"sources": a.buildSourceContext(sources),
+		"content": note.Content,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to format prompt: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 300*time.Second)
+	defer cancel()
+
+	return a.generateWithFinishReason(ctx, a.llm, promptValue)
+}
+
+// GenerateSourceSummary writes a concise summary across a notebook's sources. It is stored
+// as a source so retrieval can draw on the notebook as a whole.
+func (a *Agent) GenerateSourceSummary(ctx context.Context, sources []Source) (string, error) {
+	prompt := prompts.NewPromptTemplate(autoSummaryPrompt(), []string{"sources"})
+	prompt.TemplateFormat = prompts.TemplateFormatFString
+
+	promptValue, err := prompt.Format(map[string]any{
+		"sources": a.buildSourceContext(sources),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to format prompt: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 300*time.Second)
+	defer cancel()
+
+	return llms.GenerateFromSinglePrompt(ctx, a.llm, promptValue)
+}
+
+// generateWithFinishReason generates text and also returns why the model stopped, e.g.
+// "stop" or "length". Providers that do not report it return "".
+func (a *Agent) generateWithFinishReason(ctx context.Context, llm llms.Model, prompt string, options ...llms.CallOption) (string, string, error) {
+	resp, err := llm.GenerateContent(ctx, []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, prompt),
+	}, options...)
+	if err != nil {
+		return "", "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", "", fmt.Errorf("empty response from model")
+	}
+	choice := resp.Choices[0]
+	return choice.Content, choice.StopReason, nil
+}
+
+// isTruncatedFinish reports whether a finish reason means the output token limit was hit
+func isTruncatedFinish(reason string) bool {
+	switch strings.ToLower(reason) {
+	case "length", "max_tokens":
+		return true
+	}
+	return false
+}
+
+// Ping sends the text model a minimal prompt to check that it is reachable
+func (a *Agent) Ping(ctx context.Context) error {
+	_, err := llms.GenerateFromSinglePrompt(ctx, a.llm, "ping", llms.WithMaxTokens(1))
+	return err
+}
+
+// buildSourceContext renders sources for a transformation prompt, truncating long content
+func (a *Agent) buildSourceContext(sources []Source) string {
+	var sourceContext strings.Builder
+	for i, src := range sources {
+		sourceContext.WriteString(fmt.Sprintf("\n## Source %d: %s\n", i+1, src.Name))
+
+		// Use MaxContextLength from config, or default to a safe large value if not set (or too small)
+		limit := a.cfg.MaxContextLength
+		if limit <= 0 {
+			limit = 100000 // Default to 100k chars if config is invalid
+		}
+
+		if src.Content != "" {
+			if len(src.Content) <= limit {
+				sourceContext.WriteString(src.Content)
+			} else {
+				// Truncate content instead of replacing it entirely
+				sourceContext.WriteString(src.Content[:limit])
+				sourceContext.WriteString(fmt.Sprintf("\n... [Content truncated, total length: %d]", len(src.Content)))
+			}
+		} else {
+			sourceContext.WriteString(fmt.Sprintf("[Source content: %s, type: %s]", src.Name, src.Type))
+		}
+		sourceContext.WriteString("\n")
+	}
+	return sourceContext.String()
+}
+
+// requestModel returns the text model a request asked for, or the configured one
+func (a *Agent) requestModel(model string) string {
+	if model != "" {
+		return model
+	}
+	return a.textModelName()
+}
+
+// modelOptions returns the call options that select a request's text model instead of
+// the configured one
+func (a *Agent) modelOptions(model string) []llms.CallOption {
+	if model == "" {
+		return nil
+	}
+	return []llms.CallOption{llms.WithModel(model)}
+}
+
+// textModelName returns the name of the configured text generation model
+func (a *Agent) textModelName() string {
+	if a.cfg.TextProvider == TextProviderGemini {
+		return a.cfg.GeminiTextModel
+	}
+	if a.cfg.IsOllama() {
+		return a.cfg.OllamaModel
+	}
+	return a.cfg.OpenAIModel
+}
+
+// citationPattern matches inline citations such as [来源 2] or [Source 2]
+var citationPattern = regexp.MustCompile(`\[(?:来源|Source)\s*(\d+)\]`)
+
+// ChatOptions holds notebook-level settings that change how a chat turn is answered
+type ChatOptions struct {
+	// StrictGrounding only allows answers backed by retrieved chunks and requires citations
+	StrictGrounding bool
+	// Locale selects the language of fixed replies such as the "not found in sources" message
+	Locale string
+	// PinnedSources are always-include sources put in front of the retrieved chunks
+	PinnedSources []Source
+	// SystemPrompt holds the notebook's custom instructions, put in front of the built-in prompt
+	SystemPrompt string
+	// HistorySummary summarizes the session's turns older than the history window
+	HistorySummary string
+	// Model is the text model the request asked for, empty for the configured one
+	Model string
+}
+
+// Ways of combining keyword matches with semantic results when the fallback runs
+const (
+	ChatKeywordMerge   = "merge"   // merge both result lists and rerank
+	ChatKeywordReplace = "replace" // use the keyword matches instead of the semantic results
+)
+
+// retrieve finds up to numDocs chunks of a notebook relevant to the query. Keyword matches
+// are merged in, or replace the semantic results, when semantic retrieval found nothing
+// close to the query; the second result reports whether that happened.
+func (a *Agent) retrieve(ctx context.Context, notebookID, query string, numDocs int) ([]schema.Document, bool, error) {
+	docs, err := a.vectorStore.SimilaritySearch(ctx, notebookID, query, numDocs)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to search documents: %w", err)
+	}
+
+	if !a.cfg.ChatKeywordFallback || (len(docs) > 0 && float64(docs[0].Score) >= a.cfg.ChatMinSimilarity) {
+		return docs, false, nil
+	}
+	keywordDocs, err := a.vectorStore.KeywordSearch(ctx, notebookID, query, numDocs)
+	if err != nil {
+		golog.Warnf("keyword search failed for notebook %s: %v", notebookID, err)
+		return docs, false, nil
+	}
+	if len(keywordDocs) == 0 {
+		return docs, false, nil
+	}
+	if a.cfg.ChatKeywordMode == ChatKeywordReplace {
+		return keywordDocs, true, nil
+	}
+	return mergeRetrievedDocs(docs, keywordDocs, numDocs), true, nil
+}
+
+// sourceSummariesFromDocs lists the distinct sources of retrieved chunks
+func sourceSummariesFromDocs(docs []schema.Document) []SourceSummary {
+	sourceSummaries := make([]SourceSummary, 0, len(docs))
+	sourceMap := make(map[string]bool)
+	for _, doc := range docs {
+		if source, ok := doc.Metadata["source"].(string); ok {
+			// Prefer the source ID when the chunk carries one, so answers can be linked back
+			id := source
+			if sourceID, ok := doc.Metadata["source_id"].(string); ok && sourceID != "" {
+				id = sourceID
+			}
+			if !sourceMap[id] {
+				sourceSummaries = append(sourceSummaries, SourceSummary{
+					ID:   id,
+					Name: source,
+					Type: "file",
+				})
+				sourceMap[id] = true
+			}
+		}
+	}
+	return sourceSummaries
+}
+
 // Chat performs a chat query with RAG
-func (a *Agent) Chat(ctx context.Context, notebookID, message string, history []ChatMessage) (*ChatResponse, error) {
+func (a *Agent) Chat(ctx context.Context, notebookID, message string, history []ChatMessage, opts ChatOptions) (*ChatResponse, error) {
+	return a.ChatStream(ctx, notebookID, message, history, opts, nil)
+}
+
+// ChatStream is Chat that passes the answer to onDelta as it is generated. Answers that
+// may be rewritten after generation, with chat tools or strict grounding, are not
+// streamed; onDelta is not called for them and the full answer is in the response.
+func (a *Agent) ChatStream(ctx context.Context, notebookID, message string, history []ChatMessage, opts ChatOptions, onDelta func(string) error) (*ChatResponse, error) {
 	// Perform similarity search to find relevant sources
-	docs, err := a.vectorStore.SimilaritySearch(ctx, notebookID, message, a.cfg.MaxSources)
+	docs, keywordFallback, err := a.retrieve(ctx, notebookID, message, a.cfg.MaxSources)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search documents: %w", err)
+		return nil, err
+	}
+
+	if len(opts.PinnedSources) > 0 {
+		docs = prependPinnedDocs(notebookID, opts.PinnedSources, docs)
+	}
+	docs, contextTruncated := a.fitDocsToContext(docs)
+
+	notFoundMessage := translate(opts.Locale, "chat.not_found_in_sources")
+
+	// In strict grounding mode there is nothing to answer from without retrieved chunks
+	if opts.StrictGrounding && len(docs) == 0 {
+		return &ChatResponse{
+			Message:   notFoundMessage,
+			Sources:   []SourceSummary{},
+			SessionID: notebookID,
+			Metadata: map[string]interface{}{
+				"docs_retrieved":   0,
+				"strict_grounding": true,
+				"grounded":         false,
+			},
+		}, nil
 	}
 
 	// Build context from retrieved documents
@@ -198,23 +598,23 @@ func (a *Agent) Chat(ctx context.Context, notebookID, message string, history []
 		}
 	}
 
-	// Build chat history
+	// Build chat history from the latest turns, after the summary of the earlier ones
 	var historyBuilder strings.Builder
-	for i, msg := range history {
-		if i >= 10 { // Limit history
-			break
-		}
-		role := "用户"
-		if msg.Role == "assistant" {
-			role = "助手"
-		}
-		historyBuilder.WriteString(fmt.Sprintf("%s: %s\n", role, msg.Content))
+	if opts.HistorySummary != "" {
+		historyBuilder.WriteString(fmt.Sprintf("较早对话的摘要：%s\n\n", opts.HistorySummary))
+	}
+	for _, msg := range recentChatHistory(history, a.cfg.ChatHistoryTurns) {
+		historyBuilder.WriteString(fmt.Sprintf("%s: %s\n", chatHistoryRole(msg.Role), msg.Content))
 	}
 
 	// Create RAG prompt using f-string format
+	systemPrompt := chatSystemPrompt()
+	if opts.StrictGrounding {
+		systemPrompt = chatStrictGroundingPrompt(notFoundMessage)
+	}
 	promptTemplate := prompts.NewPromptTemplate(
-		chatSystemPrompt(),
-		[]string{"history", "context", "question"},
+		systemPrompt,
+		[]string{"history", "context", "question", "language"},
 	)
 	promptTemplate.TemplateFormat = prompts.TemplateFormatFString
 
@@ -222,46 +622,163 @@ func (a *Agent) Chat(ctx context.Context, notebookID, message string, history []
 		"history":  historyBuilder.String(),
 		"context":  contextBuilder.String(),
 		"question": message,
+		"language": translate(opts.Locale, "language.name"),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to format prompt: %w", err)
 	}
+	if opts.SystemPrompt != "" {
+		promptValue = chatNotebookInstructions(opts.SystemPrompt) + promptValue
+	}
 
 	// Generate response
 	ctx, cancel := context.WithTimeout(ctx, 300*time.Second)
 	defer cancel()
 
-	response, err := a.provider.GenerateFromSinglePrompt(ctx, a.llm, promptValue)
+	var response string
+	var toolCalls []ToolCall
+	modelOptions := a.modelOptions(opts.Model)
+	if a.cfg.EnableChatTools {
+		response, toolCalls, err = a.generateWithTools(ctx, promptValue, modelOptions...)
+	} else if onDelta != nil && !opts.StrictGrounding {
+		response, err = llms.GenerateFromSinglePrompt(ctx, a.llm, promptValue,
+			append(modelOptions, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+				return onDelta(string(chunk))
+			}))...)
+	} else {
+		response, err = llms.GenerateFromSinglePrompt(ctx, a.llm, promptValue, modelOptions...)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate response: %w", err)
 	}
 
 	// Build source summaries
-	sourceSummaries := make([]SourceSummary, 0, len(docs))
-	sourceMap := make(map[string]bool)
-	for _, doc := range docs {
-		if source, ok := doc.Metadata["source"].(string); ok {
-			if !sourceMap[source] {
-				sourceSummaries = append(sourceSummaries, SourceSummary{
-					ID:   source,
-					Name: source,
-					Type: "file",
-				})
-				sourceMap[source] = true
-			}
+	sourceSummaries := sourceSummariesFromDocs(docs)
+
+	metadata := map[string]interface{}{
+		"docs_retrieved": len(docs),
+	}
+	if keywordFallback {
+		metadata["keyword_fallback"] = true
+	}
+	if contextTruncated {
+		metadata["context_truncated"] = true
+	}
+	if len(toolCalls) > 0 {
+		metadata["tool_calls"] = toolCalls
+	}
+
+	// Post-validate that a strictly grounded answer actually cites a retrieved source
+	if opts.StrictGrounding {
+		grounded := citesRetrievedSource(response, len(docs))
+		metadata["strict_grounding"] = true
+		metadata["grounded"] = grounded
+		if !grounded {
+			golog.Infof("strict grounding: answer for notebook %s cited no retrieved source, replacing", notebookID)
+			response = notFoundMessage
+			sourceSummaries = []SourceSummary{}
 		}
 	}
+	if len(sourceSummaries) > 0 {
+		metadata["citations"] = chatCitations(response, docs)
+	}
 
 	return &ChatResponse{
 		Message:   response,
 		Sources:   sourceSummaries,
 		SessionID: notebookID,
-		Metadata: map[string]interface{}{
-			"docs_retrieved": len(docs),
-		},
+		Metadata:  metadata,
 	}, nil
 }
 
+// generateWithTools runs the tool-use loop: the model may answer with tool calls, which are
+// executed and fed back until it produces a final answer or runs out of rounds
+func (a *Agent) generateWithTools(ctx context.Context, prompt string, options ...llms.CallOption) (string, []ToolCall, error) {
+	prompt += chatToolInstructions()
+	var toolCalls []ToolCall
+
+	for round := 0; round < maxToolRounds; round++ {
+		response, err := llms.GenerateFromSinglePrompt(ctx, a.llm, prompt, options...)
+		if err != nil {
+			return "", toolCalls, err
+		}
+
+		calls := parseToolCalls(response)
+		if len(calls) == 0 {
+			return response, toolCalls, nil
+		}
+
+		var results strings.Builder
+		for _, call := range calls {
+			call = executeToolCall(call)
+			toolCalls = append(toolCalls, call)
+			if call.Error != "" {
+				results.WriteString(fmt.Sprintf("%s(%s) 出错：%s\n", call.Tool, call.Input, call.Error))
+			} else {
+				results.WriteString(fmt.Sprintf("%s(%s) = %s\n", call.Tool, call.Input, call.Output))
+			}
+		}
+		golog.Infof("chat tool round %d executed %d tool calls", round+1, len(calls))
+
+		prompt += "\n\n" + response + chatToolResultsPrompt(results.String())
+	}
+
+	response, err := llms.GenerateFromSinglePrompt(ctx, a.llm, prompt+chatToolFinalPrompt(), options...)
+	if err != nil {
+		return "", toolCalls, err
+	}
+	// Drop any tool calls the model still emitted
+	response = strings.TrimSpace(toolCallPattern.ReplaceAllString(response, ""))
+	return response, toolCalls, nil
+}
+
+// citesRetrievedSource reports whether the answer contains at least one citation
+// pointing at one of the numDocs retrieved chunks
+func citesRetrievedSource(answer string, numDocs int) bool {
+	for _, match := range citationPattern.FindAllStringSubmatch(answer, -1) {
+		var n int
+		if _, err := fmt.Sscanf(match[1], "%d", &n); err == nil && n >= 1 && n <= numDocs {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeRetrievedDocs merges semantic and keyword search results. A chunk found by both
+// searches scores the sum of its two scores, so agreeing results rank first.
+func mergeRetrievedDocs(semantic, keyword []schema.Document, limit int) []schema.Document {
+	merged := make([]schema.Document, 0, len(semantic)+len(keyword))
+	index := make(map[string]int)
+	for _, list := range [][]schema.Document{semantic, keyword} {
+		for _, doc := range list {
+			key := chunkKey(doc)
+			if i, ok := index[key]; ok {
+				merged[i].Score += doc.Score
+				continue
+			}
+			index[key] = len(merged)
+			merged = append(merged, doc)
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
+	})
+	if limit > 0 && len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged
+}
+
+// chunkKey identifies a chunk by its source and position, falling back to its content
+func chunkKey(doc schema.Document) string {
+	sourceID, _ := doc.Metadata["source_id"].(string)
+	if chunk, ok := doc.Metadata["chunk"]; ok && sourceID != "" {
+		return fmt.Sprintf("%s#%v", sourceID, chunk)
+	}
+	return doc.PageContent
+}
+
 // Slide represents a parsed PPT slide
 type Slide struct {
 	Style   string
@@ -335,11 +852,12 @@ func (a *Agent) ParsePPTSlides(content string) []Slide {
 }
 
 // GeneratePodcastScript generates a podcast script from sources
-func (a *Agent) GeneratePodcastScript(ctx context.Context, sources []Source, voice string) (string, error) {
+func (a *Agent) GeneratePodcastScript(ctx context.Context, sources []Source, settings *PodcastSettings) (string, error) {
 	req := &TransformationRequest{
-		Type:   "podcast",
-		Length: "medium",
-		Format: "markdown",
+		Type:    "podcast",
+		Length:  "medium",
+		Format:  "markdown",
+		Podcast: settings,
 	}
 
 	resp, err := a.GenerateTransformation(ctx, req, sources)
@@ -350,6 +868,11 @@ func (a *Agent) GeneratePodcastScript(ctx context.Context, sources []Source, voi
 	return resp.Content, nil
 }
 
+// GeneratePodcastAudio reads a podcast script aloud and returns the path of the audio file
+func (a *Agent) GeneratePodcastAudio(ctx context.Context, script, voice, userID string) (string, error) {
+	return a.speech.GenerateSpeech(ctx, speechText(script), voice, userID)
+}
+
 // GenerateOutline generates an outline from sources
 func (a *Agent) GenerateOutline(ctx context.Context, sources []Source) (string, error) {
 	req := &TransformationRequest{
@@ -421,7 +944,7 @@ func (a *Agent) callDeepInsight(ctx context.Context, summary string) (string, er
 
 	// Execute DeepInsight command
 	// DeepInsight -o report.md "summary text"
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
 	defer cancel()
 	output, err := execCommandContext(ctx, "./DeepInsight", "-o", tmpFile, escapeShellArg(summary))
 	if err != nil {
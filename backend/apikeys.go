@@ -0,0 +1,243 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+// Headers of a request signed with a service key
+const (
+	HeaderAPIKeyID        = "X-Notex-Key-Id"
+	HeaderAPITimestamp    = "X-Notex-Timestamp" // unix seconds
+	HeaderAPIKeySignature = "X-Notex-Signature" // hex HMAC-SHA256
+)
+
+// maxSignedBodyBytes caps the body of a signed request when uploads are not limited. The
+// body is held in memory to check the signature.
+const maxSignedBodyBytes = 100 << 20
+
+// Authentication methods recorded in the request context under "auth_method"
+const (
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "api_key"
+)
+
+// newAPIKeySecret returns a random signing secret
+func newAPIKeySecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// apiKeyStringToSign builds the message a client signs: the method, the request path
+// with its query string, the timestamp and the hex SHA-256 of the body, joined by "\n"
+func apiKeyStringToSign(method, path, timestamp string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return strings.Join([]string{strings.ToUpper(method), path, timestamp, hex.EncodeToString(bodyHash[:])}, "\n")
+}
+
+// signAPIRequest returns the hex HMAC-SHA256 signature of a request
+func signAPIRequest(secret, method, path, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(apiKeyStringToSign(method, path, timestamp, body)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// authMiddleware authenticates requests with a JWT session, or with a service key
+// signature when the key ID header is present
+func (s *Server) authMiddleware() gin.HandlerFunc {
+	jwtAuth := AuthMiddleware(s.cfg.JWTKeys(), s.store.Store)
+	return func(c *gin.Context) {
+		if c.GetHeader(HeaderAPIKeyID) == "" {
+			c.Set("auth_method", AuthMethodJWT)
+			jwtAuth(c)
+			return
+		}
+		s.verifySignedRequest(c)
+	}
+}
+
+// verifySignedRequest checks a service key signature. Requests are rejected when their
+// timestamp is outside API_KEY_SIGNATURE_WINDOW, which limits how long a captured
+// request can be replayed.
+func (s *Server) verifySignedRequest(c *gin.Context) {
+	keyID := c.GetHeader(HeaderAPIKeyID)
+	timestamp := c.GetHeader(HeaderAPITimestamp)
+	signature := c.GetHeader(HeaderAPIKeySignature)
+	if timestamp == "" || signature == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: fmt.Sprintf("%s and %s headers required", HeaderAPITimestamp, HeaderAPIKeySignature)})
+		return
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid timestamp"})
+		return
+	}
+	skew := time.Since(time.Unix(ts, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > time.Duration(s.cfg.APIKeySignatureWindow)*time.Second {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: "Request timestamp outside the allowed window", Code: "timestamp_expired"})
+		return
+	}
+
+	key, err := s.store.GetAPIKey(c.Request.Context(), keyID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid API key"})
+		return
+	}
+
+	// The body is read into memory before the signature is known to be valid, so it is
+	// capped at the largest upload a signed request may carry
+	limit := int64(maxSignedBodyBytes)
+	if s.cfg.MaxUploadBytes > 0 {
+		limit = s.cfg.MaxUploadBytes + multipartOverhead
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: "Request body is too large", Code: "body_too_large"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read request body"})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	expected := signAPIRequest(key.Secret, c.Request.Method, c.Request.URL.RequestURI(), timestamp, body)
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected)) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid signature"})
+		return
+	}
+
+	if err := s.store.TouchAPIKey(context.Background(), key.ID); err != nil {
+		golog.Errorf("failed to update api key %s: %v", key.ID, err)
+	}
+
+	c.Set("user_id", key.UserID)
+	c.Set("auth_method", AuthMethodAPIKey)
+	c.Set("api_key_id", key.ID)
+	c.Next()
+}
+
+// requireSession rejects requests authenticated with a service key, so a leaked key
+// cannot be used to mint or revoke other keys
+func requireSession(c *gin.Context) bool {
+	if c.GetString("auth_method") == AuthMethodAPIKey {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "API keys can only be managed from a signed-in session"})
+		return false
+	}
+	return true
+}
+
+// handleListAPIKeys lists the current user's service keys
+func (s *Server) handleListAPIKeys(c *gin.Context) {
+	ctx := context.Background()
+	userID := c.GetString("user_id")
+
+	keys, err := s.store.ListAPIKeys(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list API keys"})
+		return
+	}
+	respondList(c, keys)
+}
+
+// handleCreateAPIKey registers a service key. The secret is only returned in this response.
+func (s *Server) handleCreateAPIKey(c *gin.Context) {
+	ctx := context.Background()
+	userID := c.GetString("user_id")
+
+	if !requireSession(c) {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	secret, err := newAPIKeySecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate API key"})
+		return
+	}
+	key := &APIKey{
+		UserID: userID,
+		Name:   strings.TrimSpace(req.Name),
+		Secret: secret,
+	}
+	if err := s.store.CreateAPIKey(ctx, key); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create API key"})
+		return
+	}
+
+	// Log API key creation activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "create_api_key",
+		ResourceType: "api_key",
+		ResourceID:   key.ID,
+		ResourceName: key.Name,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log api key activity: %v", err)
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// handleDeleteAPIKey revokes one of the current user's service keys
+func (s *Server) handleDeleteAPIKey(c *gin.Context) {
+	ctx := context.Background()
+	userID := c.GetString("user_id")
+	keyID := c.Param("keyId")
+
+	if !requireSession(c) {
+		return
+	}
+
+	if err := s.store.DeleteAPIKey(ctx, userID, keyID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "API key not found"})
+		return
+	}
+
+	// Log API key revocation activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "delete_api_key",
+		ResourceType: "api_key",
+		ResourceID:   keyID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log api key activity: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -3,6 +3,7 @@ package backend
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/kataras/golog"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/github"
@@ -57,25 +59,33 @@ func NewAuthHandler(cfg Config, store *Store) *AuthHandler {
 func (h *AuthHandler) HandleLogin(c *gin.Context) {
 	provider := c.Param("provider")
 
-	var url string
+	var oauthConfig *oauth2.Config
 	switch provider {
 	case "github":
 		if h.githubConfig == nil {
 			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "GitHub auth not configured"})
 			return
 		}
-		url = h.githubConfig.AuthCodeURL("state", oauth2.AccessTypeOnline)
+		oauthConfig = h.githubConfig
 	case "google":
 		if h.googleConfig == nil {
 			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Google auth not configured"})
 			return
 		}
-		url = h.googleConfig.AuthCodeURL("state", oauth2.AccessTypeOnline)
+		oauthConfig = h.googleConfig
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid provider"})
 		return
 	}
 
+	state, err := h.setOAuthState(c, provider, oauthConfig.RedirectURL)
+	if err != nil {
+		golog.Errorf("failed to create oauth state: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	url := oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOnline)
+
 	// Redirect to the OAuth provider's authorization page
 	c.Redirect(http.StatusTemporaryRedirect, url)
 }
@@ -89,6 +99,13 @@ func (h *AuthHandler) HandleCallback(c *gin.Context) {
 		return
 	}
 
+	// Reject callbacks that were not started from this browser (login CSRF)
+	if err := h.verifyOAuthState(c, provider); err != nil {
+		golog.Warnf("rejected %s oauth callback from %s: %v", provider, c.ClientIP(), err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OAuth state", "details": err.Error()})
+		return
+	}
+
 	var email, name, avatarURL string
 	
 	switch provider {
@@ -178,11 +195,11 @@ func (h *AuthHandler) HandleCallback(c *gin.Context) {
 		return
 	}
 	
-	// Create or Update User
+	// Providers may return empty or unsafe profile data, which ends up in the page below
 	user := &User{
 		Email:     email,
-		Name:      name,
-		AvatarURL: avatarURL,
+		Name:      sanitizeDisplayName(name, email),
+		AvatarURL: sanitizeAvatarURL(avatarURL, h.config.DefaultAvatarURL),
 		Provider:  provider,
 	}
 	
@@ -197,9 +214,14 @@ func (h *AuthHandler) HandleCallback(c *gin.Context) {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
         return
     }
+
+    // Users listed in ADMIN_EMAILS are flagged as administrators when they log in
+    if err := h.store.RecordLogin(context.Background(), dbUser.ID, isAdminEmail(h.config, dbUser.Email)); err != nil {
+        golog.Errorf("failed to record login: %v", err)
+    }
 	
     // Generate JWT
-    tokenString, err := GenerateJWT(dbUser.ID, h.config.JWTSecret)
+    tokenString, err := GenerateJWT(dbUser.ID, h.config.JWTKeys(), h.config.JWTExpiry())
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
         return
@@ -237,13 +259,14 @@ func (h *AuthHandler) HandleCallback(c *gin.Context) {
         origin = fmt.Sprintf("%s://%s", scheme, c.Request.Host)
     }
 
+    // Every value is JSON-encoded, which escapes <, > and & so nothing can close the script
     c.Header("Content-Type", "text/html")
     c.String(http.StatusOK, fmt.Sprintf(`
         <script>
-            window.opener.postMessage({token: "%s", user: %s}, "%s");
+            window.opener.postMessage({token: %s, user: %s}, %s);
             window.close();
         </script>
-    `, tokenString, toJson(dbUser), origin))
+    `, toJson(tokenString), toJson(dbUser), toJson(origin)))
 }
 
 func (h *AuthHandler) HandleMe(c *gin.Context) {
@@ -258,22 +281,187 @@ func (h *AuthHandler) HandleMe(c *gin.Context) {
         c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
         return
     }
+
+    if quota, err := dailyQuotaStatus(c, h.config, h.store, user); err != nil {
+        golog.Errorf("failed to get quota for user %s: %v", userID, err)
+    } else {
+        user.Quota = quota
+    }
     
     c.JSON(http.StatusOK, user)
 }
 
+// HandleUpdateMe updates the current user's settings (currently the preferred locale)
+func (h *AuthHandler) HandleUpdateMe(c *gin.Context) {
+    userID := c.GetString("user_id")
+    if userID == "" {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    var req struct {
+        Locale string `json:"locale" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    locale := normalizeLocale(req.Locale)
+    if locale == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported locale"})
+        return
+    }
+
+    user, err := h.store.UpdateUserLocale(c, userID, locale)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+        return
+    }
+
+    c.JSON(http.StatusOK, user)
+}
+
+// HandleRefresh exchanges a session token for a new one with a fresh expiry. Tokens that
+// expired less than JWT_REFRESH_GRACE seconds ago are still accepted, so a client that
+// was idle around the expiry does not need a new OAuth login. The presented token is
+// revoked, so each token can be exchanged only once.
+func (h *AuthHandler) HandleRefresh(c *gin.Context) {
+	tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if tokenString == "" {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Authorization header required"})
+		return
+	}
+
+	keys := h.config.JWTKeys()
+	grace := time.Duration(h.config.JWTRefreshGrace) * time.Second
+	token, err := keys.Parse(tokenString, jwt.WithLeeway(grace), jwt.WithExpirationRequired())
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Token expired, please log in again", Code: "token_expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid token"})
+		return
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	userID, ok := claims["user_id"].(string)
+	if !ok || userID == "" {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid token claims"})
+		return
+	}
+	jti, _ := claims["jti"].(string)
+	if jti != "" {
+		revoked, err := h.store.IsTokenRevoked(c, jti)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to verify token"})
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Token has been revoked", Code: "token_revoked"})
+			return
+		}
+	}
+
+	// Erased users must not keep a session alive by refreshing
+	if _, err := h.store.GetUser(c, userID); err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not found"})
+		return
+	}
+
+	expiresAt := time.Now().Add(h.config.JWTExpiry())
+	newToken, err := GenerateJWT(userID, keys, h.config.JWTExpiry())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate token"})
+		return
+	}
+
+	// The presented token is replaced, so it must not be refreshed or used again
+	if jti != "" {
+		oldExpiresAt := time.Now().Add(h.config.JWTExpiry())
+		if exp, err := token.Claims.GetExpirationTime(); err == nil && exp != nil {
+			oldExpiresAt = exp.Time
+		}
+		if err := h.store.RevokeToken(c, jti, oldExpiresAt.Add(grace)); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke token"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": newToken, "expires_at": expiresAt.Unix()})
+}
+
+// HandleLogout revokes the session token of the request, so it is rejected from now on
+// even though it has not expired. Tokens issued without an ID cannot be revoked and
+// stay valid until they expire.
+func (h *AuthHandler) HandleLogout(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if c.GetString("auth_method") != AuthMethodJWT {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Only session tokens can be logged out"})
+		return
+	}
+
+	if jti := c.GetString("token_id"); jti != "" {
+		// Keep the entry through the refresh grace window, where the token is still usable
+		expiresAt := time.Now().Add(h.config.JWTExpiry())
+		if exp, ok := c.Get("token_expires_at"); ok {
+			expiresAt = exp.(time.Time)
+		}
+		expiresAt = expiresAt.Add(time.Duration(h.config.JWTRefreshGrace) * time.Second)
+
+		if err := h.store.RevokeToken(c, jti, expiresAt); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke token"})
+			return
+		}
+	}
+
+	activityLog := &ActivityLog{
+		UserID:    userID,
+		Action:    "logout",
+		IPAddress: c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+	}
+	if err := h.store.LogActivity(c, activityLog); err != nil {
+		golog.Errorf("failed to log logout activity: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// revokedTokensPruneInterval is how often expired token revocations are removed
+const revokedTokensPruneInterval = time.Hour
+
+// pruneRevokedTokensLoop removes revocations of expired tokens, which are rejected
+// anyway, so the revocation list only holds tokens that could still be used
+func (h *AuthHandler) pruneRevokedTokensLoop() {
+	ticker := time.NewTicker(revokedTokensPruneInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n, err := h.store.PruneRevokedTokens(context.Background(), time.Now())
+		if err != nil {
+			golog.Errorf("failed to prune revoked tokens: %v", err)
+		} else if n > 0 {
+			golog.Infof("pruned %d expired token revocations", n)
+		}
+	}
+}
+
 func toJson(v interface{}) string {
     b, _ := json.Marshal(v)
     return string(b)
 }
 
-func GenerateJWT(userID, secret string) (string, error) {
+// GenerateJWT issues a session token for a user that expires after ttl
+func GenerateJWT(userID string, keys *JWTKeySet, ttl time.Duration) (string, error) {
+    now := time.Now()
     claims := jwt.MapClaims{
         "user_id": userID,
-        "exp":     time.Now().Add(time.Hour * 24 * 7).Unix(),
+        "jti":     uuid.New().String(),
+        "iat":     now.Unix(),
+        "exp":     now.Add(ttl).Unix(),
     }
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    return token.SignedString([]byte(secret))
+    return keys.Sign(claims)
 }
 
 // getOriginFromURL extracts the origin (scheme://host) from a URL
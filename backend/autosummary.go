@@ -0,0 +1,144 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/kataras/golog"
+)
+
+// SourceTypeAutoSummary marks the generated cross-source summary of a notebook
+const SourceTypeAutoSummary = "auto_summary"
+
+// autoSummaryEnabled reports whether a notebook opted in to the auto-generated summary
+// source through its "auto_summary" metadata flag
+func autoSummaryEnabled(notebook *Notebook) bool {
+	return metadataBool(notebook.Metadata, "auto_summary")
+}
+
+// maybeRefreshAutoSummary starts regenerating a notebook's summary source in the
+// background once the notebook has at least AUTO_SUMMARY_SOURCE_THRESHOLD sources. The
+// summary is not regenerated more often than AUTO_SUMMARY_INTERVAL.
+func (s *Server) maybeRefreshAutoSummary(notebookID, userID, locale string) {
+	ctx := context.Background()
+
+	notebook, err := s.store.GetNotebook(ctx, notebookID)
+	if err != nil || !autoSummaryEnabled(notebook) {
+		return
+	}
+
+	sources, err := s.store.ListSources(ctx, notebookID)
+	if err != nil {
+		golog.Errorf("failed to list sources for auto summary: %v", err)
+		return
+	}
+	count := 0
+	var lastSummary time.Time
+	for _, src := range sources {
+		if src.Type == SourceTypeAutoSummary {
+			if src.CreatedAt.After(lastSummary) {
+				lastSummary = src.CreatedAt
+			}
+			continue
+		}
+		count++
+	}
+	if count < s.cfg.AutoSummarySourceThreshold {
+		return
+	}
+	if time.Since(lastSummary) < time.Duration(s.cfg.AutoSummaryInterval)*time.Minute {
+		return
+	}
+
+	// One summary at a time per notebook
+	if _, running := s.autoSummaries.LoadOrStore(notebookID, struct{}{}); running {
+		return
+	}
+	go func() {
+		defer s.autoSummaries.Delete(notebookID)
+		if err := s.refreshAutoSummary(context.Background(), notebookID, userID, locale); err != nil {
+			golog.Errorf("failed to generate auto summary for notebook %s: %v", notebookID, err)
+		}
+	}()
+}
+
+// refreshAutoSummary generates a summary across the notebook's sources, adds it as a
+// source for retrieval and removes the summaries it replaces
+func (s *Server) refreshAutoSummary(ctx context.Context, notebookID, userID, locale string) error {
+	sources, err := s.store.ListSources(ctx, notebookID)
+	if err != nil {
+		return err
+	}
+	inputs := make([]Source, 0, len(sources))
+	inputIDs := make([]string, 0, len(sources))
+	previous := make([]Source, 0)
+	for _, src := range sources {
+		if src.Type == SourceTypeAutoSummary {
+			previous = append(previous, src)
+			continue
+		}
+		inputs = append(inputs, src)
+		inputIDs = append(inputIDs, src.ID)
+	}
+
+	golog.Infof("generating auto summary for notebook %s from %d sources...", notebookID, len(inputs))
+
+	requestJSON, _ := json.Marshal(map[string]interface{}{"source_ids": inputIDs})
+	gen := &Generation{
+		UserID:     userID,
+		NotebookID: notebookID,
+		Type:       SourceTypeAutoSummary,
+		Request:    string(requestJSON),
+		Model:      s.agent.textModelName(),
+	}
+	if err := s.store.CreateGeneration(ctx, gen); err != nil {
+		golog.Errorf("failed to record generation: %v", err)
+	}
+
+	summary, err := s.agent.GenerateSourceSummary(ctx, inputs)
+	if err != nil {
+		gen.Status = GenerationStatusFailed
+		gen.Error = err.Error()
+		if err := s.store.FinishGeneration(ctx, gen); err != nil {
+			golog.Errorf("failed to update generation %s: %v", gen.ID, err)
+		}
+		return err
+	}
+	gen.PromptTokens = estimateTokens(s.agent.buildSourceContext(inputs))
+	gen.CompletionTokens = estimateTokens(summary)
+	gen.Status = GenerationStatusSucceeded
+	if err := s.store.FinishGeneration(ctx, gen); err != nil {
+		golog.Errorf("failed to update generation %s: %v", gen.ID, err)
+	}
+
+	summarySource := &Source{
+		NotebookID: notebookID,
+		Name:       translate(locale, "source.auto_summary"),
+		Type:       SourceTypeAutoSummary,
+		Content:    summary,
+		Metadata: map[string]interface{}{
+			"generated_at": time.Now(),
+			"source_ids":   inputIDs,
+		},
+	}
+	s.vectorStore.AssignChunkStrategy(summarySource)
+	if err := s.store.CreateSource(ctx, summarySource); err != nil {
+		return err
+	}
+	if _, err := s.indexSource(ctx, summarySource); err != nil {
+		golog.Errorf("failed to ingest auto summary: %v", err)
+	}
+
+	// The new summary supersedes the old ones
+	for _, old := range previous {
+		if err := s.store.DeleteSource(ctx, old.ID); err != nil {
+			golog.Errorf("failed to delete previous auto summary %s: %v", old.ID, err)
+			continue
+		}
+		s.vectorStore.DeleteSourceChunks(ctx, notebookID, old.ID)
+	}
+
+	golog.Infof("auto summary for notebook %s updated (%d sources)", notebookID, len(inputs))
+	return nil
+}
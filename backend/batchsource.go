@@ -0,0 +1,207 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+const (
+	// maxBatchSources is the most sources accepted by one batch request
+	maxBatchSources = 50
+	// batchSourceWorkers bounds how many sources of a batch are fetched at the same time
+	batchSourceWorkers = 4
+)
+
+// BatchSourceItem is one source of a batch: a URL to fetch or pasted text
+type BatchSourceItem struct {
+	Name     string                 `json:"name"`
+	Type     string                 `json:"type"` // url or text
+	URL      string                 `json:"url"`
+	Content  string                 `json:"content"`
+	Metadata map[string]interface{} `json:"metadata"`
+	// ExtractionMode selects how a URL page is turned into text, as for a single source
+	ExtractionMode string `json:"extraction_mode"`
+}
+
+// BatchSourceResult is the outcome of one item of a batch, in request order
+type BatchSourceResult struct {
+	Index  int     `json:"index"`
+	Name   string  `json:"name"`
+	Status string  `json:"status"`           // created, not_indexed (created, indexing retried later), duplicate or failed
+	Source *Source `json:"source,omitempty"` // the new source, or the existing one for duplicates
+	Error  string  `json:"error,omitempty"`
+}
+
+// BatchSourceResponse reports the results of a batch source request
+type BatchSourceResponse struct {
+	Results    []BatchSourceResult `json:"results"`
+	Created    int                 `json:"created"`
+	NotIndexed int                 `json:"not_indexed"` // created but not yet indexed
+	Duplicates int                 `json:"duplicates"`  // already in the notebook, not added again
+	Failed     int                 `json:"failed"`
+}
+
+// validateBatchSourceItem fills in defaults of an item and checks it can be imported
+func validateBatchSourceItem(item *BatchSourceItem) error {
+	item.URL = strings.TrimSpace(item.URL)
+	if item.Type == "" {
+		item.Type = "text"
+		if item.URL != "" {
+			item.Type = "url"
+		}
+	}
+	switch item.Type {
+	case "url":
+		if item.URL == "" {
+			return fmt.Errorf("url is required for url sources")
+		}
+		if item.ExtractionMode == "" {
+			item.ExtractionMode = URLExtractFullText
+		}
+		if !validURLExtractionMode(item.ExtractionMode) {
+			return fmt.Errorf("unknown extraction_mode: %s (supported: readability, full-text, main-content)", item.ExtractionMode)
+		}
+		if item.Name == "" {
+			item.Name = item.URL
+		}
+	case "text":
+		if strings.TrimSpace(item.Content) == "" {
+			return fmt.Errorf("content is required for text sources")
+		}
+		if item.Name == "" {
+			return fmt.Errorf("name is required for text sources")
+		}
+	default:
+		return fmt.Errorf("unsupported source type: %s (supported: url, text)", item.Type)
+	}
+	return nil
+}
+
+// handleBatchAddSources adds several URL and text sources at once. URLs are fetched by a
+// bounded pool of workers; an item that fails is reported in its result and does not
+// stop the others. Items already in the notebook are reported as duplicates unless the
+// request sets ?dedupe=false.
+func (s *Server) handleBatchAddSources(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var req struct {
+		Sources []BatchSourceItem `json:"sources" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if len(req.Sources) == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "No sources given"})
+		return
+	}
+	if len(req.Sources) > maxBatchSources {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("At most %d sources can be added at once", maxBatchSources)})
+		return
+	}
+
+	dedupe := dedupeRequested(c)
+	results := make([]BatchSourceResult, len(req.Sources))
+	sem := make(chan struct{}, batchSourceWorkers)
+	var wg sync.WaitGroup
+	for i := range req.Sources {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = s.addBatchSource(ctx, notebookID, i, req.Sources[i], dedupe)
+		}(i)
+	}
+	wg.Wait()
+
+	resp := BatchSourceResponse{Results: results}
+	for _, r := range results {
+		switch r.Status {
+		case BulkURLCreated:
+			resp.Created++
+		case BulkURLNotIndexed:
+			resp.NotIndexed++
+		case BulkURLDuplicate:
+			resp.Duplicates++
+		default:
+			resp.Failed++
+		}
+	}
+
+	// Log batch import activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "batch_add_sources",
+		ResourceType: "notebook",
+		ResourceID:   notebookID,
+		Details:      fmt.Sprintf(`{"created": %d, "not_indexed": %d, "duplicates": %d, "failed": %d}`, resp.Created, resp.NotIndexed, resp.Duplicates, resp.Failed),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log batch source activity: %v", err)
+	}
+
+	if resp.Created+resp.NotIndexed > 0 {
+		s.maybeRefreshAutoSummary(notebookID, userID, s.resolveLocale(c))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// addBatchSource fetches, creates and indexes one item of a batch. With dedupe, an item
+// whose URL or text is already in the notebook returns the existing source instead.
+func (s *Server) addBatchSource(ctx context.Context, notebookID string, index int, item BatchSourceItem, dedupe bool) BatchSourceResult {
+	failed := func(err error) BatchSourceResult {
+		return BatchSourceResult{Index: index, Name: item.Name, Status: BulkURLFailed, Error: err.Error()}
+	}
+	if err := validateBatchSourceItem(&item); err != nil {
+		return failed(err)
+	}
+
+	source := &Source{
+		NotebookID: notebookID,
+		Name:       item.Name,
+		Type:       item.Type,
+		URL:        item.URL,
+		Content:    normalizeLineEndings(item.Content),
+		Metadata:   item.Metadata,
+	}
+	if source.Metadata == nil {
+		source.Metadata = make(map[string]interface{})
+	}
+	source.ContentHash = sourceContentHash(source)
+	if dedupe {
+		if existing := s.findDuplicateSource(ctx, notebookID, source.ContentHash); existing != nil {
+			return BatchSourceResult{Index: index, Name: existing.Name, Status: BulkURLDuplicate, Source: existing}
+		}
+	}
+
+	var err error
+	if item.Type == "url" {
+		_, err = s.addURLSource(ctx, source, item.ExtractionMode, nil)
+	} else {
+		err = s.createIndexedSource(ctx, source)
+	}
+	if errors.Is(err, errSourceNotIndexed) {
+		return BatchSourceResult{Index: index, Name: source.Name, Status: BulkURLNotIndexed, Source: source, Error: err.Error()}
+	}
+	if err != nil {
+		return failed(err)
+	}
+	return BatchSourceResult{Index: index, Name: source.Name, Status: BulkURLCreated, Source: source}
+}
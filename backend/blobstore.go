@@ -0,0 +1,116 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+// Upload storage modes
+const (
+	UploadStorageUser = "user" // <user_id>/<name>_<random>.<ext>
+	UploadStorageHash = "hash" // blobs/<sha256>.<ext>, shared across notebooks
+)
+
+// contentHashFileName matches file names produced by content-addressed storage
+var contentHashFileName = regexp.MustCompile(`^[0-9a-f]{64}(\.[A-Za-z0-9]+)?$`)
+
+// isContentHashFileName reports whether filename refers to a content-addressed upload
+func isContentHashFileName(filename string) bool {
+	return contentHashFileName.MatchString(filename)
+}
+
+// generatedImageFileName matches images written by the image providers. Each generation
+// gets a new name, so the content behind a name never changes.
+var generatedImageFileName = regexp.MustCompile(`^infograph_\d+\.png$`)
+
+// isImmutableFile reports whether a served file can be cached indefinitely
+func isImmutableFile(filename string) bool {
+	return isContentHashFileName(filename) || generatedImageFileName.MatchString(filename)
+}
+
+// stageUploadByHash saves an uploaded file to the staging directory and names it after
+// its SHA-256 hash, so identical content is stored once. Whether the blob is already
+// stored is decided when the upload is moved to storage.
+func stageUploadByHash(file *multipart.FileHeader, limit int64) (fileName, path, hash string, err error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", "", "", err
+	}
+	defer src.Close()
+
+	path, err = newStagingPath(file.Filename)
+	if err != nil {
+		return "", "", "", err
+	}
+	tmp, err := os.Create(path)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	hasher := sha256.New()
+	if _, err := copyUploadLimited(io.MultiWriter(tmp, hasher), src, limit); err != nil {
+		tmp.Close()
+		os.Remove(path)
+		return "", "", "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(path)
+		return "", "", "", err
+	}
+
+	hash = hex.EncodeToString(hasher.Sum(nil))
+	fileName = hash + strings.ToLower(filepath.Ext(file.Filename))
+	return fileName, path, hash, nil
+}
+
+// serveContentAddressedFile serves a blob. Blobs can be shared by several sources, so the
+// request is allowed when the user owns, or the public can see, any notebook with a source
+// referencing it.
+func (s *Server) serveContentAddressedFile(c *gin.Context, filename, userID string) {
+	notebooks, err := s.store.ListNotebooksByFileName(c.Request.Context(), filename)
+	if err != nil || len(notebooks) == 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "File not found"})
+		return
+	}
+
+	owned, isPublic := false, false
+	for _, nb := range notebooks {
+		if userID != "" && nb.UserID == userID {
+			owned = true
+		}
+		if nb.IsPublic {
+			isPublic = true
+		}
+	}
+
+	if !owned && !isPublic {
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Authorization required"})
+			return
+		}
+		golog.Warnf("Unauthorized access attempt by user %s to blob %s", userID, filename)
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Access denied"})
+		return
+	}
+
+	obj, err := s.storage.Get(c.Request.Context(), uploadKey("", filename))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "File not found"})
+		return
+	}
+	defer obj.Close()
+
+	c.Header("Content-Type", contentTypeForFile(filename))
+	s.setFileCacheHeaders(c, filename, obj, owned, isPublic)
+	serveFileContent(c, filename, obj)
+}
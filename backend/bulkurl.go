@@ -0,0 +1,236 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+// maxBulkURLs is the most URLs accepted by one bulk import
+const maxBulkURLs = 50
+
+// Values of BulkURLResult.Status
+const (
+	BulkURLPending   = "pending"
+	BulkURLCreated   = "created"
+	BulkURLDuplicate = "duplicate" // a source with the same URL or content already exists
+	BulkURLFailed    = "failed"
+	// BulkURLNotIndexed is a source that was created but could not be indexed; indexing
+	// is retried in the background
+	BulkURLNotIndexed = "not_indexed"
+)
+
+// errSourceNotIndexed marks a source that was created but could not be indexed. The
+// background index retry picks it up later.
+var errSourceNotIndexed = errors.New("source was created but could not be indexed")
+
+// BulkURLResult is the outcome of importing one URL of a bulk import
+type BulkURLResult struct {
+	URL      string `json:"url"`
+	Status   string `json:"status"`
+	SourceID string `json:"source_id,omitempty"` // the new source, or the existing one for duplicates
+	Error    string `json:"error,omitempty"`
+}
+
+// addURLSource fetches the page of a URL source with the given extraction mode, then
+// creates and indexes the source. duplicateOf, when not nil, is asked for an existing
+// source with the fetched content; its ID is returned and nothing is created. An
+// indexing failure is returned as by createIndexedSource.
+func (s *Server) addURLSource(ctx context.Context, source *Source, mode string, duplicateOf func(content string) string) (string, error) {
+	if err := checkPublicURL(ctx, source.URL); err != nil {
+		return "", err
+	}
+	content, err := s.vectorStore.ExtractFromURLWithMode(ctx, source.URL, mode)
+	if err != nil {
+		golog.Errorf("failed to fetch URL content of %s: %v", source.URL, err)
+		return "", fmt.Errorf("failed to fetch URL content: %w", err)
+	}
+	if duplicateOf != nil {
+		if id := duplicateOf(content); id != "" {
+			return id, nil
+		}
+	}
+
+	source.Type = "url"
+	source.Content = content
+	if source.Metadata == nil {
+		source.Metadata = make(map[string]interface{})
+	}
+	source.Metadata["extraction_mode"] = mode
+	return "", s.createIndexedSource(ctx, source)
+}
+
+// createIndexedSource creates a source and indexes it. An indexing failure is returned
+// wrapping errSourceNotIndexed, the source is created.
+func (s *Server) createIndexedSource(ctx context.Context, source *Source) error {
+	s.vectorStore.AssignChunkStrategy(source)
+	if err := s.store.CreateSource(ctx, source); err != nil {
+		return fmt.Errorf("failed to create source")
+	}
+	if _, err := s.indexSource(ctx, source); err != nil {
+		golog.Errorf("failed to ingest source %s: %v", source.ID, err)
+		return fmt.Errorf("%w: %v", errSourceNotIndexed, err)
+	}
+	return nil
+}
+
+// contentDigest hashes source text for duplicate detection
+func contentDigest(content string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(content)))
+	return hex.EncodeToString(sum[:])
+}
+
+// handleBulkImportURLs imports a list of URLs as sources in a background job. The job
+// progress holds the status of every URL, so clients can show them as they complete.
+func (s *Server) handleBulkImportURLs(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var req struct {
+		URLs []string `json:"urls" binding:"required"`
+		// ExtractionMode applies to every URL, as for a single URL source
+		ExtractionMode string `json:"extraction_mode"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.ExtractionMode == "" {
+		req.ExtractionMode = URLExtractFullText
+	}
+	if !validURLExtractionMode(req.ExtractionMode) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("unknown extraction_mode: %s (supported: readability, full-text, main-content)", req.ExtractionMode)})
+		return
+	}
+
+	// Repeated URLs in the list are imported once
+	urls := make([]string, 0, len(req.URLs))
+	seen := make(map[string]bool, len(req.URLs))
+	for _, u := range req.URLs {
+		u = strings.TrimSpace(u)
+		if u != "" && !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "No URLs given"})
+		return
+	}
+	if len(urls) > maxBulkURLs {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("At most %d URLs can be imported at once", maxBulkURLs)})
+		return
+	}
+
+	locale := s.resolveLocale(c)
+	job := s.jobs.Start(userID, notebookID, "bulk_url_import", func(ctx context.Context, job *Job) (interface{}, error) {
+		return s.importURLs(ctx, job, notebookID, userID, locale, urls, req.ExtractionMode)
+	})
+
+	// Log bulk import activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "bulk_import_urls",
+		ResourceType: "notebook",
+		ResourceID:   notebookID,
+		Details:      fmt.Sprintf(`{"url_count": %d, "job_id": "%s"}`, len(urls), job.ID),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log bulk import activity: %v", err)
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// importURLs fetches and indexes each URL in turn. URLs already in the notebook, or whose
+// content matches an existing source, are reported as duplicates instead of imported.
+func (s *Server) importURLs(ctx context.Context, job *Job, notebookID, userID, locale string, urls []string, mode string) ([]BulkURLResult, error) {
+	existing, err := s.store.Store.ListSources(ctx, notebookID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sources: %w", err)
+	}
+	byURL := make(map[string]string, len(existing))
+	byDigest := make(map[string]string, len(existing))
+	for _, src := range existing {
+		if src.URL != "" {
+			byURL[src.URL] = src.ID
+		}
+		if src.Content != "" {
+			byDigest[contentDigest(src.Content)] = src.ID
+		}
+	}
+
+	results := make([]BulkURLResult, len(urls))
+	for i, u := range urls {
+		results[i] = BulkURLResult{URL: u, Status: BulkURLPending}
+	}
+	report := func() {
+		snapshot := make([]BulkURLResult, len(results))
+		copy(snapshot, results)
+		job.SetProgress("urls", snapshot)
+	}
+	report()
+
+	created := 0
+	for i, u := range urls {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		job.SetProgress("completed", fmt.Sprintf("%d/%d", i, len(urls)))
+
+		result := &results[i]
+		if id, ok := byURL[u]; ok {
+			result.Status, result.SourceID = BulkURLDuplicate, id
+			report()
+			continue
+		}
+
+		source := &Source{NotebookID: notebookID, Name: u, URL: u}
+		source.ContentHash = sourceContentHash(source)
+		if existing := s.findDuplicateSource(ctx, notebookID, source.ContentHash); existing != nil {
+			result.Status, result.SourceID = BulkURLDuplicate, existing.ID
+			report()
+			continue
+		}
+		duplicateID, err := s.addURLSource(ctx, source, mode, func(content string) string {
+			return byDigest[contentDigest(content)]
+		})
+		switch {
+		case duplicateID != "":
+			result.Status, result.SourceID = BulkURLDuplicate, duplicateID
+		case errors.Is(err, errSourceNotIndexed):
+			result.Status, result.SourceID, result.Error = BulkURLNotIndexed, source.ID, err.Error()
+		case err != nil:
+			result.Status, result.Error = BulkURLFailed, err.Error()
+		default:
+			result.Status, result.SourceID = BulkURLCreated, source.ID
+		}
+		if result.Status == BulkURLCreated || result.Status == BulkURLNotIndexed {
+			byURL[u], byDigest[contentDigest(source.Content)] = source.ID, source.ID
+			created++
+		}
+		report()
+	}
+	job.SetProgress("completed", fmt.Sprintf("%d/%d", len(urls), len(urls)))
+
+	if created > 0 {
+		s.maybeRefreshAutoSummary(notebookID, userID, locale)
+	}
+	golog.Infof("bulk import into notebook %s: %d of %d URLs imported", notebookID, created, len(urls))
+	return results, nil
+}
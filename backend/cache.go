@@ -296,6 +296,52 @@ func (cs *CachedStore) DeleteNotebook(ctx context.Context, id string) error {
 	return nil
 }
 
+// RestoreNotebook takes a notebook out of the trash and invalidates cache
+func (cs *CachedStore) RestoreNotebook(ctx context.Context, id string) error {
+	notebook, err := cs.Store.GetNotebookIncludingDeleted(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := cs.Store.RestoreNotebook(ctx, id); err != nil {
+		return err
+	}
+
+	// Invalidate caches
+	cs.cache.Delete(notebookKey(id))
+	if notebook.UserID != "" {
+		cs.cache.Delete(notebookListKey(notebook.UserID))
+		cs.cache.Delete(notebookListKey(notebook.UserID) + ":stats")
+	}
+
+	return nil
+}
+
+// PurgeNotebook permanently deletes a notebook and invalidates cache
+func (cs *CachedStore) PurgeNotebook(ctx context.Context, id string) (*NotebookPurge, error) {
+	notebook, err := cs.Store.GetNotebookIncludingDeleted(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	purge, err := cs.Store.PurgeNotebook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Invalidate caches
+	cs.cache.Delete(notebookKey(id))
+	if notebook.UserID != "" {
+		cs.cache.Delete(notebookListKey(notebook.UserID))
+		cs.cache.Delete(notebookListKey(notebook.UserID) + ":stats")
+	}
+	cs.cache.InvalidatePattern(notesListKey(id))
+	cs.cache.InvalidatePattern(sourcesListKey(id))
+	cs.cache.InvalidatePattern(chatSessionsKey(id))
+
+	return purge, nil
+}
+
 // ListNotes retrieves all notes for a notebook with caching
 func (cs *CachedStore) ListNotes(ctx context.Context, notebookID string) ([]Note, error) {
 	key := notesListKey(notebookID)
@@ -328,6 +374,19 @@ func (cs *CachedStore) CreateNote(ctx context.Context, note *Note) error {
 	return nil
 }
 
+// UpdateNote updates a note and invalidates cache
+func (cs *CachedStore) UpdateNote(ctx context.Context, note *Note) error {
+	err := cs.Store.UpdateNote(ctx, note)
+	if err != nil {
+		return err
+	}
+
+	// Invalidate notes list cache for this notebook
+	cs.cache.Delete(notesListKey(note.NotebookID))
+
+	return nil
+}
+
 // DeleteNote deletes a note and invalidates cache
 func (cs *CachedStore) DeleteNote(ctx context.Context, id string) error {
 	// Get the note first to find its notebook ID
@@ -347,6 +406,35 @@ func (cs *CachedStore) DeleteNote(ctx context.Context, id string) error {
 	return nil
 }
 
+// CreateNoteComment adds a comment and invalidates the cached comment counts
+func (cs *CachedStore) CreateNoteComment(ctx context.Context, comment *NoteComment) error {
+	if err := cs.Store.CreateNoteComment(ctx, comment); err != nil {
+		return err
+	}
+
+	// Note lists carry comment counts
+	cs.cache.Delete(notesListKey(comment.NotebookID))
+
+	return nil
+}
+
+// DeleteNoteComment deletes a comment and invalidates the cached comment counts
+func (cs *CachedStore) DeleteNoteComment(ctx context.Context, id string) error {
+	comment, err := cs.Store.GetNoteComment(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := cs.Store.DeleteNoteComment(ctx, id); err != nil {
+		return err
+	}
+
+	// Note lists carry comment counts
+	cs.cache.Delete(notesListKey(comment.NotebookID))
+
+	return nil
+}
+
 // ListSources retrieves all sources for a notebook with caching
 func (cs *CachedStore) ListSources(ctx context.Context, notebookID string) ([]Source, error) {
 	key := sourcesListKey(notebookID)
@@ -379,6 +467,87 @@ func (cs *CachedStore) CreateSource(ctx context.Context, source *Source) error {
 	return nil
 }
 
+// UpdateSourceChunkCount updates a source's chunk count and invalidates cache
+func (cs *CachedStore) UpdateSourceChunkCount(ctx context.Context, id string, chunkCount int) error {
+	source, err := cs.Store.GetSource(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := cs.Store.UpdateSourceChunkCount(ctx, id, chunkCount); err != nil {
+		return err
+	}
+
+	// Invalidate sources list cache so the new count is visible
+	cs.cache.Delete(sourcesListKey(source.NotebookID))
+
+	return nil
+}
+
+// UpdateSourceContent updates a source's content and invalidates cache
+func (cs *CachedStore) UpdateSourceContent(ctx context.Context, id, content string, metadata map[string]interface{}) error {
+	source, err := cs.Store.GetSource(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := cs.Store.UpdateSourceContent(ctx, id, content, metadata); err != nil {
+		return err
+	}
+
+	cs.cache.Delete(sourcesListKey(source.NotebookID))
+
+	return nil
+}
+
+// UpdateSource updates a source's name, content and metadata and invalidates cache
+func (cs *CachedStore) UpdateSource(ctx context.Context, id, name, content string, metadata map[string]interface{}) error {
+	source, err := cs.Store.GetSource(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := cs.Store.UpdateSource(ctx, id, name, content, metadata); err != nil {
+		return err
+	}
+
+	cs.cache.Delete(sourcesListKey(source.NotebookID))
+
+	return nil
+}
+
+// UpdateSourceMetadata updates a source's metadata and invalidates cache
+func (cs *CachedStore) UpdateSourceMetadata(ctx context.Context, id string, metadata map[string]interface{}) error {
+	source, err := cs.Store.GetSource(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := cs.Store.UpdateSourceMetadata(ctx, id, metadata); err != nil {
+		return err
+	}
+
+	cs.cache.Delete(sourcesListKey(source.NotebookID))
+
+	return nil
+}
+
+// UpdateSourceIngestion records a source's indexing outcome and invalidates cache
+func (cs *CachedStore) UpdateSourceIngestion(ctx context.Context, id string, chunkCount int, metadata map[string]interface{}) error {
+	source, err := cs.Store.GetSource(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := cs.Store.UpdateSourceIngestion(ctx, id, chunkCount, metadata); err != nil {
+		return err
+	}
+
+	cs.cache.Delete(sourcesListKey(source.NotebookID))
+
+	return nil
+}
+
 // DeleteSource deletes a source and invalidates cache
 func (cs *CachedStore) DeleteSource(ctx context.Context, id string) error {
 	// Get the source first to find its notebook ID
@@ -430,6 +599,44 @@ func (cs *CachedStore) CreateChatSession(ctx context.Context, notebookID, title
 	return session, nil
 }
 
+// UpdateChatSession renames a chat session and invalidates cache
+func (cs *CachedStore) UpdateChatSession(ctx context.Context, id, title string) (*ChatSession, error) {
+	session, err := cs.Store.UpdateChatSession(ctx, id, title)
+	if err != nil {
+		return nil, err
+	}
+
+	// Invalidate chat sessions list cache for this notebook
+	cs.cache.Delete(chatSessionsKey(session.NotebookID))
+
+	return session, nil
+}
+
+// UpdateChatHistorySummary stores a session's history summary and invalidates cache
+func (cs *CachedStore) UpdateChatHistorySummary(ctx context.Context, notebookID, id, summary string, messages int) error {
+	if err := cs.Store.UpdateChatHistorySummary(ctx, notebookID, id, summary, messages); err != nil {
+		return err
+	}
+
+	// Invalidate chat sessions list cache for this notebook
+	cs.cache.Delete(chatSessionsKey(notebookID))
+
+	return nil
+}
+
+// DeleteChatMessage deletes a chat message and invalidates cache
+func (cs *CachedStore) DeleteChatMessage(ctx context.Context, notebookID, sessionID, messageID string, withReply bool) ([]string, error) {
+	deleted, err := cs.Store.DeleteChatMessage(ctx, notebookID, sessionID, messageID, withReply)
+	if err != nil {
+		return nil, err
+	}
+
+	// Invalidate chat sessions list cache for this notebook
+	cs.cache.Delete(chatSessionsKey(notebookID))
+
+	return deleted, nil
+}
+
 // DeleteChatSession deletes a chat session and invalidates cache
 func (cs *CachedStore) DeleteChatSession(ctx context.Context, id string) error {
 	// Get the session first to find its notebook ID
@@ -449,6 +656,19 @@ func (cs *CachedStore) DeleteChatSession(ctx context.Context, id string) error {
 	return nil
 }
 
+// EraseUser deletes a user and all of their data, then drops every cached entry since the
+// user's notebooks, sources, notes and sessions are all affected
+func (cs *CachedStore) EraseUser(ctx context.Context, userID string) (*UserErasure, error) {
+	receipt, err := cs.Store.EraseUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.cache.Clear()
+
+	return receipt, nil
+}
+
 // GetCacheStats returns the cache statistics
 func (cs *CachedStore) GetCacheStats() CacheStats {
 	return cs.cache.GetStats()
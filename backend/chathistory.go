@@ -0,0 +1,154 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	// historySummaryKey holds the running summary of older turns in session metadata
+	historySummaryKey = "history_summary"
+	// historySummaryMessagesKey is how many of the session's first messages the summary covers
+	historySummaryMessagesKey = "history_summary_messages"
+	// historySummaryTimeout bounds the model call that updates a session's summary
+	historySummaryTimeout = 60 * time.Second
+)
+
+// recentChatHistory returns the last turns of a conversation that are sent to the model,
+// one turn being a user message and its answer
+func recentChatHistory(history []ChatMessage, turns int) []ChatMessage {
+	if keep := 2 * turns; len(history) > keep {
+		return history[len(history)-keep:]
+	}
+	return history
+}
+
+// sessionHistorySummary returns the stored summary of a session's older turns and how
+// many messages it covers
+func sessionHistorySummary(session *ChatSession) (string, int) {
+	summary, _ := session.Metadata[historySummaryKey].(string)
+	covered, _ := session.Metadata[historySummaryMessagesKey].(float64)
+	return summary, int(covered)
+}
+
+// sessionChatOptions returns the chat options of a notebook with the summary of the
+// session's turns that no longer fit in the history window
+func (s *Server) sessionChatOptions(c *gin.Context, notebook *Notebook, session *ChatSession) ChatOptions {
+	opts := s.chatOptions(c, notebook)
+	if s.cfg.ChatHistorySummary && len(session.Messages) > 2*s.cfg.ChatHistoryTurns {
+		opts.HistorySummary, _ = sessionHistorySummary(session)
+	}
+	return opts
+}
+
+// errChatQuotaExceeded skips a background model call of a user whose chat quota is used up
+var errChatQuotaExceeded = errors.New("daily chat quota exceeded")
+
+// sessionModelCall runs a background model call on a chat session of userID, such as
+// naming it or summarizing its history. Like a chat message, the call counts against
+// the user's daily chat quota, which is given back if it fails, and it is recorded in
+// the generations table as genType. input is what the model is asked about, for the
+// token estimate.
+func (s *Server) sessionModelCall(ctx context.Context, userID string, session *ChatSession, genType, input string, call func(ctx context.Context) (string, error)) (string, error) {
+	charge, _, ok := s.chargeQuota(ctx, userID, QuotaKindChat)
+	if !ok {
+		return "", errChatQuotaExceeded
+	}
+
+	requestJSON, _ := json.Marshal(map[string]interface{}{"session_id": session.ID})
+	gen := &Generation{
+		UserID:     userID,
+		NotebookID: session.NotebookID,
+		Type:       genType,
+		Request:    string(requestJSON),
+		Model:      s.agent.textModelName(),
+	}
+	if err := s.store.CreateGeneration(ctx, gen); err != nil {
+		golog.Errorf("failed to record generation: %v", err)
+	}
+
+	output, err := call(ctx)
+	gen.PromptTokens = estimateTokens(input)
+	gen.CompletionTokens = estimateTokens(output)
+	gen.Status = GenerationStatusSucceeded
+	if err != nil {
+		charge.release(s.store)
+		gen.Status = GenerationStatusFailed
+		gen.Error = err.Error()
+	}
+	// The call context may be done, the outcome is recorded anyway
+	if err := s.store.FinishGeneration(context.Background(), gen); err != nil {
+		golog.Errorf("failed to update generation %s: %v", gen.ID, err)
+	}
+	return output, err
+}
+
+// maybeSummarizeHistory folds the messages of a session that dropped out of the history
+// window into its running summary, in the background. The messages themselves are kept.
+// The summary is charged to userID.
+func (s *Server) maybeSummarizeHistory(session *ChatSession, userID string) {
+	if !s.cfg.ChatHistorySummary {
+		return
+	}
+	older := len(session.Messages) - 2*s.cfg.ChatHistoryTurns
+	summary, covered := sessionHistorySummary(session)
+	if older <= covered {
+		return
+	}
+
+	// One summary at a time per session
+	if _, running := s.historySummaries.LoadOrStore(session.ID, struct{}{}); running {
+		return
+	}
+	go func() {
+		defer s.historySummaries.Delete(session.ID)
+
+		ctx, cancel := context.WithTimeout(context.Background(), historySummaryTimeout)
+		defer cancel()
+		messages := session.Messages[covered:older]
+		var input strings.Builder
+		input.WriteString(summary)
+		for _, msg := range messages {
+			input.WriteString(msg.Content)
+		}
+		summary, err := s.sessionModelCall(ctx, userID, session, "history_summary", input.String(), func(ctx context.Context) (string, error) {
+			return s.agent.SummarizeChatHistory(ctx, summary, messages)
+		})
+		if err != nil {
+			golog.Errorf("failed to summarize history of chat session %s: %v", session.ID, err)
+			return
+		}
+		if err := s.store.UpdateChatHistorySummary(context.Background(), session.NotebookID, session.ID, summary, older); err != nil {
+			golog.Errorf("failed to save history summary of chat session %s: %v", session.ID, err)
+		}
+	}()
+}
+
+// SummarizeChatHistory extends the running summary of a conversation with more messages
+func (a *Agent) SummarizeChatHistory(ctx context.Context, summary string, messages []ChatMessage) (string, error) {
+	var conversation strings.Builder
+	for _, msg := range messages {
+		conversation.WriteString(fmt.Sprintf("%s: %s\n", chatHistoryRole(msg.Role), msg.Content))
+	}
+	result, err := llms.GenerateFromSinglePrompt(ctx, a.llm, chatHistorySummaryPrompt(summary, conversation.String()), llms.WithMaxTokens(1024))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(result), nil
+}
+
+// chatHistoryRole is how a message's author is named in prompts
+func chatHistoryRole(role string) string {
+	if role == "assistant" {
+		return "助手"
+	}
+	return "用户"
+}
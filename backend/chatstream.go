@@ -0,0 +1,91 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+// chatStreamKey marks requests to the chat stream route
+const chatStreamKey = "chat_stream"
+
+// wantsEventStream reports whether a chat request asked for a streamed answer, by the
+// stream route or an Accept: text/event-stream header
+func wantsEventStream(c *gin.Context) bool {
+	return c.GetBool(chatStreamKey) || strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+}
+
+// handleChatStream is handleChat answering with Server-Sent Events
+func (s *Server) handleChatStream(c *gin.Context) {
+	c.Set(chatStreamKey, true)
+	s.handleChat(c)
+}
+
+// streamChat answers a chat message as Server-Sent Events: "delta" events carry pieces
+// of the answer as they are generated, and a final "done" event carries the complete
+// ChatResponse with its sources. The messages are saved once the answer is complete;
+// the user message only when saveUserMessage is set, as handleSendMessage saves it
+// before answering. Generation stops when the client disconnects.
+func (s *Server) streamChat(c *gin.Context, notebook *Notebook, session *ChatSession, message string, charge *quotaCharge, saveUserMessage bool) {
+	ctx := c.Request.Context()
+	sessionID := session.ID
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	emit := func(event string, data interface{}) {
+		c.SSEvent(event, data)
+		c.Writer.Flush()
+	}
+
+	streamed := false
+	response, err := s.agent.ChatStream(ctx, notebook.ID, message, session.Messages, s.sessionChatOptions(c, notebook, session), func(delta string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		streamed = true
+		emit("delta", gin.H{"content": delta})
+		return nil
+	})
+	if err != nil {
+		charge.release(s.store)
+		if ctx.Err() != nil {
+			golog.Infof("chat stream for notebook %s stopped: %v", notebook.ID, ctx.Err())
+			return
+		}
+		emit("error", ErrorResponse{Error: fmt.Sprintf("Chat failed: %v", err)})
+		return
+	}
+	if !streamed {
+		emit("delta", gin.H{"content": response.Message})
+	}
+
+	response.SessionID = sessionID
+
+	// Save with a fresh context, the answer is complete even if the client just left
+	sourceIDs := make([]string, len(response.Sources))
+	for i, src := range response.Sources {
+		sourceIDs[i] = src.ID
+	}
+	if saveUserMessage {
+		if _, err := s.store.AddChatMessage(context.Background(), sessionID, "user", message, nil); err != nil {
+			golog.Errorf("failed to save chat message: %v", err)
+		}
+	}
+	if _, err := s.store.AddChatMessageWithMetadata(context.Background(), sessionID, "assistant", response.Message, sourceIDs, response.Metadata); err != nil {
+		golog.Errorf("failed to save chat response: %v", err)
+		emit("error", ErrorResponse{Error: "Failed to save response"})
+		return
+	}
+	s.recordSourceUsage(context.Background(), notebook.ID, sourceIDs)
+	s.maybeSummarizeHistory(session, c.GetString("user_id"))
+
+	emit("done", response)
+}
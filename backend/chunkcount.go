@@ -0,0 +1,103 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+// indexSource makes sure a source is in the vector index and records the number of
+// chunks the index holds for it as its chunk_count. All paths that add a source go
+// through here so the stored count always matches the index, also when indexing fails.
+func (s *Server) indexSource(ctx context.Context, src *Source) (int, error) {
+	chunkCount, err := s.reindexSource(ctx, src)
+
+	src.ChunkCount = chunkCount
+	if uerr := s.store.UpdateSourceChunkCount(ctx, src.ID, chunkCount); uerr != nil && err == nil {
+		err = fmt.Errorf("failed to record chunk count: %w", uerr)
+	}
+	return chunkCount, err
+}
+
+// reindexChangedSource replaces the chunks of a source whose content or name changed
+// and records the new chunk_count. A notebook that is not loaded is loaded first, which
+// already indexes the new content from the database.
+func (s *Server) reindexChangedSource(ctx context.Context, src *Source) (int, error) {
+	s.vectorMutex.Lock()
+	if err := s.ensureNotebookLoaded(ctx, src.NotebookID); err != nil {
+		golog.Errorf("failed to load vector index: %v", err)
+	} else {
+		s.vectorStore.DeleteSourceChunks(ctx, src.NotebookID, src.ID)
+	}
+	s.vectorMutex.Unlock()
+
+	return s.indexSource(ctx, src)
+}
+
+// reconcileChunkCounts corrects the recorded chunk_count of sources that differ from
+// the number of chunks the vector index holds for them, and returns their IDs. The
+// notebook must be loaded, otherwise every source would look empty; the caller holds
+// vectorMutex.
+func (s *Server) reconcileChunkCounts(ctx context.Context, notebookID string, sources []Source) ([]string, error) {
+	counts := s.vectorStore.SourceChunkCounts(ctx, notebookID)
+
+	fixed := make([]string, 0)
+	for i := range sources {
+		src := &sources[i]
+		if src.ChunkCount == counts[src.ID] {
+			continue
+		}
+		if err := s.store.UpdateSourceChunkCount(ctx, src.ID, counts[src.ID]); err != nil {
+			return fixed, fmt.Errorf("failed to update chunk count of source %s: %w", src.ID, err)
+		}
+		src.ChunkCount = counts[src.ID]
+		fixed = append(fixed, src.ID)
+	}
+	return fixed, nil
+}
+
+// reconcileLoadedChunkCounts reconciles the chunk counts of every notebook loaded in
+// the vector index. Unloaded notebooks have no chunks to compare against and are skipped.
+func (s *Server) reconcileLoadedChunkCounts(ctx context.Context) (*ChunkCountReport, error) {
+	s.vectorMutex.RLock()
+	defer s.vectorMutex.RUnlock()
+
+	notebookIDs := make([]string, 0, len(s.loadedNotebooks))
+	for id := range s.loadedNotebooks {
+		notebookIDs = append(notebookIDs, id)
+	}
+	sort.Strings(notebookIDs)
+
+	report := &ChunkCountReport{ChunkCountsFixed: make([]string, 0)}
+	for _, notebookID := range notebookIDs {
+		sources, err := s.store.Store.ListSources(ctx, notebookID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list sources of notebook %s: %w", notebookID, err)
+		}
+		fixed, err := s.reconcileChunkCounts(ctx, notebookID, sources)
+		report.ChunkCountsFixed = append(report.ChunkCountsFixed, fixed...)
+		if err != nil {
+			return nil, err
+		}
+		report.NotebooksChecked++
+		report.SourcesChecked += len(sources)
+	}
+	return report, nil
+}
+
+// handleReconcileChunkCounts corrects drifted source chunk counts in all loaded
+// notebooks (admin only)
+func (s *Server) handleReconcileChunkCounts(c *gin.Context) {
+	report, err := s.reconcileLoadedChunkCounts(context.Background())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reconcile chunk counts", Details: err.Error()})
+		return
+	}
+
+	golog.Infof("admin %s reconciled chunk counts: %d of %d sources fixed", c.GetString("user_id"), len(report.ChunkCountsFixed), report.SourcesChecked)
+	c.JSON(http.StatusOK, report)
+}
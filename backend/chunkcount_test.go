@@ -0,0 +1,221 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chunkCountTestServer is a server backed by a temporary store and the in-memory vector
+// index, with the source routes of one logged-in user
+type chunkCountTestServer struct {
+	*Server
+	router   *gin.Engine
+	notebook *Notebook
+}
+
+func newChunkCountTestServer(t *testing.T) *chunkCountTestServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	// Uploads are stored under ./data relative to the working directory
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	cfg := Config{
+		StorePath:               dir + "/notex.db",
+		SQLitePath:              dir + "/vectors.db",
+		SQLiteBusyTimeout:       1000,
+		SQLiteJournalMode:       "WAL",
+		SQLiteSynchronous:       "NORMAL",
+		UploadAllowedExtensions: defaultUploadExtensions,
+		UploadStorage:           UploadStorageHash,
+		MaxUploadBytes:          1 << 20,
+		ChunkSize:               20,
+		ChunkStrategy:           "fixed",
+	}
+	store, err := NewStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectorStore, err := NewVectorStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	user := &User{Email: "owner@example.com", Name: "owner", Provider: "github"}
+	if err := store.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	notebook, err := store.CreateNotebook(ctx, user.ID, "notebook", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{
+		cfg:             cfg,
+		store:           NewCachedStore(store, time.Minute),
+		storage:         NewLocalStorage(uploadRoot),
+		jobs:            NewJobManager(),
+		vectorStore:     vectorStore,
+		loadedNotebooks: make(map[string]time.Time),
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", user.ID) })
+	router.POST("/api/upload", s.handleUpload)
+	router.POST("/api/notebooks/:id/sources", s.handleAddSource)
+
+	return &chunkCountTestServer{Server: s, router: router, notebook: notebook}
+}
+
+// serve runs a request through the test routes
+func (ts *chunkCountTestServer) serve(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	return w
+}
+
+// source returns the stored source with the given name
+func (ts *chunkCountTestServer) source(t *testing.T, name string) *Source {
+	t.Helper()
+	sources, err := ts.store.Store.ListSources(context.Background(), ts.notebook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range sources {
+		if sources[i].Name == name {
+			return &sources[i]
+		}
+	}
+	t.Fatalf("source %q not found", name)
+	return nil
+}
+
+// checkChunkCount fails unless the stored chunk count of src matches the index and is not zero
+func (ts *chunkCountTestServer) checkChunkCount(t *testing.T, src *Source) {
+	t.Helper()
+	indexed := ts.vectorStore.SourceChunkCounts(context.Background(), ts.notebook.ID)[src.ID]
+	if indexed == 0 {
+		t.Fatalf("source %q has no chunks in the index", src.Name)
+	}
+	if src.ChunkCount != indexed {
+		t.Fatalf("source %q: stored chunk_count %d, index holds %d", src.Name, src.ChunkCount, indexed)
+	}
+}
+
+// longText returns text that is split into several chunks
+func longText() string {
+	return strings.Repeat("The quick brown fox jumps over the lazy dog near the river bank. ", 20)
+}
+
+func TestUploadRecordsChunkCount(t *testing.T) {
+	ts := newChunkCountTestServer(t)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("notebook_id", ts.notebook.ID)
+	part, err := form.CreateFormFile("file", "notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(longText()))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := ts.serve(req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("upload: status %d: %s", w.Code, w.Body.String())
+	}
+	var accepted UploadJobResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &accepted); err != nil {
+		t.Fatal(err)
+	}
+
+	// The upload is processed by a background job
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, ok := ts.jobs.Get(accepted.JobID)
+		if !ok {
+			t.Fatal("upload job not found")
+		}
+		if job.finished() {
+			if job.Status != JobStatusDone {
+				t.Fatalf("upload job %s: %s", job.Status, job.Error)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("upload job did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ts.checkChunkCount(t, ts.source(t, "notes.txt"))
+}
+
+func TestAddSourceRecordsChunkCount(t *testing.T) {
+	ts := newChunkCountTestServer(t)
+
+	payload, _ := json.Marshal(map[string]string{"name": "pasted", "type": "text", "content": longText()})
+	req := httptest.NewRequest(http.MethodPost, "/api/notebooks/"+ts.notebook.ID+"/sources", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := ts.serve(req)
+	if w.Code != http.StatusCreated && w.Code != http.StatusOK {
+		t.Fatalf("add source: status %d: %s", w.Code, w.Body.String())
+	}
+
+	var added Source
+	if err := json.Unmarshal(w.Body.Bytes(), &added); err != nil {
+		t.Fatal(err)
+	}
+	ts.checkChunkCount(t, &added)
+	ts.checkChunkCount(t, ts.source(t, "pasted"))
+}
+
+func TestReconcileChunkCountsFixesDrift(t *testing.T) {
+	ts := newChunkCountTestServer(t)
+	ctx := context.Background()
+
+	src := &Source{NotebookID: ts.notebook.ID, Name: "drifted", Type: "text", Content: longText()}
+	if err := ts.store.CreateSource(ctx, src); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.indexSource(ctx, src); err != nil {
+		t.Fatal(err)
+	}
+	indexed := src.ChunkCount
+
+	// Let the stored count drift away from the index
+	if err := ts.store.UpdateSourceChunkCount(ctx, src.ID, indexed+5); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := ts.reconcileLoadedChunkCounts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.ChunkCountsFixed) != 1 || report.ChunkCountsFixed[0] != src.ID {
+		t.Fatalf("fixed %v, want [%s]", report.ChunkCountsFixed, src.ID)
+	}
+	ts.checkChunkCount(t, ts.source(t, "drifted"))
+
+	// A second pass has nothing left to fix
+	report, err = ts.reconcileLoadedChunkCounts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.ChunkCountsFixed) != 0 {
+		t.Fatalf("second pass fixed %v", report.ChunkCountsFixed)
+	}
+}
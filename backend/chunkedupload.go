@@ -0,0 +1,401 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kataras/golog"
+)
+
+// chunkedUploadDir holds the partial files of chunked uploads
+var chunkedUploadDir = filepath.Join(stagingDir, "chunked")
+
+// maxUploadSessionsPerUser bounds the unfinished chunked uploads of one user
+const maxUploadSessionsPerUser = 10
+
+// uploadOffsetHeader carries the offset of a chunk, and the bytes received so far in
+// responses, as in the tus protocol
+const uploadOffsetHeader = "Upload-Offset"
+
+// ChunkedUpload is a file uploaded in several requests. Chunks are appended in order at
+// Offset until Size bytes have arrived; the upload is then committed like a single one.
+type ChunkedUpload struct {
+	ID          string    `json:"id"`
+	NotebookID  string    `json:"notebook_id"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type,omitempty"`
+	Size        int64     `json:"size"`
+	Offset      int64     `json:"offset"` // bytes received so far
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"` // discarded unless a chunk arrives before
+
+	userID string
+	path   string // partial file
+	mu     sync.Mutex
+}
+
+// ChunkedUploads tracks unfinished chunked uploads. They are kept in memory with their
+// partial files on disk, so a restart discards them.
+type ChunkedUploads struct {
+	mu      sync.Mutex
+	uploads map[string]*ChunkedUpload
+	ttl     time.Duration
+}
+
+// NewChunkedUploads creates the tracker and removes partial files left by a previous run
+func NewChunkedUploads(ttl time.Duration) *ChunkedUploads {
+	if err := os.RemoveAll(chunkedUploadDir); err != nil {
+		golog.Warnf("failed to remove stale chunked uploads: %v", err)
+	}
+	return &ChunkedUploads{uploads: make(map[string]*ChunkedUpload), ttl: ttl}
+}
+
+// Create starts an upload with an empty partial file
+func (m *ChunkedUploads) Create(userID, notebookID, fileName, contentType string, size int64) (*ChunkedUpload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	open := 0
+	for _, u := range m.uploads {
+		if u.userID == userID {
+			open++
+		}
+	}
+	if open >= maxUploadSessionsPerUser {
+		return nil, fmt.Errorf("too many unfinished uploads, commit or abort one first")
+	}
+
+	if err := os.MkdirAll(chunkedUploadDir, 0755); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	u := &ChunkedUpload{
+		ID:          uuid.New().String(),
+		NotebookID:  notebookID,
+		FileName:    fileName,
+		ContentType: contentType,
+		Size:        size,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(m.ttl),
+		userID:      userID,
+	}
+	u.path = filepath.Join(chunkedUploadDir, u.ID+".part")
+	f, err := os.Create(u.path)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	m.uploads[u.ID] = u
+	return u, nil
+}
+
+// Get returns an upload of the user
+func (m *ChunkedUploads) Get(id, userID string) (*ChunkedUpload, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.uploads[id]
+	if !ok || u.userID != userID {
+		return nil, false
+	}
+	return u, true
+}
+
+// forget stops tracking an upload, leaving its file to the caller
+func (m *ChunkedUploads) forget(id string) {
+	m.mu.Lock()
+	delete(m.uploads, id)
+	m.mu.Unlock()
+}
+
+// Remove discards an upload and its partial file
+func (m *ChunkedUploads) Remove(u *ChunkedUpload) {
+	m.forget(u.ID)
+	os.Remove(u.path)
+}
+
+// Sweep discards uploads that expired before now and returns how many. Uploads
+// receiving a chunk right now are left alone.
+func (m *ChunkedUploads) Sweep(now time.Time) int {
+	m.mu.Lock()
+	var expired []*ChunkedUpload
+	for id, u := range m.uploads {
+		if !u.mu.TryLock() {
+			continue
+		}
+		if now.After(u.ExpiresAt) {
+			delete(m.uploads, id)
+			expired = append(expired, u)
+		}
+		u.mu.Unlock()
+	}
+	m.mu.Unlock()
+
+	for _, u := range expired {
+		os.Remove(u.path)
+	}
+	return len(expired)
+}
+
+// sweepLoop discards abandoned uploads every minute
+func (m *ChunkedUploads) sweepLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if n := m.Sweep(now); n > 0 {
+			golog.Infof("discarded %d abandoned chunked uploads", n)
+		}
+	}
+}
+
+// snapshot copies the public fields of an upload for a response
+func (u *ChunkedUpload) snapshot() *ChunkedUpload {
+	return &ChunkedUpload{
+		ID:          u.ID,
+		NotebookID:  u.NotebookID,
+		FileName:    u.FileName,
+		ContentType: u.ContentType,
+		Size:        u.Size,
+		Offset:      u.Offset,
+		CreatedAt:   u.CreatedAt,
+		ExpiresAt:   u.ExpiresAt,
+	}
+}
+
+// handleInitUpload starts a chunked upload. The file is checked against the upload
+// limits by its declared name, size and type before any data is sent.
+func (s *Server) handleInitUpload(c *gin.Context) {
+	ctx := context.Background()
+	userID := c.GetString("user_id")
+
+	var req struct {
+		NotebookID  string `json:"notebook_id" binding:"required"`
+		FileName    string `json:"file_name" binding:"required"`
+		Size        int64  `json:"size"`
+		ContentType string `json:"content_type"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.Size <= 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "size must be positive"})
+		return
+	}
+	// Only the base name is kept, as for multipart uploads
+	req.FileName = filepath.Base(strings.ReplaceAll(req.FileName, "\\", "/"))
+
+	if err := s.checkNotebookAccess(ctx, req.NotebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !s.checkUploadFile(c, req.FileName, req.Size, req.ContentType) {
+		return
+	}
+
+	upload, err := s.uploads.Create(userID, req.NotebookID, req.FileName, req.ContentType, req.Size)
+	if err != nil {
+		golog.Errorf("failed to start chunked upload: %v", err)
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error(), Code: "upload_not_started"})
+		return
+	}
+
+	c.Header(uploadOffsetHeader, "0")
+	c.JSON(http.StatusCreated, upload.snapshot())
+}
+
+// chunkedUpload returns the upload of the :id parameter, or answers 404
+func (s *Server) chunkedUpload(c *gin.Context) (*ChunkedUpload, bool) {
+	upload, ok := s.uploads.Get(c.Param("id"), c.GetString("user_id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Upload not found"})
+		return nil, false
+	}
+	return upload, true
+}
+
+// handleGetUpload returns how far an upload got, so a client can resume it
+func (s *Server) handleGetUpload(c *gin.Context) {
+	upload, ok := s.chunkedUpload(c)
+	if !ok {
+		return
+	}
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+
+	c.Header(uploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	c.JSON(http.StatusOK, upload.snapshot())
+}
+
+// handlePatchUpload appends the request body to an upload. The Upload-Offset header (or
+// ?offset=) must match the bytes received so far. When the connection drops mid-chunk,
+// what arrived is kept and the client resumes from the offset GET reports.
+func (s *Server) handlePatchUpload(c *gin.Context) {
+	upload, ok := s.chunkedUpload(c)
+	if !ok {
+		return
+	}
+	if !upload.mu.TryLock() {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Another chunk of this upload is being received", Code: "upload_busy"})
+		return
+	}
+	defer upload.mu.Unlock()
+
+	offsetValue := c.GetHeader(uploadOffsetHeader)
+	if offsetValue == "" {
+		offsetValue = c.Query("offset")
+	}
+	offset, err := strconv.ParseInt(offsetValue, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Upload-Offset header required"})
+		return
+	}
+	c.Header(uploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	if offset != upload.Offset {
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Error:   "Chunk offset does not match the bytes received",
+			Code:    "offset_mismatch",
+			Details: fmt.Sprintf("expected offset %d", upload.Offset),
+		})
+		return
+	}
+
+	f, err := os.OpenFile(upload.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		golog.Errorf("failed to open chunked upload %s: %v", upload.ID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save chunk"})
+		return
+	}
+	remaining := upload.Size - upload.Offset
+	written, copyErr := io.Copy(f, io.LimitReader(c.Request.Body, remaining+1))
+	if written > remaining {
+		// Never keep more than the declared size
+		f.Truncate(upload.Size)
+		written = remaining
+		copyErr = errUploadTooLarge
+	}
+	if err := f.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+
+	upload.Offset += written
+	upload.ExpiresAt = time.Now().Add(s.uploads.ttl)
+	c.Header(uploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+
+	if errors.Is(copyErr, errUploadTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: "Chunk goes past the declared file size", Code: "file_too_large"})
+		return
+	}
+	if copyErr != nil {
+		golog.Warnf("chunk of upload %s interrupted at offset %d: %v", upload.ID, upload.Offset, copyErr)
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Chunk was interrupted, resume from the returned offset", Code: "chunk_interrupted"})
+		return
+	}
+
+	c.JSON(http.StatusOK, upload.snapshot())
+}
+
+// handleCommitUpload finishes an upload once every byte arrived. The file is staged and
+// added as a source like a single-request upload, answering the same way.
+func (s *Server) handleCommitUpload(c *gin.Context) {
+	ctx := context.Background()
+	userID := c.GetString("user_id")
+
+	upload, ok := s.chunkedUpload(c)
+	if !ok {
+		return
+	}
+	if !upload.mu.TryLock() {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "A chunk of this upload is being received", Code: "upload_busy"})
+		return
+	}
+	defer upload.mu.Unlock()
+
+	if upload.Offset != upload.Size {
+		c.Header(uploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Error:   "Upload is incomplete",
+			Code:    "upload_incomplete",
+			Details: fmt.Sprintf("received %d of %d bytes", upload.Offset, upload.Size),
+		})
+		return
+	}
+	if err := s.checkNotebookAccess(ctx, upload.NotebookID, userID); err != nil {
+		s.uploads.Remove(upload)
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	fileHash, err := fileSHA256(upload.path)
+	if err != nil {
+		golog.Errorf("failed to hash chunked upload %s: %v", upload.ID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save file"})
+		return
+	}
+	staged := stagedUpload{
+		notebookID: upload.NotebookID,
+		userID:     userID,
+		name:       upload.FileName,
+		size:       upload.Size,
+		fileHash:   fileHash,
+	}
+	if s.cfg.UploadStorage == UploadStorageHash {
+		staged.fileName = fileHash + strings.ToLower(filepath.Ext(upload.FileName))
+		staged.contentHash = fileHash
+	} else {
+		staged.fileName = uniqueUploadName(upload.FileName)
+	}
+
+	staged.path, err = newStagingPath(staged.fileName)
+	if err == nil {
+		err = os.Rename(upload.path, staged.path)
+	}
+	if err != nil {
+		golog.Errorf("failed to stage chunked upload %s: %v", upload.ID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save file"})
+		return
+	}
+	s.uploads.forget(upload.ID)
+
+	s.acceptUpload(c, staged)
+}
+
+// handleAbortUpload discards an unfinished upload
+func (s *Server) handleAbortUpload(c *gin.Context) {
+	upload, ok := s.chunkedUpload(c)
+	if !ok {
+		return
+	}
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+
+	s.uploads.Remove(upload)
+	c.Status(http.StatusNoContent)
+}
+
+// fileSHA256 returns the hex SHA-256 of a file
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,262 @@
+package backend
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Chunking strategies
+const (
+	ChunkStrategyFixed    = "fixed"    // fixed-size windows of words (or characters for CJK text)
+	ChunkStrategySentence = "sentence" // pack whole sentences up to the chunk size
+	ChunkStrategyMarkdown = "markdown" // split on headings, then on sentences within long sections
+)
+
+// validChunkStrategy reports whether name is a supported chunking strategy
+func validChunkStrategy(name string) bool {
+	return name == ChunkStrategyFixed || name == ChunkStrategySentence || name == ChunkStrategyMarkdown
+}
+
+// ChunkStrategyFor picks the chunking strategy for a source. A strategy already recorded in
+// the source metadata wins so re-indexing produces the same chunks; otherwise overrides
+// keyed by file extension (".md") or source type ("url") are checked before the default.
+func (vs *VectorStore) ChunkStrategyFor(src *Source) string {
+	if strategy, ok := src.Metadata["chunk_strategy"].(string); ok && validChunkStrategy(strategy) {
+		return strategy
+	}
+
+	name := src.FileName
+	if name == "" {
+		name = src.Name
+	}
+	if ext := strings.ToLower(filepath.Ext(name)); ext != "" {
+		if strategy, ok := vs.cfg.ChunkStrategyOverrides[ext]; ok {
+			return strategy
+		}
+	}
+	if strategy, ok := vs.cfg.ChunkStrategyOverrides[src.Type]; ok {
+		return strategy
+	}
+
+	return vs.cfg.ChunkStrategy
+}
+
+// AssignChunkStrategy records the chunking strategy in the source metadata before it is saved
+func (vs *VectorStore) AssignChunkStrategy(src *Source) {
+	strategy := vs.ChunkStrategyFor(src)
+	if src.Metadata == nil {
+		src.Metadata = make(map[string]interface{})
+	}
+	src.Metadata["chunk_strategy"] = strategy
+}
+
+// IngestSource chunks a source with its strategy and adds it to the index
+func (vs *VectorStore) IngestSource(ctx context.Context, src *Source) (int, error) {
+	strategy := vs.ChunkStrategyFor(src)
+	chunks := vs.chunkText(src.Content, strategy)
+	return vs.addChunks(src.NotebookID, src.ID, src.Name, strategy, src.Content, chunks), nil
+}
+
+// chunkText splits text using the given strategy
+func (vs *VectorStore) chunkText(text, strategy string) []string {
+	switch strategy {
+	case ChunkStrategySentence:
+		return vs.splitSentences(text, vs.cfg.ChunkSize, vs.cfg.ChunkOverlap)
+	case ChunkStrategyMarkdown:
+		return vs.splitMarkdown(text, vs.cfg.ChunkSize, vs.cfg.ChunkOverlap)
+	default:
+		return vs.splitText(text, vs.cfg.ChunkSize, vs.cfg.ChunkOverlap)
+	}
+}
+
+// sentenceEnd matches the end of a sentence in western or CJK text, or a blank line
+var sentenceEnd = regexp.MustCompile(`[.!?]+["')\]]*\s+|[。！？；]+["”’）」』]*|\n\s*\n`)
+
+// splitIntoSentences breaks text into sentences, keeping their punctuation
+func splitIntoSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for _, loc := range sentenceEnd.FindAllStringIndex(text, -1) {
+		if s := strings.TrimSpace(text[start:loc[1]]); s != "" {
+			sentences = append(sentences, s)
+		}
+		start = loc[1]
+	}
+	if s := strings.TrimSpace(text[start:]); s != "" {
+		sentences = append(sentences, s)
+	}
+	return sentences
+}
+
+// chunkUnits measures text in the same unit as the fixed splitter: characters for CJK
+// text and words otherwise, so ChunkSize means the same thing for every strategy
+func chunkUnits(text string) int {
+	if isMostlyCJK(text) {
+		return utf8.RuneCountInString(text)
+	}
+	return len(strings.Fields(text))
+}
+
+// isMostlyCJK reports whether more than 30% of the first 1000 characters are CJK
+func isMostlyCJK(text string) bool {
+	total, cjk := 0, 0
+	for _, r := range text {
+		if total >= 1000 {
+			break
+		}
+		total++
+		if r >= 0x4E00 && r <= 0x9FFF {
+			cjk++
+		}
+	}
+	return total > 0 && float64(cjk)/float64(total) > 0.3
+}
+
+// splitSentences packs whole sentences into chunks of up to chunkSize units, repeating the
+// trailing sentences of a chunk (up to chunkOverlap units) at the start of the next one
+func (vs *VectorStore) splitSentences(text string, chunkSize, chunkOverlap int) []string {
+	if chunkSize <= 0 {
+		chunkSize = 1000
+	}
+	if chunkOverlap < 0 || chunkOverlap >= chunkSize {
+		chunkOverlap = 0
+	}
+
+	joiner := " "
+	if isMostlyCJK(text) {
+		joiner = ""
+	}
+
+	var chunks []string
+	var current []string
+	currentSize := 0
+	pending := false // current holds sentences not emitted yet
+
+	flush := func() {
+		if !pending {
+			return
+		}
+		chunks = append(chunks, strings.Join(current, joiner))
+		pending = false
+
+		// Carry trailing sentences over as overlap
+		var overlap []string
+		size := 0
+		for i := len(current) - 1; i >= 0; i-- {
+			n := chunkUnits(current[i])
+			if size+n > chunkOverlap {
+				break
+			}
+			overlap = append([]string{current[i]}, overlap...)
+			size += n
+		}
+		current, currentSize = overlap, size
+	}
+
+	for _, sentence := range splitIntoSentences(text) {
+		n := chunkUnits(sentence)
+		if n > chunkSize {
+			// A single oversized sentence falls back to fixed-size windows
+			flush()
+			current, currentSize = nil, 0
+			chunks = append(chunks, vs.splitText(sentence, chunkSize, chunkOverlap)...)
+			continue
+		}
+		if currentSize+n > chunkSize {
+			flush()
+			// Drop overlap that would not leave room for this sentence
+			for len(current) > 0 && currentSize+n > chunkSize {
+				currentSize -= chunkUnits(current[0])
+				current = current[1:]
+			}
+		}
+		current = append(current, sentence)
+		currentSize += n
+		pending = true
+	}
+	flush()
+
+	return chunks
+}
+
+// markdownHeading matches an ATX heading line
+var markdownHeading = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+
+// splitMarkdown splits markdown on headings. Each chunk is prefixed with its heading path
+// so it keeps its context, and sections longer than chunkSize are split on sentences.
+func (vs *VectorStore) splitMarkdown(text string, chunkSize, chunkOverlap int) []string {
+	if chunkSize <= 0 {
+		chunkSize = 1000
+	}
+
+	type section struct {
+		path string
+		body strings.Builder
+	}
+
+	var sections []*section
+	var headings []string // heading titles by level
+	current := &section{}
+	inFence := false
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+
+		if !inFence {
+			if m := markdownHeading.FindStringSubmatch(line); m != nil {
+				sections = append(sections, current)
+
+				level := len(m[1])
+				if len(headings) >= level {
+					headings = headings[:level-1]
+				}
+				for len(headings) < level-1 {
+					headings = append(headings, "")
+				}
+				headings = append(headings, m[2])
+
+				var parts []string
+				for _, h := range headings {
+					if h != "" {
+						parts = append(parts, h)
+					}
+				}
+				current = &section{path: strings.Join(parts, " > ")}
+				continue
+			}
+		}
+
+		current.body.WriteString(line)
+		current.body.WriteString("\n")
+	}
+	sections = append(sections, current)
+
+	var chunks []string
+	for _, sec := range sections {
+		body := strings.TrimSpace(sec.body.String())
+		if body == "" {
+			continue
+		}
+
+		prefix := ""
+		if sec.path != "" {
+			prefix = sec.path + "\n\n"
+		}
+
+		if chunkUnits(body) <= chunkSize {
+			chunks = append(chunks, prefix+body)
+			continue
+		}
+		for _, part := range vs.splitSentences(body, chunkSize, chunkOverlap) {
+			chunks = append(chunks, prefix+part)
+		}
+	}
+
+	return chunks
+}
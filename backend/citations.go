@@ -0,0 +1,137 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// Citation is a retrieved chunk an answer cites, with where it is in its source.
+// Start and End are character (rune) offsets into the source content; they are left out
+// when the chunk could not be located, e.g. in sources indexed before offsets were kept.
+type Citation struct {
+	Index      int    `json:"index"` // the N of [来源 N] in the answer
+	SourceID   string `json:"source_id,omitempty"`
+	SourceName string `json:"source_name"`
+	Chunk      *int   `json:"chunk,omitempty"`
+	Text       string `json:"text"`
+	Start      *int   `json:"start,omitempty"`
+	End        *int   `json:"end,omitempty"`
+}
+
+// chunkOffsets locates each chunk in content and returns its [start, end) rune range,
+// or -1, -1 when it is not found. Chunkers join words and sentences with single spaces,
+// so whitespace is compared collapsed. Markdown chunks are tried without the heading path
+// they are prefixed with.
+func chunkOffsets(content string, chunks []string) [][2]int {
+	offsets := make([][2]int, len(chunks))
+
+	// Collapse whitespace runs in content, remembering the rune each byte came from
+	var b strings.Builder
+	var runeAt []int
+	space := false
+	ri := 0
+	for _, r := range content {
+		if unicode.IsSpace(r) {
+			if !space {
+				b.WriteByte(' ')
+				runeAt = append(runeAt, ri)
+			}
+			space = true
+		} else {
+			b.WriteRune(r)
+			for n := utf8.RuneLen(r); n > 0; n-- {
+				runeAt = append(runeAt, ri)
+			}
+			space = false
+		}
+		ri++
+	}
+	normalized := b.String()
+
+	// Chunks come in order, possibly overlapping, so search on from the previous match
+	from := 0
+	for i, chunk := range chunks {
+		offsets[i] = [2]int{-1, -1}
+		candidates := []string{chunk}
+		if _, body, ok := strings.Cut(chunk, "\n\n"); ok {
+			candidates = append(candidates, body)
+		}
+		for _, candidate := range candidates {
+			needle := strings.Join(strings.Fields(candidate), " ")
+			if needle == "" {
+				continue
+			}
+			pos := strings.Index(normalized[from:], needle)
+			if pos >= 0 {
+				pos += from
+			} else if pos = chunkBacktrack(normalized, needle, from); pos < 0 {
+				continue
+			}
+			offsets[i] = [2]int{runeAt[pos], runeAt[pos+len(needle)-1] + 1}
+			from = pos
+			break
+		}
+	}
+	return offsets
+}
+
+// chunkBacktrackWindow is how many bytes before the previous match are searched for a
+// chunk that is not found after it
+const chunkBacktrackWindow = 8 << 10
+
+// chunkBacktrack finds needle starting within chunkBacktrackWindow bytes before from,
+// for chunks that overlap their predecessor further than usual. Searching only a window
+// keeps locating all chunks linear in the content.
+func chunkBacktrack(normalized, needle string, from int) int {
+	start := max(0, from-chunkBacktrackWindow)
+	end := min(len(normalized), from+len(needle)-1)
+	if end-start < len(needle) {
+		return -1
+	}
+	pos := strings.Index(normalized[start:end], needle)
+	if pos < 0 {
+		return -1
+	}
+	return start + pos
+}
+
+// chatCitations lists the retrieved chunks an answer cites with [来源 N]. An answer
+// without inline citations is attributed to every retrieved chunk.
+func chatCitations(answer string, docs []schema.Document) []Citation {
+	var cited []int
+	seen := make(map[int]bool)
+	for _, match := range citationPattern.FindAllStringSubmatch(answer, -1) {
+		var n int
+		if _, err := fmt.Sscanf(match[1], "%d", &n); err == nil && n >= 1 && n <= len(docs) && !seen[n] {
+			seen[n] = true
+			cited = append(cited, n)
+		}
+	}
+	if len(cited) == 0 {
+		for n := 1; n <= len(docs); n++ {
+			cited = append(cited, n)
+		}
+	}
+
+	citations := make([]Citation, 0, len(cited))
+	for _, n := range cited {
+		doc := docs[n-1]
+		citation := Citation{Index: n, Text: doc.PageContent}
+		citation.SourceID, _ = doc.Metadata["source_id"].(string)
+		citation.SourceName, _ = doc.Metadata["source"].(string)
+		if chunk, ok := doc.Metadata["chunk"].(int); ok {
+			citation.Chunk = &chunk
+		}
+		start, okStart := doc.Metadata["start"].(int)
+		end, okEnd := doc.Metadata["end"].(int)
+		if okStart && okEnd {
+			citation.Start, citation.End = &start, &end
+		}
+		citations = append(citations, citation)
+	}
+	return citations
+}
@@ -0,0 +1,133 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+// maxCommentLength is the longest comment body accepted, in characters
+const maxCommentLength = 4000
+
+// notebookNote loads a note after checking that the user can access its notebook and
+// that the note belongs to it. Notebooks are not shared, so only the notebook owner gets
+// through; comments are the owner's own annotations on their notes. On failure the
+// response has been written.
+func (s *Server) notebookNote(ctx context.Context, c *gin.Context) (*Note, bool) {
+	notebookID := c.Param("id")
+	if err := s.checkNotebookAccess(ctx, notebookID, c.GetString("user_id")); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return nil, false
+	}
+
+	note, err := s.store.GetNote(ctx, c.Param("noteId"))
+	if err != nil || note.NotebookID != notebookID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Note not found"})
+		return nil, false
+	}
+	return note, true
+}
+
+// handleListNoteComments lists the comments on a note, oldest first
+func (s *Server) handleListNoteComments(c *gin.Context) {
+	ctx := context.Background()
+
+	note, ok := s.notebookNote(ctx, c)
+	if !ok {
+		return
+	}
+
+	comments, err := s.store.ListNoteComments(ctx, note.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list comments"})
+		return
+	}
+
+	respondList(c, comments)
+}
+
+// handleCreateNoteComment adds a comment by the current user to a note
+func (s *Server) handleCreateNoteComment(c *gin.Context) {
+	ctx := context.Background()
+	userID := c.GetString("user_id")
+
+	note, ok := s.notebookNote(ctx, c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Body string `json:"body" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Comment body is empty"})
+		return
+	}
+	if len([]rune(body)) > maxCommentLength {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Comment is longer than %d characters", maxCommentLength)})
+		return
+	}
+
+	comment := &NoteComment{
+		NoteID:     note.ID,
+		NotebookID: note.NotebookID,
+		UserID:     userID,
+		Body:       body,
+	}
+	if err := s.store.CreateNoteComment(ctx, comment); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create comment"})
+		return
+	}
+	if user, err := s.store.GetUser(ctx, userID); err == nil {
+		comment.AuthorName = user.Name
+	}
+
+	// Log comment activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "comment_note",
+		ResourceType: "note",
+		ResourceID:   note.ID,
+		ResourceName: note.Title,
+		Details:      fmt.Sprintf(`{"notebook_id": "%s", "comment_id": "%s"}`, note.NotebookID, comment.ID),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log comment activity: %v", err)
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// handleDeleteNoteComment deletes a comment on a note of the owner's notebook
+func (s *Server) handleDeleteNoteComment(c *gin.Context) {
+	ctx := context.Background()
+
+	note, ok := s.notebookNote(ctx, c)
+	if !ok {
+		return
+	}
+
+	comment, err := s.store.GetNoteComment(ctx, c.Param("commentId"))
+	if err != nil || comment.NoteID != note.ID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Comment not found"})
+		return
+	}
+
+	if err := s.store.DeleteNoteComment(ctx, comment.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete comment"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -14,7 +15,27 @@ type Config struct {
 	ServerHost string
 	ServerPort string
 
+	// Audit log files under ./logs
+	AuditLogMaxAgeDays    int // days rotated files are kept
+	AuditLogRotationHours int // hours between rotations
+	AuditLogMaxSizeMB     int // also rotate once the current file reaches this size, 0 = no size limit
+
 	// LLM settings
+	TextProvider      string // "openai" (also OpenAI-compatible servers such as Ollama) or "gemini"
+	GeminiTextModel   string
+	AllowedModels     []string // text models offered besides the configured default
+	LLMMaxRetries     int // extra attempts after a failed text generation call
+	LLMTimeout        int // seconds per text generation attempt
+	RequestTimeout           int // seconds an API request may take, 0 = no limit
+	GenerationRequestTimeout int // seconds for transform, chat, research, upload, source and index requests
+
+	// Shared HTTP transport of the model provider clients
+	ProviderMaxIdleConns        int  // idle connections kept across all provider hosts
+	ProviderMaxIdleConnsPerHost int  // idle connections kept per provider host
+	ProviderIdleConnTimeout     int  // seconds an idle connection is kept open
+	ProviderDNSCacheTTL         int  // seconds provider host lookups are cached, 0 = no caching
+	ProviderHTTP2               bool // negotiate HTTP/2 with providers that support it
+
 	OpenAIAPIKey      string
 	OpenAIBaseURL     string
 	OpenAIModel       string
@@ -24,12 +45,18 @@ type Config struct {
 	OllamaModel       string
 
 	// Image generation settings
-	ImageProvider     string // "gemini", "glm", "zimage"
+	ImageProvider     string // "gemini", "glm", "zimage", "openai" (also OpenAI-compatible servers)
 	GLMAPIKey        string
 	GLMImageModel    string
 	GeminiImageModel string
 	ZImageAPIKey     string
 	ZImageModel      string
+	OpenAIImageModel string
+	OpenAIImageBaseURL string // defaults to OPENAI_BASE_URL
+	ImageMaxRetries      int // extra attempts after a failed Gemini image call
+	ImageRetryBaseDelay  int // milliseconds before the first retry, doubled on each further retry
+	ImageRetryMaxDelay   int // milliseconds the delay between retries is capped at
+	PPTSlideConcurrency  int // slide images of a deck generated at the same time
 
 	// Vector store settings
 	VectorStoreType    string // "memory", "supabase", "pgvector", "redis", "sqlite"
@@ -38,33 +65,148 @@ type Config struct {
 	PostgreSQLURL      string
 	RedisURL           string
 	SQLitePath         string
+	MaxLoadedNotebooks int // notebook indexes kept in memory, least recently used evicted first; 0 = no limit
+
+	// Upload storage
+	UploadStorage           string   // "user" (per-user directories) or "hash" (content-addressed)
+	MaxUploadBytes          int64    // largest accepted upload; 0 = no limit
+	UploadAllowedExtensions []string // accepted document extensions; audio/video depend on transcription
+	UploadAllowedMIMETypes  []string // accepted declared Content-Types, "text/*" matches a family; empty = any
+	UploadSessionTTL        int      // minutes a chunked upload may sit idle before it is discarded
+
+	// File storage backend for uploaded and generated files
+	StorageBackend    string // "local" (./data/uploads) or "s3"
+	S3Endpoint        string // empty = AWS endpoint of S3Region
+	S3Region          string
+	S3Bucket          string
+	S3Prefix          string // key prefix inside the bucket
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3PathStyle       bool // bucket in the URL path, required by MinIO and most self-hosted servers
 
 	// Store settings (for checkpoints)
 	StoreType          string // "memory", "sqlite", "postgres", "redis"
 	StorePath          string
 
+	// SQLite store tuning
+	SQLiteJournalMode  string // "WAL", "DELETE", "TRUNCATE", "PERSIST", "MEMORY", "OFF"
+	SQLiteBusyTimeout  int    // milliseconds to wait on a locked database
+	SQLiteSynchronous  string // "OFF", "NORMAL", "FULL", "EXTRA"
+	SQLiteMaxOpenConns int    // 0 = pick based on journal mode
+	SQLiteMaxIdleConns int    // 0 = keep all open connections idle
+
 	// Application settings
 	MaxSources         int
-	MaxContextLength   int
+	MaxContextLength   int // characters per source in a transformation prompt, also caps the model context window
+	MaxContextChars    int // characters of source material per prompt, 0 = no limit
 	ChunkSize          int
 	ChunkOverlap       int
+	ChunkStrategy          string            // "fixed", "sentence", "markdown"
+	ChunkStrategyOverrides map[string]string // by file extension (".md") or source type ("url")
+
+	// Chat retrieval
+	ChatMinSimilarity   float64 // top-result score below which keyword search is added
+	ChatKeywordFallback bool
+	ChatKeywordMode     string // "merge" (rerank with semantic results) or "replace" (keyword results only)
+	PinnedSourceBudget  int // tokens of always-include sources added to chats and transformations
+
+	// Deep research
+	ResearchMaxSteps    int // sub-questions per research run
+	ResearchDocsPerStep int // chunks retrieved per sub-question
 
 	// Podcast generation
 	EnablePodcast      bool
 	PodcastVoice       string
+	TTSModel           string // OpenAI speech model reading podcast scripts
+	TTSBaseURL         string // speech API endpoint, empty = OPENAI_BASE_URL or the OpenAI API
+
+	// Transcription of uploaded audio and video
+	EnableTranscription  bool
+	TranscriptionModel   string
+	TranscriptionBaseURL string // empty = OPENAI_BASE_URL or the OpenAI API
 
 	// Document conversion
 	EnableMarkitdown   bool
 
+	// Localization
+	DefaultLocale string // "zh", "en"
+	// Instruction appended to infographic and slide image prompts, {language} is replaced
+	// by the resolved language name; empty uses the built-in wording of each locale
+	ImageLanguageInstruction string
+
+	// Response compression (gzip)
+	CompressionEnabled      bool
+	CompressionMinSize      int      // responses smaller than this many bytes are sent as-is
+	CompressionContentTypes []string // content types eligible for compression
+
+	// Cross-origin access to the API for separately hosted frontends
+	CORSAllowedOrigins   []string // exact origins, "*" or wildcard subdomains; empty = no CORS
+	CORSAllowCredentials bool     // allow cookies and auth headers on cross-origin requests
+	CORSMaxAge           int      // seconds browsers may cache a preflight response
+
+	// Browser caching of files served by /api/files (seconds, 0 = always revalidate)
+	ImmutableFileMaxAge int // generated images and content-addressed uploads, which never change
+	PublicFileMaxAge    int // other files of public notebooks
+
 	// Demo settings
 	AllowMultipleNotesOfSameType     bool
 
+	// Let chat call deterministic tools (calculator, date math) before answering
+	EnableChatTools bool
+
+	// Count which sources chat answers cite
+	TrackSourceUsage bool
+
+	// Link manually created notes to all sources when no source_ids are given
+	AutoAttachNoteSources bool
+
+	// Auto-generated summary source for notebooks that opt in with the "auto_summary" flag
+	AutoSummarySourceThreshold int // generate once a notebook has this many sources
+	AutoSummaryInterval        int // minutes between regenerations
+
+	// Name chat sessions still titled "New Chat" after their first message, using the text model
+	ChatAutoTitle bool
+
+	// Chat history sent to the model; sessions keep all messages
+	ChatHistoryTurns   int  // latest user/assistant message pairs included
+	ChatHistorySummary bool // summarize older turns into a running summary in session metadata
+
+	// Maximum follow-up requests when continuing a note cut off at the output limit
+	MaxNoteContinuations int
+
+	// Re-ingestion of sources whose indexing failed (content but no chunks)
+	IngestRetryOnStartup   bool // scan once when the server starts
+	IngestRetryInterval    int  // minutes between scans, 0 = no periodic scans
+	IngestRetryMaxAttempts int  // give up on a source after this many failed attempts
+
+	// Daily generation quotas per user (0 = unlimited); admins are exempt
+	DailyTransformQuota int
+	DailyChatQuota      int
+	DailyImageQuota     int // infographic and slide deck transformations
+
+	// Soft API rate limit: requests per minute per user reported in X-RateLimit-* headers (0 = off)
+	APIRateLimit int
+	// Enforced rate limits of generation endpoints in requests per minute per user (0 = off)
+	TransformRateLimit int
+	ChatRateLimit      int
+
 	// LangSmith tracing (optional)
 	LangChainAPIKey    string
 	LangChainProject   string
 
 	// Auth settings
-	JWTSecret string
+	JWTSecret          string   // signs new session tokens
+	JWTPreviousSecrets []string // still accepted for tokens issued before a rotation
+	JWTExpiryHours     int      // lifetime of a session token
+	JWTRefreshGrace    int      // seconds after expiry a token can still be refreshed
+	AdminEmails        []string // users with these emails are flagged as admins on login
+	DefaultAvatarURL   string   // used when an OAuth provider returns no valid avatar
+
+	// Seconds a signed service key request stays valid around its timestamp
+	APIKeySignatureWindow int
+
+	// Signs transformation webhooks; webhook_url is refused while it is empty
+	WebhookSecret string
 
 	// GitHub OAuth
 	GithubClientID     string
@@ -94,6 +236,21 @@ func LoadConfig() Config {
 	cfg := Config{
 		ServerHost:       getEnv("SERVER_HOST", "0.0.0.0"),
 		ServerPort:       getEnv("SERVER_PORT", "8080"),
+		AuditLogMaxAgeDays:    getEnvInt("AUDIT_LOG_MAX_AGE_DAYS", 7),
+		AuditLogRotationHours: getEnvInt("AUDIT_LOG_ROTATION_HOURS", 24),
+		AuditLogMaxSizeMB:     getEnvInt("AUDIT_LOG_MAX_SIZE_MB", 100),
+		TextProvider:     strings.ToLower(getEnv("TEXT_PROVIDER", TextProviderOpenAI)),
+		GeminiTextModel:  getEnv("GEMINI_TEXT_MODEL", "gemini-2.5-flash"),
+		AllowedModels:    getEnvList("ALLOWED_MODELS", nil),
+		LLMMaxRetries:    getEnvInt("LLM_MAX_RETRIES", 2),
+		LLMTimeout:       getEnvInt("LLM_TIMEOUT", 300),
+		RequestTimeout:           getEnvInt("REQUEST_TIMEOUT", 60),
+		GenerationRequestTimeout: getEnvInt("GENERATION_REQUEST_TIMEOUT", 900),
+		ProviderMaxIdleConns:        getEnvInt("PROVIDER_MAX_IDLE_CONNS", 100),
+		ProviderMaxIdleConnsPerHost: getEnvInt("PROVIDER_MAX_IDLE_CONNS_PER_HOST", 20),
+		ProviderIdleConnTimeout:     getEnvInt("PROVIDER_IDLE_CONN_TIMEOUT", 90),
+		ProviderDNSCacheTTL:         getEnvInt("PROVIDER_DNS_CACHE_TTL", 60),
+		ProviderHTTP2:               getEnvBool("PROVIDER_HTTP2", true),
 		OpenAIAPIKey:     getEnv("OPENAI_API_KEY", ""),
 		OpenAIBaseURL:    getEnv("OPENAI_BASE_URL", ""),
 		OpenAIModel:      getEnv("OPENAI_MODEL", "gpt-4o-mini"),
@@ -107,26 +264,100 @@ func LoadConfig() Config {
 		GeminiImageModel: getEnv("GEMINI_IMAGE_MODEL", "gemini-2.0-flash-exp"),
 		ZImageAPIKey:     getEnv("ZIMAGE_API_KEY", ""),
 		ZImageModel:      getEnv("ZIMAGE_MODEL", "z-image-turbo"),
+		OpenAIImageModel: getEnv("OPENAI_IMAGE_MODEL", "gpt-image-1"),
+		OpenAIImageBaseURL: getEnv("OPENAI_IMAGE_BASE_URL", ""),
+		ImageMaxRetries:     getEnvInt("IMAGE_MAX_RETRIES", 4),
+		ImageRetryBaseDelay: getEnvInt("IMAGE_RETRY_BASE_DELAY", 2000),
+		ImageRetryMaxDelay:  getEnvInt("IMAGE_RETRY_MAX_DELAY", 30000),
+		PPTSlideConcurrency: getEnvInt("PPT_SLIDE_CONCURRENCY", 3),
 		VectorStoreType:  getEnv("VECTOR_STORE_TYPE", "sqlite"),
 		SupabaseURL:      getEnv("SUPABASE_URL", ""),
 		SupabaseKey:      getEnv("SUPABASE_KEY", ""),
 		PostgreSQLURL:    getEnv("POSTGRES_URL", ""),
 		RedisURL:         getEnv("REDIS_URL", "redis://localhost:6379"),
 		SQLitePath:       getEnv("SQLITE_PATH", "./data/vector.db"),
+		MaxLoadedNotebooks: getEnvInt("MAX_LOADED_NOTEBOOKS", 100),
+		UploadStorage:    getEnv("UPLOAD_STORAGE", UploadStorageUser),
+		MaxUploadBytes:   int64(getEnvInt("MAX_UPLOAD_MB", 100)) << 20,
+		UploadAllowedExtensions: getEnvList("UPLOAD_ALLOWED_EXTENSIONS", defaultUploadExtensions),
+		UploadAllowedMIMETypes:  getEnvList("UPLOAD_ALLOWED_MIME_TYPES", nil),
+		UploadSessionTTL:        getEnvInt("UPLOAD_SESSION_TTL", 60),
+		StorageBackend:    getEnv("STORAGE_BACKEND", StorageBackendLocal),
+		S3Endpoint:        getEnv("S3_ENDPOINT", ""),
+		S3Region:          getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:          getEnv("S3_BUCKET", ""),
+		S3Prefix:          getEnv("S3_PREFIX", ""),
+		S3AccessKeyID:     getEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey: getEnv("S3_SECRET_ACCESS_KEY", ""),
+		S3PathStyle:       getEnvBool("S3_PATH_STYLE", false),
 		StoreType:        getEnv("STORE_TYPE", "sqlite"),
 		StorePath:        getEnv("STORE_PATH", "./data/checkpoints.db"),
+		SQLiteJournalMode:  strings.ToUpper(getEnv("SQLITE_JOURNAL_MODE", "WAL")),
+		SQLiteBusyTimeout:  getEnvInt("SQLITE_BUSY_TIMEOUT", 5000),
+		SQLiteSynchronous:  strings.ToUpper(getEnv("SQLITE_SYNCHRONOUS", "NORMAL")),
+		SQLiteMaxOpenConns: getEnvInt("SQLITE_MAX_OPEN_CONNS", 0),
+		SQLiteMaxIdleConns: getEnvInt("SQLITE_MAX_IDLE_CONNS", 0),
 		MaxSources:       getEnvInt("MAX_SOURCES", 5),
 		MaxContextLength: getEnvInt("MAX_CONTEXT_LENGTH", 128000),
+		MaxContextChars:  getEnvInt("MAX_CONTEXT_CHARS", 0),
 		ChunkSize:        getEnvInt("CHUNK_SIZE", 1000),
 		ChunkOverlap:     getEnvInt("CHUNK_OVERLAP", 200),
+		ChunkStrategy:          getEnv("CHUNK_STRATEGY", ChunkStrategyFixed),
+		ChunkStrategyOverrides: getEnvMap("CHUNK_STRATEGY_OVERRIDES", map[string]string{".md": ChunkStrategyMarkdown, ".markdown": ChunkStrategyMarkdown}),
+		ChatMinSimilarity:      getEnvFloat("CHAT_MIN_SIMILARITY", 0.35),
+		ChatKeywordFallback:    getEnvBool("CHAT_KEYWORD_FALLBACK", true),
+		ChatKeywordMode:        getEnv("CHAT_KEYWORD_MODE", ChatKeywordMerge),
+		PinnedSourceBudget:     getEnvInt("PINNED_SOURCE_BUDGET", 4000),
+		ResearchMaxSteps:       getEnvInt("RESEARCH_MAX_STEPS", 5),
+		ResearchDocsPerStep:    getEnvInt("RESEARCH_DOCS_PER_STEP", 4),
 		EnablePodcast:    getEnvBool("ENABLE_PODCAST", true),
 		PodcastVoice:     getEnv("PODCAST_VOICE", "alloy"),
+		TTSModel:         getEnv("TTS_MODEL", "tts-1"),
+		TTSBaseURL:       getEnv("TTS_BASE_URL", ""),
+		EnableTranscription:  getEnvBool("ENABLE_TRANSCRIPTION", false),
+		TranscriptionModel:   getEnv("TRANSCRIPTION_MODEL", "whisper-1"),
+		TranscriptionBaseURL: getEnv("TRANSCRIPTION_BASE_URL", ""),
 		EnableMarkitdown:           getEnvBool("ENABLE_MARKITDOWN", true),
 		AllowMultipleNotesOfSameType: getEnvBool("ALLOW_MULTIPLE_NOTES_OF_SAME_TYPE", true),
+		AutoAttachNoteSources:        getEnvBool("AUTO_ATTACH_NOTE_SOURCES", false),
+		TrackSourceUsage:             getEnvBool("TRACK_SOURCE_USAGE", true),
+		EnableChatTools:              getEnvBool("ENABLE_CHAT_TOOLS", false),
+		AutoSummarySourceThreshold:   getEnvInt("AUTO_SUMMARY_SOURCE_THRESHOLD", 10),
+		AutoSummaryInterval:          getEnvInt("AUTO_SUMMARY_INTERVAL", 60),
+		ChatAutoTitle:                getEnvBool("CHAT_AUTO_TITLE", true),
+		ChatHistoryTurns:             getEnvInt("CHAT_HISTORY_TURNS", 5),
+		ChatHistorySummary:           getEnvBool("CHAT_HISTORY_SUMMARY", false),
+		MaxNoteContinuations:         getEnvInt("MAX_NOTE_CONTINUATIONS", 3),
+		IngestRetryOnStartup:         getEnvBool("INGEST_RETRY_ON_STARTUP", true),
+		IngestRetryInterval:          getEnvInt("INGEST_RETRY_INTERVAL", 30),
+		IngestRetryMaxAttempts:       getEnvInt("INGEST_RETRY_MAX_ATTEMPTS", 5),
+		DailyTransformQuota:          getEnvInt("DAILY_TRANSFORM_QUOTA", 0),
+		DailyChatQuota:               getEnvInt("DAILY_CHAT_QUOTA", 0),
+		DailyImageQuota:              getEnvInt("DAILY_IMAGE_QUOTA", 0),
+		APIRateLimit:                 getEnvInt("API_RATE_LIMIT", 120),
+		TransformRateLimit:           getEnvInt("TRANSFORM_RATE_LIMIT", 10),
+		ChatRateLimit:                getEnvInt("CHAT_RATE_LIMIT", 30),
+		DefaultLocale:    getEnv("DEFAULT_LOCALE", LocaleZH),
+		ImageLanguageInstruction: getEnv("IMAGE_LANGUAGE_INSTRUCTION", ""),
+		CompressionEnabled:      getEnvBool("COMPRESSION_ENABLED", true),
+		CompressionMinSize:      getEnvInt("COMPRESSION_MIN_SIZE", 1024),
+		CompressionContentTypes: getEnvList("COMPRESSION_CONTENT_TYPES", []string{"application/json", "text/html", "text/plain", "text/markdown", "text/css", "application/javascript"}),
+		CORSAllowedOrigins:      getEnvList("CORS_ALLOWED_ORIGINS", nil),
+		CORSAllowCredentials:    getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+		CORSMaxAge:              getEnvInt("CORS_MAX_AGE", 600),
+		ImmutableFileMaxAge:     getEnvInt("IMMUTABLE_FILE_MAX_AGE", 31536000),
+		PublicFileMaxAge:        getEnvInt("PUBLIC_FILE_MAX_AGE", 3600),
 		LangChainAPIKey:  getEnv("LANGCHAIN_API_KEY", ""),
 		LangChainProject: getEnv("LANGCHAIN_PROJECT", "notex"),
 		
 		JWTSecret:        getEnv("JWT_SECRET", "your-secret-key-change-me"),
+		JWTPreviousSecrets: getEnvList("JWT_PREVIOUS_SECRETS", nil),
+		JWTExpiryHours:     getEnvInt("JWT_EXPIRY_HOURS", 168),
+		JWTRefreshGrace:    getEnvInt("JWT_REFRESH_GRACE", 300),
+		AdminEmails:      getEnvList("ADMIN_EMAILS", nil),
+		DefaultAvatarURL: getEnv("DEFAULT_AVATAR_URL", ""),
+		APIKeySignatureWindow: getEnvInt("API_KEY_SIGNATURE_WINDOW", 300),
+		WebhookSecret:         getEnv("WEBHOOK_SECRET", ""),
 		
 		GithubClientID:     getEnv("GITHUB_CLIENT_ID", ""),
 		GithubClientSecret: getEnv("GITHUB_CLIENT_SECRET", ""),
@@ -137,6 +368,11 @@ func LoadConfig() Config {
 		GoogleRedirectURL:  getEnv("GOOGLE_REDIRECT_URL", ""),
 	}
 
+	// Accept language tags such as "en-US" or "zh_CN"; unsupported ones fail validation
+	if locale := normalizeLocale(cfg.DefaultLocale); locale != "" {
+		cfg.DefaultLocale = locale
+	}
+
 	// Auto-detect provider from base URL or model name
 	if cfg.OpenAIBaseURL == "" && cfg.OpenAIModel != "" {
 		if contains(cfg.OpenAIModel, "ollama") || contains(cfg.OpenAIModel, "llama") {
@@ -157,6 +393,42 @@ func ValidateConfig(cfg Config) error {
 		return fmt.Errorf("either OPENAI_API_KEY or OLLAMA_BASE_URL must be set")
 	}
 
+	// Validate text generation provider; embeddings still use the OpenAI-compatible client
+	switch cfg.TextProvider {
+	case TextProviderOpenAI:
+	case TextProviderGemini:
+		if cfg.GoogleAPIKey == "" {
+			return fmt.Errorf("GOOGLE_API_KEY required for gemini text provider")
+		}
+	default:
+		return fmt.Errorf("unknown TEXT_PROVIDER: %s (supported: openai, gemini)", cfg.TextProvider)
+	}
+	if cfg.LLMMaxRetries < 0 {
+		return fmt.Errorf("LLM_MAX_RETRIES must not be negative")
+	}
+	if cfg.LLMTimeout <= 0 {
+		return fmt.Errorf("LLM_TIMEOUT must be positive")
+	}
+	if cfg.ImageMaxRetries < 0 {
+		return fmt.Errorf("IMAGE_MAX_RETRIES must not be negative")
+	}
+	if cfg.ImageRetryBaseDelay <= 0 || cfg.ImageRetryMaxDelay < cfg.ImageRetryBaseDelay {
+		return fmt.Errorf("IMAGE_RETRY_BASE_DELAY must be positive and not above IMAGE_RETRY_MAX_DELAY")
+	}
+	if cfg.PPTSlideConcurrency < 1 {
+		return fmt.Errorf("PPT_SLIDE_CONCURRENCY must be at least 1")
+	}
+	if cfg.RequestTimeout < 0 || cfg.GenerationRequestTimeout < 0 {
+		return fmt.Errorf("REQUEST_TIMEOUT and GENERATION_REQUEST_TIMEOUT must not be negative")
+	}
+
+	if cfg.ProviderMaxIdleConns < 0 || cfg.ProviderMaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("PROVIDER_MAX_IDLE_CONNS and PROVIDER_MAX_IDLE_CONNS_PER_HOST must not be negative")
+	}
+	if cfg.ProviderIdleConnTimeout < 0 || cfg.ProviderDNSCacheTTL < 0 {
+		return fmt.Errorf("PROVIDER_IDLE_CONN_TIMEOUT and PROVIDER_DNS_CACHE_TTL must not be negative")
+	}
+
 	// Validate vector store configuration
 	switch cfg.VectorStoreType {
 	case "supabase":
@@ -176,6 +448,158 @@ func ValidateConfig(cfg Config) error {
 	default:
 		return fmt.Errorf("unknown vector store type: %s", cfg.VectorStoreType)
 	}
+	if cfg.MaxLoadedNotebooks < 0 {
+		return fmt.Errorf("MAX_LOADED_NOTEBOOKS must not be negative")
+	}
+
+	if normalizeLocale(cfg.DefaultLocale) != cfg.DefaultLocale {
+		return fmt.Errorf("unsupported DEFAULT_LOCALE: %s (supported: zh, en)", cfg.DefaultLocale)
+	}
+
+	if (&PodcastSettings{Voice: cfg.PodcastVoice}).validate() != nil {
+		return fmt.Errorf("unsupported PODCAST_VOICE: %s (supported: %s)", cfg.PodcastVoice, strings.Join(podcastVoices, ", "))
+	}
+
+	// Validate SQLite store settings
+	switch cfg.SQLiteJournalMode {
+	case "WAL", "DELETE", "TRUNCATE", "PERSIST", "MEMORY", "OFF":
+	default:
+		return fmt.Errorf("unknown SQLITE_JOURNAL_MODE: %s", cfg.SQLiteJournalMode)
+	}
+	switch cfg.SQLiteSynchronous {
+	case "OFF", "NORMAL", "FULL", "EXTRA":
+	default:
+		return fmt.Errorf("unknown SQLITE_SYNCHRONOUS: %s", cfg.SQLiteSynchronous)
+	}
+	if cfg.SQLiteBusyTimeout < 0 || cfg.SQLiteMaxOpenConns < 0 || cfg.SQLiteMaxIdleConns < 0 {
+		return fmt.Errorf("SQLITE_BUSY_TIMEOUT, SQLITE_MAX_OPEN_CONNS and SQLITE_MAX_IDLE_CONNS must not be negative")
+	}
+
+	if cfg.UploadStorage != UploadStorageUser && cfg.UploadStorage != UploadStorageHash {
+		return fmt.Errorf("unknown UPLOAD_STORAGE: %s (supported: user, hash)", cfg.UploadStorage)
+	}
+
+	switch cfg.StorageBackend {
+	case StorageBackendLocal:
+	case StorageBackendS3:
+		if cfg.S3Bucket == "" || cfg.S3AccessKeyID == "" || cfg.S3SecretAccessKey == "" {
+			return fmt.Errorf("S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required when STORAGE_BACKEND is 's3'")
+		}
+	default:
+		return fmt.Errorf("unknown STORAGE_BACKEND: %s (supported: local, s3)", cfg.StorageBackend)
+	}
+	if cfg.MaxUploadBytes < 0 {
+		return fmt.Errorf("MAX_UPLOAD_MB must not be negative")
+	}
+	if cfg.UploadSessionTTL < 1 {
+		return fmt.Errorf("UPLOAD_SESSION_TTL must be at least 1 minute")
+	}
+	for _, ext := range cfg.UploadAllowedExtensions {
+		if !strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("UPLOAD_ALLOWED_EXTENSIONS entries must start with a dot: %s", ext)
+		}
+	}
+
+	if cfg.ChunkSize <= 0 {
+		return fmt.Errorf("CHUNK_SIZE must be positive")
+	}
+	if cfg.ChunkOverlap < 0 || cfg.ChunkOverlap >= cfg.ChunkSize {
+		return fmt.Errorf("CHUNK_OVERLAP must be at least 0 and smaller than CHUNK_SIZE (%d)", cfg.ChunkSize)
+	}
+	if !validChunkStrategy(cfg.ChunkStrategy) {
+		return fmt.Errorf("unknown CHUNK_STRATEGY: %s (supported: fixed, sentence, markdown)", cfg.ChunkStrategy)
+	}
+	for key, strategy := range cfg.ChunkStrategyOverrides {
+		if !validChunkStrategy(strategy) {
+			return fmt.Errorf("unknown chunk strategy %s for %s in CHUNK_STRATEGY_OVERRIDES", strategy, key)
+		}
+	}
+
+	if cfg.ChatMinSimilarity < 0 || cfg.ChatMinSimilarity > 1 {
+		return fmt.Errorf("CHAT_MIN_SIMILARITY must be between 0 and 1")
+	}
+	if cfg.ChatKeywordMode != ChatKeywordMerge && cfg.ChatKeywordMode != ChatKeywordReplace {
+		return fmt.Errorf("unknown CHAT_KEYWORD_MODE: %s (supported: merge, replace)", cfg.ChatKeywordMode)
+	}
+	if cfg.PinnedSourceBudget < 0 {
+		return fmt.Errorf("PINNED_SOURCE_BUDGET must not be negative")
+	}
+	if cfg.ChatHistoryTurns < 1 {
+		return fmt.Errorf("CHAT_HISTORY_TURNS must be at least 1")
+	}
+
+	if cfg.MaxContextChars < 0 {
+		return fmt.Errorf("MAX_CONTEXT_CHARS must not be negative")
+	}
+	if cfg.ResearchMaxSteps < 1 || cfg.ResearchDocsPerStep < 1 {
+		return fmt.Errorf("RESEARCH_MAX_STEPS and RESEARCH_DOCS_PER_STEP must be at least 1")
+	}
+
+	if cfg.CompressionMinSize < 0 {
+		return fmt.Errorf("COMPRESSION_MIN_SIZE must not be negative")
+	}
+
+	for _, origin := range cfg.CORSAllowedOrigins {
+		if origin == "*" && cfg.CORSAllowCredentials {
+			return fmt.Errorf("CORS_ALLOW_CREDENTIALS cannot be combined with CORS_ALLOWED_ORIGINS=*, list the trusted origins instead")
+		}
+		if origin != "*" && !strings.Contains(origin, "://") {
+			return fmt.Errorf("invalid CORS_ALLOWED_ORIGINS entry %q, expected an origin such as https://app.example.com", origin)
+		}
+	}
+	if cfg.CORSMaxAge < 0 {
+		return fmt.Errorf("CORS_MAX_AGE must not be negative")
+	}
+
+	if cfg.ImmutableFileMaxAge < 0 || cfg.PublicFileMaxAge < 0 {
+		return fmt.Errorf("IMMUTABLE_FILE_MAX_AGE and PUBLIC_FILE_MAX_AGE must not be negative")
+	}
+
+	if cfg.AutoSummarySourceThreshold < 1 {
+		return fmt.Errorf("AUTO_SUMMARY_SOURCE_THRESHOLD must be at least 1")
+	}
+	if cfg.AutoSummaryInterval < 0 {
+		return fmt.Errorf("AUTO_SUMMARY_INTERVAL must not be negative")
+	}
+
+	if cfg.MaxNoteContinuations < 1 {
+		return fmt.Errorf("MAX_NOTE_CONTINUATIONS must be at least 1")
+	}
+
+	if cfg.IngestRetryInterval < 0 {
+		return fmt.Errorf("INGEST_RETRY_INTERVAL must not be negative")
+	}
+	if cfg.IngestRetryMaxAttempts < 1 {
+		return fmt.Errorf("INGEST_RETRY_MAX_ATTEMPTS must be at least 1")
+	}
+
+	if cfg.APIKeySignatureWindow <= 0 {
+		return fmt.Errorf("API_KEY_SIGNATURE_WINDOW must be positive")
+	}
+	if cfg.JWTExpiryHours <= 0 {
+		return fmt.Errorf("JWT_EXPIRY_HOURS must be positive")
+	}
+	if cfg.JWTRefreshGrace < 0 {
+		return fmt.Errorf("JWT_REFRESH_GRACE must not be negative")
+	}
+
+	if cfg.DailyTransformQuota < 0 || cfg.DailyChatQuota < 0 || cfg.DailyImageQuota < 0 {
+		return fmt.Errorf("DAILY_TRANSFORM_QUOTA, DAILY_CHAT_QUOTA and DAILY_IMAGE_QUOTA must not be negative")
+	}
+
+	if cfg.APIRateLimit < 0 || cfg.TransformRateLimit < 0 || cfg.ChatRateLimit < 0 {
+		return fmt.Errorf("API_RATE_LIMIT, TRANSFORM_RATE_LIMIT and CHAT_RATE_LIMIT must not be negative")
+	}
+
+	if cfg.AuditLogMaxAgeDays < 1 || cfg.AuditLogRotationHours < 1 {
+		return fmt.Errorf("AUDIT_LOG_MAX_AGE_DAYS and AUDIT_LOG_ROTATION_HOURS must be at least 1")
+	}
+	if cfg.AuditLogMaxAgeDays*24 < cfg.AuditLogRotationHours {
+		return fmt.Errorf("AUDIT_LOG_ROTATION_HOURS must not exceed AUDIT_LOG_MAX_AGE_DAYS")
+	}
+	if cfg.AuditLogMaxSizeMB < 0 {
+		return fmt.Errorf("AUDIT_LOG_MAX_SIZE_MB must not be negative")
+	}
 
 	return nil
 }
@@ -198,6 +622,16 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvFloat gets an environment variable as a float or returns a default value
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return defaultValue
+}
+
 // getEnvBool gets an environment variable as a boolean or returns a default value
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
@@ -208,6 +642,36 @@ func getEnvBool(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+// getEnvList gets a comma-separated environment variable as a list or returns a default value
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvMap gets a comma-separated list of key:value pairs or returns a default value
+func getEnvMap(key string, defaultValue map[string]string) map[string]string {
+	items := getEnvList(key, nil)
+	if items == nil {
+		return defaultValue
+	}
+	m := make(map[string]string, len(items))
+	for _, item := range items {
+		if k, v, ok := strings.Cut(item, ":"); ok {
+			m[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		}
+	}
+	return m
+}
+
 // contains checks if a string contains a substring
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr || containsMiddle(s, substr)))
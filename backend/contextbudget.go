@@ -0,0 +1,132 @@
+package backend
+
+import (
+	"sort"
+	"unicode/utf8"
+
+	"github.com/kataras/golog"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// contextTruncationMarker replaces the middle of source content cut to fit MAX_CONTEXT_CHARS
+const contextTruncationMarker = "\n\n[... content truncated ...]\n\n"
+
+// minContextShare is the fewest characters worth keeping of a source; less is left out
+const minContextShare = 200
+
+// headTail shortens text to about limit characters, keeping its beginning and end, where
+// introductions and conclusions usually are
+func headTail(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	keep := limit - utf8.RuneCountInString(contextTruncationMarker)
+	if keep <= 0 {
+		return string(runes[:limit])
+	}
+	head := keep * 2 / 3
+	return string(runes[:head]) + contextTruncationMarker + string(runes[len(runes)-(keep-head):])
+}
+
+// fitSourcesToContext shortens the sources of a transformation to MAX_CONTEXT_CHARS in
+// total. Sources shorter than an even share are kept whole and the rest split what is
+// left, each keeping its head and tail. It reports whether anything was cut.
+func (a *Agent) fitSourcesToContext(sources []Source) ([]Source, bool) {
+	budget := a.cfg.MaxContextChars
+	if budget <= 0 {
+		return sources, false
+	}
+
+	total := 0
+	for _, src := range sources {
+		total += utf8.RuneCountInString(src.Content)
+	}
+	if total <= budget {
+		return sources, false
+	}
+
+	// Shortest first, so their unused share goes to the longer sources
+	order := make([]int, len(sources))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(sources[order[i]].Content) < len(sources[order[j]].Content)
+	})
+
+	fitted := make([]Source, len(sources))
+	copy(fitted, sources)
+	remaining := budget
+	for n, i := range order {
+		share := remaining / (len(order) - n)
+		length := utf8.RuneCountInString(fitted[i].Content)
+		if length > share {
+			fitted[i].Content = headTail(fitted[i].Content, share)
+			length = utf8.RuneCountInString(fitted[i].Content)
+		}
+		remaining -= length
+	}
+
+	golog.Warnf("sources of ~%d characters truncated to the MAX_CONTEXT_CHARS budget of %d; the result may be incomplete", total, budget)
+	return fitted, true
+}
+
+// fitDocsToContext limits the chunks given to a chat to MAX_CONTEXT_CHARS. Retrieved
+// chunks are kept by rank while they fit; always-include sources get what is left, with
+// their head and tail. It reports whether anything was cut or left out.
+func (a *Agent) fitDocsToContext(docs []schema.Document) ([]schema.Document, bool) {
+	budget := a.cfg.MaxContextChars
+	if budget <= 0 {
+		return docs, false
+	}
+
+	keep := make([]bool, len(docs))
+	used, pinned := 0, 0
+	truncated := false
+	for i, doc := range docs {
+		if always, _ := doc.Metadata[sourceAlwaysIncludeKey].(bool); always {
+			pinned++
+			continue
+		}
+		if n := utf8.RuneCountInString(doc.PageContent); used+n <= budget {
+			keep[i] = true
+			used += n
+		} else {
+			truncated = true
+		}
+	}
+
+	fitted := make([]schema.Document, 0, len(docs))
+	for i, doc := range docs {
+		if always, _ := doc.Metadata[sourceAlwaysIncludeKey].(bool); always {
+			share := (budget - used) / pinned
+			pinned--
+			if utf8.RuneCountInString(doc.PageContent) > share {
+				truncated = true
+				if share < minContextShare {
+					continue
+				}
+				// The cut content no longer spans the whole source
+				metadata := make(map[string]any, len(doc.Metadata))
+				for k, v := range doc.Metadata {
+					if k != "start" && k != "end" {
+						metadata[k] = v
+					}
+				}
+				doc = schema.Document{PageContent: headTail(doc.PageContent, share), Metadata: metadata, Score: doc.Score}
+			}
+			used += utf8.RuneCountInString(doc.PageContent)
+			fitted = append(fitted, doc)
+			continue
+		}
+		if keep[i] {
+			fitted = append(fitted, doc)
+		}
+	}
+
+	if truncated {
+		golog.Warnf("chat context cut from %d to %d chunks to fit MAX_CONTEXT_CHARS of %d; the answer may be incomplete", len(docs), len(fitted), budget)
+	}
+	return fitted, truncated
+}
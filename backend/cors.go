@@ -0,0 +1,85 @@
+package backend
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsAllowMethods are the methods cross-origin frontends may use on the API
+const corsAllowMethods = "GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS"
+
+// corsExposeHeaders are the response headers cross-origin frontends may read
+const corsExposeHeaders = "Content-Disposition, ETag, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, X-Quota-Reset"
+
+// corsOriginAllowed reports whether origin matches an entry of the allowlist. An entry is
+// an exact origin, "*" for any origin, or a wildcard subdomain such as
+// https://*.example.com, which does not match example.com itself.
+func corsOriginAllowed(origin string, allowed []string) bool {
+	for _, pattern := range allowed {
+		if pattern == "*" || strings.EqualFold(pattern, origin) {
+			return true
+		}
+		if i := strings.Index(pattern, "://*."); i != -1 {
+			scheme, domain := pattern[:i+3], strings.ToLower(pattern[i+4:])
+			if strings.HasPrefix(strings.ToLower(origin), scheme) && strings.HasSuffix(strings.ToLower(origin), domain) &&
+				len(origin) > len(scheme)+len(domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CORSMiddleware lets frontends hosted on the origins of CORSAllowedOrigins call the
+// API. It is registered on the engine rather than the /api group so preflight OPTIONS
+// requests, which match no route, are answered too; paths outside /api are left alone.
+func CORSMiddleware(cfg Config) gin.HandlerFunc {
+	wildcard := false
+	for _, origin := range cfg.CORSAllowedOrigins {
+		if origin == "*" {
+			wildcard = true
+		}
+	}
+	maxAge := strconv.Itoa(cfg.CORSMaxAge)
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if len(cfg.CORSAllowedOrigins) == 0 || origin == "" || !strings.HasPrefix(c.Request.URL.Path, "/api/") {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+		if !corsOriginAllowed(origin, cfg.CORSAllowedOrigins) {
+			c.Next()
+			return
+		}
+
+		// Credentialed requests need the actual origin echoed back, never "*"
+		if wildcard && !cfg.CORSAllowCredentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.CORSAllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", corsAllowMethods)
+			if headers := c.GetHeader("Access-Control-Request-Headers"); headers != "" {
+				c.Header("Access-Control-Allow-Headers", headers)
+				c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+			}
+			c.Header("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Header("Access-Control-Expose-Headers", corsExposeHeaders)
+		c.Next()
+	}
+}
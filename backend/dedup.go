@@ -0,0 +1,55 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+// textContentHash returns the SHA-256 of a string, hex encoded
+func textContentHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// sourceContentHash identifies what a source was added from, to find duplicates in a
+// notebook: the address of a URL source or the text of a pasted one. Uploaded files are
+// hashed by their bytes while they are received. Empty when there is nothing to compare.
+func sourceContentHash(source *Source) string {
+	if url := strings.TrimSpace(source.URL); url != "" {
+		return textContentHash("url:" + url)
+	}
+	if strings.TrimSpace(source.Content) != "" {
+		return textContentHash(source.Content)
+	}
+	return ""
+}
+
+// dedupeRequested reports whether adding a source should return an existing duplicate
+// instead of creating one. It is on unless the request sets ?dedupe=false.
+func dedupeRequested(c *gin.Context) bool {
+	dedupe, err := strconv.ParseBool(c.DefaultQuery("dedupe", "true"))
+	return err != nil || dedupe
+}
+
+// findDuplicateSource returns the source of the notebook with the same content hash,
+// or nil when there is none
+func (s *Server) findDuplicateSource(ctx context.Context, notebookID, hash string) *Source {
+	if hash == "" {
+		return nil
+	}
+	source, err := s.store.FindSourceByContentHash(ctx, notebookID, hash)
+	if err != nil {
+		golog.Errorf("failed to look up duplicate sources in notebook %s: %v", notebookID, err)
+		return nil
+	}
+	if source != nil {
+		golog.Infof("source %s of notebook %s has the same content, not adding a duplicate", source.ID, notebookID)
+	}
+	return source
+}
@@ -0,0 +1,165 @@
+package backend
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	textunicode "golang.org/x/text/encoding/unicode"
+)
+
+// Encoding names recorded in source metadata
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+)
+
+// legacyEncodings are tried in order when text is not valid UTF-8. Chinese encodings come
+// first because they are the most common non-UTF-8 input for this app; they also win ties,
+// so EUC-KR text is only recognized when the client sends a charset.
+var legacyEncodings = []struct {
+	name string
+	enc  encoding.Encoding
+}{
+	{"gb18030", simplifiedchinese.GB18030},
+	{"big5", traditionalchinese.Big5},
+	{"shift_jis", japanese.ShiftJIS},
+	{"euc-kr", korean.EUCKR},
+	{"windows-1252", charmap.Windows1252},
+}
+
+// decodeText converts raw text of unknown encoding to UTF-8 with "\n" line endings and
+// returns the name of the detected source encoding. hint is an optional charset label,
+// e.g. from a Content-Type header, that is trusted when it decodes the data cleanly.
+func decodeText(data []byte, hint string) (string, string) {
+	text, name := toUTF8(data, hint)
+	return normalizeLineEndings(text), name
+}
+
+// toUTF8 detects the encoding of data and converts it to UTF-8
+func toUTF8(data []byte, hint string) (string, string) {
+	// A byte order mark is authoritative
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:]), EncodingUTF8
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeWith(textunicode.UTF16(textunicode.LittleEndian, textunicode.IgnoreBOM), data[2:]), EncodingUTF16LE
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeWith(textunicode.UTF16(textunicode.BigEndian, textunicode.IgnoreBOM), data[2:]), EncodingUTF16BE
+	}
+
+	// UTF-16 without a BOM shows up as a zero byte in every other position. This is
+	// checked first because ASCII text in UTF-16 is also valid UTF-8.
+	if name, order, ok := guessUTF16(data); ok {
+		return decodeWith(textunicode.UTF16(order, textunicode.IgnoreBOM), data), name
+	}
+
+	if utf8.Valid(data) {
+		return string(data), EncodingUTF8
+	}
+
+	if hint != "" {
+		if enc, err := htmlindex.Get(hint); err == nil {
+			if name, _ := htmlindex.Name(enc); name != EncodingUTF8 {
+				if text := decodeWith(enc, data); !strings.ContainsRune(text, utf8.RuneError) {
+					return text, name
+				}
+			}
+		}
+	}
+
+	// Pick the legacy encoding whose output looks most like real text
+	bestText, bestName, bestScore := "", "", -1.0
+	for _, candidate := range legacyEncodings {
+		text := decodeWith(candidate.enc, data)
+		if score := textPlausibility(text); score > bestScore {
+			bestText, bestName, bestScore = text, candidate.name, score
+		}
+	}
+	return bestText, bestName
+}
+
+// decodeWith decodes data with enc, replacing invalid sequences with U+FFFD
+func decodeWith(enc encoding.Encoding, data []byte) string {
+	out, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return strings.ToValidUTF8(string(data), string(utf8.RuneError))
+	}
+	return string(out)
+}
+
+// guessUTF16 detects BOM-less UTF-16 by the share of zero bytes at even or odd offsets
+func guessUTF16(data []byte) (string, textunicode.Endianness, bool) {
+	n := len(data)
+	if n > 4096 {
+		n = 4096
+	}
+	if n < 4 {
+		return "", textunicode.LittleEndian, false
+	}
+
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i+1 < n; i += 2 {
+		if data[i] == 0 {
+			evenZeros++
+		}
+		if data[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	pairs := n / 2
+	switch {
+	case float64(oddZeros)/float64(pairs) > 0.3 && evenZeros < oddZeros/4:
+		return EncodingUTF16LE, textunicode.LittleEndian, true
+	case float64(evenZeros)/float64(pairs) > 0.3 && oddZeros < evenZeros/4:
+		return EncodingUTF16BE, textunicode.BigEndian, true
+	}
+	return "", textunicode.LittleEndian, false
+}
+
+// textPlausibility scores decoded text by the share of characters that commonly appear
+// in documents. Replacement characters and controls count against it, and CJK characters
+// count extra so multi-byte encodings are not beaten by windows-1252.
+func textPlausibility(text string) float64 {
+	total, score := 0, 0.0
+	for _, r := range text {
+		total++
+		switch {
+		case r == utf8.RuneError:
+			score -= 5
+		case r >= 0x3040 && r <= 0x30FF:
+			// Kana only come out of Japanese encodings, so they break ties with Chinese
+			score += 2.5
+		case r >= 0x4E00 && r <= 0x9FFF, r >= 0xAC00 && r <= 0xD7A3:
+			score += 2
+		case r < 0x80 && (unicode.IsPrint(r) || unicode.IsSpace(r)):
+			score++
+		case unicode.IsControl(r) || unicode.Is(unicode.Co, r):
+			score -= 2
+		case unicode.IsLetter(r) || unicode.IsPunct(r) || unicode.IsSpace(r):
+			score += 0.5
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return score / float64(total)
+}
+
+// normalizeLineEndings converts CRLF and lone CR line endings to LF
+func normalizeLineEndings(s string) string {
+	if !strings.ContainsRune(s, '\r') {
+		return s
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\r", "\n")
+}
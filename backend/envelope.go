@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIVersionV1 marks requests made through /api/v1
+const APIVersionV1 = "v1"
+
+// apiVersionKey is the request context key holding the API version
+const apiVersionKey = "api_version"
+
+// apiVersion records the API version of a route group in the request context
+func apiVersion(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(apiVersionKey, version)
+		c.Next()
+	}
+}
+
+// respondList writes a list of items. The legacy /api routes return a bare array; /api/v1
+// returns the page selected by the offset and limit query parameters in a ListResponse.
+func respondList[T any](c *gin.Context, items []T) {
+	c.JSON(http.StatusOK, listBody(c, items))
+}
+
+// respondListWithETag is respondList answering conditional requests, see respondWithETag
+func respondListWithETag[T any](c *gin.Context, items []T) {
+	respondWithETag(c, listBody(c, items))
+}
+
+// listBody returns the response body of a list for the request's API version
+func listBody[T any](c *gin.Context, items []T) interface{} {
+	if c.GetString(apiVersionKey) != APIVersionV1 {
+		return items
+	}
+
+	offset, limit := parsePagination(c, 50, 200)
+	total := len(items)
+	start := min(offset, total)
+	end := min(start+limit, total)
+	page := items[start:end]
+	if page == nil {
+		page = []T{}
+	}
+
+	return ListResponse{
+		Data: page,
+		Meta: ListMeta{
+			Total:   total,
+			Limit:   limit,
+			Offset:  offset,
+			HasMore: end < total,
+		},
+	}
+}
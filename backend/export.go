@@ -0,0 +1,453 @@
+package backend
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+const (
+	// exportDir holds generated export archives until their download link expires
+	exportDir = "./data/exports"
+	// exportLinkTTL is how long a signed export download link stays valid
+	exportLinkTTL = 24 * time.Hour
+	// exportFormatVersion is bumped when the archive layout changes
+	exportFormatVersion = 1
+)
+
+// ExportManifest is the top-level manifest.json of an account export
+type ExportManifest struct {
+	Version    int                      `json:"version"`
+	ExportedAt time.Time                `json:"exported_at"`
+	UserID     string                   `json:"user_id"`
+	Notebooks  []ExportManifestNotebook `json:"notebooks"`
+}
+
+// ExportManifestNotebook describes one notebook folder in an export archive
+type ExportManifestNotebook struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Folder      string `json:"folder"`
+	SourceCount int    `json:"source_count"`
+	NoteCount   int    `json:"note_count"`
+	FileCount   int    `json:"file_count"`
+}
+
+// writeNotebookArchive writes a notebook into zw under prefix using the per-notebook layout:
+//
+//	notebook.json   notebook metadata
+//	sources.json    all sources including their extracted content
+//	notes.json      all notes
+//	sources/*.md    source content as markdown for easy reading
+//	notes/*.md      note content as markdown for easy reading
+//	files/*         uploaded source files and generated images
+func (s *Server) writeNotebookArchive(ctx context.Context, zw *zip.Writer, prefix string, notebook *Notebook) (*ExportManifestNotebook, error) {
+	sources, err := s.store.ListSources(ctx, notebook.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sources: %w", err)
+	}
+	notes, err := s.store.ListNotes(ctx, notebook.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", err)
+	}
+
+	if err := writeZipJSON(zw, prefix+"notebook.json", notebook); err != nil {
+		return nil, err
+	}
+	if err := writeZipJSON(zw, prefix+"sources.json", sources); err != nil {
+		return nil, err
+	}
+	if err := writeZipJSON(zw, prefix+"notes.json", notes); err != nil {
+		return nil, err
+	}
+
+	for i, src := range sources {
+		name := fmt.Sprintf("%ssources/%02d-%s.md", prefix, i+1, slugify(src.Name))
+		w, err := zw.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		header := "# " + src.Name + "\n\n"
+		if src.URL != "" {
+			header += "<" + src.URL + ">\n\n"
+		}
+		if _, err := fmt.Fprintf(w, "%s%s\n", header, src.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, note := range notes {
+		name := fmt.Sprintf("%snotes/%02d-%s.md", prefix, i+1, slugify(note.Title))
+		w, err := zw.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fmt.Fprintf(w, "# %s\n\n%s\n", note.Title, note.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	// Copy the files referenced by sources and notes
+	fileCount := 0
+	for _, filename := range notebookFileNames(sources, notes) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		copied, err := copyFileToZip(ctx, s.storage, zw, prefix+"files/"+filename, uploadKey(notebook.UserID, filename))
+		if err != nil {
+			return nil, err
+		}
+		if copied {
+			fileCount++
+		}
+	}
+
+	return &ExportManifestNotebook{
+		ID:          notebook.ID,
+		Name:        notebook.Name,
+		Folder:      strings.TrimSuffix(prefix, "/"),
+		SourceCount: len(sources),
+		NoteCount:   len(notes),
+		FileCount:   fileCount,
+	}, nil
+}
+
+// notebookFileNames collects the uploaded and generated file names referenced by a notebook
+func notebookFileNames(sources []Source, notes []Note) []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	add := func(name string) {
+		name = filepath.Base(name)
+		if name == "" || name == "." || name == "/" || seen[name] {
+			return
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+
+	for _, src := range sources {
+		if src.FileName != "" {
+			add(src.FileName)
+		}
+	}
+	for _, note := range notes {
+		if imageURL, ok := note.Metadata["image_url"].(string); ok {
+			add(imageURL)
+		}
+		if slides, ok := note.Metadata["slides"].([]interface{}); ok {
+			for _, slide := range slides {
+				if slideURL, ok := slide.(string); ok {
+					add(slideURL)
+				}
+			}
+		}
+	}
+
+	return names
+}
+
+// writeZipJSON writes v as indented JSON into the archive
+func writeZipJSON(zw *zip.Writer, name string, v interface{}) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// copyFileToZip copies a stored file into the archive, skipping files that no longer exist
+func copyFileToZip(ctx context.Context, st Storage, zw *zip.Writer, name, key string) (bool, error) {
+	f, err := st.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			golog.Warnf("export: skipping missing file %s", key)
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	w, err := zw.Create(name)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// slugify turns a name into a string that is safe to use in archive paths
+func slugify(name string) string {
+	var b strings.Builder
+	lastDash := false
+	for _, r := range strings.TrimSpace(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			lastDash = false
+		} else if !lastDash && b.Len() > 0 {
+			b.WriteRune('-')
+			lastDash = true
+		}
+	}
+	slug := strings.TrimSuffix(b.String(), "-")
+	if slug == "" {
+		return "untitled"
+	}
+	if runes := []rune(slug); len(runes) > 60 {
+		slug = string(runes[:60])
+	}
+	return slug
+}
+
+// notebookFolder returns the archive folder for a notebook
+func notebookFolder(notebook *Notebook) string {
+	id := notebook.ID
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	return fmt.Sprintf("%s-%s/", slugify(notebook.Name), id)
+}
+
+// exportAllNotebooks builds an archive with every notebook owned by the user plus a manifest
+func (s *Server) exportAllNotebooks(ctx context.Context, job *Job, userID string) (interface{}, error) {
+	notebooks, err := s.store.ListNotebooks(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notebooks: %w", err)
+	}
+
+	if err := os.MkdirAll(exportDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	removeExpiredExports()
+
+	filename := "export-" + job.ID + ".zip"
+	path := filepath.Join(exportDir, filename)
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export file: %w", err)
+	}
+	job.AddArtifact(path)
+
+	zw := zip.NewWriter(f)
+	manifest := ExportManifest{
+		Version:    exportFormatVersion,
+		ExportedAt: time.Now(),
+		UserID:     userID,
+		Notebooks:  make([]ExportManifestNotebook, 0, len(notebooks)),
+	}
+
+	for i := range notebooks {
+		if err := ctx.Err(); err != nil {
+			zw.Close()
+			f.Close()
+			return nil, err
+		}
+		job.SetProgress("notebooks", fmt.Sprintf("%d/%d", i+1, len(notebooks)))
+
+		entry, err := s.writeNotebookArchive(ctx, zw, notebookFolder(&notebooks[i]), &notebooks[i])
+		if err != nil {
+			zw.Close()
+			f.Close()
+			os.Remove(path)
+			return nil, fmt.Errorf("failed to export notebook %s: %w", notebooks[i].ID, err)
+		}
+		manifest.Notebooks = append(manifest.Notebooks, *entry)
+	}
+
+	if err := writeZipJSON(zw, "manifest.json", manifest); err != nil {
+		zw.Close()
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to finalize export: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write export: %w", err)
+	}
+
+	var size int64
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+
+	expiresAt := time.Now().Add(exportLinkTTL)
+	return map[string]interface{}{
+		"download_url":   s.signedExportURL(filename, expiresAt),
+		"expires_at":     expiresAt,
+		"notebook_count": len(manifest.Notebooks),
+		"size":           size,
+	}, nil
+}
+
+// removeExpiredExports deletes export archives whose download links can no longer be valid
+func removeExpiredExports() {
+	entries, err := os.ReadDir(exportDir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-exportLinkTTL)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(exportDir, entry.Name())); err != nil {
+			golog.Errorf("failed to remove expired export %s: %v", entry.Name(), err)
+		}
+	}
+}
+
+// exportSignedMessage is the message an export download link signature covers
+func exportSignedMessage(filename string, expires int64) string {
+	return fmt.Sprintf("%s|%d", filename, expires)
+}
+
+// signedExportURL returns a download link for an export archive that is valid until expiresAt
+func (s *Server) signedExportURL(filename string, expiresAt time.Time) string {
+	expires := expiresAt.Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", s.cfg.JWTKeys().MAC(exportSignedMessage(filename, expires)))
+	return "/api/exports/" + filename + "?" + query.Encode()
+}
+
+// Export handlers
+
+func (s *Server) handleExportAllNotebooks(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	job := s.jobs.Start(userID, "", "export_all", func(ctx context.Context, job *Job) (interface{}, error) {
+		return s.exportAllNotebooks(ctx, job, userID)
+	})
+
+	// Log export activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "export_all",
+		ResourceType: "user",
+		ResourceID:   userID,
+		Details:      fmt.Sprintf(`{"job_id": "%s"}`, job.ID),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(context.Background(), activityLog); err != nil {
+		golog.Errorf("failed to log export activity: %v", err)
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// handleExportNotebook streams a ZIP backup of one notebook: its metadata, sources and
+// notes as JSON and markdown, its files and a manifest. The archive is written while it is read,
+// so errors after the first bytes can only be logged.
+func (s *Server) handleExportNotebook(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+	notebook, err := s.store.GetNotebook(ctx, notebookID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Notebook not found"})
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.zip", slugify(notebook.Name), time.Now().Format("20060102"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	entry, err := s.writeNotebookArchive(ctx, zw, "", notebook)
+	if err != nil {
+		golog.Errorf("failed to export notebook %s: %v", notebookID, err)
+		return
+	}
+	// The manifest lets the archive be imported again
+	manifest := ExportManifest{
+		Version:    exportFormatVersion,
+		ExportedAt: time.Now(),
+		UserID:     userID,
+		Notebooks:  []ExportManifestNotebook{*entry},
+	}
+	if err := writeZipJSON(zw, "manifest.json", manifest); err != nil {
+		golog.Errorf("failed to export notebook %s: %v", notebookID, err)
+		return
+	}
+	if err := zw.Close(); err != nil {
+		golog.Errorf("failed to export notebook %s: %v", notebookID, err)
+		return
+	}
+
+	// Log export activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "export_notebook",
+		ResourceType: "notebook",
+		ResourceID:   notebook.ID,
+		ResourceName: notebook.Name,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log export activity: %v", err)
+	}
+}
+
+// handleDownloadExport serves an export archive. Access is granted by the signed link
+// rather than a session, so the link can be opened directly by the browser.
+func (s *Server) handleDownloadExport(c *gin.Context) {
+	filename := c.Param("filename")
+	if filename != filepath.Base(filename) || !strings.HasPrefix(filename, "export-") || !strings.HasSuffix(filename, ".zip") {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "File not found"})
+		return
+	}
+
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Invalid download link"})
+		return
+	}
+	if !s.cfg.JWTKeys().VerifyMAC(exportSignedMessage(filename, expires), c.Query("signature")) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Invalid download link"})
+		return
+	}
+	if time.Now().Unix() > expires {
+		c.JSON(http.StatusGone, ErrorResponse{Error: "Download link expired"})
+		return
+	}
+
+	path := filepath.Join(exportDir, filename)
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "File not found"})
+		return
+	}
+
+	c.FileAttachment(path, fmt.Sprintf("notex-export-%s.zip", time.Now().Format("20060102")))
+}
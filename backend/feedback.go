@@ -0,0 +1,83 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+// maxFeedbackCommentLength bounds the comment given with a rating, in characters
+const maxFeedbackCommentLength = 2000
+
+// handleSetMessageFeedback records a thumbs up or down, with an optional comment, on an
+// assistant message. Rating a message again replaces the earlier feedback.
+func (s *Server) handleSetMessageFeedback(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	sessionID := c.Param("sessionId")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var req struct {
+		Rating  int    `json:"rating" binding:"required"`
+		Comment string `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.Rating != 1 && req.Rating != -1 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "rating must be 1 or -1"})
+		return
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	if len([]rune(req.Comment)) > maxFeedbackCommentLength {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("comment must be at most %d characters", maxFeedbackCommentLength)})
+		return
+	}
+
+	session, err := s.store.GetChatSession(ctx, sessionID)
+	if err != nil || session.NotebookID != notebookID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Chat session not found"})
+		return
+	}
+	message, err := s.store.GetChatMessage(ctx, c.Param("messageId"))
+	if err != nil || message.SessionID != sessionID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Message not found"})
+		return
+	}
+	if message.Role != "assistant" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Only assistant messages can be rated"})
+		return
+	}
+
+	message, err = s.store.SetMessageFeedback(ctx, message.ID, req.Rating, req.Comment)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save feedback"})
+		return
+	}
+
+	// Log feedback activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "message_feedback",
+		ResourceType: "chat_message",
+		ResourceID:   message.ID,
+		Details:      fmt.Sprintf(`{"notebook_id": "%s", "session_id": "%s", "rating": %d}`, notebookID, sessionID, req.Rating),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log message feedback activity: %v", err)
+	}
+
+	c.JSON(http.StatusOK, message)
+}
@@ -0,0 +1,410 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+// Flashcard export formats
+const (
+	FlashcardFormatAnki = "anki" // tab-separated text with Anki import headers
+	FlashcardFormatCSV  = "csv"
+)
+
+// flashcard is one front/back card extracted from a note
+type flashcard struct {
+	Front string
+	Back  string
+}
+
+// structuredFlashcards is the JSON shape glossary and quiz notes may be generated in
+type structuredFlashcards struct {
+	Terms []struct {
+		Term       string `json:"term"`
+		Definition string `json:"definition"`
+	} `json:"terms"`
+	Questions []struct {
+		Question    string   `json:"question"`
+		Options     []string `json:"options"`
+		Answer      string   `json:"answer"`
+		Explanation string   `json:"explanation"`
+	} `json:"questions"`
+}
+
+var (
+	// "**Term**: definition", "Term：definition", "**Term** - definition"
+	glossaryEntryPattern = regexp.MustCompile(`^\*\*(.+?)\*\*\s*(?:[:：]|\s[-–—]\s)\s*(.+)$|^([^:：*]{1,40})[:：]\s*(.+)$`)
+	listMarkerPattern    = regexp.MustCompile(`^(?:[-*+]|\d+[.)])\s+`)
+	// "1. question", "**问题 1：** question", "### Question 1) question", "第1题：question"
+	quizQuestionPattern = regexp.MustCompile(`(?i)^(?:#{1,6}\s*)?(?:\*\*)?\s*(?:问题|题目|第|question|q)?\s*(\d+)\s*(?:题)?\s*(?:\*\*)?\s*[.、:：)）]\s*(?:\*\*)?\s*(.*)$`)
+	quizAnswerPattern   = regexp.MustCompile(`(?i)^(?:[-*]\s*)?(?:\*\*)?\s*(?:正确答案|参考答案|答案|correct answer|answer)\s*(?:\*\*)?\s*[:：]\s*(?:\*\*)?\s*(.*)$`)
+	quizAnswerSection   = regexp.MustCompile(`(?i)^(?:参考)?答案(?:与解析|及解析|解析|部分)?$|^answers?(?: key)?$`)
+)
+
+// noteFlashcards extracts cards from a glossary or quiz note. Structured JSON content is
+// used when present; otherwise the markdown the prompts produce is parsed.
+func noteFlashcards(note *Note) ([]flashcard, error) {
+	if note.Type != "glossary" && note.Type != "quiz" {
+		return nil, fmt.Errorf("note type %s cannot be exported as flashcards", note.Type)
+	}
+
+	// Notes generated with response_format json keep their JSON in metadata
+	if structured, ok := note.Metadata["structured"]; ok {
+		if data, err := json.Marshal(structured); err == nil {
+			if cards, ok := structuredNoteFlashcards(string(data)); ok {
+				return cards, nil
+			}
+		}
+	}
+	if cards, ok := structuredNoteFlashcards(note.Content); ok {
+		return cards, nil
+	}
+	if note.Type == "glossary" {
+		return glossaryFlashcards(note.Content), nil
+	}
+	return quizFlashcards(note.Content), nil
+}
+
+// structuredNoteFlashcards reads cards from JSON note content
+func structuredNoteFlashcards(content string) ([]flashcard, bool) {
+	content = strings.TrimSpace(content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSpace(strings.TrimSuffix(content, "```"))
+	if !strings.HasPrefix(content, "{") {
+		return nil, false
+	}
+
+	var data structuredFlashcards
+	if err := json.Unmarshal([]byte(content), &data); err != nil {
+		return nil, false
+	}
+
+	cards := make([]flashcard, 0, len(data.Terms)+len(data.Questions))
+	for _, t := range data.Terms {
+		if t.Term != "" && t.Definition != "" {
+			cards = append(cards, flashcard{Front: t.Term, Back: t.Definition})
+		}
+	}
+	for _, q := range data.Questions {
+		if q.Question == "" || q.Answer == "" {
+			continue
+		}
+		front := q.Question
+		if len(q.Options) > 0 {
+			front += "\n" + strings.Join(q.Options, "\n")
+		}
+		back := q.Answer
+		if q.Explanation != "" {
+			back += "\n\n" + q.Explanation
+		}
+		cards = append(cards, flashcard{Front: front, Back: back})
+	}
+	return cards, true
+}
+
+// glossaryFlashcards parses term/definition pairs from markdown: "**Term**: definition"
+// list items, table rows, and headings or bold lines followed by a description
+func glossaryFlashcards(content string) []flashcard {
+	cards := make([]flashcard, 0)
+
+	var term string
+	var body []string
+	itemCards := 0
+	flush := func() {
+		if term != "" && itemCards == 0 && len(body) > 0 {
+			cards = append(cards, flashcard{Front: term, Back: strings.Join(body, "\n")})
+		}
+		term, body, itemCards = "", nil, 0
+	}
+
+	inTable := false
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			inTable = false
+			continue
+		}
+
+		if strings.HasPrefix(line, "|") {
+			cells := tableCells(line)
+			if !inTable || isTableSeparator(cells) {
+				// Header row or separator
+				inTable = true
+				continue
+			}
+			if len(body) > 0 {
+				flush()
+			}
+			if len(cells) >= 2 && cells[0] != "" {
+				cards = append(cards, flashcard{Front: stripEmphasis(cells[0]), Back: strings.Join(cells[1:], "\n")})
+				itemCards++
+			}
+			continue
+		}
+		inTable = false
+
+		if strings.HasPrefix(line, "#") {
+			flush()
+			term = stripEmphasis(strings.TrimLeft(line, "# "))
+			continue
+		}
+		if strings.HasPrefix(line, "**") && strings.HasSuffix(line, "**") && strings.Count(line, "**") == 2 {
+			flush()
+			term = stripEmphasis(line)
+			continue
+		}
+
+		item := listMarkerPattern.ReplaceAllString(line, "")
+		if m := glossaryEntryPattern.FindStringSubmatch(item); m != nil {
+			front, back := m[1], m[2]
+			if front == "" {
+				front, back = m[3], m[4]
+			}
+			// "定义：..." under a term heading describes that term
+			if term != "" && !strings.HasPrefix(item, "**") {
+				body = append(body, item)
+				continue
+			}
+			if len(body) > 0 {
+				flush()
+			}
+			cards = append(cards, flashcard{Front: stripEmphasis(front), Back: strings.TrimSpace(back)})
+			itemCards++
+			continue
+		}
+		if term != "" {
+			body = append(body, item)
+		}
+	}
+	flush()
+
+	return cards
+}
+
+// quizFlashcards parses numbered questions and their answers from markdown. Answers may
+// follow each question ("答案：B") or be listed in a separate answer section.
+func quizFlashcards(content string) []flashcard {
+	type question struct {
+		front []string
+		back  []string
+	}
+	questions := make([]*question, 0)
+	byNumber := make(map[int]*question)
+
+	var current *question
+	inAnswer := false    // collecting the answer of the current question
+	inAnswerKey := false // inside a separate answer section
+	var keyed *question  // question whose answer the answer section is describing
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		heading := strings.TrimRight(stripEmphasis(strings.TrimLeft(line, "# ")), ":：")
+		if quizAnswerSection.MatchString(heading) {
+			inAnswerKey, current, keyed = true, nil, nil
+			continue
+		}
+
+		if inAnswerKey {
+			if m := quizQuestionPattern.FindStringSubmatch(line); m != nil {
+				n, _ := strconv.Atoi(m[1])
+				keyed = byNumber[n]
+				if keyed != nil && len(keyed.back) > 0 {
+					// Already answered inline
+					keyed = nil
+				}
+				if keyed != nil {
+					keyed.back = append(keyed.back, stripEmphasis(m[2]))
+				}
+				continue
+			}
+			if keyed != nil && !strings.HasPrefix(line, "#") {
+				keyed.back = append(keyed.back, line)
+			}
+			continue
+		}
+
+		if m := quizQuestionPattern.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			current = &question{front: []string{stripEmphasis(m[2])}}
+			questions = append(questions, current)
+			if byNumber[n] == nil {
+				byNumber[n] = current
+			}
+			inAnswer = false
+			continue
+		}
+		if current == nil || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if m := quizAnswerPattern.FindStringSubmatch(line); m != nil {
+			current.back = append(current.back, stripEmphasis(m[1]))
+			inAnswer = true
+			continue
+		}
+		if inAnswer {
+			current.back = append(current.back, line)
+		} else {
+			current.front = append(current.front, line)
+		}
+	}
+
+	cards := make([]flashcard, 0, len(questions))
+	for _, q := range questions {
+		front := strings.TrimSpace(strings.Join(q.front, "\n"))
+		back := strings.TrimSpace(strings.Join(q.back, "\n"))
+		if front != "" && back != "" {
+			cards = append(cards, flashcard{Front: front, Back: back})
+		}
+	}
+	return cards
+}
+
+// tableCells splits a markdown table row into trimmed cells
+func tableCells(line string) []string {
+	line = strings.Trim(strings.TrimSpace(line), "|")
+	cells := strings.Split(line, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// isTableSeparator reports whether cells form a markdown table separator row (|---|:--:|)
+func isTableSeparator(cells []string) bool {
+	for _, cell := range cells {
+		if strings.Trim(cell, "-: ") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// stripEmphasis trims whitespace and surrounding bold markers
+func stripEmphasis(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "**")
+	s = strings.TrimSuffix(s, "**")
+	return strings.TrimSpace(s)
+}
+
+// writeAnkiCards writes cards as tab-separated text that Anki imports directly. Fields are
+// HTML so line breaks survive the import.
+func writeAnkiCards(cards []flashcard, tag string) []byte {
+	field := func(s string) string {
+		s = html.EscapeString(strings.ReplaceAll(s, "\t", " "))
+		return strings.ReplaceAll(s, "\n", "<br>")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("#separator:tab\n#html:true\n#tags column:3\n")
+	for _, card := range cards {
+		fmt.Fprintf(&buf, "%s\t%s\t%s\n", field(card.Front), field(card.Back), tag)
+	}
+	return buf.Bytes()
+}
+
+// writeCSVCards writes cards as front,back CSV rows
+func writeCSVCards(cards []flashcard) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	for _, card := range cards {
+		if err := w.Write([]string{card.Front, card.Back}); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// handleExportNote exports a glossary or quiz note as flashcards
+func (s *Server) handleExportNote(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	noteID := c.Param("noteId")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	format := c.DefaultQuery("format", FlashcardFormatAnki)
+	if format != FlashcardFormatAnki && format != FlashcardFormatCSV {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("unsupported export format: %s (supported: anki, csv)", format)})
+		return
+	}
+
+	note, err := s.store.GetNote(ctx, noteID)
+	if err != nil || note.NotebookID != notebookID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Note not found"})
+		return
+	}
+
+	cards, err := noteFlashcards(note)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Only glossary and quiz notes can be exported as flashcards",
+			Code:    "unsupported_note_type",
+			Details: err.Error(),
+		})
+		return
+	}
+	if len(cards) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{
+			Error: "No flashcards could be extracted from this note",
+			Code:  "no_flashcards",
+		})
+		return
+	}
+
+	var data []byte
+	var contentType, ext string
+	switch format {
+	case FlashcardFormatCSV:
+		data, err = writeCSVCards(cards)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export note"})
+			return
+		}
+		contentType, ext = "text/csv; charset=utf-8", ".csv"
+	default:
+		data = writeAnkiCards(cards, "notex::"+note.Type)
+		contentType, ext = "text/plain; charset=utf-8", ".txt"
+	}
+
+	// Log note export activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "export_note",
+		ResourceType: "note",
+		ResourceID:   note.ID,
+		ResourceName: note.Title,
+		Details:      fmt.Sprintf(`{"notebook_id": "%s", "format": "%s", "cards": %d}`, notebookID, format, len(cards)),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log note export activity: %v", err)
+	}
+
+	filename := slugify(note.Title) + "-" + format + ext
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Data(http.StatusOK, contentType, data)
+}
@@ -570,6 +570,23 @@ class OpenNotebook {
         }
     }
 
+    // 轮询后台任务直到结束，onProgress 接收任务的 progress
+    async waitForJob(jobId, onProgress, interval = 1000) {
+        for (;;) {
+            const job = await this.api(`/jobs/${jobId}`);
+            if (onProgress && job.progress) {
+                onProgress(job.progress);
+            }
+            if (job.status === 'done') {
+                return job.result;
+            }
+            if (job.status === 'failed' || job.status === 'cancelled') {
+                throw new Error(job.error || '任务失败');
+            }
+            await new Promise(resolve => setTimeout(resolve, interval));
+        }
+    }
+
     // Auth Methods
     async initAuth() {
         if (!this.token) {
@@ -742,6 +759,14 @@ class OpenNotebook {
     }
 
     handleLogout() {
+        // Revoke the token on the server; the local session is cleared either way
+        if (this.token) {
+            fetch('/api/auth/logout', {
+                method: 'POST',
+                headers: { 'Authorization': `Bearer ${this.token}` }
+            }).catch(() => {});
+        }
+
         this.token = null;
         this.currentUser = null;
         localStorage.removeItem('token');
@@ -1667,10 +1692,18 @@ class OpenNotebook {
             formData.append('notebook_id', this.currentNotebook.id);
 
             try {
-                await this.api('/upload', {
+                const upload = await this.api('/upload', {
                     method: 'POST',
                     body: formData,
                 });
+                if (upload && upload.job_id) {
+                    const stages = { extracting: '提取内容', ingesting: '建立索引' };
+                    await this.waitForJob(upload.job_id, progress => {
+                        if (stages[progress.stage]) {
+                            this.showLoading(`${file.name}: ${stages[progress.stage]}...`);
+                        }
+                    });
+                }
             } catch (error) {
                 this.showError(`上传失败: ${file.name} - ${error.message}`);
             }
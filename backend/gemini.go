@@ -2,11 +2,10 @@ package backend
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/kataras/golog"
@@ -16,7 +15,7 @@ import (
 
 // LLMProvider defines the interface for LLM operations
 type LLMProvider interface {
-	// GenerateImage generates an image using the provider
+	// GenerateImage generates an image using the provider and returns its storage key
 	GenerateImage(ctx context.Context, model, prompt string, userID string) (string, error)
 
 	// GenerateTextWithModel generates text using a specific model
@@ -30,16 +29,64 @@ type LLMProvider interface {
 type GeminiClient struct {
 	googleAPIKey string
 	llm          llms.Model // maybe other llm except gemini for chat/summary etc.
+	text         *GeminiTextModel
+	transport    http.RoundTripper
+	retry        imageRetryPolicy
+	storage      Storage
 }
 
 // NewGeminiClient creates a new GeminiClient
-func NewGeminiClient(googleAPIKey string, llm llms.Model) *GeminiClient {
+func NewGeminiClient(googleAPIKey string, llm llms.Model, transport http.RoundTripper, retry imageRetryPolicy, storage Storage) *GeminiClient {
 	return &GeminiClient{
 		googleAPIKey: googleAPIKey,
 		llm:          llm,
+		text:         NewGeminiTextModel(googleAPIKey, "", transport),
+		transport:    transport,
+		retry:        retry,
+		storage:      storage,
 	}
 }
 
+// imageRetryPolicy controls how failed image generation calls are retried
+type imageRetryPolicy struct {
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+// newImageRetryPolicy reads the image retry settings from cfg
+func newImageRetryPolicy(cfg Config) imageRetryPolicy {
+	return imageRetryPolicy{
+		attempts:  cfg.ImageMaxRetries + 1,
+		baseDelay: time.Duration(cfg.ImageRetryBaseDelay) * time.Millisecond,
+		maxDelay:  time.Duration(cfg.ImageRetryMaxDelay) * time.Millisecond,
+	}
+}
+
+// delay returns the wait before the given attempt: the base delay doubled for each
+// earlier retry and capped, then jittered down by up to half so parallel slide
+// generations do not retry in lockstep
+func (p imageRetryPolicy) delay(attempt int) time.Duration {
+	d := p.baseDelay
+	for i := 2; i < attempt && d < p.maxDelay; i++ {
+		d *= 2
+	}
+	if d > p.maxDelay {
+		d = p.maxDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryableImageError reports whether a failed GenerateContent call is worth retrying:
+// rate limiting, server errors and network failures are, other API errors are not
+func retryableImageError(err error) bool {
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= 500
+	}
+	return true
+}
+
 // GenerateImage generates an image using the Google GenAI SDK
 func (n *GeminiClient) GenerateImage(ctx context.Context, model, prompt string, userID string) (string, error) {
 	if n.googleAPIKey == "" {
@@ -47,14 +94,7 @@ func (n *GeminiClient) GenerateImage(ctx context.Context, model, prompt string,
 		return "", fmt.Errorf("google_api_key is not set")
 	}
 
-	httpClient := &http.Client{
-		Timeout: time.Hour, // Give the model enough time to "think"
-		Transport: &http.Transport{
-			DisableKeepAlives: false,
-			MaxIdleConns:      100,
-			IdleConnTimeout:   time.Hour,
-		},
-	}
+	httpClient := providerHTTPClient(n.transport, time.Hour) // Give the model enough time to "think"
 
 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
 		APIKey:     n.googleAPIKey,
@@ -65,11 +105,17 @@ func (n *GeminiClient) GenerateImage(ctx context.Context, model, prompt string,
 		return "", fmt.Errorf("failed to create genai client: %w", err)
 	}
 
+	attempts := n.retry.attempts
 	var lastErr error
-	for attempt := 1; attempt <= 3; attempt++ {
+	for attempt := 1; attempt <= attempts; attempt++ {
 		if attempt > 1 {
-			golog.Infof("retrying image generation (attempt %d/3)...", attempt)
-			time.Sleep(2 * time.Second)
+			delay := n.retry.delay(attempt)
+			golog.Infof("retrying image generation in %s (attempt %d/%d)...", delay.Round(time.Millisecond), attempt, attempts)
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(delay):
+			}
 		} else {
 			golog.Infof("generating images with model %s using GenerateContent...", model)
 		}
@@ -78,14 +124,21 @@ func (n *GeminiClient) GenerateImage(ctx context.Context, model, prompt string,
 		resp, err := client.Models.GenerateContent(genCtx, model, genai.Text(prompt), nil)
 		if err != nil {
 			cancel()
-			golog.Errorf("failed to generate content (attempt %d): %v", attempt, err)
+			if ctx.Err() != nil {
+				// The caller gave up, don't retry
+				return "", ctx.Err()
+			}
+			golog.Errorf("failed to generate content (attempt %d/%d): %v", attempt, attempts, err)
 			lastErr = err
+			if !retryableImageError(err) {
+				return "", fmt.Errorf("failed to generate image: %w", err)
+			}
 			continue
 		}
 
 		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
 			cancel()
-			golog.Errorf("no candidates returned by the model (attempt %d)", attempt)
+			golog.Errorf("no candidates returned by the model (attempt %d/%d)", attempt, attempts)
 			lastErr = fmt.Errorf("no candidates generated")
 			continue
 		}
@@ -100,7 +153,7 @@ func (n *GeminiClient) GenerateImage(ctx context.Context, model, prompt string,
 
 		if len(imageData) == 0 {
 			cancel()
-			golog.Errorf("no image data found in the response parts (attempt %d)", attempt)
+			golog.Errorf("no image data found in the response parts (attempt %d/%d)", attempt, attempts)
 			lastErr = fmt.Errorf("no image data in response")
 			continue
 		}
@@ -108,30 +161,11 @@ func (n *GeminiClient) GenerateImage(ctx context.Context, model, prompt string,
 		cancel()
 		golog.Infof("image data received successfully, saving...")
 
-		// Save the image to user-specific directory
-		fileName := fmt.Sprintf("infograph_%d.png", time.Now().UnixNano())
-		var uploadDir string
-		if userID != "" {
-			uploadDir = filepath.Join("./data/uploads", userID)
-		} else {
-			uploadDir = "./data/uploads"
-		}
-
-		if err := os.MkdirAll(uploadDir, 0755); err != nil {
-			return "", fmt.Errorf("failed to create upload directory: %w", err)
-		}
-
-		filePath := filepath.Join(uploadDir, fileName)
-		if err := os.WriteFile(filePath, imageData, 0644); err != nil {
-			golog.Errorf("failed to save image to %s: %v", filePath, err)
-			return "", fmt.Errorf("failed to save image: %w", err)
-		}
-
-		golog.Infof("infographic saved to %s", filePath)
-		return filePath, nil
+		// Save the image to the user's files
+		return saveGeneratedImage(ctx, n.storage, userID, imageData)
 	}
 
-	return "", fmt.Errorf("failed to generate image after 3 attempts: %w", lastErr)
+	return "", fmt.Errorf("failed to generate image after %d attempts: %w", attempts, lastErr)
 }
 
 // GenerateTextWithModel generates text using the Google GenAI SDK with a specific model
@@ -141,49 +175,17 @@ func (n *GeminiClient) GenerateTextWithModel(ctx context.Context, prompt string,
 		return "", fmt.Errorf("google_api_key is not set")
 	}
 
-	httpClient := &http.Client{
-		Timeout: 5 * time.Minute, // Give the model enough time to "think"
-		Transport: &http.Transport{
-			DisableKeepAlives: false,
-			MaxIdleConns:      100,
-			IdleConnTimeout:   5 * time.Minute,
-		},
-	}
-
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:     n.googleAPIKey,
-		Backend:    genai.BackendGeminiAPI,
-		HTTPClient: httpClient,
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to create genai client: %w", err)
-	}
-
 	golog.Infof("generating text with model %s using GenerateContent...", model)
 
 	// Set a timeout for the text generation
 	ctx, cancel := context.WithTimeout(ctx, 300*time.Second)
 	defer cancel()
 
-	resp, err := client.Models.GenerateContent(ctx, model, genai.Text(prompt), nil)
+	result, err := llms.GenerateFromSinglePrompt(ctx, n.text, prompt, llms.WithModel(model))
 	if err != nil {
 		golog.Errorf("failed to generate gemini text: %v", err)
-		return "", fmt.Errorf("failed to generate gemini text: %w", err)
-	}
-
-	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
-		golog.Errorf("no text candidates returned by the model")
-		return "", fmt.Errorf("no text generated")
+		return "", err
 	}
-
-	var textContent strings.Builder
-	for _, part := range resp.Candidates[0].Content.Parts {
-		if part.Text != "" {
-			textContent.WriteString(part.Text)
-		}
-	}
-
-	result := textContent.String()
 	if result == "" {
 		golog.Errorf("empty text content in response")
 		return "", fmt.Errorf("empty response from model")
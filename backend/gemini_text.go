@@ -0,0 +1,138 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"google.golang.org/genai"
+)
+
+// Text generation providers
+const (
+	TextProviderOpenAI = "openai" // OpenAI or an OpenAI-compatible server such as Ollama
+	TextProviderGemini = "gemini"
+)
+
+// GeminiTextModel adapts the Google GenAI SDK to the langchaingo llms.Model interface so
+// Gemini can serve transforms and chat the same way the OpenAI client does
+type GeminiTextModel struct {
+	apiKey    string
+	model     string // default model, can be overridden per call with llms.WithModel
+	transport http.RoundTripper
+
+	once      sync.Once
+	client    *genai.Client
+	clientErr error
+}
+
+var _ llms.Model = (*GeminiTextModel)(nil)
+
+// NewGeminiTextModel creates a Gemini text model. The API client is created on first use.
+func NewGeminiTextModel(apiKey, model string, transport http.RoundTripper) *GeminiTextModel {
+	return &GeminiTextModel{
+		apiKey:    apiKey,
+		model:     model,
+		transport: transport,
+	}
+}
+
+// getClient returns the shared GenAI client
+func (g *GeminiTextModel) getClient(ctx context.Context) (*genai.Client, error) {
+	g.once.Do(func() {
+		if g.apiKey == "" {
+			g.clientErr = fmt.Errorf("google_api_key is not set")
+			return
+		}
+		g.client, g.clientErr = genai.NewClient(ctx, &genai.ClientConfig{
+			APIKey:     g.apiKey,
+			Backend:    genai.BackendGeminiAPI,
+			HTTPClient: providerHTTPClient(g.transport, 5*time.Minute), // Give the model enough time to "think"
+		})
+		if g.clientErr != nil {
+			g.clientErr = fmt.Errorf("failed to create genai client: %w", g.clientErr)
+		}
+	})
+	return g.client, g.clientErr
+}
+
+// GenerateContent implements llms.Model
+func (g *GeminiTextModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	client, err := g.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := llms.CallOptions{Model: g.model}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	config := &genai.GenerateContentConfig{}
+	if opts.MaxTokens > 0 {
+		config.MaxOutputTokens = int32(opts.MaxTokens)
+	}
+	if opts.Temperature > 0 {
+		temperature := float32(opts.Temperature)
+		config.Temperature = &temperature
+	}
+	if len(opts.StopWords) > 0 {
+		config.StopSequences = opts.StopWords
+	}
+
+	var contents []*genai.Content
+	for _, msg := range messages {
+		text := messageText(msg)
+		switch msg.Role {
+		case llms.ChatMessageTypeSystem:
+			config.SystemInstruction = genai.NewContentFromText(text, genai.RoleUser)
+		case llms.ChatMessageTypeAI:
+			contents = append(contents, genai.NewContentFromText(text, genai.RoleModel))
+		default:
+			contents = append(contents, genai.NewContentFromText(text, genai.RoleUser))
+		}
+	}
+
+	resp, err := client.Models.GenerateContent(ctx, opts.Model, contents, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate gemini text: %w", err)
+	}
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return nil, fmt.Errorf("no text generated")
+	}
+
+	candidate := resp.Candidates[0]
+	var content strings.Builder
+	for _, part := range candidate.Content.Parts {
+		if part.Text != "" && !part.Thought {
+			content.WriteString(part.Text)
+		}
+	}
+
+	return &llms.ContentResponse{
+		Choices: []*llms.ContentChoice{{
+			Content:    content.String(),
+			StopReason: string(candidate.FinishReason),
+		}},
+	}, nil
+}
+
+// Call implements llms.Model
+func (g *GeminiTextModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, g, prompt, options...)
+}
+
+// messageText joins the text parts of a message
+func messageText(msg llms.MessageContent) string {
+	var b strings.Builder
+	for _, part := range msg.Parts {
+		if text, ok := part.(llms.TextContent); ok {
+			b.WriteString(text.Text)
+		}
+	}
+	return b.String()
+}
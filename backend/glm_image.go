@@ -6,8 +6,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -21,21 +19,16 @@ type GLMImageClient struct {
 	apiKey     string
 	baseURL    string
 	httpClient *http.Client
+	storage    Storage
 }
 
 // NewGLMImageClient creates a new GLM image client
-func NewGLMImageClient(apiKey string) *GLMImageClient {
+func NewGLMImageClient(apiKey string, transport http.RoundTripper, storage Storage) *GLMImageClient {
 	return &GLMImageClient{
 		apiKey: apiKey,
 		baseURL: "https://open.bigmodel.cn/api/paas/v4/images/generations",
-		httpClient: &http.Client{
-			Timeout: 5 * time.Minute,
-			Transport: &http.Transport{
-				DisableKeepAlives: false,
-				MaxIdleConns:      100,
-				IdleConnTimeout:   5 * time.Minute,
-			},
-		},
+		httpClient: providerHTTPClient(transport, 5*time.Minute),
+		storage: storage,
 	}
 }
 
@@ -141,27 +134,8 @@ func (g *GLMImageClient) GenerateImage(ctx context.Context, model, prompt string
 
 	golog.Infof("image data received successfully (%d bytes), saving...", len(imageData))
 
-	// Save the image to user-specific directory
-	fileName := fmt.Sprintf("infograph_%d.png", time.Now().UnixNano())
-	var uploadDir string
-	if userID != "" {
-		uploadDir = filepath.Join("./data/uploads", userID)
-	} else {
-		uploadDir = "./data/uploads"
-	}
-
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create upload directory: %w", err)
-	}
-
-	filePath := filepath.Join(uploadDir, fileName)
-	if err := os.WriteFile(filePath, imageData, 0644); err != nil {
-		golog.Errorf("failed to save image to %s: %v", filePath, err)
-		return "", fmt.Errorf("failed to save image: %w", err)
-	}
-
-	golog.Infof("infographic saved to %s", filePath)
-	return filePath, nil
+	// Save the image to the user's files
+	return saveGeneratedImage(ctx, g.storage, userID, imageData)
 }
 
 // GenerateTextWithModel generates text using GLM (optional, for compatibility)
@@ -0,0 +1,229 @@
+package backend
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Supported locales
+const (
+	LocaleZH = "zh"
+	LocaleEN = "en"
+)
+
+// messageCatalog holds user-facing strings per locale. Chinese is the reference
+// locale and the fallback when a key is missing in another locale.
+var messageCatalog = map[string]map[string]string{
+	LocaleZH: {
+		"note.title.summary":     "摘要",
+		"note.title.faq":         "常见问题解答",
+		"note.title.study_guide": "学习指南",
+		"note.title.outline":     "大纲",
+		"note.title.podcast":     "播客脚本",
+		"note.title.timeline":    "时间线",
+		"note.title.glossary":    "术语表",
+		"note.title.quiz":        "测验",
+		"note.title.infograph":   "信息图",
+		"note.title.ppt":         "幻灯片",
+		"note.title.mindmap":     "思维导图",
+		"note.title.insight":     "洞察报告",
+		"note.title.research":    "深度研究报告",
+		"note.title.default":     "笔记",
+
+		"source.insight_report":     "洞察报告",
+		"source.auto_summary":       "来源综合摘要",
+		"error.duplicate_note_type": "该笔记本已存在相同类型的笔记，不允许创建重复类型",
+		"error.ppt_too_many_slides": "PPT页数超过20页上限，已停止生成图片",
+		"chat.not_found_in_sources": "抱歉，在当前笔记本的来源中没有找到可以回答该问题的信息。",
+
+		"language.name":              "中文",
+		"image.language_instruction": "**注意：无论来源是什么语言，请务必使用中文**",
+	},
+	LocaleEN: {
+		"note.title.summary":     "Summary",
+		"note.title.faq":         "FAQ",
+		"note.title.study_guide": "Study Guide",
+		"note.title.outline":     "Outline",
+		"note.title.podcast":     "Podcast Script",
+		"note.title.timeline":    "Timeline",
+		"note.title.glossary":    "Glossary",
+		"note.title.quiz":        "Quiz",
+		"note.title.infograph":   "Infographic",
+		"note.title.ppt":         "Slide Deck",
+		"note.title.mindmap":     "Mind Map",
+		"note.title.insight":     "Insight Report",
+		"note.title.research":    "Research Report",
+		"note.title.default":     "Note",
+
+		"source.insight_report":     "Insight Report",
+		"source.auto_summary":       "Summary of Sources",
+		"error.duplicate_note_type": "A note of this type already exists in this notebook",
+		"error.ppt_too_many_slides": "The slide deck exceeds the page limit, image generation was skipped",
+		"chat.not_found_in_sources": "Sorry, the sources in this notebook do not contain information that answers this question.",
+
+		"language.name":              "English",
+		"image.language_instruction": "**Important: whatever the language of the sources, all text must be in English**",
+	},
+}
+
+// translate returns the message for key in the given locale, falling back to Chinese
+func translate(locale, key string) string {
+	if msg, ok := messageCatalog[locale][key]; ok {
+		return msg
+	}
+	if msg, ok := messageCatalog[LocaleZH][key]; ok {
+		return msg
+	}
+	return key
+}
+
+// normalizeLocale maps a language tag such as "en-US" or "zh_CN" to a supported locale,
+// returning "" when the language is not supported
+func normalizeLocale(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_;"); i != -1 {
+		tag = tag[:i]
+	}
+	if _, ok := messageCatalog[tag]; ok {
+		return tag
+	}
+	return ""
+}
+
+// localeFromAcceptLanguage picks the first supported locale from an Accept-Language header
+func localeFromAcceptLanguage(header string) string {
+	for _, part := range strings.Split(header, ",") {
+		if locale := normalizeLocale(part); locale != "" {
+			return locale
+		}
+	}
+	return ""
+}
+
+// resolveLocale determines the locale for a request: the user's saved setting first,
+// then the Accept-Language header, then the deployment default
+func (s *Server) resolveLocale(c *gin.Context) string {
+	if locale := s.requestLocale(c); locale != "" {
+		return locale
+	}
+	return s.cfg.DefaultLocale
+}
+
+// requestLocale returns the locale the user asked for, by saved setting or
+// Accept-Language header, or "" when the request does not name a supported one
+func (s *Server) requestLocale(c *gin.Context) string {
+	if locale := s.userLocale(c); locale != "" {
+		return locale
+	}
+	return localeFromAcceptLanguage(c.GetHeader("Accept-Language"))
+}
+
+// userLocale returns the supported locale saved in the requesting user's settings, or ""
+func (s *Server) userLocale(c *gin.Context) string {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		return ""
+	}
+	user, err := s.store.GetUser(context.Background(), userID)
+	if err != nil {
+		return ""
+	}
+	return normalizeLocale(user.Locale)
+}
+
+// supportedLocales lists the locales of the message catalog
+func supportedLocales() []string {
+	return []string{LocaleZH, LocaleEN}
+}
+
+// notebookLanguage returns the supported locale in a notebook's "language" metadata, or ""
+func (s *Server) notebookLanguage(ctx context.Context, notebookID string) string {
+	notebook, err := s.store.GetNotebook(ctx, notebookID)
+	if err != nil {
+		return ""
+	}
+	language, _ := notebook.Metadata["language"].(string)
+	return normalizeLocale(language)
+}
+
+// outputLanguage resolves the language transformations write in: the requested
+// output_language, then the notebook's "language" metadata, then Chinese
+func (s *Server) outputLanguage(ctx context.Context, notebookID, requested string) string {
+	if requested != "" {
+		return requested
+	}
+	if locale := s.notebookLanguage(ctx, notebookID); locale != "" {
+		return locale
+	}
+	return LocaleZH
+}
+
+// transformLanguage resolves the language of text generated into images: the requested
+// output_language, then the notebook's "language" metadata, then the user's saved locale,
+// then the language detected in the sources. Accept-Language, which browsers always send,
+// is only the last hint before the deployment default.
+func (s *Server) transformLanguage(ctx context.Context, c *gin.Context, notebookID string, sources []Source, requested string) string {
+	if requested != "" {
+		return requested
+	}
+	if locale := s.notebookLanguage(ctx, notebookID); locale != "" {
+		return locale
+	}
+	if locale := s.userLocale(c); locale != "" {
+		return locale
+	}
+	if locale := detectSourcesLocale(sources); locale != "" {
+		return locale
+	}
+	if locale := localeFromAcceptLanguage(c.GetHeader("Accept-Language")); locale != "" {
+		return locale
+	}
+	return s.cfg.DefaultLocale
+}
+
+// localeDetectionSample is how many characters of each source are looked at
+const localeDetectionSample = 2000
+
+// detectSourcesLocale guesses the main language of the sources from their script:
+// Chinese when Han characters make up a fair share of the letters, otherwise English.
+// It returns "" when the sources have no letters at all.
+func detectSourcesLocale(sources []Source) string {
+	han, latin := 0, 0
+	for _, src := range sources {
+		n := 0
+		for _, r := range src.Content {
+			if n >= localeDetectionSample {
+				break
+			}
+			n++
+			switch {
+			case unicode.Is(unicode.Han, r):
+				han++
+			case unicode.Is(unicode.Latin, r):
+				latin++
+			}
+		}
+	}
+
+	switch {
+	case han == 0 && latin == 0:
+		return ""
+	case han*3 >= latin: // a Han character carries roughly a word
+		return LocaleZH
+	default:
+		return LocaleEN
+	}
+}
+
+// imageLanguageInstruction is appended to image prompts so that text drawn in the image
+// is in the given language. IMAGE_LANGUAGE_INSTRUCTION overrides the built-in wording,
+// with {language} replaced by the language name.
+func imageLanguageInstruction(cfg Config, locale string) string {
+	if cfg.ImageLanguageInstruction == "" {
+		return translate(locale, "image.language_instruction")
+	}
+	return strings.ReplaceAll(cfg.ImageLanguageInstruction, "{language}", translate(locale, "language.name"))
+}
@@ -0,0 +1,365 @@
+package backend
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kataras/golog"
+)
+
+const (
+	// maxImportArchiveSize bounds the size of an uploaded notebook archive
+	maxImportArchiveSize = 512 << 20
+	// maxImportExtractedSize bounds the uncompressed size of the files in an archive
+	maxImportExtractedSize = 2 << 30
+)
+
+// NotebookImportResult describes a notebook recreated from an export archive. Sources
+// are indexed by a background job.
+type NotebookImportResult struct {
+	NotebookID  string `json:"notebook_id"`
+	Name        string `json:"name"`
+	SourceCount int    `json:"source_count"`
+	NoteCount   int    `json:"note_count"`
+	FileCount   int    `json:"file_count"`
+	JobID       string `json:"job_id"` // indexes the sources into the vector store
+}
+
+// readZipJSON decodes a JSON file of the archive
+func readZipJSON(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("%s is missing", name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return nil
+}
+
+// uniqueNotebookName appends " (2)", " (3)", ... to name until it differs from the
+// names of the user's notebooks
+func uniqueNotebookName(name string, notebooks []Notebook) string {
+	taken := make(map[string]bool, len(notebooks))
+	for _, nb := range notebooks {
+		taken[nb.Name] = true
+	}
+	candidate := name
+	for i := 2; taken[candidate]; i++ {
+		candidate = fmt.Sprintf("%s (%d)", name, i)
+	}
+	return candidate
+}
+
+// importedFileName returns the name an archived file is restored under. Content-addressed
+// blobs keep their name; other files get a fresh suffix so they cannot collide with
+// files of the account the archive was exported from.
+func importedFileName(name string) string {
+	if isContentHashFileName(name) {
+		return name
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if i := strings.LastIndex(base, "_"); i > 0 {
+		base = base[:i]
+	}
+	return fmt.Sprintf("%s_%s%s", base, uuid.New().String()[:8], ext)
+}
+
+// extractZipFile writes an archived file to path, refusing to write more than its
+// declared size so a forged header cannot fill the disk
+func extractZipFile(f *zip.File, path string) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, io.LimitReader(r, int64(f.UncompressedSize64)+1))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && uint64(n) > f.UncompressedSize64 {
+		err = fmt.Errorf("%s is larger than declared", f.Name)
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// renameFileReference rewrites a file URL or path that ends in an old file name
+func renameFileReference(ref string, renamed map[string]string) string {
+	if newName, ok := renamed[filepath.Base(ref)]; ok {
+		return strings.TrimSuffix(ref, filepath.Base(ref)) + newName
+	}
+	return ref
+}
+
+// handleImportNotebook recreates a notebook from an archive produced by the notebook
+// export. The notebook is created for the current user under a unique name; sources,
+// notes and files are restored with new IDs and the sources are re-indexed.
+func (s *Server) handleImportNotebook(c *gin.Context) {
+	ctx := context.Background()
+	userID := c.GetString("user_id")
+
+	if err := parseLimitedMultipartForm(c, maxImportArchiveSize); err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: fmt.Sprintf("Archive is larger than %d MB", maxImportArchiveSize>>20), Code: "file_too_large"})
+		return
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "No file uploaded"})
+		return
+	}
+	if file.Size > maxImportArchiveSize {
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: fmt.Sprintf("Archive is larger than %d MB", maxImportArchiveSize>>20)})
+		return
+	}
+	upload, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read archive"})
+		return
+	}
+	defer upload.Close()
+
+	zr, err := zip.NewReader(upload, file.Size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "File is not a ZIP archive"})
+		return
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	invalid := func(err error) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid notebook archive", Code: "invalid_archive", Details: err.Error()})
+	}
+
+	var manifest ExportManifest
+	if err := readZipJSON(files, "manifest.json", &manifest); err != nil {
+		invalid(err)
+		return
+	}
+	if manifest.Version < 1 || manifest.Version > exportFormatVersion {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error: fmt.Sprintf("Unsupported archive version %d (supported: 1 to %d)", manifest.Version, exportFormatVersion),
+			Code:  "unsupported_version",
+		})
+		return
+	}
+	if len(manifest.Notebooks) != 1 {
+		invalid(fmt.Errorf("the archive contains %d notebooks, expected 1", len(manifest.Notebooks)))
+		return
+	}
+	prefix := ""
+	if folder := manifest.Notebooks[0].Folder; folder != "" {
+		prefix = folder + "/"
+	}
+
+	var archived Notebook
+	var sources []Source
+	var notes []Note
+	for name, v := range map[string]interface{}{"notebook.json": &archived, "sources.json": &sources, "notes.json": &notes} {
+		if err := readZipJSON(files, prefix+name, v); err != nil {
+			invalid(err)
+			return
+		}
+	}
+
+	// Check the files before anything is created
+	var extracted uint64
+	fileNames := notebookFileNames(sources, notes)
+	for _, name := range fileNames {
+		if f, ok := files[prefix+"files/"+name]; ok {
+			extracted += f.UncompressedSize64
+		}
+	}
+	if extracted > maxImportExtractedSize {
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: fmt.Sprintf("Archive files are larger than %d MB", maxImportExtractedSize>>20)})
+		return
+	}
+
+	existing, err := s.store.ListNotebooks(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list notebooks"})
+		return
+	}
+	name := uniqueNotebookName(archived.Name, existing)
+	notebook, err := s.store.CreateNotebook(ctx, userID, name, archived.Description, archived.Metadata)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create notebook"})
+		return
+	}
+
+	var written []string // storage keys of restored files
+	fail := func(msg string, err error) {
+		golog.Errorf("failed to import notebook %s: %s: %v", notebook.ID, msg, err)
+		if _, err := s.store.PurgeNotebook(ctx, notebook.ID); err != nil {
+			golog.Errorf("failed to remove partially imported notebook %s: %v", notebook.ID, err)
+		}
+		for _, key := range written {
+			removeStored(context.Background(), s.storage, key, "imported file")
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: msg})
+	}
+
+	// Restore files first so sources and notes can point at their new names
+	renamed := make(map[string]string, len(fileNames))
+	for _, name := range fileNames {
+		f, ok := files[prefix+"files/"+name]
+		if !ok {
+			continue
+		}
+		newName := importedFileName(name)
+		key := uploadKey(userID, newName)
+		if isContentHashFileName(newName) && storageExists(ctx, s.storage, key) {
+			renamed[name] = newName
+			continue
+		}
+		path, err := newStagingPath(newName)
+		if err == nil {
+			err = extractZipFile(f, path)
+		}
+		if err == nil {
+			if err = storeFile(ctx, s.storage, key, path); err != nil {
+				os.Remove(path)
+			}
+		}
+		if err != nil {
+			fail("Failed to restore files", err)
+			return
+		}
+		written = append(written, key)
+		renamed[name] = newName
+	}
+
+	sourceIDs := make(map[string]string, len(sources))
+	imported := make([]*Source, 0, len(sources))
+	for _, src := range sources {
+		oldID := src.ID
+		source := &Source{
+			NotebookID:  notebook.ID,
+			Name:        src.Name,
+			Type:        src.Type,
+			URL:         src.URL,
+			Content:     src.Content,
+			FileName:    src.FileName,
+			FileSize:    src.FileSize,
+			ContentHash: src.ContentHash,
+			Metadata:    src.Metadata,
+		}
+		if source.Metadata == nil {
+			source.Metadata = make(map[string]interface{})
+		}
+		if newName, ok := renamed[filepath.Base(src.FileName)]; ok {
+			source.FileName = newName
+			source.Metadata["path"] = uploadKey(userID, newName)
+		}
+		if _, ok := source.Metadata["user_id"]; ok {
+			source.Metadata["user_id"] = userID
+		}
+		s.vectorStore.AssignChunkStrategy(source)
+		if err := s.store.CreateSource(ctx, source); err != nil {
+			fail("Failed to create source", err)
+			return
+		}
+		sourceIDs[oldID] = source.ID
+		imported = append(imported, source)
+	}
+
+	for _, n := range notes {
+		note := &Note{
+			NotebookID: notebook.ID,
+			Title:      n.Title,
+			Content:    n.Content,
+			Type:       n.Type,
+			SourceIDs:  make([]string, 0, len(n.SourceIDs)),
+			Metadata:   n.Metadata,
+		}
+		for _, id := range n.SourceIDs {
+			if newID, ok := sourceIDs[id]; ok {
+				note.SourceIDs = append(note.SourceIDs, newID)
+			}
+		}
+		if imageURL, ok := note.Metadata["image_url"].(string); ok {
+			note.Metadata["image_url"] = renameFileReference(imageURL, renamed)
+		}
+		if slides, ok := note.Metadata["slides"].([]interface{}); ok {
+			for i, slide := range slides {
+				if slideURL, ok := slide.(string); ok {
+					slides[i] = renameFileReference(slideURL, renamed)
+				}
+			}
+		}
+		if err := s.store.CreateNote(ctx, note); err != nil {
+			fail("Failed to create note", err)
+			return
+		}
+	}
+
+	job := s.jobs.Start(userID, notebook.ID, "import_index", func(ctx context.Context, job *Job) (interface{}, error) {
+		indexed := 0
+		for i, source := range imported {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			job.SetProgress("sources", fmt.Sprintf("%d/%d", i+1, len(imported)))
+			if source.Content == "" {
+				continue
+			}
+			if _, err := s.indexSource(ctx, source); err != nil {
+				golog.Errorf("failed to index imported source %s: %v", source.ID, err)
+				continue
+			}
+			indexed++
+		}
+		return map[string]int{"indexed_sources": indexed}, nil
+	})
+
+	// Log import activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "import_notebook",
+		ResourceType: "notebook",
+		ResourceID:   notebook.ID,
+		ResourceName: notebook.Name,
+		Details:      fmt.Sprintf(`{"sources": %d, "notes": %d, "files": %d}`, len(imported), len(notes), len(renamed)),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log notebook import activity: %v", err)
+	}
+
+	c.JSON(http.StatusCreated, NotebookImportResult{
+		NotebookID:  notebook.ID,
+		Name:        notebook.Name,
+		SourceCount: len(imported),
+		NoteCount:   len(notes),
+		FileCount:   len(renamed),
+		JobID:       job.ID,
+	})
+}
@@ -0,0 +1,148 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kataras/golog"
+)
+
+// Source metadata keys used by the ingestion retry scanner
+const (
+	sourceIngestionStatusKey   = "ingestion_status"
+	sourceIngestionAttemptsKey = "ingestion_attempts"
+	sourceIngestionRetryAtKey  = "ingestion_retry_at" // unix seconds
+	sourceExcludeFromIndexKey  = "exclude_from_index" // set by users to keep a source out of the scanner
+)
+
+// Values of the ingestion_status source metadata
+const (
+	IngestionStatusIndexed  = "indexed"
+	IngestionStatusRetrying = "retrying"
+	IngestionStatusFailed   = "failed" // gave up after INGEST_RETRY_MAX_ATTEMPTS
+)
+
+// ingestRetryMinAge keeps the scanner away from sources whose upload is still being indexed
+const ingestRetryMinAge = time.Minute
+
+// ingestRetryDelay is the backoff before the next attempt after attempts failures:
+// the scan interval, doubled for every further failure
+func ingestRetryDelay(cfg Config, attempts int) time.Duration {
+	base := time.Duration(cfg.IngestRetryInterval) * time.Minute
+	if base <= 0 {
+		base = time.Minute
+	}
+	if attempts > 8 {
+		attempts = 8
+	}
+	return base << (attempts - 1)
+}
+
+// ingestRetryLoop re-ingests failed sources at startup and then every
+// INGEST_RETRY_INTERVAL minutes
+func (s *Server) ingestRetryLoop() {
+	if s.cfg.IngestRetryOnStartup {
+		s.runIngestRetry()
+	}
+	if s.cfg.IngestRetryInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(s.cfg.IngestRetryInterval) * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.runIngestRetry()
+	}
+}
+
+// runIngestRetry runs one scan and logs its outcome
+func (s *Server) runIngestRetry() {
+	recovered, failed, err := s.retryFailedIngestion(context.Background(), time.Now())
+	if err != nil {
+		golog.Errorf("ingestion retry scan failed: %v", err)
+		return
+	}
+	if recovered > 0 || failed > 0 {
+		golog.Infof("ingestion retry: %d sources recovered, %d still failing", recovered, failed)
+	}
+}
+
+// retryFailedIngestion finds sources that have content but no chunks, meaning their
+// indexing failed when they were added, and indexes them again. Sources are skipped
+// while their backoff runs, once they are marked failed, or when flagged
+// exclude_from_index. It returns how many sources were recovered and how many failed.
+func (s *Server) retryFailedIngestion(ctx context.Context, now time.Time) (int, int, error) {
+	sources, err := s.store.Store.ListUnindexedSources(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list unindexed sources: %w", err)
+	}
+
+	recovered, failed := 0, 0
+	for i := range sources {
+		src := &sources[i]
+		if metadataBool(src.Metadata, sourceExcludeFromIndexKey) || now.Sub(src.CreatedAt) < ingestRetryMinAge {
+			continue
+		}
+		if status, _ := src.Metadata[sourceIngestionStatusKey].(string); status == IngestionStatusFailed {
+			continue
+		}
+		if retryAt, ok := src.Metadata[sourceIngestionRetryAtKey].(float64); ok && now.Before(time.Unix(int64(retryAt), 0)) {
+			continue
+		}
+
+		chunkCount, err := s.reindexSource(ctx, src)
+		if err == nil && chunkCount == 0 {
+			err = fmt.Errorf("content produced no chunks")
+		}
+
+		if err == nil {
+			src.Metadata[sourceIngestionStatusKey] = IngestionStatusIndexed
+			delete(src.Metadata, sourceIngestionAttemptsKey)
+			delete(src.Metadata, sourceIngestionRetryAtKey)
+			recovered++
+		} else {
+			attempts := 1
+			if n, ok := src.Metadata[sourceIngestionAttemptsKey].(float64); ok {
+				attempts = int(n) + 1
+			}
+			src.Metadata[sourceIngestionAttemptsKey] = attempts
+			if attempts >= s.cfg.IngestRetryMaxAttempts {
+				src.Metadata[sourceIngestionStatusKey] = IngestionStatusFailed
+				delete(src.Metadata, sourceIngestionRetryAtKey)
+				golog.Warnf("giving up indexing source %s after %d attempts: %v", src.ID, attempts, err)
+			} else {
+				src.Metadata[sourceIngestionStatusKey] = IngestionStatusRetrying
+				src.Metadata[sourceIngestionRetryAtKey] = now.Add(ingestRetryDelay(s.cfg, attempts)).Unix()
+				golog.Errorf("failed to index source %s (attempt %d): %v", src.ID, attempts, err)
+			}
+			chunkCount = 0
+			failed++
+		}
+
+		if err := s.store.UpdateSourceIngestion(ctx, src.ID, chunkCount, src.Metadata); err != nil {
+			golog.Errorf("failed to record ingestion of source %s: %v", src.ID, err)
+		}
+	}
+	return recovered, failed, nil
+}
+
+// reindexSource makes sure a source is in the vector index and returns the number of
+// chunks the index holds for it, even when ingestion fails. The notebook is loaded
+// first, which may already index the source.
+func (s *Server) reindexSource(ctx context.Context, src *Source) (int, error) {
+	s.vectorMutex.Lock()
+	defer s.vectorMutex.Unlock()
+
+	// Loading under the same lock, so the notebook cannot be evicted before the source is added
+	if err := s.ensureNotebookLoaded(ctx, src.NotebookID); err != nil {
+		return 0, err
+	}
+
+	if n := s.vectorStore.SourceChunkCounts(ctx, src.NotebookID)[src.ID]; n > 0 || src.Content == "" {
+		return n, nil
+	}
+	_, err := s.vectorStore.IngestSource(ctx, src)
+	return s.vectorStore.SourceChunkCounts(ctx, src.NotebookID)[src.ID], err
+}
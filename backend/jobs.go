@@ -0,0 +1,317 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kataras/golog"
+)
+
+// Job statuses
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusDone      = "done"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// jobRetention is how long finished jobs are kept around for polling
+const jobRetention = time.Hour
+
+// Job tracks a long-running background operation such as an async transformation
+type Job struct {
+	ID         string                 `json:"id"`
+	UserID     string                 `json:"user_id"`
+	NotebookID string                 `json:"notebook_id,omitempty"`
+	Type       string                 `json:"type"`
+	Status     string                 `json:"status"`
+	Progress   map[string]interface{} `json:"progress,omitempty"`
+	Result     interface{}            `json:"result,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+	UpdatedAt  time.Time              `json:"updated_at"`
+
+	mu        sync.Mutex
+	ctx       context.Context
+	cancel    context.CancelFunc
+	artifacts []jobArtifact // files produced so far, removed if the job is cancelled
+}
+
+// jobArtifact is a file created by a job and how to remove it
+type jobArtifact struct {
+	name   string
+	remove func() error
+}
+
+// SetProgress records a progress value that pollers can read
+func (j *Job) SetProgress(key string, value interface{}) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.Progress == nil {
+		j.Progress = make(map[string]interface{})
+	}
+	j.Progress[key] = value
+	j.UpdatedAt = time.Now()
+}
+
+// AddArtifact registers a file created by the job so it can be cleaned up on cancellation
+func (j *Job) AddArtifact(path string) {
+	j.addArtifact(path, func() error { return os.Remove(path) })
+}
+
+// AddStoredArtifact registers a file the job put in storage, see AddArtifact
+func (j *Job) AddStoredArtifact(storage Storage, key string) {
+	j.addArtifact(key, func() error { return storage.Delete(context.Background(), key) })
+}
+
+func (j *Job) addArtifact(name string, remove func() error) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.artifacts = append(j.artifacts, jobArtifact{name: name, remove: remove})
+}
+
+// snapshot returns a copy of the job's public fields that is safe to serialize
+func (j *Job) snapshot() *Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	progress := make(map[string]interface{}, len(j.Progress))
+	for k, v := range j.Progress {
+		progress[k] = v
+	}
+
+	return &Job{
+		ID:         j.ID,
+		UserID:     j.UserID,
+		NotebookID: j.NotebookID,
+		Type:       j.Type,
+		Status:     j.Status,
+		Progress:   progress,
+		Result:     j.Result,
+		Error:      j.Error,
+		CreatedAt:  j.CreatedAt,
+		UpdatedAt:  j.UpdatedAt,
+	}
+}
+
+// finished reports whether the job reached a terminal status
+func (j *Job) finished() bool {
+	return j.Status == JobStatusDone || j.Status == JobStatusFailed || j.Status == JobStatusCancelled
+}
+
+// JobFunc is the work executed by a job. It must observe ctx to support cancellation.
+type JobFunc func(ctx context.Context, job *Job) (interface{}, error)
+
+// JobManager runs and tracks background jobs in memory
+type JobManager struct {
+	mu   sync.RWMutex
+	jobs map[string]*Job
+}
+
+// NewJobManager creates a new job manager
+func NewJobManager() *JobManager {
+	m := &JobManager{
+		jobs: make(map[string]*Job),
+	}
+	// Start cleanup goroutine
+	go m.cleanupLoop()
+	return m
+}
+
+// Start registers a new job and runs fn in the background
+func (m *JobManager) Start(userID, notebookID, jobType string, fn JobFunc) *Job {
+	job := m.register(context.Background(), userID, notebookID, jobType)
+
+	go m.run(job, fn)
+
+	return job.snapshot()
+}
+
+// Begin registers a job that the caller runs itself, such as a synchronous request, so it
+// can be cancelled like a background job. The returned context ends when parent does or
+// the job is cancelled; the caller must report the outcome with Finish.
+func (m *JobManager) Begin(parent context.Context, userID, notebookID, jobType string) (*Job, context.Context) {
+	job := m.register(parent, userID, notebookID, jobType)
+	job.start()
+	return job, job.ctx
+}
+
+// Finish records the outcome of a job started with Begin
+func (m *JobManager) Finish(job *Job, result interface{}, err error) {
+	defer job.cancel()
+	job.finish(result, err)
+}
+
+// register adds a pending job whose context is derived from parent
+func (m *JobManager) register(parent context.Context, userID, notebookID, jobType string) *Job {
+	ctx, cancel := context.WithCancel(parent)
+	now := time.Now()
+	job := &Job{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		NotebookID: notebookID,
+		Type:       jobType,
+		Status:     JobStatusPending,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	m.mu.Unlock()
+
+	return job
+}
+
+// run executes the job function and records its outcome
+func (m *JobManager) run(job *Job, fn JobFunc) {
+	defer job.cancel()
+
+	job.start()
+	result, err := fn(job.ctx, job)
+	job.finish(result, err)
+}
+
+// start marks a pending job as running
+func (j *Job) start() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.Status == JobStatusPending {
+		j.Status = JobStatusRunning
+		j.UpdatedAt = time.Now()
+	}
+}
+
+// finish records the outcome of the job's work. Work that completed without an error
+// has saved its result, so the job is done even when a cancel arrived too late to stop
+// it, and the files the result references are kept.
+func (j *Job) finish(result interface{}, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.UpdatedAt = time.Now()
+	switch {
+	case err == nil:
+		j.Status = JobStatusDone
+		j.Result = result
+	case j.Status == JobStatusCancelled || errors.Is(err, context.Canceled):
+		j.Status = JobStatusCancelled
+		j.removeArtifacts()
+	default:
+		j.Status = JobStatusFailed
+		j.Error = err.Error()
+	}
+
+	golog.Infof("job %s (%s) finished with status %s", j.ID, j.Type, j.Status)
+}
+
+// removeArtifacts deletes files created by a cancelled job. Caller must hold j.mu.
+func (j *Job) removeArtifacts() {
+	for _, artifact := range j.artifacts {
+		if err := artifact.remove(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			golog.Errorf("failed to remove artifact %s of cancelled job %s: %v", artifact.name, j.ID, err)
+		}
+	}
+	j.artifacts = nil
+}
+
+// Get returns a snapshot of a job
+func (m *JobManager) Get(id string) (*Job, bool) {
+	m.mu.RLock()
+	job, ok := m.jobs[id]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return job.snapshot(), true
+}
+
+// Running returns snapshots of a user's unfinished jobs of a type in a notebook, oldest first
+func (m *JobManager) Running(userID, notebookID, jobType string) []*Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jobs := []*Job{}
+	for _, job := range m.jobs {
+		if job.UserID != userID || job.NotebookID != notebookID || job.Type != jobType {
+			continue
+		}
+		job.mu.Lock()
+		finished := job.finished()
+		job.mu.Unlock()
+		if !finished {
+			jobs = append(jobs, job.snapshot())
+		}
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].CreatedAt.Before(jobs[k].CreatedAt) })
+	return jobs
+}
+
+// Cancel signals a running job to stop and marks it cancelled. A job whose work still
+// completes, because the cancel came after its result was saved, ends up done.
+func (m *JobManager) Cancel(id string) (*Job, error) {
+	m.mu.RLock()
+	job, ok := m.jobs[id]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("job not found")
+	}
+
+	job.mu.Lock()
+	if job.finished() {
+		job.mu.Unlock()
+		return nil, fmt.Errorf("job already %s", job.Status)
+	}
+	job.Status = JobStatusCancelled
+	job.UpdatedAt = time.Now()
+	job.mu.Unlock()
+
+	// The worker observes the cancelled context and cleans up in run()
+	job.cancel()
+
+	return job.snapshot(), nil
+}
+
+// cleanupLoop periodically removes finished jobs
+func (m *JobManager) cleanupLoop() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.cleanup()
+	}
+}
+
+// cleanup removes finished jobs older than the retention period
+func (m *JobManager) cleanup() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cutoff := time.Now().Add(-jobRetention)
+	for id, job := range m.jobs {
+		job.mu.Lock()
+		expired := job.finished() && job.UpdatedAt.Before(cutoff)
+		job.mu.Unlock()
+		if expired {
+			delete(m.jobs, id)
+		}
+	}
+}
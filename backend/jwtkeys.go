@@ -0,0 +1,112 @@
+package backend
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTKeySet holds the secrets session tokens are signed with. New tokens are signed
+// with the current secret; tokens signed with a previous secret stay valid until they
+// expire, so JWT_SECRET can be rotated without logging everyone out.
+type JWTKeySet struct {
+	currentID string
+	secrets   map[string][]byte // by key ID
+	order     []string          // key IDs, current first
+}
+
+// NewJWTKeySet creates a key set that signs with current and also accepts previous
+func NewJWTKeySet(current string, previous []string) *JWTKeySet {
+	ks := &JWTKeySet{secrets: make(map[string][]byte)}
+	for _, secret := range append([]string{current}, previous...) {
+		if secret == "" {
+			continue
+		}
+		kid := jwtKeyID(secret)
+		if _, ok := ks.secrets[kid]; ok {
+			continue
+		}
+		ks.secrets[kid] = []byte(secret)
+		ks.order = append(ks.order, kid)
+	}
+	if len(ks.order) > 0 {
+		ks.currentID = ks.order[0]
+	}
+	return ks
+}
+
+// jwtKeyID derives the public key ID of a secret, so operators do not have to name keys
+func jwtKeyID(secret string) string {
+	sum := sha256.Sum256([]byte("notex-jwt-kid:" + secret))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Sign signs claims with the current secret and records its key ID in the "kid" header
+func (ks *JWTKeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = ks.currentID
+	return token.SignedString(ks.secrets[ks.currentID])
+}
+
+// Keyfunc selects the verification secret of a token by its "kid" header. Tokens issued
+// before key IDs were added are checked against every secret in the set.
+func (ks *JWTKeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	if kid, ok := token.Header["kid"].(string); ok {
+		secret, ok := ks.secrets[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id: %s", kid)
+		}
+		return secret, nil
+	}
+
+	keys := jwt.VerificationKeySet{Keys: make([]jwt.VerificationKey, 0, len(ks.order))}
+	for _, kid := range ks.order {
+		keys.Keys = append(keys.Keys, ks.secrets[kid])
+	}
+	return keys, nil
+}
+
+// Parse parses and validates a token signed with any secret in the set
+func (ks *JWTKeySet) Parse(tokenString string, opts ...jwt.ParserOption) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, ks.Keyfunc, opts...)
+}
+
+// MAC computes a hex HMAC-SHA256 of message with the current secret
+func (ks *JWTKeySet) MAC(message string) string {
+	return macHex(ks.secrets[ks.currentID], message)
+}
+
+// VerifyMAC reports whether mac was computed over message with any secret in the set,
+// so links signed before a rotation keep working like tokens do
+func (ks *JWTKeySet) VerifyMAC(message, mac string) bool {
+	for _, kid := range ks.order {
+		if hmac.Equal([]byte(macHex(ks.secrets[kid], message)), []byte(mac)) {
+			return true
+		}
+	}
+	return false
+}
+
+func macHex(secret []byte, message string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// JWTKeys returns the key set for JWT_SECRET and JWT_PREVIOUS_SECRETS
+func (c *Config) JWTKeys() *JWTKeySet {
+	return NewJWTKeySet(c.JWTSecret, c.JWTPreviousSecrets)
+}
+
+// JWTExpiry returns the lifetime of new session tokens
+func (c *Config) JWTExpiry() time.Duration {
+	return time.Duration(c.JWTExpiryHours) * time.Hour
+}
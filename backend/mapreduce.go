@@ -0,0 +1,174 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kataras/golog"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/prompts"
+)
+
+// transformOutputReserve is the number of tokens of the context window kept free for the
+// generated note
+const transformOutputReserve = 8192
+
+// maxMapReduceRounds bounds how often batch summaries are condensed again when they
+// still do not fit together
+const maxMapReduceRounds = 3
+
+// promptBudget returns how many tokens of a prompt like the given one a model accepts while
+// leaving room for the output
+func promptBudget(cfg Config, model, prompt string) int {
+	window := modelContextWindow(cfg, model, prompt)
+	reserve := transformOutputReserve
+	if reserve > window/2 {
+		reserve = window / 2
+	}
+	return window - reserve
+}
+
+// mapReduceSources condenses sources that do not fit into one prompt. Sources are
+// summarized in batches that each fit the budget, and the batch summaries are
+// summarized again until they fit together. It returns the condensed sources and
+// the number of summaries generated.
+func (a *Agent) mapReduceSources(ctx context.Context, transformType string, sources []Source, budget int) ([]Source, int, error) {
+	// Room for the sources once the map prompt itself is accounted for
+	batchBudget := budget - estimateTokens(mapReducePrompt()) - 256
+	if batchBudget < 1024 {
+		return nil, 0, fmt.Errorf("context window too small to summarize sources")
+	}
+	// buildSourceContext truncates a source at MaxContextLength characters, so parts stay below it
+	partBudget := batchBudget
+	if limit := a.cfg.MaxContextLength / 4; limit > 0 && limit < partBudget {
+		partBudget = limit
+	}
+
+	calls := 0
+	for round := 1; round <= maxMapReduceRounds; round++ {
+		batches := batchSources(sources, batchBudget, partBudget)
+		golog.Infof("map-reduce round %d: condensing %d sources in %d batches for %s", round, len(sources), len(batches), transformType)
+
+		summaries := make([]Source, 0, len(batches))
+		for i, batch := range batches {
+			summary, err := a.summarizeBatch(ctx, transformType, batch)
+			if err != nil {
+				return nil, calls, fmt.Errorf("failed to summarize batch %d: %w", i+1, err)
+			}
+			calls++
+			summaries = append(summaries, Source{
+				ID:      fmt.Sprintf("batch-%d-%d", round, i+1),
+				Name:    batchName(batch),
+				Type:    "summary",
+				Content: summary,
+			})
+		}
+
+		sources = summaries
+		if estimateTokens(a.buildSourceContext(sources)) <= batchBudget {
+			break
+		}
+	}
+	return sources, calls, nil
+}
+
+// summarizeBatch condenses one batch of sources
+func (a *Agent) summarizeBatch(ctx context.Context, transformType string, batch []Source) (string, error) {
+	prompt := prompts.NewPromptTemplate(mapReducePrompt(), []string{"type", "sources"})
+	prompt.TemplateFormat = prompts.TemplateFormatFString
+
+	promptValue, err := prompt.Format(map[string]any{
+		"type":    transformType,
+		"sources": a.buildSourceContext(batch),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to format prompt: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 300*time.Second)
+	defer cancel()
+
+	return llms.GenerateFromSinglePrompt(ctx, a.llm, promptValue)
+}
+
+// batchSources groups sources into batches of at most maxTokens. Sources longer than
+// partTokens are split into parts first.
+func batchSources(sources []Source, maxTokens, partTokens int) [][]Source {
+	var batches [][]Source
+	var current []Source
+	currentTokens := 0
+	for _, src := range sources {
+		parts := splitByTokens(src.Content, partTokens)
+		for i, part := range parts {
+			piece := src
+			piece.Content = part
+			if len(parts) > 1 {
+				piece.Name = fmt.Sprintf("%s (%d/%d)", src.Name, i+1, len(parts))
+			}
+
+			tokens := estimateTokens(part) + estimateTokens(piece.Name) + 8
+			if len(current) > 0 && currentTokens+tokens > maxTokens {
+				batches = append(batches, current)
+				current, currentTokens = nil, 0
+			}
+			current = append(current, piece)
+			currentTokens += tokens
+		}
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// splitByTokens splits text into parts of at most maxTokens, preferring to break at
+// a line boundary in the second half of a part
+func splitByTokens(text string, maxTokens int) []string {
+	if estimateTokens(text) <= maxTokens {
+		return []string{text}
+	}
+
+	var parts []string
+	runes := []rune(text)
+	for len(runes) > 0 {
+		cjk, other, end, lastBreak := 0, 0, 0, -1
+		for end < len(runes) {
+			if isCJK(runes[end]) {
+				cjk++
+			} else {
+				other++
+			}
+			if cjk+(other+3)/4 > maxTokens {
+				break
+			}
+			if runes[end] == '\n' && end > 0 {
+				lastBreak = end
+			}
+			end++
+		}
+		if end < len(runes) && lastBreak > end/2 {
+			end = lastBreak + 1
+		}
+		if end == 0 {
+			end = 1
+		}
+		parts = append(parts, string(runes[:end]))
+		runes = runes[end:]
+	}
+	return parts
+}
+
+// batchName describes the sources a batch summary was made from
+func batchName(batch []Source) string {
+	names := make([]string, 0, len(batch))
+	seen := make(map[string]bool)
+	for _, src := range batch {
+		if !seen[src.Name] {
+			seen[src.Name] = true
+			names = append(names, src.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
@@ -17,33 +17,43 @@ import (
 var auditLogger *golog.Logger
 
 func init() {
-	// Create audit logger
+	// Create audit logger; it writes to stdout until ConfigureAuditLog adds the log files
 	auditLogger = golog.New()
+	auditLogger.SetOutput(os.Stdout)
 
+	// Set audit logger configuration
+	auditLogger.SetLevel("info")
+	auditLogger.SetTimeFormat("2006-01-02 15:04:05")
+}
+
+// ConfigureAuditLog writes the audit log to rotated files under ./logs as well as stdout.
+// Files rotate every AuditLogRotationHours, or sooner once they reach AuditLogMaxSizeMB,
+// and are removed after AuditLogMaxAgeDays.
+func ConfigureAuditLog(cfg Config) {
 	// Create logs directory if not exists
 	if err := os.MkdirAll("./logs", 0755); err != nil {
 		golog.Errorf("failed to create logs directory: %v", err)
 	}
 
-	// Setup log rotation
+	// Name files by hour when they rotate more often than daily, so each period gets its own file.
+	// Files rotated for size within a period get a .1, .2, ... suffix.
 	logFiles := "./logs/audit.log.%Y%m%d"
+	if cfg.AuditLogRotationHours%24 != 0 {
+		logFiles = "./logs/audit.log.%Y%m%d%H"
+	}
 	writer, err := rotatelogs.New(
 		logFiles,
 		rotatelogs.WithLinkName("./logs/audit.log"),
-		rotatelogs.WithMaxAge(time.Duration(7)*24*time.Hour),
-		rotatelogs.WithRotationTime(24*time.Hour),
+		rotatelogs.WithMaxAge(time.Duration(cfg.AuditLogMaxAgeDays)*24*time.Hour),
+		rotatelogs.WithRotationTime(time.Duration(cfg.AuditLogRotationHours)*time.Hour),
+		rotatelogs.WithRotationSize(int64(cfg.AuditLogMaxSizeMB)<<20),
 	)
 	if err != nil {
 		golog.Errorf("failed to create rotatelogs writer: %v", err)
-		auditLogger.SetOutput(os.Stdout)
-	} else {
-		// Write to both file and stdout
-		auditLogger.SetOutput(io.MultiWriter(writer, os.Stdout))
+		return
 	}
-
-	// Set audit logger configuration
-	auditLogger.SetLevel("info")
-	auditLogger.SetTimeFormat("2006-01-02 15:04:05")
+	// Write to both file and stdout
+	auditLogger.SetOutput(io.MultiWriter(writer, os.Stdout))
 }
 
 // getClientIP extracts the real client IP from the request, taking into account
@@ -179,8 +189,9 @@ func AuditMiddlewareLite() gin.HandlerFunc {
 	}
 }
 		
-		// AuthMiddleware authenticates requests using JWT
-		func AuthMiddleware(secret string) gin.HandlerFunc {
+		// AuthMiddleware authenticates requests using JWT. Tokens on the revocation list
+		// are rejected.
+		func AuthMiddleware(keys *JWTKeySet, store *Store) gin.HandlerFunc {
 			return func(c *gin.Context) {
 				tokenString := c.GetHeader("Authorization")
 				if tokenString == "" {
@@ -193,12 +204,7 @@ func AuditMiddlewareLite() gin.HandlerFunc {
 					tokenString = tokenString[7:]
 				}
 
-				token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-					if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-						return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-					}
-					return []byte(secret), nil
-				})
+				token, err := keys.Parse(tokenString)
 
 				if err != nil {
 					c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -211,6 +217,21 @@ func AuditMiddlewareLite() gin.HandlerFunc {
 						c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
 						return
 					}
+					if jti, ok := claims["jti"].(string); ok {
+						revoked, err := store.IsTokenRevoked(c.Request.Context(), jti)
+						if err != nil {
+							c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+							return
+						}
+						if revoked {
+							c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked", "code": "token_revoked"})
+							return
+						}
+						c.Set("token_id", jti)
+						if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+							c.Set("token_expires_at", exp.Time)
+						}
+					}
 					c.Set("user_id", userID)
 				} else {
 					c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -221,9 +242,21 @@ func AuditMiddlewareLite() gin.HandlerFunc {
 			}
 		}
 
+		// AdminMiddleware rejects requests from users who are not administrators.
+		// It must run after AuthMiddleware.
+		func AdminMiddleware(cfg Config, store *Store) gin.HandlerFunc {
+			return func(c *gin.Context) {
+				if !isAdminUser(c.Request.Context(), cfg, store, c.GetString("user_id")) {
+					c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: "Admin access required"})
+					return
+				}
+				c.Next()
+			}
+		}
+
 		// OptionalAuthMiddleware tries to authenticate using JWT, but doesn't require it
 		// It supports Authorization header, cookie, and token URL parameter
-		func OptionalAuthMiddleware(secret string) gin.HandlerFunc {
+		func OptionalAuthMiddleware(keys *JWTKeySet, store *Store) gin.HandlerFunc {
 			return func(c *gin.Context) {
 				var tokenString string
 
@@ -261,12 +294,7 @@ func AuditMiddlewareLite() gin.HandlerFunc {
 				}
 
 				// Try to validate token
-				token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-					if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-						return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-					}
-					return []byte(secret), nil
-				})
+				token, err := keys.Parse(tokenString)
 
 				if err != nil {
 					// Invalid token, continue without setting user_id
@@ -276,6 +304,14 @@ func AuditMiddlewareLite() gin.HandlerFunc {
 				}
 
 				if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+					if jti, ok := claims["jti"].(string); ok {
+						if revoked, err := store.IsTokenRevoked(c.Request.Context(), jti); err != nil || revoked {
+							// Revoked token, continue without setting user_id
+							auditLogger.Infof("OptionalAuth: Revoked token")
+							c.Next()
+							return
+						}
+					}
 					if userID, ok := claims["user_id"].(string); ok {
 						auditLogger.Infof("OptionalAuth: Successfully authenticated user_id: %s", userID)
 						c.Set("user_id", userID)
@@ -0,0 +1,200 @@
+package backend
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ways a model is used by notex
+const (
+	ModelUseChat      = "chat"
+	ModelUseTransform = "transform"
+	ModelUseImage     = "image"
+)
+
+// Approximate relative cost of a model
+const (
+	CostTierLocal   = "local" // self-hosted, no per-token cost
+	CostTierLow     = "low"
+	CostTierMedium  = "medium"
+	CostTierHigh    = "high"
+	CostTierUnknown = "unknown"
+)
+
+// modelCapabilities describes what a model family can do
+type modelCapabilities struct {
+	prefix         string
+	contextWindow  int // tokens, 0 for image models
+	supportsImages bool
+	supportsTools  bool
+	costTier       string
+}
+
+// knownModels lists capabilities by model name prefix. More specific prefixes come
+// first because the first match wins.
+var knownModels = []modelCapabilities{
+	{prefix: "gpt-4o-mini", contextWindow: 128000, supportsImages: true, supportsTools: true, costTier: CostTierLow},
+	{prefix: "gpt-4o", contextWindow: 128000, supportsImages: true, supportsTools: true, costTier: CostTierMedium},
+	{prefix: "gpt-4.1-nano", contextWindow: 1047576, supportsImages: true, supportsTools: true, costTier: CostTierLow},
+	{prefix: "gpt-4.1-mini", contextWindow: 1047576, supportsImages: true, supportsTools: true, costTier: CostTierLow},
+	{prefix: "gpt-4.1", contextWindow: 1047576, supportsImages: true, supportsTools: true, costTier: CostTierMedium},
+	{prefix: "gpt-4-turbo", contextWindow: 128000, supportsImages: true, supportsTools: true, costTier: CostTierHigh},
+	{prefix: "gpt-4", contextWindow: 8192, supportsTools: true, costTier: CostTierHigh},
+	{prefix: "gpt-3.5-turbo", contextWindow: 16385, supportsTools: true, costTier: CostTierLow},
+	{prefix: "gemini-3-pro", contextWindow: 1048576, supportsImages: true, supportsTools: true, costTier: CostTierHigh},
+	{prefix: "gemini-3-flash", contextWindow: 1048576, supportsImages: true, supportsTools: true, costTier: CostTierLow},
+	{prefix: "gemini-2.5-pro", contextWindow: 1048576, supportsImages: true, supportsTools: true, costTier: CostTierHigh},
+	{prefix: "gemini-2.5-flash", contextWindow: 1048576, supportsImages: true, supportsTools: true, costTier: CostTierLow},
+	{prefix: "gemini-2.0-flash", contextWindow: 1048576, supportsImages: true, supportsTools: true, costTier: CostTierLow},
+	{prefix: "llama3", contextWindow: 128000, supportsTools: true, costTier: CostTierLocal},
+	{prefix: "qwen", contextWindow: 32768, supportsTools: true, costTier: CostTierLocal},
+	{prefix: "glm-image", costTier: CostTierMedium},
+	{prefix: "z-image", costTier: CostTierLow},
+}
+
+// lookupModel returns the known capabilities of a model, if any
+func lookupModel(model string) (modelCapabilities, bool) {
+	model = strings.ToLower(model)
+	for _, caps := range knownModels {
+		if strings.HasPrefix(model, caps.prefix) {
+			return caps, true
+		}
+	}
+	return modelCapabilities{}, false
+}
+
+// modelContextWindow returns the number of tokens a text model accepts, capped by
+// MAX_CONTEXT_LENGTH. Unknown models are assumed to accept MAX_CONTEXT_LENGTH. The setting
+// is in characters; it is converted to tokens for text like sample, see charsToTokens.
+func modelContextWindow(cfg Config, model, sample string) int {
+	limit := charsToTokens(cfg.MaxContextLength, sample)
+	caps, ok := lookupModel(model)
+	if !ok || caps.contextWindow == 0 || caps.contextWindow > limit {
+		return limit
+	}
+	return caps.contextWindow
+}
+
+// charsToTokens converts a length in characters to tokens, counted as estimateTokens
+// counts sample: a CJK character is a token, other text takes four characters a token.
+// Without a sample the text is assumed not to be CJK.
+func charsToTokens(chars int, sample string) int {
+	runes := utf8.RuneCountInString(sample)
+	if runes == 0 {
+		return (chars + 3) / 4
+	}
+	return int(int64(chars) * int64(estimateTokens(sample)) / int64(runes))
+}
+
+// textProviderName returns the provider serving text generation
+func textProviderName(cfg Config) string {
+	if cfg.TextProvider == TextProviderGemini {
+		return TextProviderGemini
+	}
+	if cfg.IsOllama() {
+		return "ollama"
+	}
+	return TextProviderOpenAI
+}
+
+// newModelInfo describes a configured model for the models endpoint
+func newModelInfo(cfg Config, id, provider string, uses []string, isDefault bool) ModelInfo {
+	info := ModelInfo{
+		ID:       id,
+		Provider: provider,
+		Uses:     uses,
+		Default:  isDefault,
+		CostTier: CostTierUnknown,
+	}
+	caps, known := lookupModel(id)
+	if known {
+		info.SupportsImages = caps.supportsImages
+		info.SupportsTools = caps.supportsTools
+		info.CostTier = caps.costTier
+	}
+	if provider == "ollama" {
+		info.CostTier = CostTierLocal
+	}
+	if uses[0] != ModelUseImage {
+		info.ContextWindow = modelContextWindow(cfg, id, "")
+		if !known && provider != TextProviderGemini {
+			info.SupportsTools = cfg.SupportsFunctionCalling()
+		}
+	}
+	return info
+}
+
+// availableModels lists the models this server is configured to use: the text model and
+// the ALLOWED_MODELS alternatives for chat and transformations, the Gemini slide deck
+// model when a Google API key is set, and the image model of IMAGE_PROVIDER
+func availableModels(cfg Config, textModel string) []ModelInfo {
+	provider := textProviderName(cfg)
+	textUses := []string{ModelUseChat, ModelUseTransform}
+
+	var models []ModelInfo
+	ids := textModels(cfg, textModel)
+	for i, id := range ids {
+		models = append(models, newModelInfo(cfg, id, provider, textUses, i == 0))
+	}
+
+	if cfg.GoogleAPIKey != "" && !slices.Contains(ids, pptTextModel) {
+		models = append(models, newModelInfo(cfg, pptTextModel, TextProviderGemini, []string{ModelUseTransform}, false))
+	}
+
+	imageModel := cfg.GeminiImageModel
+	imageProvider := "gemini"
+	switch cfg.ImageProvider {
+	case "glm":
+		imageModel, imageProvider = cfg.GLMImageModel, "glm"
+	case "zimage":
+		imageModel, imageProvider = cfg.ZImageModel, "zimage"
+	case "openai":
+		imageModel, imageProvider = cfg.OpenAIImageModel, "openai"
+	}
+	models = append(models, newModelInfo(cfg, imageModel, imageProvider, []string{ModelUseImage}, true))
+
+	return models
+}
+
+// requestModelKey is the request context key holding the text model a chat request picked
+const requestModelKey = "request_model"
+
+// textModels returns the text models requests may pick: the configured one and the
+// ALLOWED_MODELS alternatives
+func textModels(cfg Config, textModel string) []string {
+	models := []string{textModel}
+	for _, id := range cfg.AllowedModels {
+		if !slices.Contains(models, id) {
+			models = append(models, id)
+		}
+	}
+	return models
+}
+
+// checkRequestModel answers 400 and returns false when a request picked a text model that
+// is not available. An empty model selects the configured one.
+func (s *Server) checkRequestModel(c *gin.Context, model string) bool {
+	if model == "" {
+		return true
+	}
+	available := textModels(s.cfg, s.agent.textModelName())
+	if slices.Contains(available, model) {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, ErrorResponse{
+		Error:   fmt.Sprintf("unknown or unavailable model: %s", model),
+		Code:    "invalid_model",
+		Details: "available: " + strings.Join(available, ", "),
+	})
+	return false
+}
+
+// handleListModels lists the configured models and their capabilities
+func (s *Server) handleListModels(c *gin.Context) {
+	c.JSON(http.StatusOK, availableModels(s.cfg, s.agent.textModelName()))
+}
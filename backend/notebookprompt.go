@@ -0,0 +1,38 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// systemPromptKey is the notebook metadata key holding custom chat instructions, e.g. to
+// answer as a tutor or as a legal assistant
+const systemPromptKey = "system_prompt"
+
+// maxSystemPromptLength is the longest custom system prompt, in characters
+const maxSystemPromptLength = 4000
+
+// parseSystemPrompt reads a notebook's custom system prompt from a metadata value. An
+// empty prompt means the built-in one is used alone.
+func parseSystemPrompt(value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	prompt, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string", systemPromptKey)
+	}
+	prompt = strings.TrimSpace(prompt)
+	if n := utf8.RuneCountInString(prompt); n > maxSystemPromptLength {
+		return "", fmt.Errorf("%s is %d characters long, at most %d are allowed", systemPromptKey, n, maxSystemPromptLength)
+	}
+	return prompt, nil
+}
+
+// notebookSystemPrompt returns the custom system prompt of a notebook
+func notebookSystemPrompt(notebook *Notebook) string {
+	// An invalid stored prompt is ignored rather than failing chat
+	prompt, _ := parseSystemPrompt(notebook.Metadata[systemPromptKey])
+	return prompt
+}
@@ -0,0 +1,79 @@
+package backend
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// oauthStateCookie holds the signed state of a login in progress
+	oauthStateCookie = "notex_oauth_state"
+	// oauthStateTTL is how long a user has to complete a login at the provider
+	oauthStateTTL = 10 * time.Minute
+)
+
+// newOAuthState returns a random state parameter for an authorization request
+func newOAuthState() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// setOAuthState starts a login: it generates a state for the provider and stores it in a
+// short-lived cookie signed with the JWT keys, binding the callback to this browser
+func (h *AuthHandler) setOAuthState(c *gin.Context, provider, redirectURL string) (string, error) {
+	state, err := newOAuthState()
+	if err != nil {
+		return "", err
+	}
+	signed, err := h.config.JWTKeys().Sign(jwt.MapClaims{
+		"purpose":  "oauth_state",
+		"state":    state,
+		"provider": provider,
+		"exp":      time.Now().Add(oauthStateTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Lax, not Strict: the provider's redirect back is a cross-site top-level navigation
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, signed, int(oauthStateTTL.Seconds()), "/auth/callback",
+		"", strings.HasPrefix(redirectURL, "https://"), true)
+	return state, nil
+}
+
+// verifyOAuthState checks the state returned to the callback against the cookie set when
+// the login started. The cookie is cleared either way, so a state is only used once.
+func (h *AuthHandler) verifyOAuthState(c *gin.Context, provider string) error {
+	signed, err := c.Cookie(oauthStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, "", -1, "/auth/callback", "", false, true)
+	if err != nil || signed == "" {
+		return fmt.Errorf("login session not found or expired")
+	}
+
+	token, err := h.config.JWTKeys().Parse(signed, jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return fmt.Errorf("login session not found or expired")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != "oauth_state" || claims["provider"] != provider {
+		return fmt.Errorf("login session does not match this provider")
+	}
+	expected, _ := claims["state"].(string)
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(c.Query("state"))) != 1 {
+		return fmt.Errorf("state parameter does not match")
+	}
+	return nil
+}
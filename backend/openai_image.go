@@ -0,0 +1,146 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kataras/golog"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// OpenAIImageClient generates images through the OpenAI images API, or any server that
+// implements it
+type OpenAIImageClient struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+	storage    Storage
+}
+
+// NewOpenAIImageClient creates a client for the images API under baseURL, e.g.
+// https://api.openai.com/v1
+func NewOpenAIImageClient(apiKey, baseURL string, transport http.RoundTripper, storage Storage) *OpenAIImageClient {
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	return &OpenAIImageClient{
+		apiKey:     apiKey,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: providerHTTPClient(transport, 5*time.Minute),
+		storage:    storage,
+	}
+}
+
+// GenerateImage generates an image and saves it in the user's files. The
+// image is taken from b64_json when the server returns it, otherwise downloaded from url.
+func (o *OpenAIImageClient) GenerateImage(ctx context.Context, model, prompt string, userID string) (string, error) {
+	requestBody := map[string]interface{}{
+		"model":  model,
+		"prompt": prompt,
+		"n":      1,
+		"size":   "1024x1024",
+	}
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	golog.Infof("generating image with OpenAI-compatible model %s...", model)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.baseURL+"/images/generations", bytes.NewReader(jsonBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data []struct {
+			B64JSON string `json:"b64_json"`
+			URL     string `json:"url"`
+		} `json:"data"`
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			Code    string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || result.Error.Message != "" {
+		golog.Errorf("OpenAI image API error: %d - %s", resp.StatusCode, result.Error.Message)
+		return "", fmt.Errorf("OpenAI image API error (%d): %s", resp.StatusCode, result.Error.Message)
+	}
+	if len(result.Data) == 0 {
+		return "", fmt.Errorf("no image in response")
+	}
+
+	var imageData []byte
+	switch {
+	case result.Data[0].B64JSON != "":
+		imageData, err = base64.StdEncoding.DecodeString(result.Data[0].B64JSON)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode image data: %w", err)
+		}
+	case result.Data[0].URL != "":
+		imageData, err = o.download(ctx, result.Data[0].URL)
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("no image in response")
+	}
+
+	golog.Infof("image data received successfully (%d bytes), saving...", len(imageData))
+
+	// Save the image to the user's files
+	return saveGeneratedImage(ctx, o.storage, userID, imageData)
+}
+
+// download fetches an image the API returned by URL
+func (o *OpenAIImageClient) download(ctx context.Context, imageURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download image, status: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image data: %w", err)
+	}
+	return data, nil
+}
+
+// GenerateTextWithModel is not supported, text goes through the TEXT_PROVIDER model
+func (o *OpenAIImageClient) GenerateTextWithModel(ctx context.Context, prompt string, model string) (string, error) {
+	return "", fmt.Errorf("OpenAI image client does not support text generation")
+}
+
+// GenerateFromSinglePrompt generates text (optional, for compatibility)
+func (o *OpenAIImageClient) GenerateFromSinglePrompt(ctx context.Context, llm llms.Model, prompt string, options ...llms.CallOption) (string, error) {
+	return "", fmt.Errorf("OpenAI image client does not support text generation")
+}
@@ -0,0 +1,169 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// sourceAlwaysIncludeKey is the source metadata flag for reference material, such as a
+// glossary or style guide, that is put in front of every chat and transformation
+// regardless of retrieval
+const sourceAlwaysIncludeKey = "always_include"
+
+// pinnedSources returns the sources flagged always_include. Their content is cut to fit
+// within budget tokens in total; sources past the budget are left out.
+func pinnedSources(sources []Source, budget int) []Source {
+	pinned := make([]Source, 0)
+	remaining := budget
+	for _, src := range sources {
+		if !metadataBool(src.Metadata, sourceAlwaysIncludeKey) {
+			continue
+		}
+		if remaining <= 0 {
+			golog.Warnf("always-include source %s left out, PINNED_SOURCE_BUDGET of %d tokens used up", src.ID, budget)
+			continue
+		}
+		if tokens := estimateTokens(src.Content); tokens > remaining {
+			golog.Infof("always-include source %s truncated from ~%d to %d tokens", src.ID, tokens, remaining)
+			src.Content = splitByTokens(src.Content, remaining)[0]
+		}
+		remaining -= estimateTokens(src.Content)
+		pinned = append(pinned, src)
+	}
+	return pinned
+}
+
+// withPinnedSources puts the pinned sources in front of sources. Pinned sources already
+// selected keep their full content; the others are added.
+func withPinnedSources(pinned, sources []Source) []Source {
+	selected := make(map[string]int, len(sources))
+	for i, src := range sources {
+		selected[src.ID] = i
+	}
+
+	result := make([]Source, 0, len(pinned)+len(sources))
+	isPinned := make(map[string]bool, len(pinned))
+	for _, src := range pinned {
+		isPinned[src.ID] = true
+		if i, ok := selected[src.ID]; ok {
+			result = append(result, sources[i])
+		} else {
+			result = append(result, src)
+		}
+	}
+	for _, src := range sources {
+		if !isPinned[src.ID] {
+			result = append(result, src)
+		}
+	}
+	return result
+}
+
+// prependPinnedDocs puts the pinned sources in front of the retrieved chunks, dropping
+// chunks whose text is already part of a pinned source
+func prependPinnedDocs(notebookID string, pinned []Source, docs []schema.Document) []schema.Document {
+	result := make([]schema.Document, 0, len(pinned)+len(docs))
+	for _, src := range pinned {
+		result = append(result, schema.Document{
+			PageContent: src.Content,
+			Metadata: map[string]any{
+				"notebook_id":          notebookID,
+				"source_id":            src.ID,
+				"source":               src.Name,
+				sourceAlwaysIncludeKey: true,
+				"start":                0,
+				"end":                  utf8.RuneCountInString(src.Content),
+			},
+		})
+	}
+
+	for _, doc := range docs {
+		duplicate := false
+		for _, src := range pinned {
+			if sourceID, _ := doc.Metadata["source_id"].(string); sourceID == src.ID && strings.Contains(src.Content, doc.PageContent) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			result = append(result, doc)
+		}
+	}
+	return result
+}
+
+// notebookPinnedSources loads the always-include sources of a notebook
+func (s *Server) notebookPinnedSources(ctx context.Context, notebookID string) []Source {
+	sources, err := s.store.ListSources(ctx, notebookID)
+	if err != nil {
+		golog.Errorf("failed to list sources of notebook %s: %v", notebookID, err)
+		return nil
+	}
+	return pinnedSources(sources, s.cfg.PinnedSourceBudget)
+}
+
+// handleUpdateSource changes a source's settings. Currently only the always_include flag.
+func (s *Server) handleUpdateSource(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	sourceID := c.Param("sourceId")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var req struct {
+		AlwaysInclude *bool `json:"always_include"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	source, err := s.store.GetSource(ctx, sourceID)
+	if err != nil || source.NotebookID != notebookID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Source not found"})
+		return
+	}
+
+	if req.AlwaysInclude != nil {
+		if source.Metadata == nil {
+			source.Metadata = make(map[string]interface{})
+		}
+		if *req.AlwaysInclude {
+			source.Metadata[sourceAlwaysIncludeKey] = true
+		} else {
+			delete(source.Metadata, sourceAlwaysIncludeKey)
+		}
+		if err := s.store.UpdateSourceMetadata(ctx, sourceID, source.Metadata); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update source"})
+			return
+		}
+
+		// Log source update activity
+		activityLog := &ActivityLog{
+			UserID:       userID,
+			Action:       "update_source",
+			ResourceType: "source",
+			ResourceID:   sourceID,
+			ResourceName: source.Name,
+			Details:      fmt.Sprintf(`{"notebook_id": "%s", "always_include": %t}`, notebookID, *req.AlwaysInclude),
+			IPAddress:    c.ClientIP(),
+			UserAgent:    c.GetHeader("User-Agent"),
+		}
+		if err := s.store.LogActivity(ctx, activityLog); err != nil {
+			golog.Errorf("failed to log source update activity: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, source)
+}
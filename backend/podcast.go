@@ -0,0 +1,427 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+// podcastDefaultsKey is the notebook metadata key holding its podcast defaults
+const podcastDefaultsKey = "podcast_defaults"
+
+// Voices supported by the text-to-speech model
+var podcastVoices = []string{"alloy", "ash", "coral", "echo", "fable", "nova", "onyx", "sage", "shimmer"}
+
+// Podcast styles understood by the script prompt
+var podcastStyles = []string{"conversational", "interview", "debate", "lecture", "storytelling"}
+
+// Limits of the podcast settings
+const (
+	maxPodcastSpeakers     = 4
+	maxPodcastTargetLength = 60 // minutes
+)
+
+// Built-in podcast settings used when neither the request nor the notebook sets them
+const (
+	defaultPodcastSpeakers     = 2
+	defaultPodcastTargetLength = 12
+	defaultPodcastStyle        = "conversational"
+)
+
+// validate checks the fields that are set
+func (p *PodcastSettings) validate() error {
+	if p.Voice != "" && !slices.Contains(podcastVoices, p.Voice) {
+		return fmt.Errorf("unsupported voice %q (supported: %s)", p.Voice, strings.Join(podcastVoices, ", "))
+	}
+	if p.Speakers < 0 || p.Speakers > maxPodcastSpeakers {
+		return fmt.Errorf("speakers must be between 1 and %d", maxPodcastSpeakers)
+	}
+	if p.TargetLength < 0 || p.TargetLength > maxPodcastTargetLength {
+		return fmt.Errorf("target_length must be between 1 and %d minutes", maxPodcastTargetLength)
+	}
+	if p.Style != "" && !slices.Contains(podcastStyles, p.Style) {
+		return fmt.Errorf("unsupported style %q (supported: %s)", p.Style, strings.Join(podcastStyles, ", "))
+	}
+	return nil
+}
+
+// withDefaults returns the settings with the fields left unset taken from defaults
+func (p PodcastSettings) withDefaults(defaults PodcastSettings) PodcastSettings {
+	if p.Voice == "" {
+		p.Voice = defaults.Voice
+	}
+	if p.Speakers == 0 {
+		p.Speakers = defaults.Speakers
+	}
+	if p.TargetLength == 0 {
+		p.TargetLength = defaults.TargetLength
+	}
+	if p.Style == "" {
+		p.Style = defaults.Style
+	}
+	return p
+}
+
+// parsePodcastSettings reads podcast settings from a metadata value
+func parsePodcastSettings(value interface{}) (PodcastSettings, error) {
+	var settings PodcastSettings
+	if value == nil {
+		return settings, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return settings, err
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return settings, fmt.Errorf("invalid %s: %w", podcastDefaultsKey, err)
+	}
+	return settings, settings.validate()
+}
+
+// notebookPodcastDefaults returns the notebook's podcast defaults completed with the
+// built-in ones
+func (s *Server) notebookPodcastDefaults(notebook *Notebook) PodcastSettings {
+	var settings PodcastSettings
+	if notebook != nil {
+		// Invalid stored defaults are ignored rather than failing generation
+		settings, _ = parsePodcastSettings(notebook.Metadata[podcastDefaultsKey])
+	}
+	return settings.withDefaults(PodcastSettings{
+		Voice:        s.cfg.PodcastVoice,
+		Speakers:     defaultPodcastSpeakers,
+		TargetLength: defaultPodcastTargetLength,
+		Style:        defaultPodcastStyle,
+	})
+}
+
+// resolvePodcastSettings fills the fields a podcast request leaves out from the
+// notebook's defaults
+func (s *Server) resolvePodcastSettings(ctx context.Context, notebookID string, req *PodcastSettings) (*PodcastSettings, error) {
+	var settings PodcastSettings
+	if req != nil {
+		if err := req.validate(); err != nil {
+			return nil, err
+		}
+		settings = *req
+	}
+
+	notebook, err := s.store.GetNotebook(ctx, notebookID)
+	if err != nil {
+		return nil, fmt.Errorf("notebook not found")
+	}
+	settings = settings.withDefaults(s.notebookPodcastDefaults(notebook))
+	return &settings, nil
+}
+
+// handleGetPodcastSettings returns the podcast defaults of a notebook, completed with the
+// built-in ones for fields the notebook does not set
+func (s *Server) handleGetPodcastSettings(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, c.GetString("user_id")); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	notebook, err := s.store.GetNotebook(ctx, notebookID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Notebook not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, s.notebookPodcastDefaults(notebook))
+}
+
+// handleUpdatePodcastSettings replaces the podcast defaults of a notebook. Fields left
+// out fall back to the built-in defaults.
+func (s *Server) handleUpdatePodcastSettings(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, c.GetString("user_id")); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var req PodcastSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	notebook, err := s.store.GetNotebook(ctx, notebookID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Notebook not found"})
+		return
+	}
+	metadata := notebook.Metadata
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	metadata[podcastDefaultsKey] = req
+
+	notebook, err = s.store.UpdateNotebook(ctx, notebookID, notebook.Name, notebook.Description, metadata)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update podcast settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, s.notebookPodcastDefaults(notebook))
+}
+
+// Values of Podcast.Status, in the order a podcast goes through them
+const (
+	PodcastStatusPending    = "pending"
+	PodcastStatusGenerating = "generating"
+	PodcastStatusReady      = "ready"
+	PodcastStatusError      = "error"
+)
+
+// podcastTimeout bounds writing the script and reading it aloud
+const podcastTimeout = 20 * time.Minute
+
+// podcastJobKey is the podcast metadata key holding the ID of the job generating it,
+// which can be cancelled through the jobs API
+const podcastJobKey = "job_id"
+
+// handleCreatePodcast starts generating a podcast from the notebook's sources. The
+// podcast is returned right away with status pending; clients poll it until it is
+// ready, when its audio_url is set, or error. It is generated by a podcast job, whose
+// ID is in the podcast metadata.
+func (s *Server) handleCreatePodcast(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	if !s.cfg.EnablePodcast {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Podcast generation is disabled"})
+		return
+	}
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var req struct {
+		Title     string   `json:"title"`
+		SourceIDs []string `json:"source_ids"` // empty = all sources
+		PodcastSettings
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	settings, err := s.resolvePodcastSettings(ctx, notebookID, &req.PodcastSettings)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	sources, err := s.store.ListSources(ctx, notebookID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get sources"})
+		return
+	}
+	if len(req.SourceIDs) > 0 {
+		if req.SourceIDs, err = validateNoteSourceIDs(req.SourceIDs, sources); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		wanted := make(map[string]bool, len(req.SourceIDs))
+		for _, id := range req.SourceIDs {
+			wanted[id] = true
+		}
+		filtered := make([]Source, 0, len(req.SourceIDs))
+		for _, src := range sources {
+			if wanted[src.ID] {
+				filtered = append(filtered, src)
+			}
+		}
+		sources = filtered
+	} else {
+		req.SourceIDs = make([]string, len(sources))
+		for i, src := range sources {
+			req.SourceIDs[i] = src.ID
+		}
+	}
+	if len(sources) == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "No sources available"})
+		return
+	}
+
+	charge, ok := s.consumeQuota(c, userID, QuotaKindTransform)
+	if !ok {
+		return
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = getTitleForType("podcast", s.resolveLocale(c))
+	}
+	podcast := &Podcast{
+		NotebookID: notebookID,
+		Title:      title,
+		Voice:      settings.Voice,
+		Status:     PodcastStatusPending,
+		SourceIDs:  req.SourceIDs,
+		Metadata: map[string]interface{}{
+			"speakers":      settings.Speakers,
+			"target_length": settings.TargetLength,
+			"style":         settings.Style,
+		},
+	}
+	if err := s.store.CreatePodcast(ctx, podcast); err != nil {
+		charge.release(s.store)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create podcast"})
+		return
+	}
+
+	// Log podcast creation activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "create_podcast",
+		ResourceType: "podcast",
+		ResourceID:   podcast.ID,
+		ResourceName: podcast.Title,
+		Details:      fmt.Sprintf(`{"notebook_id": "%s", "voice": "%s", "source_count": %d}`, notebookID, podcast.Voice, len(sources)),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log podcast creation activity: %v", err)
+	}
+
+	// The job saves its own copy of the podcast as it goes
+	generating := *podcast
+	generating.Metadata = maps.Clone(podcast.Metadata)
+	job := s.jobs.Start(userID, notebookID, "podcast", func(ctx context.Context, job *Job) (interface{}, error) {
+		generating.Metadata[podcastJobKey] = job.ID
+		return s.generatePodcast(ctx, &generating, sources, settings, userID, charge)
+	})
+	podcast.Metadata[podcastJobKey] = job.ID
+
+	c.JSON(http.StatusAccepted, podcast)
+}
+
+// generatePodcast writes the script of a podcast and reads it aloud, saving the
+// progress on the podcast as it goes. A podcast whose job is cancelled ends with
+// status error.
+func (s *Server) generatePodcast(ctx context.Context, podcast *Podcast, sources []Source, settings *PodcastSettings, userID string, charge *quotaCharge) (*Podcast, error) {
+	ctx, cancel := context.WithTimeout(ctx, podcastTimeout)
+	defer cancel()
+
+	save := func() {
+		if err := s.store.UpdatePodcast(context.Background(), podcast); err != nil {
+			golog.Errorf("failed to update podcast %s: %v", podcast.ID, err)
+		}
+	}
+	fail := func(err error) (*Podcast, error) {
+		golog.Errorf("podcast %s failed: %v", podcast.ID, err)
+		podcast.Status = PodcastStatusError
+		podcast.Metadata["error"] = err.Error()
+		save()
+		charge.release(s.store)
+		return nil, err
+	}
+
+	podcast.Status = PodcastStatusGenerating
+	save()
+
+	script, err := s.agent.GeneratePodcastScript(ctx, sources, settings)
+	if err != nil {
+		return fail(fmt.Errorf("failed to generate script: %w", err))
+	}
+	// Save the script first so it can be read while the audio is generated
+	podcast.Script = script
+	save()
+
+	audioPath, err := s.agent.GeneratePodcastAudio(ctx, script, podcast.Voice, userID)
+	if err != nil {
+		return fail(fmt.Errorf("failed to generate audio: %w", err))
+	}
+
+	podcast.AudioURL = s.storage.URL(audioPath)
+	podcast.Duration = estimateSpeechSeconds(speechText(script))
+	podcast.Status = PodcastStatusReady
+	save()
+	golog.Infof("podcast %s is ready (%ds)", podcast.ID, podcast.Duration)
+	return podcast, nil
+}
+
+// failInterruptedPodcasts marks the podcasts that were still being generated when the
+// server stopped as failed, since their jobs are gone and they would never finish
+func (s *Server) failInterruptedPodcasts(ctx context.Context) {
+	n, err := s.store.FailUnfinishedPodcasts(ctx, "generation was interrupted by a server restart")
+	if err != nil {
+		golog.Errorf("failed to mark interrupted podcasts as failed: %v", err)
+		return
+	}
+	if n > 0 {
+		golog.Warnf("marked %d interrupted podcasts as failed", n)
+	}
+}
+
+// handleListPodcasts lists a notebook's podcasts, newest first
+func (s *Server) handleListPodcasts(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, c.GetString("user_id")); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	podcasts, err := s.store.ListPodcasts(ctx, notebookID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list podcasts"})
+		return
+	}
+
+	respondList(c, podcasts)
+}
+
+// handleGetPodcast returns a podcast, which clients poll while it is generated
+func (s *Server) handleGetPodcast(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, c.GetString("user_id")); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	podcast, err := s.store.GetPodcast(ctx, c.Param("podcastId"))
+	if err != nil || podcast.NotebookID != notebookID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Podcast not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, podcast)
+}
+
+// podcastByFileName finds the podcast whose audio is the given uploaded file, and its
+// notebook. It returns nils when no podcast uses the file.
+func (s *Server) podcastByFileName(ctx context.Context, filename string) (*Podcast, *Notebook) {
+	podcast, err := s.store.GetPodcastByAudioURL(ctx, "/api/files/"+filename)
+	if err != nil {
+		return nil, nil
+	}
+	notebook, err := s.store.GetNotebook(ctx, podcast.NotebookID)
+	if err != nil {
+		return nil, nil
+	}
+	return podcast, notebook
+}
@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// maxDisplayNameLength is the number of characters kept of a display name
+const maxDisplayNameLength = 64
+
+// maxAvatarURLLength is the longest avatar URL accepted from an OAuth provider
+const maxAvatarURLLength = 2048
+
+// sanitizeDisplayName cleans a display name returned by an OAuth provider: control and
+// HTML-significant characters are dropped, whitespace is collapsed and the result is
+// cut to maxDisplayNameLength characters. An empty result falls back to the local
+// part of the email address.
+func sanitizeDisplayName(name, email string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsSpace(r):
+			b.WriteRune(' ')
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r):
+		case strings.ContainsRune("<>\"'`&", r):
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	cleaned := []rune(strings.Join(strings.Fields(b.String()), " "))
+	if len(cleaned) > maxDisplayNameLength {
+		cleaned = []rune(strings.TrimSpace(string(cleaned[:maxDisplayNameLength])))
+	}
+	if len(cleaned) > 0 {
+		return string(cleaned)
+	}
+
+	if local, _, ok := strings.Cut(email, "@"); ok && local != "" {
+		return sanitizeDisplayName(local, "")
+	}
+	return "user"
+}
+
+// sanitizeAvatarURL returns the avatar URL if it is an absolute http(s) URL, otherwise
+// the configured default avatar
+func sanitizeAvatarURL(raw, defaultURL string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || len(raw) > maxAvatarURLLength {
+		return defaultURL
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return defaultURL
+	}
+	return u.String()
+}
@@ -49,7 +49,7 @@ func getTransformationPrompt(transformType string) string {
 
 func summaryPrompt() string {
 	return `你是一个擅长创建综合摘要的专家。请根据以下来源，以{format}格式创建一个{length}摘要。
-**注意：无论来源是什么语言，请务必使用中文进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
+**注意：无论来源是什么语言，请务必使用{language}进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
 
 来源：
 {sources}
@@ -59,7 +59,7 @@ func summaryPrompt() string {
 
 func faqPrompt() string {
 	return `你是一个擅长创建常见问题解答（FAQ）文档的专家。请根据以下来源，以{format}格式生成一个全面的FAQ。
-**注意：无论来源是什么语言，请务必使用中文进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
+**注意：无论来源是什么语言，请务必使用{language}进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
 
 来源：
 {sources}
@@ -69,7 +69,7 @@ func faqPrompt() string {
 
 func studyGuidePrompt() string {
 	return `你是一个教育专家。请根据以下来源，以{format}格式创建一个全面的学习指南。
-**注意：无论来源是什么语言，请务必使用中文进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
+**注意：无论来源是什么语言，请务必使用{language}进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
 
 来源：
 {sources}
@@ -86,7 +86,7 @@ func studyGuidePrompt() string {
 
 func outlinePrompt() string {
 	return `你是一个擅长创建结构化大纲的专家。请根据以下来源，以{format}格式创建一个详细的层级大纲。
-**注意：无论来源是什么语言，请务必使用中文进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
+**注意：无论来源是什么语言，请务必使用{language}进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
 
 来源：
 {sources}
@@ -100,7 +100,7 @@ func outlinePrompt() string {
 
 func podcastPrompt() string {
 	return `你是一个播客脚本编剧。请根据以下来源创建一个引人入胜的播客脚本。
-**注意：无论来源是什么语言，请务必使用中文进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
+**注意：无论来源是什么语言，请务必使用{language}进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
 
 来源：
 {sources}
@@ -108,17 +108,18 @@ func podcastPrompt() string {
 脚本应：
 - 具有对话性和吸引力
 - 涵盖来源中的主要主题
-- 包括两位主持人讨论材料
-- 口语时长约为10-15分钟
+- 包括{speakers}位主持人讨论材料
+- 口语时长约为{duration}分钟
+- 采用{style}风格（conversational=轻松对话，interview=访谈，debate=辩论，lecture=讲解，storytelling=讲故事）
 - 包含自然的过渡和提问
 - 有清晰的开场白和结束语
 
-请将其格式化为带有演讲者标签（主持人1，主持人2）和[括号]中舞台指示的播客脚本。`
+请将其格式化为带有演讲者标签（主持人1，主持人2……）和[括号]中舞台指示的播客脚本。`
 }
 
 func timelinePrompt() string {
 	return `你是一个擅长创建按时间顺序排列的时间线的专家。请根据以下来源，以{format}格式创建一个时间线。
-**注意：无论来源是什么语言，请务必使用中文进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
+**注意：无论来源是什么语言，请务必使用{language}进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
 
 来源：
 {sources}
@@ -132,7 +133,7 @@ func timelinePrompt() string {
 
 func glossaryPrompt() string {
 	return `你是一个擅长创建术语表的专家。请根据以下来源，以{format}格式创建一个全面的术语表。
-**注意：无论来源是什么语言，请务必使用中文进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
+**注意：无论来源是什么语言，请务必使用{language}进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
 
 来源：
 {sources}
@@ -146,7 +147,7 @@ func glossaryPrompt() string {
 
 func quizPrompt() string {
 	return `你是一个创建评估材料的教育家。请根据以下来源，以{format}格式创建一个测验。
-**注意：无论来源是什么语言，请务必使用中文进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
+**注意：无论来源是什么语言，请务必使用{language}进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
 
 来源：
 {sources}
@@ -162,7 +163,7 @@ func quizPrompt() string {
 
 func mindmapPrompt() string {
 	return `你是一位资深的信息架构师和知识管理专家。请将【文本内容】提炼并转换为 Mermaid.js 的 mindmap 格式。
-**注意：无论来源是什么语言，请务必使用中文进行回复。**
+**注意：无论来源是什么语言，请务必使用{language}进行回复。**
 
 # 样式规范：
 1. **中心主题**：必须使用 root((内容)) 格式（圆圈）。
@@ -227,7 +228,7 @@ func pptPrompt() string {
 
 我们将把这个大纲提供给专业设计师来制作最终成品。
 
-幻灯片内容应使用  中文。占位符应保留为 中文。
+幻灯片内容应使用 {language}。占位符应保留为 {language}。
 
 ---
 
@@ -391,7 +392,7 @@ func pptPrompt() string {
 
 func customPrompt() string {
 	return `你是一个有用的助手。根据以下来源和自定义请求，生成请求的内容。
-**注意：无论来源是什么语言，请务必使用中文进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
+**注意：无论来源是什么语言，请务必使用{language}进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
 
 来源：
 {sources}
@@ -404,7 +405,7 @@ func customPrompt() string {
 
 func insightPrompt() string {
 	return `你是一个擅长创建综合摘要的专家。请根据以下来源，生成一个简洁的摘要。
-**注意：无论来源是什么语言，请务必使用中文进行回复。**
+**注意：无论来源是什么语言，请务必使用{language}进行回复。**
 
 来源：
 {sources}
@@ -414,7 +415,7 @@ func insightPrompt() string {
 
 func defaultPrompt() string {
 	return `你是一个有用的助手。根据以下来源，以{format}格式提供一个{type}。
-**注意：无论来源是什么语言，请务必使用中文进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
+**注意：无论来源是什么语言，请务必使用{language}进行回复。不要使用 ` + "```markdown" + ` 标记包裹输出。**
 
 来源：
 {sources}
@@ -422,6 +423,85 @@ func defaultPrompt() string {
 生成{length}内容。`
 }
 
+// Prompt used to continue a note that was cut off at the model's output limit
+func continuationPrompt() string {
+	return `以下是根据来源生成的{type}笔记，但由于输出长度限制在中途被截断了。请从截断的地方继续写完。
+**注意：请使用与已有内容相同的语言、格式和风格。只输出续写的部分，不要重复已有内容，也不要添加任何说明。不要使用 ` + "```markdown" + ` 标记包裹输出。**
+
+来源：
+{sources}
+
+已有内容：
+{content}`
+}
+
+func autoSummaryPrompt() string {
+	return `请为以下所有来源写一份简明的综合摘要，供后续检索和问答使用。
+**注意：请使用来源的主要语言。按主题组织内容，覆盖每个来源的核心观点、关键事实、数据和术语，并指出来源之间的联系与分歧。不要添加来源中没有的信息，也不要使用 ` + "```markdown" + ` 标记包裹输出。**
+
+来源：
+{sources}`
+}
+
+// Prompt used to condense one batch of sources when all sources do not fit the context window
+func mapReducePrompt() string {
+	return `以下来源是一个较大笔记本的一部分，稍后将与其他部分的摘要合并，用于生成{type}笔记。请将这些来源压缩为详细的摘要。
+**注意：请使用来源的主要语言。保留生成{type}所需的全部核心观点、关键事实、数据、日期、术语和定义，并注明各信息出自哪个来源。不要添加来源中没有的信息，也不要使用 ` + "```markdown" + ` 标记包裹输出。**
+
+来源：
+{sources}`
+}
+
+// Instructions appended to a formatted transformation prompt when JSON output is
+// requested. They are filled with fmt, not as prompt templates, because the JSON
+// schema contains braces.
+func structuredOutputInstruction() string {
+	return `
+
+**输出格式要求：忽略上面关于 Markdown 或排版格式的要求，只输出一个符合以下 JSON Schema 的 JSON 对象。不要输出任何解释，也不要使用代码块标记包裹输出。所有字段的内容仍须遵守上面关于语言和内容的要求。**
+
+JSON Schema：
+%s`
+}
+
+func structuredRetryInstruction() string {
+	return `
+
+上面的输出不符合 JSON Schema，存在以下问题：
+%s
+
+请修正这些问题，重新输出完整的 JSON 对象，不要输出任何其他内容。`
+}
+
+// Prompts for deep research runs: plan sub-questions, answer each from retrieved
+// chunks, then synthesize a report
+func researchPlanPrompt() string {
+	return `你是一名研究助理。请把下面的研究问题拆解为最多 {max_steps} 个相互独立、可以分别从资料中检索回答的子问题，按回答的先后顺序排列。
+**注意：请使用研究问题的语言。每行只写一个子问题，不要编号，不要添加任何其他说明。**
+
+研究问题：{question}`
+}
+
+func researchStepPrompt() string {
+	return `请仅根据以下来源回答子问题。引用来源中的信息时，请使用 [来源 N] 标注出处。如果来源中没有相关信息，请明确说明。
+**注意：请使用子问题的语言，回答简明扼要。不要使用 ` + "```markdown" + ` 标记包裹输出。**
+
+来源：
+{context}
+
+子问题：{question}`
+}
+
+func researchSynthesisPrompt() string {
+	return `你是一名研究助理。以下是围绕一个研究问题的各个子问题及其基于资料的回答。请综合这些发现，撰写一份结构清晰的研究报告。
+**注意：请使用研究问题的语言。报告应包含概述、按主题组织的主要发现和结论，并指出资料中未能回答的部分。不要添加发现中没有的信息，也不要使用 ` + "```markdown" + ` 标记包裹输出。**
+
+研究问题：{question}
+
+子问题与发现：
+{findings}`
+}
+
 // Chat system prompt
 func chatSystemPrompt() string {
 	return `你是一个笔记本应用程序的有用人工智能助手。根据提供的上下文和聊天历史记录回答用户的问题。
@@ -438,3 +518,89 @@ func chatSystemPrompt() string {
 
 请提供有用的、准确的回答。当引用来源中的信息时，请提及信息来自哪个来源。`
 }
+
+// Custom instructions of a notebook put in front of the chat prompt. They are concatenated,
+// not formatted as a template, since they may contain braces.
+func chatNotebookInstructions(instructions string) string {
+	return "本笔记本的自定义指令（回答时请遵循）：\n" + instructions + "\n\n"
+}
+
+// Instructions appended to the chat prompt when tool-use mode is enabled
+func chatToolInstructions() string {
+	return `
+
+可用工具：
+- calculator(表达式)：计算四则运算，支持 + - * / % ^ 和括号，例如 CALL calculator((1250 - 300) * 0.15)
+- date_diff(开始日期, 结束日期)：计算两个日期之间相差的天数，日期格式为 YYYY-MM-DD，例如 CALL date_diff(2024-01-01, 2024-03-15)
+- date_add(日期, 偏移量)：计算日期加上偏移量后的日期，偏移量单位为 d/w/m/y（天/周/月/年），可为负数，例如 CALL date_add(2024-01-01, 30d)
+
+如果回答需要进行数值计算或日期计算，请不要自己心算，而是只输出一行或多行工具调用（每行一个，格式为 CALL 工具名(参数)），不要输出其他内容。
+收到工具结果后，再根据结果给出最终回答。如果不需要计算，请直接回答。`
+}
+
+// Prompt appended after tool calls to feed their results back to the model
+func chatToolResultsPrompt(results string) string {
+	return `
+
+工具结果：
+` + results + `
+请根据以上工具结果继续回答用户的问题。如仍需计算，可以继续调用工具。`
+}
+
+// Prompt appended when the model has used up its tool rounds
+func chatToolFinalPrompt() string {
+	return `
+
+请不要再调用工具，根据已有的信息和工具结果直接给出最终回答。`
+}
+
+// chatSessionTitlePrompt asks for a short title of a conversation from its first question
+func chatSessionTitlePrompt(message string) string {
+	return `请为以下对话起一个简短的标题，概括用户想了解的内容。
+要求：
+- 使用与用户提问相同的语言。
+- 不超过 20 个字（英文不超过 8 个单词）。
+- 只输出标题本身，不要加引号、标点结尾或任何解释。
+
+用户提问：
+` + message
+}
+
+// chatHistorySummaryPrompt asks for the running summary of a conversation to be
+// extended with the messages that follow it
+func chatHistorySummaryPrompt(summary, messages string) string {
+	if summary == "" {
+		summary = "（无）"
+	}
+	return `请将以下对话的已有摘要与新的对话内容合并为一份新的摘要，供后续对话参考。
+要求：
+- 保留用户的问题、关注点、已得出的结论以及仍未解决的问题。
+- 使用与对话相同的语言，不超过 300 字。
+- 只输出摘要本身，不要加标题或任何解释。
+
+已有摘要：
+` + summary + `
+
+新的对话内容：
+` + messages
+}
+
+// Chat prompt used when the notebook has strict grounding enabled. It answers in the
+// request's {language}, like the localized notFoundMessage.
+func chatStrictGroundingPrompt(notFoundMessage string) string {
+	return `你是一个笔记本应用程序的人工智能助手，只能依据提供的上下文回答用户的问题。
+**无论来源文件是什么语言，请务必使用{language}回答用户的问题。不要使用 ` + "```markdown" + ` 标记包裹输出。**
+
+严格规则：
+- 只能使用上下文中的信息作答，不得使用常识或外部知识进行补充。
+- 每一个事实性陈述都必须使用 [来源 N] 的格式标注引用，其中 N 为上下文中的来源编号。
+- 如果上下文中没有足够的信息回答该问题，请只回复：` + notFoundMessage + `
+
+聊天历史记录：
+{history}
+
+上下文：
+{context}
+
+用户问题：{question}`
+}
@@ -0,0 +1,145 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+// Daily quota kinds
+const (
+	QuotaKindTransform = "transform"
+	QuotaKindChat      = "chat"
+	QuotaKindImage     = "image"
+)
+
+// quotaKinds lists the kinds reported by the me endpoint
+var quotaKinds = []string{QuotaKindTransform, QuotaKindChat, QuotaKindImage}
+
+// quotaDay returns the usage day of t. Days are counted in UTC.
+func quotaDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// quotaResetAt returns when the usage day containing t ends
+func quotaResetAt(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+// transformQuotaKind returns the quota a transformation type counts against
+func transformQuotaKind(transformType string) string {
+	if transformType == "infograph" || transformType == "ppt" {
+		return QuotaKindImage
+	}
+	return QuotaKindTransform
+}
+
+// dailyQuotaLimit returns the configured daily limit for a kind (0 = unlimited)
+func dailyQuotaLimit(cfg Config, kind string) int {
+	switch kind {
+	case QuotaKindTransform:
+		return cfg.DailyTransformQuota
+	case QuotaKindChat:
+		return cfg.DailyChatQuota
+	case QuotaKindImage:
+		return cfg.DailyImageQuota
+	}
+	return 0
+}
+
+// dailyQuotaStatus reports a user's usage and remaining quota for today
+func dailyQuotaStatus(ctx context.Context, cfg Config, store *Store, user *User) (*QuotaStatus, error) {
+	now := time.Now()
+	day := quotaDay(now)
+	usage, err := store.GetDailyUsage(ctx, user.ID, day)
+	if err != nil {
+		return nil, err
+	}
+
+	admin := userIsAdmin(cfg, user)
+	status := &QuotaStatus{
+		Day:     day,
+		ResetAt: quotaResetAt(now),
+		Exempt:  admin,
+		Kinds:   make(map[string]QuotaUsage, len(quotaKinds)),
+	}
+	for _, kind := range quotaKinds {
+		q := QuotaUsage{Used: usage[kind], Remaining: -1}
+		if !admin {
+			q.Limit = dailyQuotaLimit(cfg, kind)
+		}
+		if q.Limit > 0 {
+			q.Remaining = q.Limit - q.Used
+			if q.Remaining < 0 {
+				q.Remaining = 0
+			}
+		}
+		status.Kinds[kind] = q
+	}
+	return status, nil
+}
+
+// quotaCharge is one generation counted against a user's daily quota
+type quotaCharge struct {
+	UserID string
+	Day    string
+	Kind   string
+}
+
+// release gives the charge back, e.g. when the generation failed
+func (q *quotaCharge) release(store *CachedStore) {
+	if q == nil {
+		return
+	}
+	if err := store.ReleaseDailyUsage(context.Background(), q.UserID, q.Day, q.Kind); err != nil {
+		golog.Errorf("failed to release %s quota for user %s: %v", q.Kind, q.UserID, err)
+	}
+}
+
+// chargeQuota counts a generation against the user's daily quota. It returns false and
+// the limit that was reached when the quota is used up. Admins are counted but never
+// limited.
+func (s *Server) chargeQuota(ctx context.Context, userID, kind string) (*quotaCharge, int, bool) {
+	charge := &quotaCharge{UserID: userID, Day: quotaDay(time.Now()), Kind: kind}
+
+	limit := dailyQuotaLimit(s.cfg, kind)
+	if limit > 0 && s.isAdmin(ctx, userID) {
+		limit = 0
+	}
+
+	ok, err := s.store.ConsumeDailyUsage(ctx, userID, charge.Day, kind, limit)
+	if err != nil {
+		// Do not block generations because usage bookkeeping failed
+		golog.Errorf("failed to record %s usage for user %s: %v", kind, userID, err)
+		return nil, limit, true
+	}
+	if !ok {
+		return nil, limit, false
+	}
+	return charge, limit, true
+}
+
+// consumeQuota counts a generation against the user's daily quota. When the quota is
+// used up it responds with 429 and the reset time and returns false.
+func (s *Server) consumeQuota(c *gin.Context, userID, kind string) (*quotaCharge, bool) {
+	charge, limit, ok := s.chargeQuota(c.Request.Context(), userID, kind)
+	if ok {
+		return charge, true
+	}
+
+	resetAt := quotaResetAt(time.Now())
+	c.Header("Retry-After", strconv.Itoa(int(time.Until(resetAt).Seconds())+1))
+	c.Header("X-Quota-Reset", resetAt.Format(time.RFC3339))
+	c.JSON(http.StatusTooManyRequests, ErrorResponse{
+		Error:   "Daily generation quota exceeded",
+		Code:    "quota_exceeded",
+		Details: fmt.Sprintf("%d %s generations per day; resets at %s", limit, kind, resetAt.Format(time.RFC3339)),
+	})
+	return nil, false
+}
@@ -0,0 +1,131 @@
+package backend
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateBucket is the token bucket of one client
+type rateBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter keeps an in-memory token bucket per client. Buckets hold up to limit
+// tokens and refill at limit tokens per minute. An enforcing limiter rejects requests
+// once a bucket is empty.
+type rateLimiter struct {
+	limit     int
+	enforce   bool
+	mu        sync.Mutex
+	buckets   map[string]*rateBucket
+	lastSweep time.Time
+}
+
+// rateLimitState is a bucket after a request has been counted
+type rateLimitState struct {
+	Limit      int
+	Remaining  int
+	Reset      time.Time     // when the bucket is full again
+	Allowed    bool          // false when the bucket was empty
+	RetryAfter time.Duration // until the next token, when not allowed
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{
+		limit:   perMinute,
+		buckets: make(map[string]*rateBucket),
+	}
+}
+
+// newEnforcingRateLimiter creates a limiter that rejects requests over the limit
+func newEnforcingRateLimiter(perMinute int) *rateLimiter {
+	l := newRateLimiter(perMinute)
+	l.enforce = true
+	return l
+}
+
+// endpointLimiters hold the enforced per-user limits of the endpoints that call model
+// providers. They are shared by all API versions.
+type endpointLimiters struct {
+	transform *rateLimiter // transformations, research, note continuation and podcasts
+	chat      *rateLimiter
+}
+
+// take counts a request by key against its bucket
+func (l *rateLimiter) take(key string, now time.Time) rateLimitState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	refill := float64(l.limit) / time.Minute.Seconds() // tokens per second
+	if now.Sub(l.lastSweep) > time.Minute {
+		l.sweep(now, refill)
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &rateBucket{tokens: float64(l.limit), updated: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(l.limit), bucket.tokens+now.Sub(bucket.updated).Seconds()*refill)
+	bucket.updated = now
+
+	state := rateLimitState{Limit: l.limit, Allowed: bucket.tokens >= 1}
+	if state.Allowed {
+		bucket.tokens--
+	} else {
+		state.RetryAfter = time.Duration(math.Ceil((1-bucket.tokens)/refill)) * time.Second
+	}
+	state.Remaining = int(bucket.tokens)
+	missing := float64(l.limit) - bucket.tokens
+	state.Reset = now.Add(time.Duration(math.Ceil(missing/refill)) * time.Second)
+	return state
+}
+
+// sweep drops the buckets that have refilled completely, which are the same as new ones
+func (l *rateLimiter) sweep(now time.Time, refill float64) {
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*refill >= float64(l.limit) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// setRateLimitHeaders reports the bucket state so clients can throttle themselves
+func setRateLimitHeaders(c *gin.Context, state rateLimitState) {
+	c.Header("X-RateLimit-Limit", strconv.Itoa(state.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(state.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.FormatInt(state.Reset.Unix(), 10))
+}
+
+// RateLimitMiddleware counts API requests per user, or per client IP for requests
+// without a user, and reports the bucket in X-RateLimit-* headers. With a soft limiter
+// requests over the limit are still served and the headers only tell clients to back
+// off; an enforcing limiter answers them with 429 and a Retry-After header.
+func RateLimitMiddleware(limiter *rateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil || limiter.limit <= 0 {
+			c.Next()
+			return
+		}
+
+		key := c.GetString("user_id")
+		if key == "" {
+			key = "ip:" + c.ClientIP()
+		}
+		state := limiter.take(key, time.Now())
+		setRateLimitHeaders(c, state)
+		if !state.Allowed && limiter.enforce {
+			c.Header("Retry-After", strconv.Itoa(int(state.RetryAfter.Seconds())))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorResponse{Error: "Too many requests, please retry later", Code: "rate_limited"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,215 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+// indexRepairAsyncSources is the source count above which a notebook repair runs as a job
+const indexRepairAsyncSources = 50
+
+// repairNotebookIndex cross-checks a notebook's sources against the vector index. Sources
+// whose chunks are missing or do not match their content are re-ingested, recorded chunk
+// counts are corrected, and chunks belonging to deleted sources are removed. vectorMutex is
+// held throughout, so loads and re-indexing of the notebook cannot interleave with it.
+func (s *Server) repairNotebookIndex(ctx context.Context, job *Job, notebookID string) (*IndexRepairReport, error) {
+	report := &IndexRepairReport{
+		NotebookID:       notebookID,
+		ReindexedSources: make([]string, 0),
+		ChunkCountsFixed: make([]string, 0),
+		OrphanSources:    make([]string, 0),
+	}
+
+	s.vectorMutex.Lock()
+	defer s.vectorMutex.Unlock()
+
+	if err := s.ensureNotebookLoaded(ctx, notebookID); err != nil {
+		return nil, err
+	}
+
+	// List sources before counting chunks so a source added meanwhile cannot look orphaned
+	sources, err := s.store.Store.ListSources(ctx, notebookID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sources: %w", err)
+	}
+	counts := s.vectorStore.SourceChunkCounts(ctx, notebookID)
+
+	known := make(map[string]bool, len(sources))
+	for i := range sources {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		job.SetProgress("sources", fmt.Sprintf("%d/%d", i+1, len(sources)))
+
+		src := &sources[i]
+		known[src.ID] = true
+		report.SourcesChecked++
+
+		indexed := counts[src.ID]
+		expected := len(s.vectorStore.chunkText(src.Content, s.vectorStore.ChunkStrategyFor(src)))
+		if indexed != expected {
+			s.vectorStore.DeleteSourceChunks(ctx, notebookID, src.ID)
+			indexed = 0
+			if src.Content != "" {
+				n, err := s.vectorStore.IngestSource(ctx, src)
+				if err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("failed to re-index source %s: %v", src.ID, err))
+					continue
+				}
+				indexed = n
+			}
+			report.ReindexedSources = append(report.ReindexedSources, src.ID)
+		}
+
+		if src.ChunkCount != indexed {
+			if err := s.store.UpdateSourceChunkCount(ctx, src.ID, indexed); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("failed to update chunk count of source %s: %v", src.ID, err))
+				continue
+			}
+			report.ChunkCountsFixed = append(report.ChunkCountsFixed, src.ID)
+		}
+	}
+
+	// Chunks without a source ID were ingested directly from files and are left alone
+	for sourceID := range counts {
+		if sourceID == "" || known[sourceID] {
+			continue
+		}
+		if _, err := s.store.Store.GetSource(ctx, sourceID); err == nil {
+			continue
+		}
+		report.OrphanChunksRemoved += s.vectorStore.DeleteSourceChunks(ctx, notebookID, sourceID)
+		report.OrphanSources = append(report.OrphanSources, sourceID)
+	}
+	sort.Strings(report.OrphanSources)
+
+	golog.Infof("index repair for notebook %s: %d re-indexed, %d chunk counts fixed, %d orphan chunks removed",
+		notebookID, len(report.ReindexedSources), len(report.ChunkCountsFixed), report.OrphanChunksRemoved)
+
+	return report, nil
+}
+
+// repairAllIndexes repairs every notebook that is loaded into the vector index and drops
+// the chunks of notebooks that no longer exist. Notebooks that are not loaded are rebuilt
+// from the database on first use and cannot have drifted.
+func (s *Server) repairAllIndexes(ctx context.Context, job *Job) (interface{}, error) {
+	seen := make(map[string]bool)
+	notebookIDs := make([]string, 0)
+	for _, id := range s.vectorStore.NotebookIDs(ctx) {
+		seen[id] = true
+		notebookIDs = append(notebookIDs, id)
+	}
+	s.vectorMutex.RLock()
+	for id := range s.loadedNotebooks {
+		if !seen[id] {
+			notebookIDs = append(notebookIDs, id)
+		}
+	}
+	s.vectorMutex.RUnlock()
+	sort.Strings(notebookIDs)
+
+	reports := make([]*IndexRepairReport, 0, len(notebookIDs))
+	for i, notebookID := range notebookIDs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		job.SetProgress("notebooks", fmt.Sprintf("%d/%d", i+1, len(notebookIDs)))
+
+		if _, err := s.store.Store.GetNotebook(ctx, notebookID); err != nil {
+			s.vectorMutex.Lock()
+			delete(s.loadedNotebooks, notebookID)
+			removed := s.vectorStore.DeleteSourceChunks(ctx, notebookID, "")
+			s.vectorMutex.Unlock()
+
+			reports = append(reports, &IndexRepairReport{
+				NotebookID:          notebookID,
+				ReindexedSources:    make([]string, 0),
+				ChunkCountsFixed:    make([]string, 0),
+				OrphanSources:       make([]string, 0),
+				OrphanChunksRemoved: removed,
+				NotebookDeleted:     true,
+			})
+			continue
+		}
+
+		report, err := s.repairNotebookIndex(ctx, nil, notebookID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			reports = append(reports, &IndexRepairReport{NotebookID: notebookID, Errors: []string{err.Error()}})
+			continue
+		}
+		reports = append(reports, report)
+	}
+
+	return map[string]interface{}{
+		"notebooks_checked": len(reports),
+		"reports":           reports,
+	}, nil
+}
+
+// Index repair handlers
+
+func (s *Server) handleRepairNotebookIndex(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	sources, err := s.store.ListSources(ctx, notebookID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list sources"})
+		return
+	}
+
+	// Log repair activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "repair_index",
+		ResourceType: "notebook",
+		ResourceID:   notebookID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log repair activity: %v", err)
+	}
+
+	// Large notebooks are repaired in the background
+	if c.Query("async") == "true" || len(sources) > indexRepairAsyncSources {
+		job := s.jobs.Start(userID, notebookID, "index_repair", func(ctx context.Context, job *Job) (interface{}, error) {
+			return s.repairNotebookIndex(ctx, job, notebookID)
+		})
+		c.JSON(http.StatusAccepted, job)
+		return
+	}
+
+	report, err := s.repairNotebookIndex(ctx, nil, notebookID)
+	if err != nil {
+		golog.Errorf("failed to repair index of notebook %s: %v", notebookID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to repair vector index"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// handleRepairAllIndexes repairs the whole vector index in the background (admin only)
+func (s *Server) handleRepairAllIndexes(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	job := s.jobs.Start(userID, "", "index_repair_all", s.repairAllIndexes)
+
+	golog.Infof("admin %s started a global index repair (job %s)", userID, job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
@@ -0,0 +1,262 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/prompts"
+)
+
+// NoteTypeResearch is the type of notes holding a deep research report
+const NoteTypeResearch = "research"
+
+// subQuestionPrefix matches list markers the model may put before a sub-question
+var subQuestionPrefix = regexp.MustCompile(`^\s*(?:[-*•]|\d+[.)、]|[（(]\d+[)）])\s*`)
+
+// formatAndGenerate fills an f-string prompt template and generates a response
+func (a *Agent) formatAndGenerate(ctx context.Context, template string, values map[string]any) (string, error) {
+	inputs := make([]string, 0, len(values))
+	for k := range values {
+		inputs = append(inputs, k)
+	}
+	prompt := prompts.NewPromptTemplate(template, inputs)
+	prompt.TemplateFormat = prompts.TemplateFormatFString
+
+	promptValue, err := prompt.Format(values)
+	if err != nil {
+		return "", fmt.Errorf("failed to format prompt: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 300*time.Second)
+	defer cancel()
+
+	return llms.GenerateFromSinglePrompt(ctx, a.llm, promptValue)
+}
+
+// PlanResearch splits a research question into at most maxSteps sub-questions
+func (a *Agent) PlanResearch(ctx context.Context, question string, maxSteps int) ([]string, error) {
+	response, err := a.formatAndGenerate(ctx, researchPlanPrompt(), map[string]any{
+		"question":  question,
+		"max_steps": maxSteps,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	questions := make([]string, 0, maxSteps)
+	for _, line := range strings.Split(response, "\n") {
+		line = strings.TrimSpace(subQuestionPrefix.ReplaceAllString(line, ""))
+		if line == "" {
+			continue
+		}
+		questions = append(questions, line)
+		if len(questions) == maxSteps {
+			break
+		}
+	}
+	// Fall back to researching the question as a whole
+	if len(questions) == 0 {
+		questions = append(questions, question)
+	}
+	return questions, nil
+}
+
+// AnswerResearchStep retrieves chunks for a sub-question and answers it from them
+func (a *Agent) AnswerResearchStep(ctx context.Context, notebookID, question string, numDocs int) (*ResearchStep, error) {
+	docs, _, err := a.retrieve(ctx, notebookID, question, numDocs)
+	if err != nil {
+		return nil, err
+	}
+
+	var contextBuilder strings.Builder
+	for i, doc := range docs {
+		contextBuilder.WriteString(fmt.Sprintf("[来源 %d] %s\n", i+1, doc.PageContent))
+		if source, ok := doc.Metadata["source"].(string); ok {
+			contextBuilder.WriteString(fmt.Sprintf("来源: %s\n\n", source))
+		}
+	}
+
+	answer, err := a.formatAndGenerate(ctx, researchStepPrompt(), map[string]any{
+		"context":  contextBuilder.String(),
+		"question": question,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResearchStep{
+		Question: question,
+		Answer:   strings.TrimSpace(answer),
+		Sources:  sourceSummariesFromDocs(docs),
+	}, nil
+}
+
+// SynthesizeResearch writes the final report from the answered sub-questions
+func (a *Agent) SynthesizeResearch(ctx context.Context, question string, steps []ResearchStep) (string, error) {
+	var findings strings.Builder
+	for _, step := range steps {
+		findings.WriteString(fmt.Sprintf("### %d. %s\n%s\n\n", step.Index, step.Question, step.Answer))
+	}
+
+	return a.formatAndGenerate(ctx, researchSynthesisPrompt(), map[string]any{
+		"question": question,
+		"findings": findings.String(),
+	})
+}
+
+// handleResearch runs a deep research agent over a notebook: the question is split into
+// sub-questions, each is answered from its own retrieval, and the answers are
+// synthesized into a report saved as a research note. Progress is streamed as
+// server-sent events: plan, step_started, step, synthesizing, then done with the note,
+// or error.
+func (s *Server) handleResearch(c *gin.Context) {
+	// The run stops when the client goes away
+	ctx := c.Request.Context()
+	notebookID := c.Param("id")
+	userID := c.GetString("user_id")
+	locale := s.resolveLocale(c)
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var req struct {
+		Question string `json:"question" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// 按需加载向量索引
+	if err := s.loadNotebookVectorIndex(ctx, notebookID); err != nil {
+		golog.Errorf("failed to load vector index: %v", err)
+	}
+
+	charge, ok := s.consumeQuota(c, userID, QuotaKindTransform)
+	if !ok {
+		return
+	}
+
+	requestJSON, _ := json.Marshal(req)
+	gen := &Generation{
+		UserID:     userID,
+		NotebookID: notebookID,
+		Type:       NoteTypeResearch,
+		Request:    string(requestJSON),
+		Model:      s.agent.textModelName(),
+	}
+	// Bookkeeping uses its own context so an abandoned run is still recorded
+	if err := s.store.CreateGeneration(context.Background(), gen); err != nil {
+		golog.Errorf("failed to record generation: %v", err)
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	emit := func(event string, data interface{}) {
+		c.SSEvent(event, data)
+		c.Writer.Flush()
+	}
+	fail := func(err error) {
+		golog.Errorf("research run for notebook %s failed: %v", notebookID, err)
+		charge.release(s.store)
+		gen.Status = GenerationStatusFailed
+		if ctx.Err() != nil {
+			gen.Status = GenerationStatusCancelled
+		}
+		gen.Error = err.Error()
+		if err := s.store.FinishGeneration(context.Background(), gen); err != nil {
+			golog.Errorf("failed to update generation %s: %v", gen.ID, err)
+		}
+		emit("error", ErrorResponse{Error: err.Error()})
+	}
+
+	questions, err := s.agent.PlanResearch(ctx, req.Question, s.cfg.ResearchMaxSteps)
+	if err != nil {
+		fail(fmt.Errorf("failed to plan research: %w", err))
+		return
+	}
+	emit("plan", gin.H{"sub_questions": questions})
+
+	steps := make([]ResearchStep, 0, len(questions))
+	sourceIDs := make([]string, 0)
+	seen := make(map[string]bool)
+	for i, question := range questions {
+		emit("step_started", gin.H{"index": i + 1, "question": question})
+
+		step, err := s.agent.AnswerResearchStep(ctx, notebookID, question, s.cfg.ResearchDocsPerStep)
+		if err != nil {
+			fail(fmt.Errorf("failed to answer sub-question %d: %w", i+1, err))
+			return
+		}
+		step.Index = i + 1
+		for _, src := range step.Sources {
+			if !seen[src.ID] {
+				seen[src.ID] = true
+				sourceIDs = append(sourceIDs, src.ID)
+			}
+		}
+		steps = append(steps, *step)
+		emit("step", step)
+	}
+
+	emit("synthesizing", gin.H{"steps": len(steps)})
+	report, err := s.agent.SynthesizeResearch(ctx, req.Question, steps)
+	if err != nil {
+		fail(fmt.Errorf("failed to synthesize report: %w", err))
+		return
+	}
+
+	note := &Note{
+		NotebookID: notebookID,
+		Title:      getTitleForType(NoteTypeResearch, locale),
+		Content:    report,
+		Type:       NoteTypeResearch,
+		SourceIDs:  sourceIDs,
+		Metadata: map[string]interface{}{
+			"question": req.Question,
+			"steps":    steps,
+		},
+	}
+	if err := s.store.CreateNote(context.Background(), note); err != nil {
+		fail(fmt.Errorf("failed to save note"))
+		return
+	}
+
+	gen.NoteID = note.ID
+	gen.Status = GenerationStatusSucceeded
+	gen.CompletionTokens = estimateTokens(report)
+	if err := s.store.FinishGeneration(context.Background(), gen); err != nil {
+		golog.Errorf("failed to update generation %s: %v", gen.ID, err)
+	}
+
+	// Log research activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "research",
+		ResourceType: "note",
+		ResourceID:   note.ID,
+		ResourceName: note.Title,
+		Details:      fmt.Sprintf(`{"notebook_id": "%s", "steps": %d, "source_count": %d}`, notebookID, len(steps), len(sourceIDs)),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(context.Background(), activityLog); err != nil {
+		golog.Errorf("failed to log research activity: %v", err)
+	}
+
+	emit("done", note)
+}
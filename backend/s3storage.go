@@ -0,0 +1,376 @@
+package backend
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Storage keeps files in a bucket of an S3-compatible object store (AWS S3, MinIO,
+// Cloudflare R2, ...). Requests are signed with AWS Signature Version 4.
+type S3Storage struct {
+	endpoint   *url.URL
+	region     string
+	bucket     string
+	prefix     string // prepended to every key, e.g. "notex/"
+	accessKey  string
+	secretKey  string
+	pathStyle  bool // bucket in the path instead of the host name, needed by most self-hosted servers
+	httpClient *http.Client
+}
+
+// NewS3Storage creates a storage for the bucket configured by the S3_* settings
+func NewS3Storage(cfg Config) (*S3Storage, error) {
+	endpoint := cfg.S3Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", cfg.S3Region)
+	}
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT: %s", endpoint)
+	}
+
+	prefix := strings.Trim(cfg.S3Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &S3Storage{
+		endpoint:  u,
+		region:    cfg.S3Region,
+		bucket:    cfg.S3Bucket,
+		prefix:    prefix,
+		accessKey: cfg.S3AccessKeyID,
+		secretKey: cfg.S3SecretAccessKey,
+		pathStyle: cfg.S3PathStyle,
+		// No client timeout, large files take long to transfer; requests end with their context
+		httpClient: &http.Client{},
+	}, nil
+}
+
+// objectURL returns the URL of an object, or of the bucket when objectKey is empty
+func (s *S3Storage) objectURL(objectKey string) *url.URL {
+	u := *s.endpoint
+	p := "/"
+	if s.pathStyle {
+		p += s.bucket + "/"
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + p + objectKey
+	u.RawPath = strings.TrimSuffix(s.endpoint.EscapedPath(), "/") + awsURIEncode(p+objectKey, false)
+	return &u
+}
+
+// do signs and sends a request. A body must come with its size.
+func (s *S3Storage) do(ctx context.Context, method string, u *url.URL, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.sign(req, time.Now().UTC())
+	return s.httpClient.Do(req)
+}
+
+// sign adds the Signature Version 4 headers. The payload is not hashed, so bodies can be
+// streamed; S3 accepts UNSIGNED-PAYLOAD for that.
+func (s *S3Storage) sign(req *http.Request, now time.Time) {
+	const payloadHash = "UNSIGNED-PAYLOAD"
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes query parameters sorted by name, as Signature Version 4 requires
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vs := values[k]
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, awsURIEncode(k, true)+"="+awsURIEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode percent-encodes everything but unreserved characters, and slashes unless
+// encodeSlash is set
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3Error turns an error response into an error. Missing objects wrap os.ErrNotExist.
+func s3Error(op, key string, resp *http.Response) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("S3 %s %s: %w", op, key, os.ErrNotExist)
+	}
+	if body.Code != "" {
+		return fmt.Errorf("S3 %s %s failed (%d): %s: %s", op, key, resp.StatusCode, body.Code, body.Message)
+	}
+	return fmt.Errorf("S3 %s %s failed with status %d", op, key, resp.StatusCode)
+}
+
+// Put uploads an object in a single request
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if size < 0 {
+		return fmt.Errorf("S3 put %s: size required", key)
+	}
+	header := http.Header{}
+	header.Set("Content-Type", contentTypeForFile(key))
+	resp, err := s.do(ctx, http.MethodPut, s.objectURL(s.prefix+key), r, size, header)
+	if err != nil {
+		return fmt.Errorf("S3 put %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("put", key, resp)
+	}
+	return nil
+}
+
+// Get looks the object up; its content is fetched on the first read, with a range
+// request when only part of it is read
+func (s *S3Storage) Get(ctx context.Context, key string) (*StorageObject, error) {
+	u := s.objectURL(s.prefix + key)
+	resp, err := s.do(ctx, http.MethodHead, u, nil, 0, nil)
+	if err != nil {
+		return nil, fmt.Errorf("S3 get %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3Error("get", key, resp)
+	}
+	size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("S3 get %s: missing Content-Length", key)
+	}
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	return &StorageObject{
+		ReadSeekCloser: &s3ObjectReader{storage: s, ctx: ctx, key: key, url: u, size: size},
+		Size:           size,
+		ModTime:        modTime,
+	}, nil
+}
+
+// Delete removes an object. S3 does not report whether it existed.
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.objectURL(s.prefix+key), nil, 0, nil)
+	if err != nil {
+		return fmt.Errorf("S3 delete %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s3Error("delete", key, resp)
+	}
+	return nil
+}
+
+// DeletePrefix lists the objects under prefix and deletes them one by one
+func (s *S3Storage) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	count := 0
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", s.prefix+prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u := s.objectURL("")
+		u.RawQuery = query.Encode()
+
+		resp, err := s.do(ctx, http.MethodGet, u, nil, 0, nil)
+		if err != nil {
+			return count, fmt.Errorf("S3 list %s: %w", prefix, err)
+		}
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = s3Error("list", prefix, resp)
+		} else {
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return count, err
+		}
+
+		for _, obj := range result.Contents {
+			if err := s.Delete(ctx, strings.TrimPrefix(obj.Key, s.prefix)); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return count, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// URL returns the file route of key; objects are not read from the bucket directly so
+// notebook access checks apply
+func (s *S3Storage) URL(key string) string {
+	return fileURL(key)
+}
+
+// s3ObjectReader reads an object lazily. Seeking drops the current response, the next
+// read requests the object from the new offset on.
+type s3ObjectReader struct {
+	storage *S3Storage
+	ctx     context.Context
+	key     string
+	url     *url.URL
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (r *s3ObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		header := http.Header{}
+		header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+		resp, err := r.storage.do(r.ctx, http.MethodGet, r.url, nil, 0, header)
+		if err != nil {
+			return 0, fmt.Errorf("S3 get %s: %w", r.key, err)
+		}
+		if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return 0, s3Error("get", r.key, resp)
+		}
+		if resp.StatusCode == http.StatusOK && r.offset > 0 {
+			resp.Body.Close()
+			return 0, fmt.Errorf("S3 get %s: range requests not supported", r.key)
+		}
+		r.body = resp.Body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if errors.Is(err, io.EOF) && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *s3ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.offset + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("s3ObjectReader.Seek: invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("s3ObjectReader.Seek: negative position")
+	}
+	if abs != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = abs
+	return abs, nil
+}
+
+func (r *s3ObjectReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
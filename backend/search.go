@@ -0,0 +1,134 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSearchResults bounds the hits returned by a notebook search
+const maxSearchResults = 100
+
+// maxSearchTerms bounds the words of a search query that are matched
+const maxSearchTerms = 10
+
+// searchSnippetRadius is the number of characters shown on each side of a match
+const searchSnippetRadius = 80
+
+// maxVectorSearchK bounds the chunks returned by a vector search
+const maxVectorSearchK = 50
+
+// handleSearchNotebook searches the text of a notebook's sources and notes. It reads the
+// database directly, so it works whether or not the notebook's vector index is loaded.
+func (s *Server) handleSearchNotebook(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	terms := strings.Fields(c.Query("q"))
+	if len(terms) == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Query parameter q is required"})
+		return
+	}
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+
+	hits, err := s.store.SearchNotebook(ctx, notebookID, terms, maxSearchResults)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to search notebook"})
+		return
+	}
+
+	respondList(c, hits)
+}
+
+// handleVectorSearch runs the retrieval step of chat on its own and returns the top k
+// chunks with their scores, to inspect what a question would retrieve
+func (s *Server) handleVectorSearch(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Query parameter q is required"})
+		return
+	}
+	k := 5
+	if v := c.Query("k"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "k must be a positive integer"})
+			return
+		}
+		k = min(n, maxVectorSearchK)
+	}
+
+	if err := s.loadNotebookVectorIndex(ctx, notebookID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load vector index", Details: err.Error()})
+		return
+	}
+
+	docs, err := s.vectorStore.SimilaritySearch(ctx, notebookID, query, k)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to search vector index", Details: err.Error()})
+		return
+	}
+
+	hits := make([]VectorSearchHit, 0, len(docs))
+	for _, doc := range docs {
+		hit := VectorSearchHit{Content: doc.PageContent, Score: doc.Score}
+		hit.SourceID, _ = doc.Metadata["source_id"].(string)
+		hit.SourceName, _ = doc.Metadata["source"].(string)
+		hit.Chunk, _ = doc.Metadata["chunk"].(int)
+		hits = append(hits, hit)
+	}
+	respondList(c, hits)
+}
+
+// searchSnippet returns the text around the earliest match of any term, with whitespace
+// collapsed. Content without a match, when only the title matched, gives its beginning.
+func searchSnippet(content string, terms []string) string {
+	// Lowercasing maps rune to rune, so rune offsets agree between the two
+	lower := strings.ToLower(content)
+	start, length := -1, 0
+	for _, term := range terms {
+		if i := strings.Index(lower, strings.ToLower(term)); i >= 0 && (start == -1 || i < start) {
+			start, length = i, len(strings.ToLower(term))
+		}
+	}
+
+	runes := []rune(content)
+	from, to := 0, len(runes)
+	if start >= 0 {
+		pos := utf8.RuneCountInString(lower[:start])
+		from = max(pos-searchSnippetRadius, 0)
+		to = min(pos+utf8.RuneCountInString(lower[start:start+length])+searchSnippetRadius, len(runes))
+	} else if to > 2*searchSnippetRadius {
+		to = 2 * searchSnippetRadius
+	}
+
+	snippet := strings.Join(strings.Fields(string(runes[from:to])), " ")
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
@@ -0,0 +1,79 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestTrashedPublicNotebookFilesNotServed checks that anonymous visitors lose access to the
+// uploads and generated images of a public notebook once it is moved to the trash
+func TestTrashedPublicNotebookFilesNotServed(t *testing.T) {
+	ts := newChunkCountTestServer(t)
+	ctx := context.Background()
+	store := ts.store.Store
+
+	if _, err := store.SetNotebookPublic(ctx, ts.notebook.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(key string) {
+		t.Helper()
+		if err := ts.storage.Put(ctx, key, strings.NewReader("data"), 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// An upload stored under the owner, a content-addressed upload and a generated image
+	uploadName := "report_1a2b3c.txt"
+	blobName := strings.Repeat("ab", 32) + ".txt"
+	imageName := "infographic_4d5e6f.png"
+	put(uploadKey(ts.notebook.UserID, uploadName))
+	put(uploadKey("", blobName))
+	put(uploadKey(ts.notebook.UserID, imageName))
+
+	for _, name := range []string{uploadName, blobName} {
+		src := &Source{NotebookID: ts.notebook.ID, Name: name, Type: "file", FileName: name}
+		if err := store.CreateSource(ctx, src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	note := &Note{
+		NotebookID: ts.notebook.ID,
+		Title:      "infographic",
+		Type:       "infograph",
+		Metadata:   map[string]interface{}{"image_url": "/api/files/" + imageName},
+	}
+	if err := store.CreateNote(ctx, note); err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests without a logged-in user
+	router := gin.New()
+	router.GET("/api/files/:filename", ts.handleServeFile)
+	fetch := func(name string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/files/"+name, nil))
+		return w.Code
+	}
+
+	names := []string{uploadName, blobName, imageName}
+	for _, name := range names {
+		if code := fetch(name); code != http.StatusOK {
+			t.Fatalf("%s of a public notebook: status %d, want 200", name, code)
+		}
+	}
+
+	if err := store.DeleteNotebook(ctx, ts.notebook.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if code := fetch(name); code != http.StatusNotFound {
+			t.Fatalf("%s of a trashed notebook: status %d, want 404", name, code)
+		}
+	}
+}
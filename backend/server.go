@@ -1,19 +1,25 @@
 package backend
 
 import (
+	"bytes"
 	"context"
 	"embed"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/kataras/golog"
 )
 
@@ -26,15 +32,25 @@ type Server struct {
 	vectorStore *VectorStore
 	store       *CachedStore
 	agent       *Agent
+	storage     Storage // uploaded and generated files
 	http        *gin.Engine
 	auth        *AuthHandler
-	// Track which notebooks have been loaded into vector store
-	loadedNotebooks map[string]bool
+	jobs        *JobManager
+	uploads     *ChunkedUploads // unfinished chunked uploads
+	// Notebooks loaded into the vector store, with the time each was last used
+	loadedNotebooks map[string]time.Time
 	vectorMutex     sync.RWMutex
+	// Notebooks whose summary source is being regenerated
+	autoSummaries sync.Map
+	// Chat sessions whose title is being generated
+	sessionTitles sync.Map
+	historySummaries sync.Map // chat sessions whose history summary is being updated
 }
 
 // NewServer creates a new server
 func NewServer(cfg Config) (*Server, error) {
+	ConfigureAuditLog(cfg)
+
 	// Initialize vector store
 	vectorStore, err := NewVectorStore(cfg)
 	if err != nil {
@@ -50,8 +66,14 @@ func NewServer(cfg Config) (*Server, error) {
 	// Wrap store with cache (5 minute TTL)
 	store := NewCachedStore(baseStore, 5*time.Minute)
 
+	// Initialize file storage
+	storage, err := NewStorage(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file storage: %w", err)
+	}
+
 	// Initialize agent
-	agent, err := NewAgent(cfg, vectorStore)
+	agent, err := NewAgent(cfg, vectorStore, storage)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create agent: %w", err)
 	}
@@ -69,9 +91,12 @@ func NewServer(cfg Config) (*Server, error) {
 		vectorStore:     vectorStore,
 		store:           store,
 		agent:           agent,
+		storage:         storage,
 		http:            router,
 		auth:            authHandler,
-		loadedNotebooks: make(map[string]bool),
+		jobs:            NewJobManager(),
+		uploads:         NewChunkedUploads(time.Duration(cfg.UploadSessionTTL) * time.Minute),
+		loadedNotebooks: make(map[string]time.Time),
 	}
 
 	// 延迟加载向量索引，不在启动时加载
@@ -84,6 +109,9 @@ func NewServer(cfg Config) (*Server, error) {
 
 // setupRoutes configures all routes
 func (s *Server) setupRoutes() {
+	// Answer cross-origin API requests, including preflights that match no route
+	s.http.Use(CORSMiddleware(s.cfg))
+
 	// Serve static files from embedded filesystem (no audit)
 	staticFS, _ := fs.Sub(frontendFS, "frontend/static")
 	s.http.StaticFS("/static", http.FS(staticFS))
@@ -117,63 +145,51 @@ func (s *Server) setupRoutes() {
 
 	// File serving route - checks notebook public status internally
 	golog.Info("Registering /api/files/:filename route")
-	s.http.GET("/api/files/:filename", AuditMiddlewareLite(), OptionalAuthMiddleware(s.cfg.JWTSecret), s.handleServeFile)
-
-	// API routes
-	api := s.http.Group("/api")
-	api.Use(AuditMiddlewareLite())
-	api.Use(AuthMiddleware(s.cfg.JWTSecret)) // Apply JWT Auth
-	{
-		// Health check
-		api.GET("/health", s.handleHealth)
-		api.GET("/config", s.handleConfig)
-
-		// Auth API (get current user)
-		api.GET("/auth/me", s.auth.HandleMe)
-
-		// Notebook routes
-		notebooks := api.Group("/notebooks")
-		{
-			notebooks.GET("", s.handleListNotebooks)
-			notebooks.GET("/stats", s.handleListNotebooksWithStats)
-			notebooks.POST("", s.handleCreateNotebook)
-			notebooks.GET("/:id", s.handleGetNotebook)
-			notebooks.PUT("/:id", s.handleUpdateNotebook)
-			notebooks.DELETE("/:id", s.handleDeleteNotebook)
+	s.http.GET("/api/files/:filename", AuditMiddlewareLite(), OptionalAuthMiddleware(s.cfg.JWTKeys(), s.store.Store), s.handleServeFile)
+	s.http.HEAD("/api/files/:filename", AuditMiddlewareLite(), OptionalAuthMiddleware(s.cfg.JWTKeys(), s.store.Store), s.handleServeFile)
 
-			// Public sharing
-			notebooks.PUT("/:id/public", s.handleSetNotebookPublic)
+	// Token refresh checks the token itself, since it accepts tokens just past their expiry
+	s.http.POST("/api/auth/refresh", AuditMiddlewareLite(), s.auth.HandleRefresh)
+	s.http.POST("/api/v1/auth/refresh", AuditMiddlewareLite(), s.auth.HandleRefresh)
 
-			// Sources within a notebook
-			notebooks.GET("/:id/sources", s.handleListSources)
-			notebooks.POST("/:id/sources", s.handleAddSource)
-			notebooks.DELETE("/:id/sources/:sourceId", s.handleDeleteSource)
+	// Export downloads are authorized by a signed link instead of a session
+	s.http.GET("/api/exports/:filename", AuditMiddlewareLite(), s.handleDownloadExport)
 
-			// Notes within a notebook
-			notebooks.GET("/:id/notes", s.handleListNotes)
-			notebooks.POST("/:id/notes", s.handleCreateNote)
-			notebooks.DELETE("/:id/notes/:noteId", s.handleDeleteNote)
-
-			// Transformations
-			notebooks.POST("/:id/transform", s.handleTransform)
-
-			// Chat within a notebook
-			notebooks.GET("/:id/chat/sessions", s.handleListChatSessions)
-			notebooks.POST("/:id/chat/sessions", s.handleCreateChatSession)
-			notebooks.DELETE("/:id/chat/sessions/:sessionId", s.handleDeleteChatSession)
-			notebooks.POST("/:id/chat/sessions/:sessionId/messages", s.handleSendMessage)
-
-			// Quick chat (auto-create session)
-			notebooks.POST("/:id/chat", s.handleChat)
-		}
+	// Shared notebook snapshots are authorized by their share token
+	s.http.GET("/api/shared/:token", AuditMiddlewareLite(), CompressionMiddleware(s.cfg), s.handleGetSharedNotebook)
+	s.http.GET("/api/v1/shared/:token", AuditMiddlewareLite(), CompressionMiddleware(s.cfg), s.handleGetSharedNotebook)
 
-		// Upload endpoint
-		api.POST("/upload", s.handleUpload)
+	// Both API versions count against the same per-user buckets
+	apiLimiter := newRateLimiter(s.cfg.APIRateLimit)
+	limits := &endpointLimiters{
+		transform: newEnforcingRateLimiter(s.cfg.TransformRateLimit),
+		chat:      newEnforcingRateLimiter(s.cfg.ChatRateLimit),
 	}
 
+	// API routes
+	api := s.http.Group("/api")
+	api.Use(AuditMiddlewareLite())
+	api.Use(CompressionMiddleware(s.cfg))
+	api.Use(s.authMiddleware()) // Apply JWT or signed service key auth
+	api.Use(RateLimitMiddleware(apiLimiter))
+	api.Use(TimeoutMiddleware(time.Duration(s.cfg.RequestTimeout) * time.Second))
+	s.registerAPIRoutes(api, limits)
+
+	// Version 1 of the API serves the same routes, but list endpoints wrap their items
+	// in a ListResponse envelope with pagination metadata
+	v1 := s.http.Group("/api/v1")
+	v1.Use(AuditMiddlewareLite())
+	v1.Use(CompressionMiddleware(s.cfg))
+	v1.Use(apiVersion(APIVersionV1))
+	v1.Use(s.authMiddleware())
+	v1.Use(RateLimitMiddleware(apiLimiter))
+	v1.Use(TimeoutMiddleware(time.Duration(s.cfg.RequestTimeout) * time.Second))
+	s.registerAPIRoutes(v1, limits)
+
 	// Public notebook routes (no authentication required)
 	public := s.http.Group("/public")
 	public.Use(AuditMiddlewareLite())
+	public.Use(CompressionMiddleware(s.cfg))
 	{
 		// List all public notebooks with infograph or ppt notes
 		public.GET("/notebooks", s.handleListPublicNotebooks)
@@ -193,16 +209,194 @@ func (s *Server) setupRoutes() {
 	})
 }
 
+// registerAPIRoutes registers the authenticated API on a route group
+func (s *Server) registerAPIRoutes(api *gin.RouterGroup, limits *endpointLimiters) {
+	// Generation endpoints wait on model providers and get a longer deadline, as do
+	// requests that fetch, index or export a notebook's sources
+	generation := TimeoutMiddleware(time.Duration(s.cfg.GenerationRequestTimeout) * time.Second)
+	// and are rate limited per user, since each request costs provider quota
+	transformLimit := RateLimitMiddleware(limits.transform)
+	chatLimit := RateLimitMiddleware(limits.chat)
+
+	// Health check
+	api.GET("/health", s.handleHealth)
+	api.GET("/config", s.handleConfig)
+	api.GET("/models", s.handleListModels)
+
+	// Auth API (get current user)
+	api.GET("/auth/me", s.auth.HandleMe)
+	api.PUT("/auth/me", s.auth.HandleUpdateMe)
+	api.POST("/auth/logout", s.auth.HandleLogout)
+	api.GET("/auth/me/export/all", s.handleExportAllNotebooks)
+
+	// Service keys for signed server-to-server requests
+	api.GET("/auth/me/api-keys", s.handleListAPIKeys)
+	api.POST("/auth/me/api-keys", s.handleCreateAPIKey)
+	api.DELETE("/auth/me/api-keys/:keyId", s.handleDeleteAPIKey)
+
+	// Notebook routes
+	notebooks := api.Group("/notebooks")
+	{
+		notebooks.POST("/import", generation, s.handleImportNotebook)
+		notebooks.GET("", s.handleListNotebooks)
+		notebooks.GET("/stats", s.handleListNotebooksWithStats)
+		notebooks.GET("/trash", s.handleListTrash)
+		notebooks.POST("", s.handleCreateNotebook)
+		notebooks.GET("/:id", s.handleGetNotebook)
+		notebooks.PUT("/:id", s.handleUpdateNotebook)
+		notebooks.GET("/:id/podcast/settings", s.handleGetPodcastSettings)
+		notebooks.PUT("/:id/podcast/settings", s.handleUpdatePodcastSettings)
+		notebooks.POST("/:id/podcast", transformLimit, s.handleCreatePodcast)
+		notebooks.GET("/:id/podcasts", s.handleListPodcasts)
+		notebooks.GET("/:id/podcasts/:podcastId", s.handleGetPodcast)
+		notebooks.DELETE("/:id", s.handleDeleteNotebook)
+		notebooks.POST("/:id/restore", s.handleRestoreNotebook)
+
+		// Public sharing
+		notebooks.PUT("/:id/public", s.handleSetNotebookPublic)
+		notebooks.POST("/:id/share", s.handleCreateShare)
+		notebooks.GET("/:id/shares", s.handleListShares)
+		notebooks.DELETE("/:id/shares/:token", s.handleRevokeShare)
+
+		// Sources within a notebook
+		notebooks.GET("/:id/search", s.handleSearchNotebook)
+		notebooks.GET("/:id/vector-search", s.handleVectorSearch)
+		notebooks.GET("/:id/sources", s.handleListSources)
+		notebooks.GET("/:id/sources/usage", s.handleSourceUsage)
+		notebooks.POST("/:id/sources", generation, s.handleAddSource)
+		notebooks.POST("/:id/sources/bulk-url", s.handleBulkImportURLs)
+		notebooks.POST("/:id/sources/batch", generation, s.handleBatchAddSources)
+		notebooks.GET("/:id/sources/:sourceId", s.handleGetSource)
+		notebooks.PUT("/:id/sources/:sourceId", generation, s.handleReplaceSource)
+		notebooks.PATCH("/:id/sources/:sourceId", s.handleUpdateSource)
+		notebooks.POST("/:id/sources/:sourceId/reprocess", generation, s.handleReprocessSource)
+		notebooks.DELETE("/:id/sources/:sourceId", s.handleDeleteSource)
+		notebooks.GET("/:id/sources/:sourceId/chunks", s.handleListSourceChunks)
+		notebooks.GET("/:id/freshness", s.handleNotebookFreshness)
+		notebooks.POST("/:id/index/repair", generation, s.handleRepairNotebookIndex)
+		notebooks.GET("/:id/index/stats", s.handleNotebookIndexStats)
+
+		// Notes within a notebook
+		notebooks.GET("/:id/notes", s.handleListNotes)
+		notebooks.POST("/:id/notes", s.handleCreateNote)
+		notebooks.GET("/:id/notes/:noteId", s.handleGetNote)
+		notebooks.PUT("/:id/notes/:noteId", s.handleUpdateNote)
+		notebooks.DELETE("/:id/notes/:noteId", s.handleDeleteNote)
+		notebooks.POST("/:id/notes/:noteId/continue", transformLimit, generation, s.handleContinueNote)
+		notebooks.GET("/:id/notes/:noteId/comments", s.handleListNoteComments)
+		notebooks.POST("/:id/notes/:noteId/comments", s.handleCreateNoteComment)
+		notebooks.DELETE("/:id/notes/:noteId/comments/:commentId", s.handleDeleteNoteComment)
+		notebooks.GET("/:id/notes/:noteId/export", s.handleExportNote)
+		notebooks.GET("/:id/export", generation, s.handleExportNotebook)
+
+		// Transformations
+		notebooks.POST("/:id/transform", transformLimit, generation, s.handleTransform)
+		notebooks.GET("/:id/transform", s.handleListTransforms)
+		notebooks.DELETE("/:id/transform/:jobId", s.handleCancelTransform)
+		notebooks.POST("/:id/research", transformLimit, generation, s.handleResearch)
+
+		// Chat within a notebook
+		notebooks.GET("/:id/chat/sessions", s.handleListChatSessions)
+		notebooks.GET("/:id/chat/sessions/stats", s.handleListChatSessionsWithStats)
+		notebooks.POST("/:id/chat/sessions", s.handleCreateChatSession)
+		notebooks.PUT("/:id/chat/sessions/:sessionId", s.handleUpdateChatSession)
+		notebooks.DELETE("/:id/chat/sessions/:sessionId", s.handleDeleteChatSession)
+		notebooks.POST("/:id/chat/sessions/:sessionId/messages", chatLimit, generation, s.handleSendMessage)
+		notebooks.DELETE("/:id/chat/sessions/:sessionId/messages/:messageId", s.handleDeleteChatMessage)
+		notebooks.POST("/:id/chat/sessions/:sessionId/messages/:messageId/feedback", s.handleSetMessageFeedback)
+
+		// Quick chat (auto-create session)
+		notebooks.POST("/:id/chat", chatLimit, generation, s.handleChat)
+		notebooks.POST("/:id/chat/stream", chatLimit, generation, s.handleChatStream)
+	}
+
+	// Notebook templates
+	api.GET("/templates", s.handleListTemplates)
+	api.POST("/templates", s.handleCreateTemplate)
+	api.POST("/templates/prompt/preview", s.handlePreviewPrompt)
+	api.DELETE("/templates/:id", s.handleDeleteTemplate)
+
+	// Upload endpoint
+	api.POST("/upload", generation, s.handleUpload)
+
+	// Chunked uploads, resumable on flaky connections
+	api.POST("/upload/init", s.handleInitUpload)
+	api.GET("/upload/:id", s.handleGetUpload)
+	// A chunk on a slow link may take longer than any fixed deadline; its size is
+	// bounded instead
+	api.PATCH("/upload/:id", TimeoutMiddleware(0), s.handlePatchUpload)
+	api.DELETE("/upload/:id", s.handleAbortUpload)
+	api.POST("/upload/:id/commit", generation, s.handleCommitUpload)
+
+	// Usage reporting
+	api.GET("/usage/generations", s.handleListGenerations)
+
+	// Activity of the current user
+	api.GET("/activity", s.handleListActivity)
+
+	// Background jobs
+	api.GET("/jobs/:id", s.handleGetJob)
+	api.POST("/jobs/:id/cancel", s.handleCancelJob)
+
+	// Admin routes
+	admin := api.Group("/admin")
+	admin.Use(AdminMiddleware(s.cfg, s.store.Store))
+	{
+		admin.POST("/index/repair", generation, s.handleRepairAllIndexes)
+		admin.POST("/index/reconcile", generation, s.handleReconcileChunkCounts)
+		admin.POST("/notebooks/:id/index/unload", s.handleUnloadNotebookIndex)
+		admin.POST("/notebooks/:id/index/reload", generation, s.handleReloadNotebookIndex)
+		admin.GET("/users", s.handleListUsers)
+		admin.DELETE("/users/:userId", s.handleEraseUser)
+	}
+}
+
 // loadNotebookVectorIndex loads a notebook's sources into the vector store on demand
 func (s *Server) loadNotebookVectorIndex(ctx context.Context, notebookID string) error {
 	s.vectorMutex.Lock()
 	defer s.vectorMutex.Unlock()
 
-	// Check if already loaded
-	if s.loadedNotebooks[notebookID] {
+	return s.ensureNotebookLoaded(ctx, notebookID)
+}
+
+// ensureNotebookLoaded records a use of a notebook's index, loading it first if needed.
+// Loading a notebook past MaxLoadedNotebooks unloads the least recently used others.
+// The caller must hold vectorMutex.
+func (s *Server) ensureNotebookLoaded(ctx context.Context, notebookID string) error {
+	if _, ok := s.loadedNotebooks[notebookID]; ok {
+		s.loadedNotebooks[notebookID] = time.Now()
 		return nil
 	}
 
+	if err := s.ingestNotebookSources(ctx, notebookID); err != nil {
+		return err
+	}
+	s.evictNotebookIndexes(ctx, notebookID)
+	return nil
+}
+
+// evictNotebookIndexes unloads the least recently used notebooks until no more than
+// MaxLoadedNotebooks are loaded, never the one given. The caller must hold vectorMutex.
+func (s *Server) evictNotebookIndexes(ctx context.Context, keep string) {
+	for s.cfg.MaxLoadedNotebooks > 0 && len(s.loadedNotebooks) > s.cfg.MaxLoadedNotebooks {
+		oldest := ""
+		var oldestAt time.Time
+		for id, usedAt := range s.loadedNotebooks {
+			if id != keep && (oldest == "" || usedAt.Before(oldestAt)) {
+				oldest, oldestAt = id, usedAt
+			}
+		}
+		if oldest == "" {
+			return
+		}
+		removed := s.unloadNotebookIndex(ctx, oldest)
+		golog.Infof("evicted vector index of notebook %s (%d chunks, last used %s)", oldest, removed, oldestAt.Format(time.RFC3339))
+	}
+}
+
+// ingestNotebookSources indexes all sources of a notebook and marks it loaded.
+// The caller must hold vectorMutex.
+func (s *Server) ingestNotebookSources(ctx context.Context, notebookID string) error {
 	golog.Infof("🔄 loading vector index for notebook %s...", notebookID)
 
 	sources, err := s.store.Store.ListSources(ctx, notebookID)
@@ -210,15 +404,21 @@ func (s *Server) loadNotebookVectorIndex(ctx context.Context, notebookID string)
 		return fmt.Errorf("failed to list sources: %w", err)
 	}
 
-	for _, src := range sources {
+	for i := range sources {
+		src := &sources[i]
 		if src.Content != "" {
-			if _, err := s.vectorStore.IngestText(ctx, notebookID, src.Name, src.Content); err != nil {
+			if _, err := s.vectorStore.IngestSource(ctx, src); err != nil {
 				golog.Errorf("failed to load source %s: %v", src.Name, err)
 			}
 		}
 	}
 
-	s.loadedNotebooks[notebookID] = true
+	s.loadedNotebooks[notebookID] = time.Now()
+	if fixed, err := s.reconcileChunkCounts(ctx, notebookID, sources); err != nil {
+		golog.Errorf("failed to reconcile chunk counts of notebook %s: %v", notebookID, err)
+	} else if len(fixed) > 0 {
+		golog.Infof("corrected chunk counts of %d sources in notebook %s", len(fixed), notebookID)
+	}
 	stats, _ := s.vectorStore.GetStats(ctx)
 	golog.Infof("✅ notebook %s loaded into vector store (%d total documents)", notebookID, stats.TotalDocuments)
 
@@ -229,24 +429,98 @@ func (s *Server) loadNotebookVectorIndex(ctx context.Context, notebookID string)
 func (s *Server) Start() error {
 	addr := fmt.Sprintf("%s:%s", s.cfg.ServerHost, s.cfg.ServerPort)
 	golog.Infof("server starting on %s", addr)
+
+	s.failInterruptedPodcasts(context.Background())
+
+	if s.cfg.IngestRetryOnStartup || s.cfg.IngestRetryInterval > 0 {
+		go s.ingestRetryLoop()
+	}
+	go s.auth.pruneRevokedTokensLoop()
+	go s.purgeExpiredTrash(context.Background())
+	go s.uploads.sweepLoop()
+
 	return s.http.Run(addr)
 }
 
-// Health check handler
+// Health check handler. The database and vector store are always checked; deep=true
+// also sends a minimal prompt to the LLM, which costs a provider call. When a check
+// fails the status is "degraded" and the response is a 503.
 func (s *Server) handleHealth(c *gin.Context) {
-	c.JSON(http.StatusOK, HealthResponse{
-		Status:    "ok",
+	ctx := c.Request.Context()
+
+	checks := map[string]HealthCheck{
+		"database": runHealthCheck(ctx, s.store.Ping),
+		"vector_store": runHealthCheck(ctx, func(ctx context.Context) error {
+			_, err := s.vectorStore.GetStats(ctx)
+			return err
+		}),
+	}
+	if c.Query("deep") == "true" {
+		checks["llm"] = runHealthCheck(ctx, s.agent.Ping)
+	}
+
+	status, code := "ok", http.StatusOK
+	for _, check := range checks {
+		if check.Status != "ok" {
+			status, code = "degraded", http.StatusServiceUnavailable
+		}
+	}
+
+	c.JSON(code, HealthResponse{
+		Status:    status,
 		Version:   "1.0.0",
 		Timestamp: time.Now().Unix(),
 		Services: map[string]string{
 			"vector_store": s.cfg.VectorStoreType,
 			"llm":          s.cfg.OpenAIModel,
 		},
+		Checks: checks,
+		Index:  s.indexMemorySummary(ctx),
 	})
 }
 
+// healthCheckTimeout bounds each dependency check of the health endpoint
+const healthCheckTimeout = 10 * time.Second
+
+// runHealthCheck runs a dependency check with a timeout and records how it went
+func runHealthCheck(ctx context.Context, check func(context.Context) error) HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := HealthCheck{Status: "ok", LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// indexMemorySummary totals the estimated index memory of all loaded notebooks
+func (s *Server) indexMemorySummary(ctx context.Context) *IndexMemorySummary {
+	s.vectorMutex.RLock()
+	notebookIDs := make([]string, 0, len(s.loadedNotebooks))
+	for id := range s.loadedNotebooks {
+		notebookIDs = append(notebookIDs, id)
+	}
+	s.vectorMutex.RUnlock()
+
+	summary := &IndexMemorySummary{LoadedNotebooks: len(notebookIDs)}
+	for _, id := range notebookIDs {
+		stats := s.vectorStore.GetNotebookStats(ctx, id)
+		summary.Chunks += stats.Chunks
+		summary.EstimatedBytes += stats.EstimatedBytes
+	}
+	return summary
+}
+
 func (s *Server) handleConfig(c *gin.Context) {
-	c.JSON(http.StatusOK, ConfigResponse{})
+	c.JSON(http.StatusOK, ConfigResponse{
+		ChunkSize:     s.cfg.ChunkSize,
+		ChunkOverlap:  s.cfg.ChunkOverlap,
+		ChunkStrategy: s.cfg.ChunkStrategy,
+	})
 }
 
 // Notebook handlers
@@ -260,7 +534,7 @@ func (s *Server) handleListNotebooks(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list notebooks"})
 		return
 	}
-	c.JSON(http.StatusOK, notebooks)
+	respondList(c, notebooks)
 }
 
 func (s *Server) handleListNotebooksWithStats(c *gin.Context) {
@@ -269,7 +543,7 @@ func (s *Server) handleListNotebooksWithStats(c *gin.Context) {
 
 	// If no user ID (anonymous or invalid token), return empty list
 	if userID == "" {
-		c.JSON(http.StatusOK, []NotebookWithStats{})
+		respondList(c, []NotebookWithStats{})
 		return
 	}
 
@@ -278,7 +552,7 @@ func (s *Server) handleListNotebooksWithStats(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list notebooks with stats"})
 		return
 	}
-	c.JSON(http.StatusOK, notebooks)
+	respondList(c, notebooks)
 }
 
 func (s *Server) handleCreateNotebook(c *gin.Context) {
@@ -296,6 +570,20 @@ func (s *Server) handleCreateNotebook(c *gin.Context) {
 		return
 	}
 
+	// Start from a saved template's configuration when one is given
+	if templateID := c.Query("template"); templateID != "" {
+		metadata, err := s.templateMetadata(ctx, userID, templateID, req.Metadata)
+		if err != nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Template not found"})
+			return
+		}
+		req.Metadata = metadata
+	}
+	if _, err := parseSystemPrompt(req.Metadata[systemPromptKey]); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	notebook, err := s.store.CreateNotebook(ctx, userID, req.Name, req.Description, req.Metadata)
 	if err != nil {
 		golog.Errorf("error creating notebook: %v", err)
@@ -337,7 +625,7 @@ func (s *Server) handleGetNotebook(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, notebook)
+	respondWithETag(c, notebook)
 }
 
 func (s *Server) handleUpdateNotebook(c *gin.Context) {
@@ -366,6 +654,14 @@ func (s *Server) handleUpdateNotebook(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	if _, err := parsePodcastSettings(req.Metadata[podcastDefaultsKey]); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if _, err := parseSystemPrompt(req.Metadata[systemPromptKey]); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
 
 	notebook, err := s.store.UpdateNotebook(ctx, id, req.Name, req.Description, req.Metadata)
 	if err != nil {
@@ -376,14 +672,17 @@ func (s *Server) handleUpdateNotebook(c *gin.Context) {
 	c.JSON(http.StatusOK, notebook)
 }
 
+// handleDeleteNotebook moves a notebook to the trash, or deletes it permanently with
+// purge=true. Notebooks already in the trash can only be purged.
 func (s *Server) handleDeleteNotebook(c *gin.Context) {
 	ctx := context.Background()
 	id := c.Param("id")
 	userID := c.GetString("user_id")
+	purge := c.Query("purge") == "true"
 
 	// Check ownership first
-	existing, err := s.store.GetNotebook(ctx, id)
-	if err != nil {
+	existing, err := s.store.GetNotebookIncludingDeleted(ctx, id)
+	if err != nil || (existing.DeletedAt != nil && !purge) {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Notebook not found"})
 		return
 	}
@@ -392,11 +691,26 @@ func (s *Server) handleDeleteNotebook(c *gin.Context) {
 		return
 	}
 
+	if purge {
+		if err := s.purgeNotebook(ctx, id); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete notebook"})
+			return
+		}
+		golog.Infof("user %s purged notebook %s", userID, id)
+		c.Status(http.StatusNoContent)
+		return
+	}
+
 	if err := s.store.DeleteNotebook(ctx, id); err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete notebook"})
 		return
 	}
 
+	// Notebooks in the trash cannot be chatted with; their index is loaded again on restore
+	s.vectorMutex.Lock()
+	s.unloadNotebookIndex(ctx, id)
+	s.vectorMutex.Unlock()
+
 	c.Status(http.StatusNoContent)
 }
 
@@ -418,7 +732,7 @@ func (s *Server) handleListSources(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, sources)
+	respondList(c, sources)
 }
 
 func (s *Server) handleAddSource(c *gin.Context) {
@@ -437,13 +751,40 @@ func (s *Server) handleAddSource(c *gin.Context) {
 		URL      string                 `json:"url"`
 		Content  string                 `json:"content"`
 		Metadata map[string]interface{} `json:"metadata"`
+		// ExtractionMode selects how a URL page is turned into text: full-text (default),
+		// main-content or readability
+		ExtractionMode string `json:"extraction_mode"`
+	}
+
+	// Pasted text may arrive in a legacy encoding; convert the body to UTF-8 before binding
+	// so it is not replaced with U+FFFD by the JSON decoder. Pasted text is held to the
+	// upload size limit.
+	var body bytes.Buffer
+	if _, err := copyUploadLimited(&body, c.Request.Body, s.cfg.MaxUploadBytes); err != nil {
+		if errors.Is(err, errUploadTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: uploadSizeMessage(s.cfg.MaxUploadBytes), Code: "file_too_large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read request body"})
+		return
 	}
+	_, params, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	bodyText, encoding := toUTF8(body.Bytes(), params["charset"])
+	c.Request.Body = io.NopCloser(strings.NewReader(bodyText))
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	if req.Content != "" {
+		req.Content = normalizeLineEndings(req.Content)
+		if req.Metadata == nil {
+			req.Metadata = make(map[string]interface{})
+		}
+		req.Metadata["encoding"] = encoding
+	}
+
 	source := &Source{
 		NotebookID: notebookID,
 		Name:       req.Name,
@@ -453,10 +794,32 @@ func (s *Server) handleAddSource(c *gin.Context) {
 		Metadata:   req.Metadata,
 	}
 
+	// Adding the same URL or text again returns the source it was added as
+	source.ContentHash = sourceContentHash(source)
+	if dedupeRequested(c) {
+		if existing := s.findDuplicateSource(ctx, notebookID, source.ContentHash); existing != nil {
+			c.JSON(http.StatusOK, existing)
+			return
+		}
+	}
+
 	// If URL is provided and Content is empty, fetch content from URL
 	if req.URL != "" {
+		mode := req.ExtractionMode
+		if mode == "" {
+			mode = URLExtractFullText
+		}
+		if !validURLExtractionMode(mode) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("unknown extraction_mode: %s (supported: readability, full-text, main-content)", mode)})
+			return
+		}
+		if source.Metadata == nil {
+			source.Metadata = make(map[string]interface{})
+		}
+		source.Metadata["extraction_mode"] = mode
+
 		golog.Infof("fetching content from URL: %s", req.URL)
-		content, err := s.vectorStore.ExtractFromURL(ctx, req.URL)
+		content, err := s.vectorStore.ExtractFromURLWithMode(ctx, req.URL, mode)
 		if err != nil {
 			golog.Errorf("failed to fetch URL content: %v", err)
 			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: fmt.Sprintf("Failed to fetch URL content: %v", err)})
@@ -466,6 +829,7 @@ func (s *Server) handleAddSource(c *gin.Context) {
 		golog.Infof("URL content fetched successfully, size: %d bytes", len(content))
 	}
 
+	s.vectorStore.AssignChunkStrategy(source)
 	if err := s.store.CreateSource(ctx, source); err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create source"})
 		return
@@ -488,16 +852,107 @@ func (s *Server) handleAddSource(c *gin.Context) {
 
 	// Ingest into vector store (synchronous for immediate availability)
 	if source.Content != "" {
-		if chunkCount, err := s.vectorStore.IngestText(ctx, notebookID, source.Name, source.Content); err != nil {
+		if _, err := s.indexSource(ctx, source); err != nil {
 			golog.Errorf("failed to ingest text: %v", err)
-		} else {
-			s.store.UpdateSourceChunkCount(ctx, source.ID, chunkCount)
 		}
 	}
 
+	s.maybeRefreshAutoSummary(notebookID, userID, s.resolveLocale(c))
+
 	c.JSON(http.StatusCreated, source)
 }
 
+// handleReplaceSource edits a source's name and content in place, keeping its ID so
+// notes that reference it stay linked. The source is re-indexed when either changes,
+// since chunks carry the source name for citations.
+func (s *Server) handleReplaceSource(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	sourceID := c.Param("sourceId")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var req struct {
+		Name    *string `json:"name"`
+		Content *string `json:"content"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	source, err := s.store.GetSource(ctx, sourceID)
+	if err != nil || source.NotebookID != notebookID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Source not found"})
+		return
+	}
+
+	nameChanged := false
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Source name is empty"})
+			return
+		}
+		nameChanged = name != source.Name
+		source.Name = name
+	}
+	contentChanged := false
+	if req.Content != nil {
+		content := normalizeLineEndings(*req.Content)
+		if strings.TrimSpace(content) == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Source content is empty"})
+			return
+		}
+		contentChanged = content != source.Content
+		source.Content = content
+	}
+	if !nameChanged && !contentChanged {
+		c.JSON(http.StatusOK, source)
+		return
+	}
+
+	if source.Metadata == nil {
+		source.Metadata = make(map[string]interface{})
+	}
+	if contentChanged {
+		source.Metadata["edited_at"] = time.Now().Unix()
+	}
+	if err := s.store.UpdateSource(ctx, sourceID, source.Name, source.Content, source.Metadata); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update source"})
+		return
+	}
+
+	if _, err := s.reindexChangedSource(ctx, source); err != nil {
+		golog.Errorf("failed to re-index updated source %s: %v", sourceID, err)
+	}
+
+	// Log source edit activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "edit_source",
+		ResourceType: "source",
+		ResourceID:   sourceID,
+		ResourceName: source.Name,
+		Details:      fmt.Sprintf(`{"notebook_id": "%s", "content_changed": %t, "chunk_count": %d}`, notebookID, contentChanged, source.ChunkCount),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log source edit activity: %v", err)
+	}
+
+	if contentChanged {
+		s.maybeRefreshAutoSummary(notebookID, userID, s.resolveLocale(c))
+	}
+
+	c.JSON(http.StatusOK, source)
+}
+
 func (s *Server) handleDeleteSource(c *gin.Context) {
 	ctx := context.Background()
 	sourceID := c.Param("sourceId")
@@ -523,153 +978,444 @@ func (s *Server) handleDeleteSource(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
-func (s *Server) checkNotebookAccess(ctx context.Context, notebookID, userID string) error {
-	notebook, err := s.store.GetNotebook(ctx, notebookID)
-	if err != nil {
-		return fmt.Errorf("notebook not found")
-	}
-	if notebook.UserID != "" && notebook.UserID != userID {
-		return fmt.Errorf("access denied")
-	}
-	return nil
-}
+// maxSourceRangeLength caps the characters of content returned for one source range
+const maxSourceRangeLength = 100000
 
-func (s *Server) handleUpload(c *gin.Context) {
+// handleGetSource returns a single source. With ?offset= and/or ?length= (in characters)
+// only that slice of the content is returned, clamped to the content, together with the
+// total length so long documents can be loaded page by page.
+func (s *Server) handleGetSource(c *gin.Context) {
 	ctx := context.Background()
+	notebookID := c.Param("id")
+	sourceID := c.Param("sourceId")
 	userID := c.GetString("user_id")
-	notebookID := c.PostForm("notebook_id")
-
-	if notebookID == "" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "notebook_id required"})
-		return
-	}
 
 	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
 		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	file, err := c.FormFile("file")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "file required"})
+	source, err := s.store.GetSource(ctx, sourceID)
+	if err != nil || source.NotebookID != notebookID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Source not found"})
 		return
 	}
 
-	// Generate unique filename to avoid conflicts
-	ext := filepath.Ext(file.Filename)
-	baseName := file.Filename[:len(file.Filename)-len(ext)]
-	uniqueFileName := fmt.Sprintf("%s_%s%s", baseName, uuid.New().String()[:8], ext)
-
-	// Store in user-specific directory for isolation
-	userUploadDir := fmt.Sprintf("./data/uploads/%s", userID)
-	tempPath := fmt.Sprintf("%s/%s", userUploadDir, uniqueFileName)
-
-	// Ensure user uploads directory exists
-	if err := os.MkdirAll(userUploadDir, 0755); err != nil {
-		golog.Errorf("failed to create user uploads directory: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create uploads directory"})
+	offsetParam, hasOffset := c.GetQuery("offset")
+	lengthParam, hasLength := c.GetQuery("length")
+	if !hasOffset && !hasLength {
+		c.JSON(http.StatusOK, SourceResponse{Source: source})
 		return
 	}
 
-	// Save file
-	if err := c.SaveUploadedFile(file, tempPath); err != nil {
-		golog.Errorf("failed to save file: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: fmt.Sprintf("Failed to save file: %v", err)})
-		return
+	offset, length := 0, maxSourceRangeLength
+	if hasOffset {
+		if offset, err = strconv.Atoi(offsetParam); err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "offset must be a non-negative integer"})
+			return
+		}
+	}
+	if hasLength {
+		if length, err = strconv.Atoi(lengthParam); err != nil || length <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "length must be a positive integer"})
+			return
+		}
+		if length > maxSourceRangeLength {
+			length = maxSourceRangeLength
+		}
 	}
 
-	// Create source
-	source := &Source{
-		NotebookID: notebookID,
-		Name:       file.Filename, // Keep original filename for display
-		Type:       "file",
-		FileName:   uniqueFileName, // Store unique filename
-		FileSize:   file.Size,
-		Metadata:   map[string]interface{}{"path": tempPath, "user_id": userID},
+	content := []rune(source.Content)
+	total := len(content)
+	if offset > total {
+		offset = total
 	}
+	end := offset + length
+	if end > total {
+		end = total
+	}
+	source.Content = string(content[offset:end])
 
-	// Extract content
-	content, err := s.vectorStore.ExtractDocument(ctx, tempPath)
-	if err != nil {
-		golog.Errorf("failed to extract document content: %v", err)
-		// Clean up uploaded file on error
-		os.Remove(tempPath)
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: fmt.Sprintf("Failed to extract document content: %v", err)})
+	c.JSON(http.StatusOK, SourceResponse{
+		Source: source,
+		ContentRange: &ContentRange{
+			Offset:      offset,
+			Length:      end - offset,
+			TotalLength: total,
+			HasMore:     end < total,
+		},
+	})
+}
+
+// maxChunkContentLength caps the text returned per chunk to keep debug payloads small
+const maxChunkContentLength = 4000
+
+// handleListSourceChunks returns how a source was chunked in the vector store, paginated
+func (s *Server) handleListSourceChunks(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	sourceID := c.Param("sourceId")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
 		return
 	}
-	source.Content = content
 
-	if err := s.store.CreateSource(ctx, source); err != nil {
-		golog.Errorf("failed to create source: %v", err)
-		// Clean up uploaded file on error
-		os.Remove(tempPath)
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create source"})
+	source, err := s.store.GetSource(ctx, sourceID)
+	if err != nil || source.NotebookID != notebookID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Source not found"})
 		return
 	}
 
-	// Log file upload activity
-	activityLog := &ActivityLog{
-		UserID:       userID,
-		Action:       "upload_file",
-		ResourceType: "source",
-		ResourceID:   source.ID,
-		ResourceName: file.Filename,
-		Details:      fmt.Sprintf(`{"notebook_id": "%s", "file_size": %d, "file_type": "%s"}`, notebookID, file.Size, filepath.Ext(file.Filename)),
-		IPAddress:    c.ClientIP(),
-		UserAgent:    c.GetHeader("User-Agent"),
-	}
-	if err := s.store.LogActivity(ctx, activityLog); err != nil {
-		golog.Errorf("failed to log file upload activity: %v", err)
+	// 按需加载向量索引
+	if err := s.loadNotebookVectorIndex(ctx, notebookID); err != nil {
+		golog.Errorf("failed to load vector index: %v", err)
 	}
 
-	// Ingest into vector store (synchronous for immediate availability)
-	// Get chunk count from vector store stats
-	stats, _ := s.vectorStore.GetStats(ctx)
-	totalDocsBefore := stats.TotalDocuments
-
-	if source.Content != "" {
-		if _, err := s.vectorStore.IngestText(ctx, notebookID, source.Name, source.Content); err != nil {
-			golog.Errorf("failed to ingest document: %v", err)
-		} else {
-			// Get updated stats to calculate chunk count
-			stats, _ = s.vectorStore.GetStats(ctx)
-			chunkCount := stats.TotalDocuments - totalDocsBefore
+	offset, limit := parsePagination(c, 20, 100)
+	docs := s.vectorStore.ListChunks(ctx, notebookID, sourceID)
 
-			// Update source with chunk count
-			source.ChunkCount = chunkCount
-
-			// Update in database
-			s.store.UpdateSourceChunkCount(ctx, source.ID, chunkCount)
+	status := "indexed"
+	if len(docs) == 0 {
+		status = "missing"
+		if source.Content == "" {
+			status = "empty"
 		}
 	}
 
-	c.JSON(http.StatusCreated, source)
+	chunks := make([]SourceChunk, 0, limit)
+	for i := offset; i < len(docs) && len(chunks) < limit; i++ {
+		index, _ := docs[i].Metadata["chunk"].(int)
+		content := docs[i].PageContent
+		length := len([]rune(content))
+		if length > maxChunkContentLength {
+			content = string([]rune(content)[:maxChunkContentLength]) + "..."
+		}
+		chunks = append(chunks, SourceChunk{Index: index, Content: content, Length: length})
+	}
+
+	c.JSON(http.StatusOK, SourceChunksResponse{
+		SourceID:        source.ID,
+		SourceName:      source.Name,
+		ChunkCount:      source.ChunkCount,
+		IndexedChunks:   len(docs),
+		EmbeddingStatus: status,
+		Offset:          offset,
+		Limit:           limit,
+		Chunks:          chunks,
+	})
 }
 
-// Note handlers
-
-func (s *Server) handleListNotes(c *gin.Context) {
+// handleSourceUsage ranks a notebook's sources by how often chat answers cited them
+func (s *Server) handleSourceUsage(c *gin.Context) {
 	ctx := context.Background()
 	notebookID := c.Param("id")
+	userID := c.GetString("user_id")
 
-	notes, err := s.store.ListNotes(ctx, notebookID)
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	usage, err := s.store.ListSourceUsage(ctx, notebookID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list notes"})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get source usage"})
 		return
 	}
 
-	c.JSON(http.StatusOK, notes)
+	respondList(c, usage)
 }
 
-func (s *Server) handleCreateNote(c *gin.Context) {
+// handleNotebookIndexStats reports the estimated memory footprint of a notebook's vector index
+func (s *Server) handleNotebookIndexStats(c *gin.Context) {
 	ctx := context.Background()
 	notebookID := c.Param("id")
+	userID := c.GetString("user_id")
 
-	var req struct {
-		Title     string   `json:"title" binding:"required"`
-		Content   string   `json:"content" binding:"required"`
-		Type      string   `json:"type" binding:"required"`
-		SourceIDs []string `json:"source_ids"`
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, s.notebookIndexStats(ctx, notebookID))
+}
+
+// handleNotebookFreshness reports how current a notebook's knowledge is: the age range
+// of its sources, URL sources that have not been refreshed recently, and stale notes
+func (s *Server) handleNotebookFreshness(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	days := 30
+	if v := c.Query("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "days must be a positive integer"})
+			return
+		}
+		days = n
+	}
+
+	sources, err := s.store.ListSources(ctx, notebookID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list sources"})
+		return
+	}
+	notes, err := s.store.ListNotes(ctx, notebookID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list notes"})
+		return
+	}
+
+	report := NotebookFreshness{
+		NotebookID:      notebookID,
+		SourceCount:     len(sources),
+		StaleAfterDays:  days,
+		StaleURLSources: make([]SourceSummary, 0),
+		NoteCount:       len(notes),
+		StaleNotes:      make([]StaleNote, 0),
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -days)
+	sourcesByID := make(map[string]*Source, len(sources))
+	for i := range sources {
+		src := &sources[i]
+		sourcesByID[src.ID] = src
+
+		if report.OldestSourceUpdatedAt == nil || src.UpdatedAt.Before(*report.OldestSourceUpdatedAt) {
+			report.OldestSourceUpdatedAt = &src.UpdatedAt
+		}
+		if report.NewestSourceUpdatedAt == nil || src.UpdatedAt.After(*report.NewestSourceUpdatedAt) {
+			report.NewestSourceUpdatedAt = &src.UpdatedAt
+		}
+
+		if src.Type == "url" {
+			report.URLSourceCount++
+			if src.UpdatedAt.Before(cutoff) {
+				report.StaleURLSources = append(report.StaleURLSources, SourceSummary{ID: src.ID, Name: src.Name, Type: src.Type})
+			}
+		}
+	}
+	report.StaleURLSourceCount = len(report.StaleURLSources)
+
+	for i := range notes {
+		if stale := noteStaleness(&notes[i], sourcesByID); stale != nil {
+			report.StaleNotes = append(report.StaleNotes, *stale)
+		}
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// noteStaleness checks whether a note is out of date relative to its sources. A note is
+// stale when one of its sources was updated after the note, or has been deleted. It
+// returns nil for notes that are up to date.
+func noteStaleness(note *Note, sourcesByID map[string]*Source) *StaleNote {
+	var updated, missing []string
+	for _, id := range note.SourceIDs {
+		src, ok := sourcesByID[id]
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+		if src.UpdatedAt.After(note.UpdatedAt) {
+			updated = append(updated, id)
+		}
+	}
+
+	if len(updated) == 0 && len(missing) == 0 {
+		return nil
+	}
+
+	return &StaleNote{
+		NoteID:           note.ID,
+		Title:            note.Title,
+		Type:             note.Type,
+		UpdatedAt:        note.UpdatedAt,
+		UpdatedSourceIDs: updated,
+		MissingSourceIDs: missing,
+	}
+}
+
+func (s *Server) checkNotebookAccess(ctx context.Context, notebookID, userID string) error {
+	notebook, err := s.store.GetNotebook(ctx, notebookID)
+	if err != nil {
+		return fmt.Errorf("notebook not found")
+	}
+	if notebook.UserID != "" && notebook.UserID != userID {
+		return fmt.Errorf("access denied")
+	}
+	return nil
+}
+
+func (s *Server) handleUpload(c *gin.Context) {
+	ctx := context.Background()
+	userID := c.GetString("user_id")
+
+	if err := parseLimitedMultipartForm(c, s.cfg.MaxUploadBytes); err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: uploadSizeMessage(s.cfg.MaxUploadBytes), Code: "file_too_large"})
+		return
+	}
+	notebookID := c.PostForm("notebook_id")
+
+	if notebookID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "notebook_id required"})
+		return
+	}
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "file required"})
+		return
+	}
+
+	// Reject oversized and unsupported files before anything is written
+	if !s.checkUploadFile(c, file.Filename, file.Size, file.Header.Get("Content-Type")) {
+		return
+	}
+
+	// The file is staged on local disk for extraction, then moved to storage
+	var uniqueFileName, tempPath, contentHash, fileHash string
+
+	if s.cfg.UploadStorage == UploadStorageHash {
+		uniqueFileName, tempPath, contentHash, err = stageUploadByHash(file, s.cfg.MaxUploadBytes)
+		fileHash = contentHash
+		if errors.Is(err, errUploadTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: uploadSizeMessage(s.cfg.MaxUploadBytes), Code: "file_too_large"})
+			return
+		}
+		if err != nil {
+			golog.Errorf("failed to save file: %v", err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: fmt.Sprintf("Failed to save file: %v", err)})
+			return
+		}
+	} else {
+		// Generate unique filename to avoid conflicts
+		uniqueFileName = uniqueUploadName(file.Filename)
+
+		tempPath, err = newStagingPath(uniqueFileName)
+		if err != nil {
+			golog.Errorf("failed to create staging directory: %v", err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create uploads directory"})
+			return
+		}
+
+		// Save file, enforcing the size limit on the bytes actually received
+		fileHash, err = saveUploadLimited(file, tempPath, s.cfg.MaxUploadBytes)
+		if errors.Is(err, errUploadTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: uploadSizeMessage(s.cfg.MaxUploadBytes), Code: "file_too_large"})
+			return
+		}
+		if err != nil {
+			golog.Errorf("failed to save file: %v", err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: fmt.Sprintf("Failed to save file: %v", err)})
+			return
+		}
+	}
+
+	s.acceptUpload(c, stagedUpload{
+		notebookID:  notebookID,
+		userID:      userID,
+		name:        file.Filename,
+		size:        file.Size,
+		fileName:    uniqueFileName,
+		path:        tempPath,
+		contentHash: contentHash,
+		fileHash:    fileHash,
+	})
+}
+
+// acceptUpload turns a staged upload into a source: it returns the existing source of
+// a duplicate, starts transcription of audio and video, or starts the job that extracts
+// and ingests a document
+func (s *Server) acceptUpload(c *gin.Context, up stagedUpload) {
+	ctx := context.Background()
+	notebookID, userID, tempPath, fileHash := up.notebookID, up.userID, up.path, up.fileHash
+	uniqueFileName := up.fileName
+
+	// Create source
+	source := &Source{
+		NotebookID: notebookID,
+		Name:        up.name, // Keep original filename for display
+		Type:        "file",
+		FileName:    uniqueFileName, // Store unique filename
+		FileSize:    up.size,
+		ContentHash: fileHash,
+		Metadata:    map[string]interface{}{"path": uploadKey(userID, uniqueFileName), "user_id": userID},
+	}
+	if up.contentHash != "" {
+		source.Metadata["content_hash"] = up.contentHash
+	}
+
+	// The same file uploaded again returns the source it was added as
+	if dedupeRequested(c) {
+		if existing := s.findDuplicateSource(ctx, notebookID, fileHash); existing != nil {
+			os.Remove(tempPath)
+			c.JSON(http.StatusOK, existing)
+			return
+		}
+	}
+
+	// Audio and video are transcribed instead of extracted
+	if isMediaFile(up.name) {
+		s.startTranscription(c, source, userID, tempPath)
+		return
+	}
+
+	// Extraction and ingestion of large documents take a while, so they run in a job the
+	// client polls through GET /jobs/:id
+	req := uploadRequest{
+		source:    source,
+		path:      tempPath,
+		key:       uploadKey(userID, uniqueFileName),
+		userID:    userID,
+		locale:    s.resolveLocale(c),
+		ipAddress: c.ClientIP(),
+		userAgent: c.GetHeader("User-Agent"),
+	}
+	job := s.jobs.Start(userID, notebookID, "upload", func(ctx context.Context, job *Job) (interface{}, error) {
+		return s.processUpload(ctx, job, req)
+	})
+
+	c.JSON(http.StatusAccepted, UploadJobResponse{JobID: job.ID, Job: job})
+}
+
+// Note handlers
+
+func (s *Server) handleListNotes(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+
+	notes, err := s.store.ListNotes(ctx, notebookID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list notes"})
+		return
+	}
+
+	respondListWithETag(c, notes)
+}
+
+func (s *Server) handleCreateNote(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+
+	var req struct {
+		Title     string   `json:"title" binding:"required"`
+		Content   string   `json:"content" binding:"required"`
+		Type      string   `json:"type" binding:"required"`
+		SourceIDs []string `json:"source_ids"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -677,6 +1423,37 @@ func (s *Server) handleCreateNote(c *gin.Context) {
 		return
 	}
 
+	if err := s.checkNotebookAccess(ctx, notebookID, c.GetString("user_id")); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	notebook, err := s.store.GetNotebook(ctx, notebookID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Notebook not found"})
+		return
+	}
+
+	sources, err := s.store.ListSources(ctx, notebookID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get sources"})
+		return
+	}
+
+	if len(req.SourceIDs) > 0 {
+		// Only allow links to sources that live in this notebook
+		req.SourceIDs, err = validateNoteSourceIDs(req.SourceIDs, sources)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	} else if s.autoAttachNoteSources(notebook) {
+		req.SourceIDs = make([]string, len(sources))
+		for i, src := range sources {
+			req.SourceIDs[i] = src.ID
+		}
+	}
+
 	note := &Note{
 		NotebookID: notebookID,
 		Title:      req.Title,
@@ -708,24 +1485,267 @@ func (s *Server) handleCreateNote(c *gin.Context) {
 	c.JSON(http.StatusCreated, note)
 }
 
+// validateNoteSourceIDs checks that every ID refers to one of the notebook's sources and
+// removes duplicates
+func validateNoteSourceIDs(ids []string, sources []Source) ([]string, error) {
+	known := make(map[string]bool, len(sources))
+	for _, src := range sources {
+		known[src.ID] = true
+	}
+
+	result := make([]string, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if !known[id] {
+			return nil, fmt.Errorf("source %s does not belong to this notebook", id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result, nil
+}
+
+// autoAttachNoteSources reports whether manually created notes without source_ids should be
+// linked to all of the notebook's sources. The notebook's "auto_attach_sources" metadata flag
+// overrides the AUTO_ATTACH_NOTE_SOURCES setting.
+func (s *Server) autoAttachNoteSources(notebook *Notebook) bool {
+	if _, ok := notebook.Metadata["auto_attach_sources"]; ok {
+		return metadataBool(notebook.Metadata, "auto_attach_sources")
+	}
+	return s.cfg.AutoAttachNoteSources
+}
+
+// handleGetNote returns a single note. Notes of other notebooks are not found, whatever
+// the user's access to them.
+func (s *Server) handleGetNote(c *gin.Context) {
+	note, ok := s.notebookNote(context.Background(), c)
+	if !ok {
+		return
+	}
+	respondWithETag(c, note)
+}
+
+// handleUpdateNote edits a note's title, content and metadata, e.g. to correct a generated
+// summary before sharing it. Fields left out of the request keep their current value.
+func (s *Server) handleUpdateNote(c *gin.Context) {
+	ctx := context.Background()
+
+	note, ok := s.notebookNote(ctx, c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Title    *string                `json:"title"`
+		Content  *string                `json:"content"`
+		Metadata map[string]interface{} `json:"metadata"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Note title is empty"})
+			return
+		}
+		note.Title = title
+	}
+	if req.Content != nil {
+		note.Content = *req.Content
+	}
+	if req.Metadata != nil {
+		note.Metadata = req.Metadata
+	}
+
+	if err := s.store.UpdateNote(ctx, note); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update note"})
+		return
+	}
+
+	// Log note update activity
+	activityLog := &ActivityLog{
+		UserID:       c.GetString("user_id"),
+		Action:       "update_note",
+		ResourceType: "note",
+		ResourceID:   note.ID,
+		ResourceName: note.Title,
+		Details:      fmt.Sprintf(`{"notebook_id": "%s", "note_type": "%s"}`, note.NotebookID, note.Type),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log note update activity: %v", err)
+	}
+
+	c.JSON(http.StatusOK, note)
+}
+
 func (s *Server) handleDeleteNote(c *gin.Context) {
 	ctx := context.Background()
-	noteID := c.Param("noteId")
 
-	if err := s.store.DeleteNote(ctx, noteID); err != nil {
+	note, ok := s.notebookNote(ctx, c)
+	if !ok {
+		return
+	}
+
+	if err := s.store.DeleteNote(ctx, note.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete note"})
 		return
 	}
 
+	// Generated images belong to the note alone; they live in the notebook owner's upload dir
+	if notebook, err := s.store.GetNotebook(ctx, note.NotebookID); err == nil {
+		s.removeNoteImages(ctx, note, notebook.UserID)
+	}
+
 	c.Status(http.StatusNoContent)
 }
 
+// handleContinueNote finishes a note that was cut off at the model's output limit by
+// asking the model to continue it, up to MaxNoteContinuations times
+func (s *Server) handleContinueNote(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	noteID := c.Param("noteId")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	note, err := s.store.GetNote(ctx, noteID)
+	if err != nil || note.NotebookID != notebookID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Note not found"})
+		return
+	}
+	if note.Type == "infograph" || note.Type == "ppt" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Image notes cannot be continued"})
+		return
+	}
+	// Notes are only continued when generation reported truncation, unless forced
+	if truncated, _ := note.Metadata["truncated"].(bool); !truncated && c.Query("force") != "true" {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Note is not truncated", Code: "not_truncated"})
+		return
+	}
+
+	sources, err := s.store.ListSources(ctx, notebookID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get sources"})
+		return
+	}
+	if len(note.SourceIDs) > 0 {
+		wanted := make(map[string]bool, len(note.SourceIDs))
+		for _, id := range note.SourceIDs {
+			wanted[id] = true
+		}
+		filtered := make([]Source, 0, len(note.SourceIDs))
+		for _, src := range sources {
+			if wanted[src.ID] {
+				filtered = append(filtered, src)
+			}
+		}
+		sources = filtered
+	}
+
+	charge, ok := s.consumeQuota(c, userID, QuotaKindTransform)
+	if !ok {
+		return
+	}
+
+	requestJSON, _ := json.Marshal(map[string]interface{}{"note_id": note.ID, "force": c.Query("force") == "true"})
+	gen := &Generation{
+		UserID:     userID,
+		NotebookID: notebookID,
+		NoteID:     note.ID,
+		Type:       "continue",
+		Request:    string(requestJSON),
+		Model:      s.agent.textModelName(),
+	}
+	if err := s.store.CreateGeneration(ctx, gen); err != nil {
+		golog.Errorf("failed to record generation: %v", err)
+	}
+
+	// Keep asking until the model finishes naturally or the limit is reached
+	rounds := 0
+	finishReason := ""
+	for rounds < s.cfg.MaxNoteContinuations {
+		continuation, reason, err := s.agent.ContinueNote(c.Request.Context(), note, sources)
+		if err != nil {
+			golog.Errorf("failed to continue note %s: %v", note.ID, err)
+			if rounds == 0 {
+				charge.release(s.store)
+				gen.Status = GenerationStatusFailed
+				gen.Error = err.Error()
+				if err := s.store.FinishGeneration(ctx, gen); err != nil {
+					golog.Errorf("failed to update generation %s: %v", gen.ID, err)
+				}
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: fmt.Sprintf("Generation failed: %v", err)})
+				return
+			}
+			// Keep what was generated so far; the note stays marked as truncated
+			finishReason = "length"
+			break
+		}
+		rounds++
+		gen.PromptTokens += estimateTokens(note.Content)
+		gen.CompletionTokens += estimateTokens(continuation)
+		note.Content += continuation
+		finishReason = reason
+		if !isTruncatedFinish(reason) || strings.TrimSpace(continuation) == "" {
+			break
+		}
+	}
+
+	// Notes created by hand are stored without metadata
+	if note.Metadata == nil {
+		note.Metadata = map[string]interface{}{}
+	}
+	previous, _ := note.Metadata["continuations"].(float64)
+	note.Metadata["continuations"] = int(previous) + rounds
+	note.Metadata["finish_reason"] = finishReason
+	note.Metadata["truncated"] = isTruncatedFinish(finishReason)
+
+	if err := s.store.UpdateNote(ctx, note); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update note"})
+		return
+	}
+
+	gen.Status = GenerationStatusSucceeded
+	if err := s.store.FinishGeneration(ctx, gen); err != nil {
+		golog.Errorf("failed to update generation %s: %v", gen.ID, err)
+	}
+
+	// Log continuation activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "continue_note",
+		ResourceType: "note",
+		ResourceID:   note.ID,
+		ResourceName: note.Title,
+		Details:      fmt.Sprintf(`{"notebook_id": "%s", "rounds": %d, "finish_reason": "%s"}`, notebookID, rounds, finishReason),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log continuation activity: %v", err)
+	}
+
+	c.JSON(http.StatusOK, note)
+}
+
 // Transformation handlers
 
 func (s *Server) handleTransform(c *gin.Context) {
 	ctx := context.Background()
 	notebookID := c.Param("id")
 	userID := c.GetString("user_id")
+	locale := s.resolveLocale(c)
 
 	// 按需加载向量索引
 	if err := s.loadNotebookVectorIndex(ctx, notebookID); err != nil {
@@ -737,8 +1757,60 @@ func (s *Server) handleTransform(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	if !s.checkRequestModel(c, req.Model) {
+		return
+	}
+
+	switch req.ResponseFormat {
+	case "", ResponseFormatMarkdown:
+	case ResponseFormatJSON:
+		if _, ok := structuredSchemas[req.Type]; !ok {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   fmt.Sprintf("response_format json is not supported for %s transformations", req.Type),
+				Details: "supported types: " + strings.Join(structuredTypes(), ", "),
+			})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "response_format must be markdown or json"})
+		return
+	}
+
+	if req.OutputLanguage != "" {
+		locale := normalizeLocale(req.OutputLanguage)
+		if locale == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Unsupported output_language", Details: "supported: " + strings.Join(supportedLocales(), ", ")})
+			return
+		}
+		req.OutputLanguage = locale
+	}
+
+	if req.WebhookURL != "" {
+		if s.cfg.WebhookSecret == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Webhooks are not enabled on this server", Code: "webhooks_disabled"})
+			return
+		}
+		if err := checkPublicURL(ctx, req.WebhookURL); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid webhook_url", Details: err.Error()})
+			return
+		}
+	}
+
+	// Podcasts fill the settings the request leaves out from the notebook's defaults
+	if req.Type == "podcast" {
+		settings, err := s.resolvePodcastSettings(ctx, notebookID, req.Podcast)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		req.Podcast = settings
+	} else {
+		req.Podcast = nil
+	}
 
-	// Check if multiple notes of same type are allowed
+	// Check if multiple notes of same type are allowed. With force the existing notes
+	// are replaced once the new one is saved.
+	var replaced []Note
 	if !s.cfg.AllowMultipleNotesOfSameType {
 		existingNotes, err := s.store.ListNotes(ctx, notebookID)
 		if err != nil {
@@ -746,71 +1818,249 @@ func (s *Server) handleTransform(c *gin.Context) {
 			return
 		}
 		for _, note := range existingNotes {
-			if note.Type == req.Type {
-				c.JSON(http.StatusConflict, ErrorResponse{Error: "该笔记本已存在相同类型的笔记，不允许创建重复类型"})
+			if note.Type != req.Type {
+				continue
+			}
+			if !req.Force {
+				c.JSON(http.StatusConflict, ErrorResponse{Error: translate(locale, "error.duplicate_note_type")})
 				return
 			}
+			replaced = append(replaced, note)
 		}
 	}
 
 	// Get sources
-	sources, err := s.store.ListSources(ctx, notebookID)
+	var sources []Source
+	var err error
+	if len(req.NoteIDs) > 0 {
+		// Meta-transform: use existing notes as the input context
+		sources, req.SourceIDs, err = s.notesAsSources(ctx, notebookID, req.NoteIDs)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	} else {
+		sources, err = s.store.ListSources(ctx, notebookID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get sources"})
+			return
+		}
+
+		if len(req.SourceIDs) > 0 {
+			// Filter by specified source IDs
+			filtered := make([]Source, 0)
+			sourceMap := make(map[string]bool)
+			for _, id := range req.SourceIDs {
+				sourceMap[id] = true
+			}
+			for _, src := range sources {
+				if sourceMap[src.ID] {
+					filtered = append(filtered, src)
+				}
+			}
+			sources = filtered
+		} else {
+			// If no source IDs specified, use all and populate the list for the note
+			req.SourceIDs = make([]string, len(sources))
+			for i, src := range sources {
+				req.SourceIDs[i] = src.ID
+			}
+		}
+	}
+
+	// Sources flagged always_include are part of every transformation
+	if pinned := s.notebookPinnedSources(ctx, notebookID); len(pinned) > 0 {
+		sources = withPinnedSources(pinned, sources)
+		for _, src := range pinned {
+			if !slices.Contains(req.SourceIDs, src.ID) {
+				req.SourceIDs = append(req.SourceIDs, src.ID)
+			}
+		}
+	}
+
+	if len(sources) == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "No sources available"})
+		return
+	}
+
+	// Images follow an explicit output_language, otherwise their own resolution
+	requestedLanguage := req.OutputLanguage
+	req.OutputLanguage = s.outputLanguage(ctx, notebookID, req.OutputLanguage)
+
+	charge, ok := s.consumeQuota(c, userID, transformQuotaKind(req.Type))
+	if !ok {
+		return
+	}
+
+	task := &transformTask{
+		UserID:     userID,
+		NotebookID: notebookID,
+		Locale:     locale,
+		Language:   s.transformLanguage(ctx, c, notebookID, sources, requestedLanguage),
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.GetHeader("User-Agent"),
+		Req:        &req,
+		Sources:    sources,
+		Replaces:   replaced,
+		Quota:      charge,
+	}
+
+	// With a webhook the note ID is returned right away and the note posted when done
+	if req.WebhookURL != "" {
+		s.startWebhookTransform(c, task)
+		return
+	}
+
+	// Async mode: run in the background and let the client poll the job
+	if req.Async {
+		job := s.jobs.Start(userID, notebookID, "transform", func(ctx context.Context, job *Job) (interface{}, error) {
+			return s.runTransform(ctx, job, task)
+		})
+		c.JSON(http.StatusAccepted, job)
+		return
+	}
+
+	// Synchronous runs stop when the request deadline passes or the client goes away. They
+	// are tracked as jobs too, so another request can list and cancel them.
+	job, jobCtx := s.jobs.Begin(c.Request.Context(), userID, notebookID, "transform")
+	note, err := s.runTransform(jobCtx, job, task)
+	s.jobs.Finish(job, note, err)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get sources"})
+		if errors.Is(err, context.Canceled) && c.Request.Context().Err() == nil {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "Transformation cancelled", Code: "transform_cancelled"})
+			return
+		}
+		var outputErr *StructuredOutputError
+		if errors.As(err, &outputErr) {
+			c.JSON(http.StatusUnprocessableEntity, ErrorResponse{
+				Error:   "Model output does not match the JSON schema",
+				Code:    "invalid_structured_output",
+				Details: strings.Join(outputErr.Errors, "; "),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	if len(req.SourceIDs) > 0 {
-		// Filter by specified source IDs
-		filtered := make([]Source, 0)
-		sourceMap := make(map[string]bool)
-		for _, id := range req.SourceIDs {
-			sourceMap[id] = true
-		}
-		for _, src := range sources {
-			if sourceMap[src.ID] {
-				filtered = append(filtered, src)
-			}
-		}
-		sources = filtered
-	} else {
-		// If no source IDs specified, use all and populate the list for the note
-		req.SourceIDs = make([]string, len(sources))
-		for i, src := range sources {
-			req.SourceIDs[i] = src.ID
-		}
+	c.JSON(http.StatusOK, note)
+}
+
+// transformTask carries everything a transformation needs once the request is validated
+type transformTask struct {
+	UserID     string
+	NotebookID string
+	Locale     string
+	Language   string // language of text generated into images
+	IPAddress  string
+	UserAgent  string
+	Req        *TransformationRequest
+	Sources    []Source
+	Replaces   []Note       // notes of the same type deleted once the new note is saved
+	NoteID     string       // reserved ID of the note, empty to assign one on save
+	Quota      *quotaCharge // daily quota charged for this run, released if it does not succeed
+}
+
+// runTransform generates the transformation, any images it needs, and saves the result
+// as a note. Generated files are registered on job so they can be removed if the job is
+// cancelled; job may be nil when the run is not tracked. Every run is recorded
+// in the generations table.
+func (s *Server) runTransform(ctx context.Context, job *Job, task *transformTask) (*Note, error) {
+	req := task.Req
+	requestJSON, _ := json.Marshal(req)
+	gen := &Generation{
+		UserID:     task.UserID,
+		NotebookID: task.NotebookID,
+		Type:       req.Type,
+		Request:    string(requestJSON),
+	}
+	// Bookkeeping uses its own context so a cancelled job is still recorded
+	if err := s.store.CreateGeneration(context.Background(), gen); err != nil {
+		golog.Errorf("failed to record generation: %v", err)
 	}
 
-	if len(sources) == 0 {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "No sources available"})
-		return
+	note, err := s.generateNote(ctx, job, task, gen)
+
+	switch {
+	case err == nil:
+		gen.Status = GenerationStatusSucceeded
+		gen.NoteID = note.ID
+	case ctx.Err() != nil:
+		gen.Status = GenerationStatusCancelled
+	default:
+		gen.Status = GenerationStatusFailed
+		gen.Error = err.Error()
+	}
+	if err := s.store.FinishGeneration(context.Background(), gen); err != nil {
+		golog.Errorf("failed to update generation %s: %v", gen.ID, err)
+	}
+	if err != nil {
+		task.Quota.release(s.store)
 	}
 
+	return note, err
+}
+
+// generateNote does the work of runTransform and fills in the model details of gen
+func (s *Server) generateNote(ctx context.Context, job *Job, task *transformTask, gen *Generation) (*Note, error) {
+	req := task.Req
+	notebookID := task.NotebookID
+	userID := task.UserID
+	locale := task.Locale
+
 	// Generate transformation
-	response, err := s.agent.GenerateTransformation(ctx, &req, sources)
+	job.SetProgress("stage", "generating")
+	response, err := s.agent.GenerateTransformation(ctx, req, task.Sources)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: fmt.Sprintf("Generation failed: %v", err)})
-		return
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("Generation failed: %w", err)
 	}
+	gen.Model, _ = response.Metadata["model"].(string)
+	gen.PromptTokens, _ = response.Metadata["prompt_tokens"].(int)
+	gen.CompletionTokens, _ = response.Metadata["completion_tokens"].(int)
 
 	metadata := map[string]interface{}{
 		"length": req.Length,
 		"format": req.Format,
 	}
+	if len(req.NoteIDs) > 0 {
+		metadata["input_note_ids"] = req.NoteIDs
+	}
+	// Record truncation so the note can be continued later
+	if reason, ok := response.Metadata["finish_reason"].(string); ok {
+		metadata["finish_reason"] = reason
+		metadata["truncated"] = response.Metadata["truncated"]
+	}
+	// Record that the sources were condensed because they exceeded the context window
+	if mapReduce, ok := response.Metadata["map_reduce"].(bool); ok && mapReduce {
+		metadata["map_reduce"] = true
+		metadata["map_reduce_summaries"] = response.Metadata["map_reduce_summaries"]
+	}
+	// Structured output is kept next to its markdown rendering in the content
+	if structured, ok := response.Metadata["structured"]; ok {
+		metadata["response_format"] = ResponseFormatJSON
+		metadata["structured"] = structured
+	}
+
+	if req.Podcast != nil {
+		metadata["podcast"] = req.Podcast
+	}
 
 	// If type is infograph, generate the image as well
 	if req.Type == "infograph" {
-		extra := "**注意：无论来源是什么语言，请务必使用中文**"
-		prompt := response.Content + "\n\n" + extra
+		job.SetProgress("stage", "generating_image")
+		prompt := response.Content + "\n\n" + imageLanguageInstruction(s.cfg, task.Language)
 		imageModel := s.getImageModelForProvider()
 		imagePath, err := s.agent.provider.GenerateImage(ctx, imageModel, prompt, userID)
 		if err != nil {
 			golog.Errorf("failed to generate infographic image: %v", err)
 			metadata["image_error"] = err.Error()
 		} else {
-			// Convert local path to web path (authenticated API)
-			webPath := "/api/files/" + filepath.Base(imagePath)
-			metadata["image_url"] = webPath
+			job.AddStoredArtifact(s.storage, imagePath)
+			// Served through the authenticated file API
+			metadata["image_url"] = s.storage.URL(imagePath)
 		}
 	}
 
@@ -819,28 +2069,22 @@ func (s *Server) handleTransform(c *gin.Context) {
 		slides := s.agent.ParsePPTSlides(response.Content)
 		if len(slides) > 10 {
 			golog.Errorf("ppt contains too many slides (%d), maximum allowed is 20. skipping image generation.", len(slides))
-			metadata["image_error"] = "PPT页数超过20页上限，已停止生成图片"
+			metadata["image_error"] = translate(locale, "error.ppt_too_many_slides")
 		} else {
-			var slideURLs []string
 			golog.Infof("generating %d slides for ppt...", len(slides))
-
-			for i, slide := range slides {
-				golog.Infof("generating image for slide %d/%d...", i+1, len(slides))
-				// Combine style and slide content for the image generator
-				prompt := fmt.Sprintf("Style: %s\n\nSlide Content: %s", slides[0].Style, slide.Content)
-				prompt += "\n\n**注意：无论来源是什么语言，请务必使用中文**\n"
-				imageModel := s.getImageModelForProvider()
-				imagePath, err := s.agent.provider.GenerateImage(ctx, imageModel, prompt, userID)
-				if err != nil {
-					golog.Errorf("failed to generate slide %d: %v", i+1, err)
-					continue
-				}
-				slideURLs = append(slideURLs, "/api/files/"+filepath.Base(imagePath))
-			}
+			slideURLs, slideErrors := s.generateSlideImages(ctx, job, slides, task.Language, userID)
 			metadata["slides"] = slideURLs
+			if len(slideErrors) > 0 {
+				metadata["slide_errors"] = slideErrors
+			}
 		}
 	}
 
+	// Don't save anything if the job was cancelled while generating
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// Save as note
 	// For infograph type: clear content only when image generation succeeds
 	// If image generation fails, keep the prompt as content so user can see/retry it
@@ -854,8 +2098,9 @@ func (s *Server) handleTransform(c *gin.Context) {
 	}
 
 	note := &Note{
+		ID:         task.NoteID,
 		NotebookID: notebookID,
-		Title:      getTitleForType(req.Type),
+		Title:      getTitleForType(req.Type, locale),
 		Content:    noteContent,
 		Type:       req.Type,
 		SourceIDs:  req.SourceIDs,
@@ -863,8 +2108,10 @@ func (s *Server) handleTransform(c *gin.Context) {
 	}
 
 	if err := s.store.CreateNote(ctx, note); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save note"})
-		return
+		return nil, fmt.Errorf("Failed to save note")
+	}
+	if len(task.Replaces) > 0 {
+		s.replaceNotes(ctx, notebookID, task.Replaces)
 	}
 
 	// Log transformation activity
@@ -875,8 +2122,8 @@ func (s *Server) handleTransform(c *gin.Context) {
 		ResourceID:   note.ID,
 		ResourceName: note.Title,
 		Details:      fmt.Sprintf(`{"notebook_id": "%s", "transform_type": "%s", "length": "%s", "format": "%s", "source_count": %d}`, notebookID, req.Type, req.Length, req.Format, len(req.SourceIDs)),
-		IPAddress:    c.ClientIP(),
-		UserAgent:    c.GetHeader("User-Agent"),
+		IPAddress:    task.IPAddress,
+		UserAgent:    task.UserAgent,
 	}
 	if err := s.store.LogActivity(ctx, activityLog); err != nil {
 		golog.Errorf("failed to log transformation activity: %v", err)
@@ -886,7 +2133,7 @@ func (s *Server) handleTransform(c *gin.Context) {
 	if req.Type == "insight" {
 		insightSource := &Source{
 			NotebookID: notebookID,
-			Name:       "洞察报告",
+			Name:       translate(locale, "source.insight_report"),
 			Type:       "insight",
 			Content:    response.Content,
 			Metadata: map[string]interface{}{
@@ -895,40 +2142,201 @@ func (s *Server) handleTransform(c *gin.Context) {
 			},
 		}
 
+		s.vectorStore.AssignChunkStrategy(insightSource)
 		if err := s.store.CreateSource(ctx, insightSource); err != nil {
 			golog.Errorf("failed to create insight source: %v", err)
 		} else {
 			// Ingest into vector store for future reference
-			if chunkCount, err := s.vectorStore.IngestText(ctx, notebookID, insightSource.Name, insightSource.Content); err != nil {
+			if _, err := s.indexSource(ctx, insightSource); err != nil {
 				golog.Errorf("failed to ingest insight text: %v", err)
-			} else {
-				s.store.UpdateSourceChunkCount(ctx, insightSource.ID, chunkCount)
 			}
 		}
 	}
 
-	c.JSON(http.StatusOK, note)
+	return note, nil
+}
+
+// replaceNotes deletes the notes a forced transformation regenerated. The old notes are
+// only removed after the new one is saved, so a failed run keeps them.
+func (s *Server) replaceNotes(ctx context.Context, notebookID string, notes []Note) {
+	notebook, err := s.store.GetNotebook(ctx, notebookID)
+	if err != nil {
+		golog.Errorf("failed to get notebook %s to replace notes: %v", notebookID, err)
+		return
+	}
+	for i := range notes {
+		if err := s.store.DeleteNote(ctx, notes[i].ID); err != nil {
+			golog.Errorf("failed to delete replaced note %s: %v", notes[i].ID, err)
+			continue
+		}
+		s.removeNoteImages(ctx, &notes[i], notebook.UserID)
+		golog.Infof("replaced %s note %s of notebook %s", notes[i].Type, notes[i].ID, notebookID)
+	}
+}
+
+// recordSourceUsage counts the sources cited by a chat answer when usage tracking is enabled
+func (s *Server) recordSourceUsage(ctx context.Context, notebookID string, sourceIDs []string) {
+	if !s.cfg.TrackSourceUsage {
+		return
+	}
+	if err := s.store.IncrementSourceCitations(ctx, notebookID, sourceIDs); err != nil {
+		golog.Errorf("failed to record source usage: %v", err)
+	}
+}
+
+// notesAsSources loads the given notes, verifies they belong to the notebook and wraps
+// them as sources so they can feed a transformation. It also returns the union of the
+// notes' own source IDs so the generated note keeps its provenance.
+func (s *Server) notesAsSources(ctx context.Context, notebookID string, noteIDs []string) ([]Source, []string, error) {
+	sources := make([]Source, 0, len(noteIDs))
+	sourceIDs := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, id := range noteIDs {
+		note, err := s.store.GetNote(ctx, id)
+		if err != nil || note.NotebookID != notebookID {
+			return nil, nil, fmt.Errorf("note %s not found in this notebook", id)
+		}
+
+		sources = append(sources, Source{
+			ID:         note.ID,
+			NotebookID: note.NotebookID,
+			Name:       note.Title,
+			Type:       "note",
+			Content:    note.Content,
+		})
+
+		for _, srcID := range note.SourceIDs {
+			if !seen[srcID] {
+				seen[srcID] = true
+				sourceIDs = append(sourceIDs, srcID)
+			}
+		}
+	}
+
+	return sources, sourceIDs, nil
+}
+
+// chatOptions derives chat behaviour from the notebook's metadata and the request locale
+func (s *Server) chatOptions(c *gin.Context, notebook *Notebook) ChatOptions {
+	return ChatOptions{
+		StrictGrounding: metadataBool(notebook.Metadata, "strict_grounding"),
+		Locale:          s.resolveLocale(c),
+		PinnedSources:   s.notebookPinnedSources(context.Background(), notebook.ID),
+		SystemPrompt:    notebookSystemPrompt(notebook),
+		Model:           c.GetString(requestModelKey),
+	}
 }
 
-func getTitleForType(t string) string {
-	titles := map[string]string{
-		"summary":     "摘要",
-		"faq":         "常见问题解答",
-		"study_guide": "学习指南",
-		"outline":     "大纲",
-		"podcast":     "播客脚本",
-		"timeline":    "时间线",
-		"glossary":    "术语表",
-		"quiz":        "测验",
-		"infograph":   "信息图",
-		"ppt":         "幻灯片",
-		"mindmap":     "思维导图",
-		"insight":     "洞察报告",
-	}
-	if title, ok := titles[t]; ok {
+// getTitleForType returns the localized default title for a note type
+func getTitleForType(t, locale string) string {
+	key := "note.title." + t
+	if title := translate(locale, key); title != key {
 		return title
 	}
-	return "笔记"
+	return translate(locale, "note.title.default")
+}
+
+// Usage handlers
+
+// handleListGenerations lists the user's transformation runs along with per-type totals
+// for the last N days (default 30)
+func (s *Server) handleListGenerations(c *gin.Context) {
+	ctx := context.Background()
+	userID := c.GetString("user_id")
+
+	days := 30
+	if v := c.Query("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "days must be a positive integer"})
+			return
+		}
+		days = n
+	}
+	offset, limit := parsePagination(c, 50, 200)
+
+	generations, err := s.store.ListGenerations(ctx, userID, offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list generations"})
+		return
+	}
+
+	usage, err := s.store.GetGenerationUsage(ctx, userID, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, GenerationsResponse{
+		Generations: generations,
+		Usage:       usage,
+		Days:        days,
+		Offset:      offset,
+		Limit:       limit,
+	})
+}
+
+// Job handlers
+
+func (s *Server) handleGetJob(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	job, ok := s.jobs.Get(c.Param("id"))
+	if !ok || job.UserID != userID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// handleListTransforms lists the user's transformations of a notebook that are still running
+func (s *Server) handleListTransforms(c *gin.Context) {
+	respondList(c, s.jobs.Running(c.GetString("user_id"), c.Param("id"), "transform"))
+}
+
+// handleCancelTransform stops a running transformation of a notebook, started in any mode.
+// Images already generated for it are removed and its daily quota is released.
+func (s *Server) handleCancelTransform(c *gin.Context) {
+	userID := c.GetString("user_id")
+	notebookID := c.Param("id")
+	jobID := c.Param("jobId")
+
+	job, ok := s.jobs.Get(jobID)
+	if !ok || job.UserID != userID || job.NotebookID != notebookID || job.Type != "transform" {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Transformation not found"})
+		return
+	}
+
+	job, err := s.jobs.Cancel(jobID)
+	if err != nil {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	golog.Infof("transformation %s of notebook %s cancelled by user %s", jobID, notebookID, userID)
+	c.JSON(http.StatusOK, job)
+}
+
+func (s *Server) handleCancelJob(c *gin.Context) {
+	userID := c.GetString("user_id")
+	jobID := c.Param("id")
+
+	job, ok := s.jobs.Get(jobID)
+	if !ok || job.UserID != userID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Job not found"})
+		return
+	}
+
+	job, err := s.jobs.Cancel(jobID)
+	if err != nil {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	golog.Infof("job %s cancelled by user %s", jobID, userID)
+	c.JSON(http.StatusOK, job)
 }
 
 // Chat handlers
@@ -943,7 +2351,28 @@ func (s *Server) handleListChatSessions(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, sessions)
+	respondList(c, sessions)
+}
+
+// handleListChatSessionsWithStats lists chat sessions with message counts and a preview of the
+// last message, so session lists render without loading each session
+func (s *Server) handleListChatSessionsWithStats(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	sessions, err := s.store.ListChatSessionsWithStats(ctx, notebookID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list chat sessions"})
+		return
+	}
+
+	respondList(c, sessions)
 }
 
 func (s *Server) handleCreateChatSession(c *gin.Context) {
@@ -977,6 +2406,48 @@ func (s *Server) handleDeleteChatSession(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// handleDeleteChatMessage removes a message from a chat session. With ?with_reply=true,
+// deleting a user message also deletes the assistant's answer to it.
+func (s *Server) handleDeleteChatMessage(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	sessionID := c.Param("sessionId")
+	messageID := c.Param("messageId")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	deleted, err := s.store.DeleteChatMessage(ctx, notebookID, sessionID, messageID, c.Query("with_reply") == "true")
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Message not found"})
+			return
+		}
+		golog.Errorf("failed to delete chat message %s: %v", messageID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete message"})
+		return
+	}
+
+	// Log message deletion activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "delete_chat_message",
+		ResourceType: "chat_message",
+		ResourceID:   messageID,
+		Details:      fmt.Sprintf(`{"notebook_id": "%s", "session_id": "%s", "deleted": %d}`, notebookID, sessionID, len(deleted)),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log message deletion activity: %v", err)
+	}
+
+	c.JSON(http.StatusOK, ChatMessageDeletion{SessionID: sessionID, Deleted: deleted})
+}
+
 func (s *Server) handleSendMessage(c *gin.Context) {
 	ctx := context.Background()
 	notebookID := c.Param("id")
@@ -992,9 +2463,24 @@ func (s *Server) handleSendMessage(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	if !s.checkRequestModel(c, req.Model) {
+		return
+	}
+	c.Set(requestModelKey, req.Model)
+
+	notebook, err := s.store.GetNotebook(ctx, notebookID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Notebook not found"})
+		return
+	}
+
+	charge, ok := s.consumeQuota(c, c.GetString("user_id"), QuotaKindChat)
+	if !ok {
+		return
+	}
 
 	// Add user message
-	_, err := s.store.AddChatMessage(ctx, sessionID, "user", req.Message, nil)
+	_, err = s.store.AddChatMessage(ctx, sessionID, "user", req.Message, nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to add message"})
 		return
@@ -1007,9 +2493,17 @@ func (s *Server) handleSendMessage(c *gin.Context) {
 		return
 	}
 
+	s.maybeGenerateSessionTitle(session, c.GetString("user_id"), req.Message)
+
+	if wantsEventStream(c) {
+		s.streamChat(c, notebook, session, req.Message, charge, false)
+		return
+	}
+
 	// Generate response
-	response, err := s.agent.Chat(ctx, notebookID, req.Message, session.Messages)
+	response, err := s.agent.Chat(c.Request.Context(), notebookID, req.Message, session.Messages, s.sessionChatOptions(c, notebook, session))
 	if err != nil {
+		charge.release(s.store)
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: fmt.Sprintf("Chat failed: %v", err)})
 		return
 	}
@@ -1019,11 +2513,13 @@ func (s *Server) handleSendMessage(c *gin.Context) {
 	for i, src := range response.Sources {
 		sourceIDs[i] = src.ID
 	}
-	_, err = s.store.AddChatMessage(ctx, sessionID, "assistant", response.Message, sourceIDs)
+	_, err = s.store.AddChatMessageWithMetadata(ctx, sessionID, "assistant", response.Message, sourceIDs, response.Metadata)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save response"})
 		return
 	}
+	s.recordSourceUsage(ctx, notebookID, sourceIDs)
+	s.maybeSummarizeHistory(session, c.GetString("user_id"))
 
 	c.JSON(http.StatusOK, response)
 }
@@ -1042,6 +2538,21 @@ func (s *Server) handleChat(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	if !s.checkRequestModel(c, req.Model) {
+		return
+	}
+	c.Set(requestModelKey, req.Model)
+
+	notebook, err := s.store.GetNotebook(ctx, notebookID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Notebook not found"})
+		return
+	}
+
+	charge, ok := s.consumeQuota(c, c.GetString("user_id"), QuotaKindChat)
+	if !ok {
+		return
+	}
 
 	// Create or get session
 	sessionID := req.SessionID
@@ -1061,9 +2572,17 @@ func (s *Server) handleChat(c *gin.Context) {
 		return
 	}
 
+	s.maybeGenerateSessionTitle(session, c.GetString("user_id"), req.Message)
+
+	if wantsEventStream(c) {
+		s.streamChat(c, notebook, session, req.Message, charge, true)
+		return
+	}
+
 	// Generate response
-	response, err := s.agent.Chat(ctx, notebookID, req.Message, session.Messages)
+	response, err := s.agent.Chat(c.Request.Context(), notebookID, req.Message, session.Messages, s.sessionChatOptions(c, notebook, session))
 	if err != nil {
+		charge.release(s.store)
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: fmt.Sprintf("Chat failed: %v", err)})
 		return
 	}
@@ -1076,7 +2595,9 @@ func (s *Server) handleChat(c *gin.Context) {
 		sourceIDs[i] = src.ID
 	}
 	s.store.AddChatMessage(ctx, sessionID, "user", req.Message, nil)
-	s.store.AddChatMessage(ctx, sessionID, "assistant", response.Message, sourceIDs)
+	s.store.AddChatMessageWithMetadata(ctx, sessionID, "assistant", response.Message, sourceIDs, response.Metadata)
+	s.recordSourceUsage(ctx, notebookID, sourceIDs)
+	s.maybeSummarizeHistory(session, c.GetString("user_id"))
 
 	c.JSON(http.StatusOK, response)
 }
@@ -1104,6 +2625,11 @@ func (s *Server) handleServeFile(c *gin.Context) {
 		return
 	}
 
+	if isContentHashFileName(filename) {
+		s.serveContentAddressedFile(c, filename, userID)
+		return
+	}
+
 	var ownerUserID string
 	var isPublic bool
 	var notebookID string
@@ -1126,9 +2652,15 @@ func (s *Server) handleServeFile(c *gin.Context) {
 			ownerUserID = nb.UserID
 			isPublic = nb.IsPublic
 			notebookID = nb.ID
+		} else if podcast, nb := s.podcastByFileName(ctx, filename); podcast != nil {
+			// Podcast audio
+			golog.Infof("File found in podcasts table, podcast_id: %s, notebook_id: %s", podcast.ID, nb.ID)
+			ownerUserID = nb.UserID
+			isPublic = nb.IsPublic
+			notebookID = nb.ID
 		} else {
-			// File not found in either table
-			golog.Errorf("File not found in either table (notes err: %v)", err)
+			// File not found in any table
+			golog.Errorf("File not found in any table (notes err: %v)", err)
 			c.JSON(http.StatusNotFound, ErrorResponse{Error: "File not found"})
 			return
 		}
@@ -1140,6 +2672,9 @@ func (s *Server) handleServeFile(c *gin.Context) {
 	if isPublic {
 		// Public notebook - allow access
 		golog.Debugf("Serving public file: %s from notebook: %s", filename, notebookID)
+	} else if share, _, ok := s.validShare(ctx, c.Query("share")); ok && share.NotebookID == notebookID {
+		// Shared link of the notebook - allow access
+		golog.Debugf("Serving shared file: %s from notebook: %s", filename, notebookID)
 	} else {
 		// Private notebook - require authentication and ownership
 		if userID == "" {
@@ -1153,67 +2688,117 @@ func (s *Server) handleServeFile(c *gin.Context) {
 		}
 	}
 
-	// Build file path using the owner's user ID
-	filePath := filepath.Join("./data/uploads", ownerUserID, filename)
+	// Security check: the name must not reach outside the owner's files
+	if strings.ContainsAny(filename, "/\\") || filename == "." || filename == ".." {
+		golog.Warnf("Attempted directory traversal for file: %s", filename)
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Access denied"})
+		return
+	}
 
-	golog.Infof("Trying to load file: %s (owner: %s, public: %v)", filePath, ownerUserID, isPublic)
+	// Files are stored under the owner's user ID
+	key := uploadKey(ownerUserID, filename)
+	golog.Infof("Trying to load file: %s (owner: %s, public: %v)", key, ownerUserID, isPublic)
 
-	// Security check
-	absPath, err := filepath.Abs(filePath)
+	obj, err := s.storage.Get(c.Request.Context(), key)
 	if err != nil {
-		golog.Errorf("Failed to get absolute path for %s: %v", filePath, err)
+		golog.Errorf("File not found: %s: %v", key, err)
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "File not found"})
 		return
 	}
+	defer obj.Close()
 
-	golog.Infof("Absolute path: %s", absPath)
+	golog.Infof("File found and serving: %s", key)
 
-	// Verify the path is within the uploads directory
-	absUploadDir, _ := filepath.Abs("./data/uploads")
-	if !strings.HasPrefix(absPath, absUploadDir) {
-		golog.Warnf("Attempted directory traversal for file: %s", filename)
-		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Access denied"})
-		return
+	c.Header("Content-Type", contentTypeForFile(filename))
+	s.setFileCacheHeaders(c, filename, obj, userID != "" && userID == ownerUserID, isPublic)
+	serveFileContent(c, filename, obj)
+
+	golog.Infof("File served: %s (notebook: %s, public: %v, user: %s)",
+		filename, notebookID, isPublic, userID)
+}
+
+// parsePagination reads offset/limit query parameters, applying a default and an upper bound to limit
+func parsePagination(c *gin.Context, defaultLimit, maxLimit int) (int, int) {
+	offset, err := strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
 	}
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return offset, limit
+}
 
-	// Check if file exists
-	if _, err := os.Stat(absPath); os.IsNotExist(err) {
-		golog.Errorf("File not found: %s", absPath)
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "File not found"})
-		return
+// metadataBool reads a boolean flag from a metadata map, accepting JSON booleans and strings
+func metadataBool(metadata map[string]interface{}, key string) bool {
+	switch v := metadata[key].(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	}
+	return false
+}
+
+// setFileCacheHeaders sets Cache-Control and ETag for a served file. Immutable files are
+// cached long-term: privately for their owner, publicly only as long as PUBLIC_FILE_MAX_AGE
+// so unpublishing a notebook takes effect in shared caches. Private mutable files are
+// always revalidated. The ETag lets serveFileContent answer revalidations with 304 Not Modified.
+func (s *Server) setFileCacheHeaders(c *gin.Context, filename string, obj *StorageObject, owned, isPublic bool) {
+	if isContentHashFileName(filename) {
+		c.Header("ETag", `"`+strings.TrimSuffix(filename, filepath.Ext(filename))+`"`)
+	} else {
+		c.Header("ETag", fmt.Sprintf(`"%x-%x"`, obj.ModTime.UnixNano(), obj.Size))
+	}
+
+	immutable := isImmutableFile(filename)
+	switch {
+	case immutable && owned && s.cfg.ImmutableFileMaxAge > 0:
+		c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d, immutable", s.cfg.ImmutableFileMaxAge))
+	case isPublic && s.cfg.PublicFileMaxAge > 0:
+		cacheControl := fmt.Sprintf("public, max-age=%d", s.cfg.PublicFileMaxAge)
+		if immutable {
+			cacheControl += ", immutable"
+		}
+		c.Header("Cache-Control", cacheControl)
+	default:
+		c.Header("Cache-Control", "no-cache")
 	}
+}
 
-	golog.Infof("File found and serving: %s", absPath)
+// serveFileContent writes a file for GET and HEAD requests. Range requests are answered
+// with 206 Partial Content so audio can be seeked and large downloads resumed; Content-Length
+// and Last-Modified are set, and conditional requests are checked against the ETag and
+// modification time.
+func serveFileContent(c *gin.Context, filename string, obj *StorageObject) {
+	c.Header("Accept-Ranges", "bytes")
+	http.ServeContent(c.Writer, c.Request, filename, obj.ModTime, obj)
+}
 
-	// Determine content type
-	ext := filepath.Ext(filename)
-	contentType := "application/octet-stream"
-	switch ext {
+// contentTypeForFile determines the content type of a served file from its extension
+func contentTypeForFile(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
 	case ".jpg", ".jpeg":
-		contentType = "image/jpeg"
+		return "image/jpeg"
 	case ".png":
-		contentType = "image/png"
+		return "image/png"
 	case ".gif":
-		contentType = "image/gif"
+		return "image/gif"
 	case ".webp":
-		contentType = "image/webp"
+		return "image/webp"
 	case ".svg":
-		contentType = "image/svg+xml"
+		return "image/svg+xml"
 	case ".pdf":
-		contentType = "application/pdf"
+		return "application/pdf"
+	case ".mp3":
+		return "audio/mpeg"
 	}
-
-	c.Header("Content-Type", contentType)
-	// Cache public files for 1 hour, private files for no-cache
-	if isPublic {
-		c.Header("Cache-Control", "public, max-age=3600")
-	} else {
-		c.Header("Cache-Control", "no-cache")
-	}
-	c.File(absPath)
-
-	golog.Infof("File served: %s (notebook: %s, public: %v, user: %s)",
-		filename, notebookID, isPublic, userID)
+	return "application/octet-stream"
 }
 
 func writeFile(path, content string) error {
@@ -1228,6 +2813,50 @@ func removeFile(path string) error {
 	return os.Remove(path)
 }
 
+// noteImageKeys resolves the image_url and slides of a generated note to the storage keys
+// of the user's files. References that would point outside of them are skipped.
+func noteImageKeys(note *Note, userID string) []string {
+	var urls []string
+	if imageURL, ok := note.Metadata["image_url"].(string); ok {
+		urls = append(urls, imageURL)
+	}
+	if slides, ok := note.Metadata["slides"].([]interface{}); ok {
+		for _, slide := range slides {
+			if slideURL, ok := slide.(string); ok {
+				urls = append(urls, slideURL)
+			}
+		}
+	}
+
+	return generatedFileKeys(urls, userID)
+}
+
+// generatedFileKeys maps the /api/files URLs of files generated for userID to their
+// storage keys. Content-addressed blobs and URLs served elsewhere are skipped.
+func generatedFileKeys(urls []string, userID string) []string {
+	if userID == "" {
+		return nil
+	}
+	keys := make([]string, 0, len(urls))
+	for _, u := range urls {
+		name, ok := strings.CutPrefix(u, "/api/files/")
+		// Content-addressed blobs can be shared, they are not owned by one note or podcast
+		if !ok || name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\?") || isContentHashFileName(name) {
+			continue
+		}
+		keys = append(keys, uploadKey(userID, name))
+	}
+	return keys
+}
+
+// removeNoteImages deletes the generated images of a note. Files that are already gone
+// or cannot be removed are logged, the note is deleted either way.
+func (s *Server) removeNoteImages(ctx context.Context, note *Note, userID string) {
+	for _, key := range noteImageKeys(note, userID) {
+		removeStored(ctx, s.storage, key, "image of note "+note.ID)
+	}
+}
+
 // getImageModelForProvider returns the image model based on configured provider
 func (s *Server) getImageModelForProvider() string {
 	switch s.cfg.ImageProvider {
@@ -1235,6 +2864,8 @@ func (s *Server) getImageModelForProvider() string {
 		return s.cfg.GLMImageModel
 	case "zimage":
 		return s.cfg.ZImageModel
+	case "openai":
+		return s.cfg.OpenAIImageModel
 	case "gemini":
 		return s.cfg.GeminiImageModel
 	default:
@@ -0,0 +1,135 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	// maxSessionTitleLength bounds chat session titles, in characters
+	maxSessionTitleLength = 100
+	// sessionTitleTimeout bounds the model call that names a session
+	sessionTitleTimeout = 30 * time.Second
+	// sessionTitleMessageLength is how much of the first message the model sees
+	sessionTitleMessageLength = 1000
+)
+
+// handleUpdateChatSession renames a chat session
+func (s *Server) handleUpdateChatSession(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var req struct {
+		Title string `json:"title" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "title must not be empty"})
+		return
+	}
+	if len([]rune(title)) > maxSessionTitleLength {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("title must be at most %d characters", maxSessionTitleLength)})
+		return
+	}
+
+	session, err := s.store.GetChatSession(ctx, c.Param("sessionId"))
+	if err != nil || session.NotebookID != notebookID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Chat session not found"})
+		return
+	}
+
+	session, err = s.store.UpdateChatSession(ctx, session.ID, title)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update chat session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// maybeGenerateSessionTitle names a session that still has the default title after the
+// given message, in the background. A title set by the user in the meantime is kept.
+// The title is charged to userID.
+func (s *Server) maybeGenerateSessionTitle(session *ChatSession, userID, message string) {
+	if !s.cfg.ChatAutoTitle || session.Title != defaultChatSessionTitle || strings.TrimSpace(message) == "" {
+		return
+	}
+
+	// One title at a time per session
+	if _, running := s.sessionTitles.LoadOrStore(session.ID, struct{}{}); running {
+		return
+	}
+	go func() {
+		defer s.sessionTitles.Delete(session.ID)
+
+		ctx, cancel := context.WithTimeout(context.Background(), sessionTitleTimeout)
+		defer cancel()
+		title, err := s.sessionModelCall(ctx, userID, session, "session_title", message, func(ctx context.Context) (string, error) {
+			return s.agent.GenerateSessionTitle(ctx, message)
+		})
+		if err != nil {
+			golog.Errorf("failed to generate title for chat session %s: %v", session.ID, err)
+			return
+		}
+		if title == "" {
+			return
+		}
+
+		current, err := s.store.GetChatSession(context.Background(), session.ID)
+		if err != nil || current.Title != defaultChatSessionTitle {
+			return
+		}
+		if _, err := s.store.UpdateChatSession(context.Background(), session.ID, title); err != nil {
+			golog.Errorf("failed to save title of chat session %s: %v", session.ID, err)
+		}
+	}()
+}
+
+// GenerateSessionTitle asks the text model for a short title of a conversation that
+// starts with message
+func (a *Agent) GenerateSessionTitle(ctx context.Context, message string) (string, error) {
+	if runes := []rune(message); len(runes) > sessionTitleMessageLength {
+		message = string(runes[:sessionTitleMessageLength])
+	}
+	title, err := llms.GenerateFromSinglePrompt(ctx, a.llm, chatSessionTitlePrompt(message), llms.WithMaxTokens(64))
+	if err != nil {
+		return "", err
+	}
+	return cleanSessionTitle(title), nil
+}
+
+// cleanSessionTitle keeps the first line of a generated title without surrounding quotes
+// or trailing punctuation, cut to maxSessionTitleLength
+func cleanSessionTitle(title string) string {
+	title = strings.TrimSpace(title)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = strings.TrimSpace(title[:i])
+	}
+	title = strings.TrimLeft(title, "# ")
+	for _, label := range []string{"标题：", "标题:", "Title:"} {
+		title = strings.TrimPrefix(title, label)
+	}
+	title = strings.Trim(title, " \"'`“”‘’《》「」*")
+	title = strings.TrimRight(title, "。.!！?？,，;；:：")
+	if runes := []rune(title); len(runes) > maxSessionTitleLength {
+		title = string(runes[:maxSessionTitleLength])
+	}
+	return strings.TrimSpace(title)
+}
@@ -0,0 +1,252 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+// NotebookShare is a read-only link to a snapshot of a notebook's notes. Anyone with the
+// token can read the notes until the link expires or is revoked; sources stay private.
+type NotebookShare struct {
+	Token      string     `json:"token"`
+	NotebookID string     `json:"notebook_id"`
+	UserID     string     `json:"user_id"` // who created the link
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // nil = until revoked
+}
+
+// expired reports whether the link can no longer be used
+func (sh *NotebookShare) expired() bool {
+	return sh.ExpiresAt != nil && !time.Now().Before(*sh.ExpiresAt)
+}
+
+// SharedNote is a note as seen through a share link
+type SharedNote struct {
+	ID        string                 `json:"id"`
+	Title     string                 `json:"title"`
+	Content   string                 `json:"content"`
+	Type      string                 `json:"type"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// SharedNotebook is the read-only snapshot returned for a share link
+type SharedNotebook struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Notes       []SharedNote `json:"notes"`
+	SharedAt    time.Time    `json:"shared_at"`
+	ExpiresAt   *time.Time   `json:"expires_at,omitempty"`
+}
+
+// newShareToken returns a random, unguessable share token
+func newShareToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// sharedFileURL appends the share token to a generated file URL, which lets anonymous
+// viewers of the link load the images of the notes
+func sharedFileURL(fileURL, token string) string {
+	if !strings.HasPrefix(fileURL, "/api/files/") {
+		return fileURL
+	}
+	return fileURL + "?share=" + url.QueryEscape(token)
+}
+
+// handleCreateShare creates a read-only share link of a notebook, optionally expiring
+func (s *Server) handleCreateShare(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var req struct {
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	// The body is optional, a link without expiry needs none
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "expires_at must be in the future"})
+		return
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create share link"})
+		return
+	}
+	share := &NotebookShare{Token: token, NotebookID: notebookID, UserID: userID, ExpiresAt: req.ExpiresAt}
+	if err := s.store.CreateShare(ctx, share); err != nil {
+		golog.Errorf("failed to create share of notebook %s: %v", notebookID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create share link"})
+		return
+	}
+
+	// Log share activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "share_notebook",
+		ResourceType: "notebook",
+		ResourceID:   notebookID,
+		Details:      fmt.Sprintf(`{"expires": %t}`, share.ExpiresAt != nil),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log share activity: %v", err)
+	}
+
+	c.JSON(http.StatusCreated, share)
+}
+
+// handleListShares lists the share links of a notebook, including expired ones
+func (s *Server) handleListShares(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, c.GetString("user_id")); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	shares, err := s.store.ListShares(ctx, notebookID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list share links"})
+		return
+	}
+
+	respondList(c, shares)
+}
+
+// handleRevokeShare deletes a share link; the token stops working immediately
+func (s *Server) handleRevokeShare(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := s.store.DeleteShare(ctx, notebookID, c.Param("token")); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Share link not found"})
+		return
+	}
+
+	// Log revoke activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "revoke_share",
+		ResourceType: "notebook",
+		ResourceID:   notebookID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log share activity: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// validShare returns the share of a token while it is usable: not revoked, not expired
+// and its notebook not in the trash
+func (s *Server) validShare(ctx context.Context, token string) (*NotebookShare, *Notebook, bool) {
+	if token == "" {
+		return nil, nil, false
+	}
+	share, err := s.store.GetShare(ctx, token)
+	if err != nil || share.expired() {
+		return nil, nil, false
+	}
+	notebook, err := s.store.GetNotebook(ctx, share.NotebookID)
+	if err != nil {
+		return nil, nil, false
+	}
+	return share, notebook, true
+}
+
+// handleGetSharedNotebook returns the read-only snapshot of a share link. It needs no
+// authentication: the token is the credential.
+func (s *Server) handleGetSharedNotebook(c *gin.Context) {
+	ctx := context.Background()
+	token := c.Param("token")
+
+	share, notebook, ok := s.validShare(ctx, token)
+	if !ok {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Shared notebook not found"})
+		return
+	}
+
+	notes, err := s.store.ListNotes(ctx, notebook.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list notes"})
+		return
+	}
+
+	snapshot := SharedNotebook{
+		Name:        notebook.Name,
+		Description: notebook.Description,
+		Notes:       make([]SharedNote, 0, len(notes)),
+		SharedAt:    share.CreatedAt,
+		ExpiresAt:   share.ExpiresAt,
+	}
+	for _, note := range notes {
+		// Copy the metadata, the cached notes must keep their own file URLs
+		metadata := make(map[string]interface{}, len(note.Metadata))
+		for k, v := range note.Metadata {
+			metadata[k] = v
+		}
+		if imageURL, ok := metadata["image_url"].(string); ok {
+			metadata["image_url"] = sharedFileURL(imageURL, token)
+		}
+		if slides, ok := metadata["slides"].([]interface{}); ok {
+			shared := make([]interface{}, len(slides))
+			for i, slide := range slides {
+				if slideURL, ok := slide.(string); ok {
+					shared[i] = sharedFileURL(slideURL, token)
+				} else {
+					shared[i] = slide
+				}
+			}
+			metadata["slides"] = shared
+		}
+
+		snapshot.Notes = append(snapshot.Notes, SharedNote{
+			ID:        note.ID,
+			Title:     note.Title,
+			Content:   note.Content,
+			Type:      note.Type,
+			CreatedAt: note.CreatedAt,
+			UpdatedAt: note.UpdatedAt,
+			Metadata:  metadata,
+		})
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, snapshot)
+}
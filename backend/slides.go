@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/kataras/golog"
+)
+
+// SlideError records a slide of a deck whose image could not be generated
+type SlideError struct {
+	Slide int    `json:"slide"` // 1-based position in the deck
+	Error string `json:"error"`
+}
+
+// generateSlideImages generates the images of a deck with up to PPTSlideConcurrency
+// calls at a time. The returned URLs keep the slide order; slides that failed, or were
+// skipped because the job was cancelled, are left out and reported in the errors instead.
+func (s *Server) generateSlideImages(ctx context.Context, job *Job, slides []Slide, language, userID string) ([]string, []SlideError) {
+	imageModel := s.getImageModelForProvider()
+	paths := make([]string, len(slides))
+	errs := make([]error, len(slides))
+
+	var mu sync.Mutex
+	completed := 0
+	job.SetProgress("stage", "generating_slides")
+	job.SetProgress("slide", fmt.Sprintf("0/%d", len(slides)))
+
+	sem := make(chan struct{}, s.cfg.PPTSlideConcurrency)
+	var wg sync.WaitGroup
+slideLoop:
+	for i, slide := range slides {
+		// Stop queueing slides once the transformation is cancelled
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break slideLoop
+		}
+		wg.Add(1)
+		go func(i int, slide Slide) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			golog.Infof("generating image for slide %d/%d...", i+1, len(slides))
+			// Combine style and slide content for the image generator
+			prompt := fmt.Sprintf("Style: %s\n\nSlide Content: %s", slides[0].Style, slide.Content)
+			prompt += "\n\n" + imageLanguageInstruction(s.cfg, language) + "\n"
+			paths[i], errs[i] = s.agent.provider.GenerateImage(ctx, imageModel, prompt, userID)
+			if errs[i] != nil {
+				golog.Errorf("failed to generate slide %d: %v", i+1, errs[i])
+			} else {
+				job.AddStoredArtifact(s.storage, paths[i])
+			}
+
+			mu.Lock()
+			completed++
+			job.SetProgress("slide", fmt.Sprintf("%d/%d", completed, len(slides)))
+			mu.Unlock()
+		}(i, slide)
+	}
+	wg.Wait()
+
+	slideURLs := make([]string, 0, len(slides))
+	slideErrors := make([]SlideError, 0)
+	for i := range slides {
+		switch {
+		case errs[i] != nil:
+			slideErrors = append(slideErrors, SlideError{Slide: i + 1, Error: errs[i].Error()})
+		case paths[i] != "":
+			slideURLs = append(slideURLs, s.storage.URL(paths[i]))
+		case ctx.Err() != nil:
+			// Not started before the job was cancelled
+			slideErrors = append(slideErrors, SlideError{Slide: i + 1, Error: fmt.Sprintf("skipped: %v", context.Cause(ctx))})
+		}
+	}
+	return slideURLs, slideErrors
+}
@@ -0,0 +1,273 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kataras/golog"
+)
+
+// Storage backends for uploaded and generated files
+const (
+	StorageBackendLocal = "local" // files under ./data/uploads
+	StorageBackendS3    = "s3"    // objects in an S3-compatible bucket
+)
+
+// uploadRoot is where the local backend keeps files
+const uploadRoot = "./data/uploads"
+
+// stagingDir holds uploads while their text is extracted or transcribed, before they are
+// moved to storage. It sits next to uploadRoot so the local backend can rename into place.
+const stagingDir = "./data/staging"
+
+// Storage keeps uploaded and generated files. Keys are slash-separated and follow the
+// layout of the local backend: "<user_id>/<file name>" or "blobs/<sha256>.<ext>".
+type Storage interface {
+	// Put stores size bytes read from r under key, replacing an existing object
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get opens the object under key; the error wraps os.ErrNotExist when there is none
+	Get(ctx context.Context, key string) (*StorageObject, error)
+	// Delete removes the object under key
+	Delete(ctx context.Context, key string) error
+	// DeletePrefix removes every object under the key prefix and returns how many it removed
+	DeletePrefix(ctx context.Context, prefix string) (int, error)
+	// URL returns where clients fetch the object. Files are always served through
+	// /api/files, which checks access to their notebook.
+	URL(key string) string
+}
+
+// StorageObject is an opened stored file. It is seekable so it can answer range requests.
+type StorageObject struct {
+	io.ReadSeekCloser
+	Size    int64
+	ModTime time.Time
+}
+
+// NewStorage creates the storage backend selected by STORAGE_BACKEND
+func NewStorage(cfg Config) (Storage, error) {
+	switch cfg.StorageBackend {
+	case StorageBackendLocal:
+		return NewLocalStorage(uploadRoot), nil
+	case StorageBackendS3:
+		return NewS3Storage(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s (supported: local, s3)", cfg.StorageBackend)
+	}
+}
+
+// uploadKey returns the storage key of an uploaded or generated file
+func uploadKey(userID, filename string) string {
+	if isContentHashFileName(filename) {
+		return "blobs/" + filename
+	}
+	if userID == "" {
+		return filename
+	}
+	return userID + "/" + filename
+}
+
+// fileURL returns the URL a file is served under
+func fileURL(key string) string {
+	return "/api/files/" + path.Base(key)
+}
+
+// newStagingPath returns a path in the staging directory for a file named name
+func newStagingPath(name string) (string, error) {
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	return filepath.Join(stagingDir, uuid.New().String()+strings.ToLower(filepath.Ext(name))), nil
+}
+
+// storeFile moves a local file into storage under key. The local file is gone afterwards,
+// unless an error is returned.
+func storeFile(ctx context.Context, st Storage, key, localPath string) error {
+	if local, ok := st.(*LocalStorage); ok {
+		return local.move(key, localPath)
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := st.Put(ctx, key, f, info.Size()); err != nil {
+		return err
+	}
+	f.Close()
+	os.Remove(localPath)
+	return nil
+}
+
+// storeBytes stores generated content under key
+func storeBytes(ctx context.Context, st Storage, key string, data []byte) error {
+	return st.Put(ctx, key, bytes.NewReader(data), int64(len(data)))
+}
+
+// saveGeneratedImage stores an image generated for userID and returns its storage key
+func saveGeneratedImage(ctx context.Context, st Storage, userID string, data []byte) (string, error) {
+	key := uploadKey(userID, fmt.Sprintf("infograph_%d.png", time.Now().UnixNano()))
+	if err := storeBytes(ctx, st, key, data); err != nil {
+		golog.Errorf("failed to save image to %s: %v", key, err)
+		return "", fmt.Errorf("failed to save image: %w", err)
+	}
+
+	golog.Infof("infographic saved to %s", key)
+	return key, nil
+}
+
+// storageExists reports whether an object is stored under key
+func storageExists(ctx context.Context, st Storage, key string) bool {
+	obj, err := st.Get(ctx, key)
+	if err != nil {
+		return false
+	}
+	obj.Close()
+	return true
+}
+
+// removeStored deletes a stored file, logging instead of failing: callers remove files
+// of records that are deleted either way
+func removeStored(ctx context.Context, st Storage, key, what string) {
+	if err := st.Delete(ctx, key); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			golog.Warnf("%s %s is already gone", what, key)
+		} else {
+			golog.Errorf("failed to remove %s %s: %v", what, key, err)
+		}
+	}
+}
+
+// LocalStorage keeps files in a directory on the local disk
+type LocalStorage struct {
+	root string
+}
+
+// NewLocalStorage creates a storage backed by the directory root
+func NewLocalStorage(root string) *LocalStorage {
+	return &LocalStorage{root: root}
+}
+
+// path maps a key to a file under root, refusing keys that would escape it
+func (l *LocalStorage) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid storage key: %q", key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(clean)), nil
+}
+
+// Put writes the file through a temporary name, so readers never see a partial file
+func (l *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".put-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), p)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Get opens the file of key
+func (l *LocalStorage) Get(ctx context.Context, key string) (*StorageObject, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: p, Err: fs.ErrNotExist}
+	}
+	return &StorageObject{ReadSeekCloser: f, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete removes the file of key
+func (l *LocalStorage) Delete(ctx context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+// DeletePrefix removes the directory of prefix, e.g. "<user_id>/", with all its files
+func (l *LocalStorage) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	dir, err := l.path(prefix)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			count++
+		}
+		return nil
+	})
+	return count, os.RemoveAll(dir)
+}
+
+// URL returns the file route of key
+func (l *LocalStorage) URL(key string) string {
+	return fileURL(key)
+}
+
+// move renames a local file into place, copying it when it is on another file system
+func (l *LocalStorage) move(key, localPath string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(localPath, p); err == nil {
+		return nil
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := l.Put(context.Background(), key, f, -1); err != nil {
+		return err
+	}
+	f.Close()
+	os.Remove(localPath)
+	return nil
+}
@@ -6,9 +6,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	_ "modernc.org/sqlite"
@@ -30,14 +33,39 @@ func NewStore(cfg Config) (*Store, error) {
 	absPath, _ := filepath.Abs(cfg.StorePath)
 	fmt.Printf("📦 Initializing SQLite Store at: %s\n", absPath)
 
-	db, err := sql.Open("sqlite", cfg.StorePath)
+	db, err := sql.Open("sqlite", sqliteDSN(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Enable foreign key constraints
-	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
-		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
+	// WAL allows concurrent readers next to a single writer; other journal modes
+	// lock the whole file on write, so a single connection avoids "database is locked"
+	maxOpenConns := cfg.SQLiteMaxOpenConns
+	if maxOpenConns == 0 {
+		maxOpenConns = 1
+		if cfg.SQLiteJournalMode == "WAL" {
+			maxOpenConns = 4
+		}
+	}
+	db.SetMaxOpenConns(maxOpenConns)
+
+	// Idle connections are kept by default: opening one means reapplying the pragmas
+	maxIdleConns := cfg.SQLiteMaxIdleConns
+	if maxIdleConns == 0 || maxIdleConns > maxOpenConns {
+		maxIdleConns = maxOpenConns
+	}
+	db.SetMaxIdleConns(maxIdleConns)
+
+	// Verify the connection and the pragmas (foreign keys, journal mode, busy timeout)
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// SQLite silently keeps the previous journal mode when the requested one is not
+	// possible (e.g. WAL on some network file systems)
+	var journalMode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err == nil && !strings.EqualFold(journalMode, cfg.SQLiteJournalMode) {
+		log.Printf("[Store] journal mode is %s, %s was requested", journalMode, cfg.SQLiteJournalMode)
 	}
 
 	store := &Store{db: db, dbPath: cfg.StorePath}
@@ -50,6 +78,23 @@ func NewStore(cfg Config) (*Store, error) {
 	return store, nil
 }
 
+// sqliteDSN builds the connection string for the store. Pragmas are passed in the
+// DSN so that every pooled connection gets them, not just the first one.
+func sqliteDSN(cfg Config) string {
+	pragmas := []string{
+		"foreign_keys(1)",
+		fmt.Sprintf("busy_timeout(%d)", cfg.SQLiteBusyTimeout),
+		fmt.Sprintf("journal_mode(%s)", cfg.SQLiteJournalMode),
+		fmt.Sprintf("synchronous(%s)", cfg.SQLiteSynchronous),
+	}
+
+	params := url.Values{}
+	for _, p := range pragmas {
+		params.Add("_pragma", p)
+	}
+	return "file:" + cfg.StorePath + "?" + params.Encode()
+}
+
 // initSchema creates the database schema
 func (s *Store) initSchema() error {
 	schema := `
@@ -80,9 +125,31 @@ func (s *Store) initSchema() error {
 		return err
 	}
 
-	// Check if user_id column exists in notebooks table (migration)
+	// Check if locale column exists in users table (migration)
 	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('notebooks') WHERE name='user_id'").Scan(&count)
+	err := s.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('users') WHERE name='locale'").Scan(&count)
+	if err == nil && count == 0 {
+		if _, err := s.db.Exec("ALTER TABLE users ADD COLUMN locale TEXT"); err != nil {
+			return fmt.Errorf("failed to add locale column to users: %w", err)
+		}
+	}
+
+	// Check if is_admin column exists in users table (migration)
+	err = s.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('users') WHERE name='is_admin'").Scan(&count)
+	if err == nil && count == 0 {
+		// Add the admin flag and the time of the user's last login
+		for _, stmt := range []string{
+			"ALTER TABLE users ADD COLUMN is_admin INTEGER NOT NULL DEFAULT 0",
+			"ALTER TABLE users ADD COLUMN last_login_at INTEGER",
+		} {
+			if _, err := s.db.Exec(stmt); err != nil {
+				return fmt.Errorf("failed to add admin columns to users: %w", err)
+			}
+		}
+	}
+
+	// Check if user_id column exists in notebooks table (migration)
+	err = s.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('notebooks') WHERE name='user_id'").Scan(&count)
 	if err == nil && count == 0 {
 		// Add user_id column
 		if _, err := s.db.Exec("ALTER TABLE notebooks ADD COLUMN user_id TEXT REFERENCES users(id)"); err != nil {
@@ -108,6 +175,15 @@ func (s *Store) initSchema() error {
 		}
 	}
 
+	// Check if deleted_at column exists in notebooks table (migration)
+	err = s.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('notebooks') WHERE name='deleted_at'").Scan(&count)
+	if err == nil && count == 0 {
+		// Add deleted_at column, set while a notebook is in the trash
+		if _, err := s.db.Exec("ALTER TABLE notebooks ADD COLUMN deleted_at INTEGER"); err != nil {
+			return fmt.Errorf("failed to add deleted_at column to notebooks: %w", err)
+		}
+	}
+
 	restSchema := `
 	CREATE TABLE IF NOT EXISTS sources (
 		id TEXT PRIMARY KEY,
@@ -175,7 +251,16 @@ func (s *Store) initSchema() error {
 		FOREIGN KEY (notebook_id) REFERENCES notebooks(id) ON DELETE CASCADE
 	);
 
+	CREATE TABLE IF NOT EXISTS source_usage (
+		source_id TEXT PRIMARY KEY,
+		notebook_id TEXT NOT NULL,
+		cited_count INTEGER NOT NULL DEFAULT 0,
+		last_cited_at INTEGER,
+		FOREIGN KEY (source_id) REFERENCES sources(id) ON DELETE CASCADE
+	);
+
 	CREATE INDEX IF NOT EXISTS idx_sources_notebook ON sources(notebook_id);
+	CREATE INDEX IF NOT EXISTS idx_source_usage_notebook ON source_usage(notebook_id);
 	CREATE INDEX IF NOT EXISTS idx_notes_notebook ON notes(notebook_id);
 	CREATE INDEX IF NOT EXISTS idx_chat_sessions_notebook ON chat_sessions(notebook_id);
 	CREATE INDEX IF NOT EXISTS idx_chat_messages_session ON chat_messages(session_id);
@@ -195,12 +280,197 @@ func (s *Store) initSchema() error {
 		FOREIGN KEY (user_id) REFERENCES users(id)
 	);
 
+	CREATE TABLE IF NOT EXISTS generations (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		notebook_id TEXT NOT NULL,
+		note_id TEXT,
+		type TEXT NOT NULL,
+		request TEXT,
+		model TEXT,
+		prompt_tokens INTEGER DEFAULT 0,
+		completion_tokens INTEGER DEFAULT 0,
+		duration_ms INTEGER DEFAULT 0,
+		status TEXT NOT NULL,
+		error TEXT,
+		created_at INTEGER NOT NULL,
+		completed_at INTEGER
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_generations_user ON generations(user_id, created_at);
+
+	CREATE TABLE IF NOT EXISTS daily_usage (
+		user_id TEXT NOT NULL,
+		day TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		count INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (user_id, day, kind)
+	);
+
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		last_used_at INTEGER,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id);
+
+	CREATE TABLE IF NOT EXISTS notebook_templates (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		description TEXT,
+		metadata TEXT,
+		created_at INTEGER NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_notebook_templates_user ON notebook_templates(user_id);
+
+	CREATE TABLE IF NOT EXISTS note_comments (
+		id TEXT PRIMARY KEY,
+		note_id TEXT NOT NULL,
+		notebook_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		body TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_note_comments_note ON note_comments(note_id, created_at);
+
+	CREATE TABLE IF NOT EXISTS revoked_tokens (
+		jti TEXT PRIMARY KEY,
+		expires_at INTEGER NOT NULL,
+		revoked_at INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires ON revoked_tokens(expires_at);
+
+	CREATE TABLE IF NOT EXISTS shares (
+		token TEXT PRIMARY KEY,
+		notebook_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER,
+		FOREIGN KEY (notebook_id) REFERENCES notebooks(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_shares_notebook ON shares(notebook_id);
+
 	CREATE INDEX IF NOT EXISTS idx_activity_logs_user ON activity_logs(user_id);
 	CREATE INDEX IF NOT EXISTS idx_activity_logs_created ON activity_logs(created_at);
+	CREATE INDEX IF NOT EXISTS idx_activity_logs_user_created ON activity_logs(user_id, created_at);
 	`
 
-	_, err = s.db.Exec(restSchema)
-	return err
+	if _, err := s.db.Exec(restSchema); err != nil {
+		return err
+	}
+
+	// Check if feedback column exists in chat_messages table (migration)
+	err = s.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('chat_messages') WHERE name='feedback'").Scan(&count)
+	if err == nil && count == 0 {
+		// Add feedback columns: the rating (1 or -1) a user gave an answer, with an optional comment
+		for _, stmt := range []string{
+			"ALTER TABLE chat_messages ADD COLUMN feedback INTEGER",
+			"ALTER TABLE chat_messages ADD COLUMN feedback_comment TEXT",
+			"ALTER TABLE chat_messages ADD COLUMN feedback_at INTEGER",
+		} {
+			if _, err := s.db.Exec(stmt); err != nil {
+				return fmt.Errorf("failed to add feedback columns to chat_messages: %w", err)
+			}
+		}
+	}
+
+	// Check if content_hash column exists in sources table (migration)
+	err = s.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('sources') WHERE name='content_hash'").Scan(&count)
+	if err == nil && count == 0 {
+		// Add content_hash column, used to find duplicate sources in a notebook
+		if _, err := s.db.Exec("ALTER TABLE sources ADD COLUMN content_hash TEXT"); err != nil {
+			return fmt.Errorf("failed to add content_hash column to sources: %w", err)
+		}
+	}
+	if _, err := s.db.Exec("CREATE INDEX IF NOT EXISTS idx_sources_notebook_hash ON sources(notebook_id, content_hash)"); err != nil {
+		return err
+	}
+
+	return s.initSearchSchema()
+}
+
+// initSearchSchema creates the FTS5 tables for full-text search over source and note
+// content. Triggers keep them in sync with their tables, including rows removed by a
+// cascading notebook delete. The trigram tokenizer matches substrings, so text without
+// spaces between words, such as Chinese, can be searched too.
+func (s *Store) initSearchSchema() error {
+	var exists int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'sources_fts'").Scan(&exists); err != nil {
+		return err
+	}
+
+	searchSchema := `
+	CREATE VIRTUAL TABLE IF NOT EXISTS sources_fts USING fts5(
+		source_id UNINDEXED, notebook_id UNINDEXED, name, content, tokenize = 'trigram'
+	);
+
+	CREATE TRIGGER IF NOT EXISTS sources_fts_insert AFTER INSERT ON sources BEGIN
+		INSERT INTO sources_fts (source_id, notebook_id, name, content)
+		VALUES (new.id, new.notebook_id, new.name, COALESCE(new.content, ''));
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS sources_fts_update AFTER UPDATE OF name, content ON sources BEGIN
+		DELETE FROM sources_fts WHERE source_id = old.id;
+		INSERT INTO sources_fts (source_id, notebook_id, name, content)
+		VALUES (new.id, new.notebook_id, new.name, COALESCE(new.content, ''));
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS sources_fts_delete AFTER DELETE ON sources BEGIN
+		DELETE FROM sources_fts WHERE source_id = old.id;
+	END;
+
+	CREATE VIRTUAL TABLE IF NOT EXISTS notes_fts USING fts5(
+		note_id UNINDEXED, notebook_id UNINDEXED, title, content, tokenize = 'trigram'
+	);
+
+	CREATE TRIGGER IF NOT EXISTS notes_fts_insert AFTER INSERT ON notes BEGIN
+		INSERT INTO notes_fts (note_id, notebook_id, title, content)
+		VALUES (new.id, new.notebook_id, new.title, new.content);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS notes_fts_update AFTER UPDATE OF title, content ON notes BEGIN
+		DELETE FROM notes_fts WHERE note_id = old.id;
+		INSERT INTO notes_fts (note_id, notebook_id, title, content)
+		VALUES (new.id, new.notebook_id, new.title, new.content);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS notes_fts_delete AFTER DELETE ON notes BEGIN
+		DELETE FROM notes_fts WHERE note_id = old.id;
+	END;
+	`
+	if _, err := s.db.Exec(searchSchema); err != nil {
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
+
+	// Index the rows that existed before the search tables were added
+	if exists == 0 {
+		if _, err := s.db.Exec(`
+			INSERT INTO sources_fts (source_id, notebook_id, name, content)
+			SELECT id, notebook_id, name, COALESCE(content, '') FROM sources
+		`); err != nil {
+			return fmt.Errorf("failed to index sources for search: %w", err)
+		}
+		if _, err := s.db.Exec(`
+			INSERT INTO notes_fts (note_id, notebook_id, title, content)
+			SELECT id, notebook_id, title, content FROM notes
+		`); err != nil {
+			return fmt.Errorf("failed to index notes for search: %w", err)
+		}
+	}
+	return nil
 }
 
 // User operations
@@ -243,11 +513,13 @@ func (s *Store) CreateUser(ctx context.Context, user *User) error {
 func (s *Store) GetUser(ctx context.Context, id string) (*User, error) {
 	var user User
 	var createdAt, updatedAt int64
+	var locale sql.NullString
+	var lastLoginAt sql.NullInt64
 
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, email, name, avatar_url, provider, created_at, updated_at
+		SELECT id, email, name, avatar_url, provider, locale, is_admin, last_login_at, created_at, updated_at
 		FROM users WHERE id = ?
-	`, id).Scan(&user.ID, &user.Email, &user.Name, &user.AvatarURL, &user.Provider, &createdAt, &updatedAt)
+	`, id).Scan(&user.ID, &user.Email, &user.Name, &user.AvatarURL, &user.Provider, &locale, &user.IsAdmin, &lastLoginAt, &createdAt, &updatedAt)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("user not found")
 	}
@@ -255,6 +527,11 @@ func (s *Store) GetUser(ctx context.Context, id string) (*User, error) {
 		return nil, err
 	}
 
+	user.Locale = locale.String
+	if lastLoginAt.Valid {
+		t := time.Unix(lastLoginAt.Int64, 0)
+		user.LastLoginAt = &t
+	}
 	user.CreatedAt = time.Unix(createdAt, 0)
 	user.UpdatedAt = time.Unix(updatedAt, 0)
 
@@ -265,11 +542,13 @@ func (s *Store) GetUser(ctx context.Context, id string) (*User, error) {
 func (s *Store) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	var user User
 	var createdAt, updatedAt int64
+	var locale sql.NullString
+	var lastLoginAt sql.NullInt64
 
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, email, name, avatar_url, provider, created_at, updated_at
+		SELECT id, email, name, avatar_url, provider, locale, is_admin, last_login_at, created_at, updated_at
 		FROM users WHERE email = ?
-	`, email).Scan(&user.ID, &user.Email, &user.Name, &user.AvatarURL, &user.Provider, &createdAt, &updatedAt)
+	`, email).Scan(&user.ID, &user.Email, &user.Name, &user.AvatarURL, &user.Provider, &locale, &user.IsAdmin, &lastLoginAt, &createdAt, &updatedAt)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("user not found")
 	}
@@ -277,12 +556,185 @@ func (s *Store) GetUserByEmail(ctx context.Context, email string) (*User, error)
 		return nil, err
 	}
 
+	user.Locale = locale.String
+	if lastLoginAt.Valid {
+		t := time.Unix(lastLoginAt.Int64, 0)
+		user.LastLoginAt = &t
+	}
 	user.CreatedAt = time.Unix(createdAt, 0)
 	user.UpdatedAt = time.Unix(updatedAt, 0)
 
 	return &user, nil
 }
 
+// RecordLogin stores the time of a user's login and whether they are an administrator,
+// so the flag follows the configuration on every login
+func (s *Store) RecordLogin(ctx context.Context, userID string, admin bool) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE users SET last_login_at = ?, is_admin = ? WHERE id = ?
+	`, time.Now().Unix(), admin, userID)
+	return err
+}
+
+// ListUsersWithUsage returns all users, most recently logged in first, with the number of
+// notebooks they own (excluding the trash) and the sources in them
+func (s *Store) ListUsersWithUsage(ctx context.Context) ([]AdminUser, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT u.id, u.email, u.name, u.avatar_url, u.provider, u.is_admin, u.last_login_at, u.created_at,
+			(SELECT COUNT(*) FROM notebooks n WHERE n.user_id = u.id AND n.deleted_at IS NULL),
+			(SELECT COUNT(*) FROM sources src JOIN notebooks n ON n.id = src.notebook_id
+				WHERE n.user_id = u.id AND n.deleted_at IS NULL)
+		FROM users u
+		ORDER BY COALESCE(u.last_login_at, 0) DESC, u.created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []AdminUser{}
+	for rows.Next() {
+		var user AdminUser
+		var lastLoginAt sql.NullInt64
+		var createdAt int64
+		if err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.AvatarURL, &user.Provider, &user.IsAdmin,
+			&lastLoginAt, &createdAt, &user.NotebookCount, &user.SourceCount); err != nil {
+			return nil, err
+		}
+		if lastLoginAt.Valid {
+			t := time.Unix(lastLoginAt.Int64, 0)
+			user.LastLoginAt = &t
+		}
+		user.CreatedAt = time.Unix(createdAt, 0)
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// UpdateUserLocale sets the user's preferred locale
+func (s *Store) UpdateUserLocale(ctx context.Context, id, locale string) (*User, error) {
+	_, err := s.db.ExecContext(ctx, `UPDATE users SET locale = ?, updated_at = ? WHERE id = ?`, locale, time.Now().Unix(), id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, id)
+}
+
+// EraseUser deletes a user and everything they own in one transaction: notebooks with their
+// sources, notes and chats, activity logs, generations, usage counters, API keys, templates
+// and the user row. Files and vectors are not touched; the receipt lists the notebook IDs and
+// unshared blobs the caller must remove.
+func (s *Store) EraseUser(ctx context.Context, userID string) (*UserErasure, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE id = ?`, userID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	receipt := &UserErasure{NotebookIDs: make([]string, 0), BlobFiles: make([]string, 0)}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM notebooks WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		receipt.NotebookIDs = append(receipt.NotebookIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	receipt.Notebooks = len(receipt.NotebookIDs)
+
+	// Blobs are shared across users, so only collect the ones nobody else references
+	rows, err = tx.QueryContext(ctx, `
+		SELECT DISTINCT s.file_name FROM sources s
+		JOIN notebooks n ON n.id = s.notebook_id
+		WHERE n.user_id = ? AND COALESCE(s.file_name, '') != ''
+		AND NOT EXISTS (
+			SELECT 1 FROM sources s2 JOIN notebooks n2 ON n2.id = s2.notebook_id
+			WHERE s2.file_name = s.file_name AND n2.user_id != ?
+		)
+	`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if isContentHashFileName(name) {
+			receipt.BlobFiles = append(receipt.BlobFiles, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	counts := []struct {
+		dest  *int
+		query string
+	}{
+		{&receipt.Sources, `SELECT COUNT(*) FROM sources WHERE notebook_id IN (SELECT id FROM notebooks WHERE user_id = ?)`},
+		{&receipt.Notes, `SELECT COUNT(*) FROM notes WHERE notebook_id IN (SELECT id FROM notebooks WHERE user_id = ?)`},
+		{&receipt.ChatSessions, `SELECT COUNT(*) FROM chat_sessions WHERE notebook_id IN (SELECT id FROM notebooks WHERE user_id = ?)`},
+		{&receipt.ChatMessages, `SELECT COUNT(*) FROM chat_messages WHERE session_id IN (SELECT cs.id FROM chat_sessions cs JOIN notebooks n ON n.id = cs.notebook_id WHERE n.user_id = ?)`},
+	}
+	for _, q := range counts {
+		if err := tx.QueryRowContext(ctx, q.query, userID).Scan(q.dest); err != nil {
+			return nil, err
+		}
+	}
+
+	// Notebook children are removed by ON DELETE CASCADE
+	deletes := []struct {
+		dest  *int
+		query string
+	}{
+		{nil, `DELETE FROM notebooks WHERE user_id = ?`},
+		{&receipt.ActivityLogs, `DELETE FROM activity_logs WHERE user_id = ?`},
+		{&receipt.Generations, `DELETE FROM generations WHERE user_id = ?`},
+		{nil, `DELETE FROM daily_usage WHERE user_id = ?`},
+		{&receipt.APIKeys, `DELETE FROM api_keys WHERE user_id = ?`},
+		{&receipt.Templates, `DELETE FROM notebook_templates WHERE user_id = ?`},
+		{nil, `DELETE FROM users WHERE id = ?`},
+	}
+	for _, d := range deletes {
+		result, err := tx.ExecContext(ctx, d.query, userID)
+		if err != nil {
+			return nil, err
+		}
+		if d.dest != nil {
+			n, err := result.RowsAffected()
+			if err != nil {
+				return nil, err
+			}
+			*d.dest = int(n)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
 // Notebook operations
 
 // CreateNotebook creates a new notebook
@@ -303,19 +755,33 @@ func (s *Store) CreateNotebook(ctx context.Context, userID, name, description st
 	return s.GetNotebook(ctx, id)
 }
 
-// GetNotebook retrieves a notebook by ID
+// GetNotebook retrieves a notebook by ID. Notebooks in the trash are not found.
 func (s *Store) GetNotebook(ctx context.Context, id string) (*Notebook, error) {
+	return s.getNotebook(ctx, id, false)
+}
+
+// GetNotebookIncludingDeleted retrieves a notebook by ID, also when it is in the trash
+func (s *Store) GetNotebookIncludingDeleted(ctx context.Context, id string) (*Notebook, error) {
+	return s.getNotebook(ctx, id, true)
+}
+
+func (s *Store) getNotebook(ctx context.Context, id string, includeDeleted bool) (*Notebook, error) {
 	var nb Notebook
 	var metadataJSON string
 	var createdAt, updatedAt int64
 	var userID sql.NullString
 	var isPublic sql.NullInt64
 	var publicToken sql.NullString
+	var deletedAt sql.NullInt64
 
-	err := s.db.QueryRowContext(ctx, `
-		SELECT id, user_id, name, description, is_public, public_token, created_at, updated_at, metadata
+	query := `
+		SELECT id, user_id, name, description, is_public, public_token, created_at, updated_at, metadata, deleted_at
 		FROM notebooks WHERE id = ?
-	`, id).Scan(&nb.ID, &userID, &nb.Name, &nb.Description, &isPublic, &publicToken, &createdAt, &updatedAt, &metadataJSON)
+	`
+	if !includeDeleted {
+		query += ` AND deleted_at IS NULL`
+	}
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&nb.ID, &userID, &nb.Name, &nb.Description, &isPublic, &publicToken, &createdAt, &updatedAt, &metadataJSON, &deletedAt)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("notebook not found")
 	}
@@ -334,6 +800,10 @@ func (s *Store) GetNotebook(ctx context.Context, id string) (*Notebook, error) {
 
 	nb.CreatedAt = time.Unix(createdAt, 0)
 	nb.UpdatedAt = time.Unix(updatedAt, 0)
+	if deletedAt.Valid {
+		t := time.Unix(deletedAt.Int64, 0)
+		nb.DeletedAt = &t
+	}
 
 	if metadataJSON != "" {
 		json.Unmarshal([]byte(metadataJSON), &nb.Metadata)
@@ -344,14 +814,30 @@ func (s *Store) GetNotebook(ctx context.Context, id string) (*Notebook, error) {
 	return &nb, nil
 }
 
-// ListNotebooks retrieves all notebooks for a user
+// ListNotebooks retrieves all notebooks for a user, leaving out those in the trash
 func (s *Store) ListNotebooks(ctx context.Context, userID string) ([]Notebook, error) {
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, user_id, name, description, is_public, public_token, created_at, updated_at, metadata
+	return s.queryNotebooks(ctx, `
+		SELECT id, user_id, name, description, is_public, public_token, created_at, updated_at, metadata, deleted_at
 		FROM notebooks
-		WHERE user_id = ?
+		WHERE user_id = ? AND deleted_at IS NULL
 		ORDER BY updated_at DESC
 	`, userID)
+}
+
+// ListDeletedNotebooks retrieves the notebooks of a user that are in the trash, most
+// recently deleted first
+func (s *Store) ListDeletedNotebooks(ctx context.Context, userID string) ([]Notebook, error) {
+	return s.queryNotebooks(ctx, `
+		SELECT id, user_id, name, description, is_public, public_token, created_at, updated_at, metadata, deleted_at
+		FROM notebooks
+		WHERE user_id = ? AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC
+	`, userID)
+}
+
+// queryNotebooks runs a query selecting notebook columns and scans the rows
+func (s *Store) queryNotebooks(ctx context.Context, query string, args ...interface{}) ([]Notebook, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -365,8 +851,9 @@ func (s *Store) ListNotebooks(ctx context.Context, userID string) ([]Notebook, e
 		var uid sql.NullString
 		var isPublic sql.NullInt64
 		var publicToken sql.NullString
+		var deletedAt sql.NullInt64
 
-		if err := rows.Scan(&nb.ID, &uid, &nb.Name, &nb.Description, &isPublic, &publicToken, &createdAt, &updatedAt, &metadataJSON); err != nil {
+		if err := rows.Scan(&nb.ID, &uid, &nb.Name, &nb.Description, &isPublic, &publicToken, &createdAt, &updatedAt, &metadataJSON, &deletedAt); err != nil {
 			return nil, err
 		}
 
@@ -381,6 +868,10 @@ func (s *Store) ListNotebooks(ctx context.Context, userID string) ([]Notebook, e
 
 		nb.CreatedAt = time.Unix(createdAt, 0)
 		nb.UpdatedAt = time.Unix(updatedAt, 0)
+		if deletedAt.Valid {
+			t := time.Unix(deletedAt.Int64, 0)
+			nb.DeletedAt = &t
+		}
 
 		if metadataJSON != "" {
 			json.Unmarshal([]byte(metadataJSON), &nb.Metadata)
@@ -453,7 +944,7 @@ func (s *Store) GetNotebookByPublicToken(ctx context.Context, token string) (*No
 
 	err := s.db.QueryRowContext(ctx, `
 		SELECT id, user_id, name, description, is_public, public_token, created_at, updated_at, metadata
-		FROM notebooks WHERE public_token = ? AND is_public = 1
+		FROM notebooks WHERE public_token = ? AND is_public = 1 AND deleted_at IS NULL
 	`, token).Scan(&nb.ID, &userID, &nb.Name, &nb.Description, &isPublic, &publicToken, &createdAt, &updatedAt, &metadataJSON)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("public notebook not found")
@@ -483,49 +974,178 @@ func (s *Store) GetNotebookByPublicToken(ctx context.Context, token string) (*No
 	return &nb, nil
 }
 
-// DeleteNotebook deletes a notebook and all its data
+// DeleteNotebook moves a notebook to the trash. Its data is kept until it is purged.
 func (s *Store) DeleteNotebook(ctx context.Context, id string) error {
-	_, err := s.db.ExecContext(ctx, `DELETE FROM notebooks WHERE id = ?`, id)
-	return err
+	result, err := s.db.ExecContext(ctx, `UPDATE notebooks SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`, time.Now().Unix(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("notebook not found")
+	}
+	return nil
 }
 
-// ListNotebooksWithStats retrieves all notebooks with their source and note counts for a user
-func (s *Store) ListNotebooksWithStats(ctx context.Context, userID string) ([]NotebookWithStats, error) {
-	query := `
-		SELECT
-			n.id, n.user_id, n.name, n.description, n.is_public, n.public_token, n.created_at, n.updated_at, n.metadata,
-			COALESCE((SELECT COUNT(*) FROM sources WHERE notebook_id = n.id), 0) as source_count,
-			COALESCE((SELECT COUNT(*) FROM notes WHERE notebook_id = n.id), 0) as note_count
-		FROM notebooks n
-		WHERE n.user_id = ?
-		ORDER BY n.updated_at DESC
-	`
+// RestoreNotebook takes a notebook out of the trash
+func (s *Store) RestoreNotebook(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE notebooks SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("notebook is not in the trash")
+	}
+	return nil
+}
 
-	rows, err := s.db.QueryContext(ctx, query, userID)
+// NotebookPurge lists what a purged notebook left in file storage
+type NotebookPurge struct {
+	UserID    string   // owner, whose upload directory holds the files
+	FileKeys  []string // storage keys of uploaded source files no other notebook uses
+	Notes     []Note   // deleted notes, with the metadata naming their generated images
+	AudioURLs []string // generated podcast audio
+}
+
+// PurgeNotebook permanently deletes a notebook and all its data, whether or not it is in
+// the trash. The files are collected and the rows deleted in one transaction, so a
+// failure leaves the notebook as it was; removing the files is up to the caller.
+func (s *Store) PurgeNotebook(ctx context.Context, id string) (*NotebookPurge, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	notebooks := make([]NotebookWithStats, 0)
+	var userID sql.NullString
+	if err := tx.QueryRowContext(ctx, `SELECT user_id FROM notebooks WHERE id = ?`, id).Scan(&userID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("notebook not found")
+		}
+		return nil, err
+	}
+	purge := &NotebookPurge{UserID: userID.String, FileKeys: make([]string, 0), Notes: make([]Note, 0), AudioURLs: make([]string, 0)}
+
+	// Blobs are shared across notebooks, so only collect the ones nobody else references
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT json_extract(s.metadata, '$.path') FROM sources s
+		WHERE s.notebook_id = ? AND COALESCE(s.file_name, '') != ''
+		AND json_extract(s.metadata, '$.path') IS NOT NULL
+		AND NOT EXISTS (
+			SELECT 1 FROM sources s2
+			WHERE s2.file_name = s.file_name AND s2.notebook_id != s.notebook_id
+		)
+	`, id)
+	if err != nil {
+		return nil, err
+	}
 	for rows.Next() {
-		var nb NotebookWithStats
-		var metadataJSON string
-		var createdAt, updatedAt int64
-		var uid sql.NullString
-		var isPublic sql.NullInt64
-		var publicToken sql.NullString
-
-		if err := rows.Scan(&nb.ID, &uid, &nb.Name, &nb.Description, &isPublic, &publicToken, &createdAt, &updatedAt, &metadataJSON, &nb.SourceCount, &nb.NoteCount); err != nil {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
 			return nil, err
 		}
+		purge.FileKeys = append(purge.FileKeys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		if uid.Valid {
-			nb.UserID = uid.String
+	rows, err = tx.QueryContext(ctx, `SELECT id, COALESCE(metadata, '') FROM notes WHERE notebook_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		note := Note{NotebookID: id}
+		var metadataJSON string
+		if err := rows.Scan(&note.ID, &metadataJSON); err != nil {
+			rows.Close()
+			return nil, err
 		}
-
-		nb.IsPublic = isPublic.Valid && isPublic.Int64 > 0
-		if publicToken.Valid {
+		if metadataJSON != "" {
+			json.Unmarshal([]byte(metadataJSON), &note.Metadata)
+		}
+		purge.Notes = append(purge.Notes, note)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT audio_url FROM podcasts WHERE notebook_id = ? AND COALESCE(audio_url, '') != ''`, id)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var audioURL string
+		if err := rows.Scan(&audioURL); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		purge.AudioURLs = append(purge.AudioURLs, audioURL)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Notebook children are removed by ON DELETE CASCADE
+	if _, err := tx.ExecContext(ctx, `DELETE FROM notebooks WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return purge, nil
+}
+
+// ListNotebooksDeletedBefore returns the notebooks moved to the trash before the given time
+func (s *Store) ListNotebooksDeletedBefore(ctx context.Context, before time.Time) ([]Notebook, error) {
+	return s.queryNotebooks(ctx, `
+		SELECT id, user_id, name, description, is_public, public_token, created_at, updated_at, metadata, deleted_at
+		FROM notebooks
+		WHERE deleted_at IS NOT NULL AND deleted_at < ?
+		ORDER BY deleted_at
+	`, before.Unix())
+}
+
+// ListNotebooksWithStats retrieves all notebooks with their source and note counts for a user
+func (s *Store) ListNotebooksWithStats(ctx context.Context, userID string) ([]NotebookWithStats, error) {
+	query := `
+		SELECT
+			n.id, n.user_id, n.name, n.description, n.is_public, n.public_token, n.created_at, n.updated_at, n.metadata,
+			COALESCE((SELECT COUNT(*) FROM sources WHERE notebook_id = n.id), 0) as source_count,
+			COALESCE((SELECT COUNT(*) FROM notes WHERE notebook_id = n.id), 0) as note_count
+		FROM notebooks n
+		WHERE n.user_id = ? AND n.deleted_at IS NULL
+		ORDER BY n.updated_at DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notebooks := make([]NotebookWithStats, 0)
+	for rows.Next() {
+		var nb NotebookWithStats
+		var metadataJSON string
+		var createdAt, updatedAt int64
+		var uid sql.NullString
+		var isPublic sql.NullInt64
+		var publicToken sql.NullString
+
+		if err := rows.Scan(&nb.ID, &uid, &nb.Name, &nb.Description, &isPublic, &publicToken, &createdAt, &updatedAt, &metadataJSON, &nb.SourceCount, &nb.NoteCount); err != nil {
+			return nil, err
+		}
+
+		if uid.Valid {
+			nb.UserID = uid.String
+		}
+
+		nb.IsPublic = isPublic.Valid && isPublic.Int64 > 0
+		if publicToken.Valid {
 			nb.PublicToken = publicToken.String
 		}
 
@@ -570,7 +1190,7 @@ func (s *Store) ListPublicNotebooks(ctx context.Context) ([]NotebookWithStats, e
 			) as ppt_first_slide
 		FROM notebooks n
 			INNER JOIN notes notes ON notes.notebook_id = n.id
-		WHERE n.is_public = 1
+		WHERE n.is_public = 1 AND n.deleted_at IS NULL
 			AND notes.type IN ('infograph', 'ppt')
 		ORDER BY n.updated_at DESC
 		LIMIT 20
@@ -647,10 +1267,10 @@ func (s *Store) CreateSource(ctx context.Context, source *Source) error {
 	metadataJSON, _ := json.Marshal(source.Metadata)
 
 	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO sources (id, notebook_id, name, type, url, content, file_name, file_size, chunk_count, created_at, updated_at, metadata)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO sources (id, notebook_id, name, type, url, content, file_name, file_size, chunk_count, created_at, updated_at, metadata, content_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''))
 	`, source.ID, source.NotebookID, source.Name, source.Type, source.URL, source.Content,
-		source.FileName, source.FileSize, source.ChunkCount, now.Unix(), now.Unix(), string(metadataJSON))
+		source.FileName, source.FileSize, source.ChunkCount, now.Unix(), now.Unix(), string(metadataJSON), source.ContentHash)
 
 	return err
 }
@@ -662,10 +1282,11 @@ func (s *Store) GetSource(ctx context.Context, id string) (*Source, error) {
 	var createdAt, updatedAt int64
 
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, notebook_id, name, type, url, content, file_name, file_size, chunk_count, created_at, updated_at, metadata
+		SELECT id, notebook_id, name, type, url, content, file_name, file_size, chunk_count, created_at, updated_at, metadata,
+			COALESCE(content_hash, '')
 		FROM sources WHERE id = ?
 	`, id).Scan(&src.ID, &src.NotebookID, &src.Name, &src.Type, &src.URL, &src.Content,
-		&src.FileName, &src.FileSize, &src.ChunkCount, &createdAt, &updatedAt, &metadataJSON)
+		&src.FileName, &src.FileSize, &src.ChunkCount, &createdAt, &updatedAt, &metadataJSON, &src.ContentHash)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("source not found")
 	}
@@ -685,7 +1306,8 @@ func (s *Store) GetSource(ctx context.Context, id string) (*Source, error) {
 	return &src, nil
 }
 
-// GetSourceByFileName finds a source by its filename and returns the source with its notebook info
+// GetSourceByFileName finds a source by its filename and returns the source with its notebook
+// info. Sources of notebooks in the trash are not found.
 func (s *Store) GetSourceByFileName(ctx context.Context, filename string) (*Source, *Notebook, error) {
 	var src Source
 	var notebook Notebook
@@ -702,7 +1324,7 @@ func (s *Store) GetSourceByFileName(ctx context.Context, filename string) (*Sour
 			n.created_at as nb_created_at, n.updated_at as nb_updated_at, n.metadata as nb_metadata
 		FROM sources s
 		INNER JOIN notebooks n ON s.notebook_id = n.id
-		WHERE s.file_name = ?
+		WHERE s.file_name = ? AND n.deleted_at IS NULL
 	`, filename).Scan(
 		&src.ID, &src.NotebookID, &src.Name, &src.Type, &src.URL, &src.Content,
 		&src.FileName, &src.FileSize, &src.ChunkCount, &createdAt, &updatedAt, &metadataJSON,
@@ -739,10 +1361,42 @@ func (s *Store) GetSourceByFileName(ctx context.Context, filename string) (*Sour
 	return &src, &notebook, nil
 }
 
+// ListNotebooksByFileName returns the notebooks of all sources that reference a stored file.
+// Content-addressed files can be shared by sources in several notebooks. Notebooks in the
+// trash are left out.
+func (s *Store) ListNotebooksByFileName(ctx context.Context, filename string) ([]Notebook, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT n.id, n.user_id, n.name, n.is_public
+		FROM sources s
+		INNER JOIN notebooks n ON s.notebook_id = n.id
+		WHERE s.file_name = ? AND n.deleted_at IS NULL
+	`, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notebooks := make([]Notebook, 0)
+	for rows.Next() {
+		var nb Notebook
+		var userID sql.NullString
+		if err := rows.Scan(&nb.ID, &userID, &nb.Name, &nb.IsPublic); err != nil {
+			return nil, err
+		}
+		if userID.Valid {
+			nb.UserID = userID.String
+		}
+		notebooks = append(notebooks, nb)
+	}
+
+	return notebooks, rows.Err()
+}
+
 // ListSources retrieves all sources for a notebook
 func (s *Store) ListSources(ctx context.Context, notebookID string) ([]Source, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, notebook_id, name, type, url, content, file_name, file_size, chunk_count, created_at, updated_at, metadata
+		SELECT id, notebook_id, name, type, url, content, file_name, file_size, chunk_count, created_at, updated_at, metadata,
+			COALESCE(content_hash, '')
 		FROM sources WHERE notebook_id = ? ORDER BY created_at DESC
 	`, notebookID)
 	if err != nil {
@@ -757,7 +1411,7 @@ func (s *Store) ListSources(ctx context.Context, notebookID string) ([]Source, e
 		var createdAt, updatedAt int64
 
 		if err := rows.Scan(&src.ID, &src.NotebookID, &src.Name, &src.Type, &src.URL, &src.Content,
-			&src.FileName, &src.FileSize, &src.ChunkCount, &createdAt, &updatedAt, &metadataJSON); err != nil {
+			&src.FileName, &src.FileSize, &src.ChunkCount, &createdAt, &updatedAt, &metadataJSON, &src.ContentHash); err != nil {
 			return nil, err
 		}
 
@@ -776,6 +1430,74 @@ func (s *Store) ListSources(ctx context.Context, notebookID string) ([]Source, e
 	return sources, nil
 }
 
+// CountNotebookChunks returns the number of sources of a notebook and the chunks recorded
+// for them
+func (s *Store) CountNotebookChunks(ctx context.Context, notebookID string) (sources, chunks int, err error) {
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(chunk_count), 0) FROM sources WHERE notebook_id = ?
+	`, notebookID).Scan(&sources, &chunks)
+	return sources, chunks, err
+}
+
+// FindSourceByContentHash returns the oldest source of a notebook with the given content
+// hash, or nil when there is none
+func (s *Store) FindSourceByContentHash(ctx context.Context, notebookID, hash string) (*Source, error) {
+	var id string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id FROM sources WHERE notebook_id = ? AND content_hash = ? ORDER BY created_at LIMIT 1
+	`, notebookID, hash).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSource(ctx, id)
+}
+
+// ListUnindexedSources retrieves sources across all notebooks that have content but no
+// recorded chunks, oldest first. Notebooks in the trash are skipped.
+func (s *Store) ListUnindexedSources(ctx context.Context) ([]Source, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT s.id, s.notebook_id, s.name, s.type, s.url, s.content, s.file_name, s.file_size, s.chunk_count,
+			s.created_at, s.updated_at, s.metadata
+		FROM sources s
+		INNER JOIN notebooks n ON s.notebook_id = n.id
+		WHERE s.chunk_count = 0 AND s.content != '' AND n.deleted_at IS NULL
+		ORDER BY s.created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sources := make([]Source, 0)
+	for rows.Next() {
+		var src Source
+		var metadataJSON string
+		var createdAt, updatedAt int64
+
+		if err := rows.Scan(&src.ID, &src.NotebookID, &src.Name, &src.Type, &src.URL, &src.Content,
+			&src.FileName, &src.FileSize, &src.ChunkCount, &createdAt, &updatedAt, &metadataJSON); err != nil {
+			return nil, err
+		}
+
+		src.CreatedAt = time.Unix(createdAt, 0)
+		src.UpdatedAt = time.Unix(updatedAt, 0)
+
+		if metadataJSON != "" {
+			json.Unmarshal([]byte(metadataJSON), &src.Metadata)
+		}
+		if src.Metadata == nil {
+			src.Metadata = make(map[string]interface{})
+		}
+
+		sources = append(sources, src)
+	}
+
+	return sources, rows.Err()
+}
+
 // DeleteSource deletes a source
 func (s *Store) DeleteSource(ctx context.Context, id string) error {
 	_, err := s.db.ExecContext(ctx, `DELETE FROM sources WHERE id = ?`, id)
@@ -788,15 +1510,138 @@ func (s *Store) UpdateSourceChunkCount(ctx context.Context, id string, chunkCoun
 	return err
 }
 
+// UpdateSourceIngestion records the outcome of indexing a source. Unlike the other
+// updates it leaves updated_at alone, since the source itself did not change.
+func (s *Store) UpdateSourceIngestion(ctx context.Context, id string, chunkCount int, metadata map[string]interface{}) error {
+	metadataJSON, _ := json.Marshal(metadata)
+	_, err := s.db.ExecContext(ctx, `UPDATE sources SET chunk_count = ?, metadata = ? WHERE id = ?`,
+		chunkCount, string(metadataJSON), id)
+	return err
+}
+
+// UpdateSourceContent replaces a source's content and metadata
+func (s *Store) UpdateSourceContent(ctx context.Context, id, content string, metadata map[string]interface{}) error {
+	metadataJSON, _ := json.Marshal(metadata)
+	result, err := s.db.ExecContext(ctx, `UPDATE sources SET content = ?, metadata = ?, updated_at = ? WHERE id = ?`,
+		content, string(metadataJSON), time.Now().Unix(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("source not found")
+	}
+	return nil
+}
+
+// UpdateSource replaces a source's name, content and metadata. The content hash of a text
+// source is cleared, it no longer matches the text that was added.
+func (s *Store) UpdateSource(ctx context.Context, id, name, content string, metadata map[string]interface{}) error {
+	metadataJSON, _ := json.Marshal(metadata)
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE sources SET name = ?, content = ?, metadata = ?, updated_at = ?,
+			content_hash = CASE WHEN type = 'text' THEN NULL ELSE content_hash END
+		WHERE id = ?
+	`, name, content, string(metadataJSON), time.Now().Unix(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("source not found")
+	}
+	return nil
+}
+
+// UpdateSourceMetadata replaces a source's metadata
+func (s *Store) UpdateSourceMetadata(ctx context.Context, id string, metadata map[string]interface{}) error {
+	metadataJSON, _ := json.Marshal(metadata)
+	result, err := s.db.ExecContext(ctx, `UPDATE sources SET metadata = ?, updated_at = ? WHERE id = ?`,
+		string(metadataJSON), time.Now().Unix(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("source not found")
+	}
+	return nil
+}
+
+// IncrementSourceCitations bumps the cited count of each source used in a chat answer
+func (s *Store) IncrementSourceCitations(ctx context.Context, notebookID string, sourceIDs []string) error {
+	if len(sourceIDs) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	for _, id := range sourceIDs {
+		// Only count IDs that belong to a source in this notebook
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO source_usage (source_id, notebook_id, cited_count, last_cited_at)
+			SELECT id, notebook_id, 1, ? FROM sources WHERE id = ? AND notebook_id = ?
+			ON CONFLICT(source_id) DO UPDATE SET
+				cited_count = cited_count + 1,
+				last_cited_at = excluded.last_cited_at
+		`, now, id, notebookID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListSourceUsage returns every source in a notebook ranked by how often chat answers cited it
+func (s *Store) ListSourceUsage(ctx context.Context, notebookID string) ([]SourceUsage, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT s.id, s.name, s.type, COALESCE(u.cited_count, 0), u.last_cited_at
+		FROM sources s
+		LEFT JOIN source_usage u ON u.source_id = s.id
+		WHERE s.notebook_id = ?
+		ORDER BY COALESCE(u.cited_count, 0) DESC, s.created_at DESC
+	`, notebookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := make([]SourceUsage, 0)
+	for rows.Next() {
+		var u SourceUsage
+		var lastCitedAt sql.NullInt64
+
+		if err := rows.Scan(&u.SourceID, &u.Name, &u.Type, &u.CitedCount, &lastCitedAt); err != nil {
+			return nil, err
+		}
+
+		if lastCitedAt.Valid {
+			t := time.Unix(lastCitedAt.Int64, 0)
+			u.LastCitedAt = &t
+		}
+
+		usage = append(usage, u)
+	}
+
+	return usage, rows.Err()
+}
+
 // Note operations
 
 // CreateNote creates a new note
 func (s *Store) CreateNote(ctx context.Context, note *Note) error {
-	note.ID = uuid.New().String()
+	// Background transformations reserve the ID of their note when they are accepted
+	if note.ID == "" {
+		note.ID = uuid.New().String()
+	}
 	now := time.Now()
 	note.CreatedAt = now
 	note.UpdatedAt = now
 
+	note.computeStats()
+
 	metadataJSON, _ := json.Marshal(note.Metadata)
 	sourceIDsJSON, _ := json.Marshal(note.SourceIDs)
 
@@ -809,6 +1654,26 @@ func (s *Store) CreateNote(ctx context.Context, note *Note) error {
 	return err
 }
 
+// UpdateNote saves a note's title, content and metadata
+func (s *Store) UpdateNote(ctx context.Context, note *Note) error {
+	note.UpdatedAt = time.Now()
+	note.computeStats()
+
+	metadataJSON, _ := json.Marshal(note.Metadata)
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE notes SET title = ?, content = ?, metadata = ?, updated_at = ?
+		WHERE id = ?
+	`, note.Title, note.Content, string(metadataJSON), note.UpdatedAt.Unix(), note.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("note not found")
+	}
+	return nil
+}
+
 // GetNote retrieves a note by ID
 func (s *Store) GetNote(ctx context.Context, id string) (*Note, error) {
 	var note Note
@@ -816,10 +1681,11 @@ func (s *Store) GetNote(ctx context.Context, id string) (*Note, error) {
 	var createdAt, updatedAt int64
 
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, notebook_id, title, content, type, source_ids, created_at, updated_at, metadata
+		SELECT id, notebook_id, title, content, type, source_ids, created_at, updated_at, metadata,
+			(SELECT COUNT(*) FROM note_comments WHERE note_id = notes.id)
 		FROM notes WHERE id = ?
 	`, id).Scan(&note.ID, &note.NotebookID, &note.Title, &note.Content, &note.Type,
-		&sourceIDsJSON, &createdAt, &updatedAt, &metadataJSON)
+		&sourceIDsJSON, &createdAt, &updatedAt, &metadataJSON, &note.CommentCount)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("note not found")
 	}
@@ -839,6 +1705,7 @@ func (s *Store) GetNote(ctx context.Context, id string) (*Note, error) {
 	if sourceIDsJSON != "" {
 		json.Unmarshal([]byte(sourceIDsJSON), &note.SourceIDs)
 	}
+	note.computeStats()
 
 	return &note, nil
 }
@@ -846,7 +1713,8 @@ func (s *Store) GetNote(ctx context.Context, id string) (*Note, error) {
 // ListNotes retrieves all notes for a notebook
 func (s *Store) ListNotes(ctx context.Context, notebookID string) ([]Note, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, notebook_id, title, content, type, source_ids, created_at, updated_at, metadata
+		SELECT id, notebook_id, title, content, type, source_ids, created_at, updated_at, metadata,
+			(SELECT COUNT(*) FROM note_comments WHERE note_id = notes.id)
 		FROM notes WHERE notebook_id = ? ORDER BY created_at DESC
 	`, notebookID)
 	if err != nil {
@@ -861,7 +1729,7 @@ func (s *Store) ListNotes(ctx context.Context, notebookID string) ([]Note, error
 		var createdAt, updatedAt int64
 
 		if err := rows.Scan(&note.ID, &note.NotebookID, &note.Title, &note.Content, &note.Type,
-			&sourceIDsJSON, &createdAt, &updatedAt, &metadataJSON); err != nil {
+			&sourceIDsJSON, &createdAt, &updatedAt, &metadataJSON, &note.CommentCount); err != nil {
 			return nil, err
 		}
 
@@ -877,6 +1745,7 @@ func (s *Store) ListNotes(ctx context.Context, notebookID string) ([]Note, error
 		if sourceIDsJSON != "" {
 			json.Unmarshal([]byte(sourceIDsJSON), &note.SourceIDs)
 		}
+		note.computeStats()
 
 		notes = append(notes, note)
 	}
@@ -885,7 +1754,7 @@ func (s *Store) ListNotes(ctx context.Context, notebookID string) ([]Note, error
 }
 
 // GetNoteByFileName finds a note by its filename in metadata (image_url or slides)
-// Returns the note with its notebook info
+// Returns the note with its notebook info. Notes of notebooks in the trash are not found.
 func (s *Store) GetNoteByFileName(ctx context.Context, filename string) (*Note, *Notebook, error) {
 	log.Printf("DEBUG: GetNoteByFileName called for filename: %s", filename)
 
@@ -899,6 +1768,7 @@ func (s *Store) GetNoteByFileName(ctx context.Context, filename string) (*Note,
 			nb.created_at as nb_created_at, nb.updated_at as nb_updated_at, nb.metadata as nb_metadata
 		FROM notes n
 		INNER JOIN notebooks nb ON n.notebook_id = nb.id
+		WHERE nb.deleted_at IS NULL
 	`)
 	if err != nil {
 		log.Printf("DEBUG: Query error: %v", err)
@@ -1013,13 +1883,16 @@ func (s *Store) DeleteNote(ctx context.Context, id string) error {
 
 // Chat operations
 
+// defaultChatSessionTitle is the title of sessions created without one
+const defaultChatSessionTitle = "New Chat"
+
 // CreateChatSession creates a new chat session
 func (s *Store) CreateChatSession(ctx context.Context, notebookID, title string) (*ChatSession, error) {
 	id := uuid.New().String()
 	now := time.Now()
 
 	if title == "" {
-		title = "New Chat"
+		title = defaultChatSessionTitle
 	}
 
 	metadataJSON, _ := json.Marshal(map[string]interface{}{})
@@ -1035,6 +1908,29 @@ func (s *Store) CreateChatSession(ctx context.Context, notebookID, title string)
 	return s.GetChatSession(ctx, id)
 }
 
+// UpdateChatSession renames a chat session
+func (s *Store) UpdateChatSession(ctx context.Context, id, title string) (*ChatSession, error) {
+	result, err := s.db.ExecContext(ctx, `UPDATE chat_sessions SET title = ? WHERE id = ?`, title, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("chat session not found")
+	}
+	return s.GetChatSession(ctx, id)
+}
+
+// UpdateChatHistorySummary stores the running summary of a session's older messages in its
+// metadata, along with how many of the first messages it covers
+func (s *Store) UpdateChatHistorySummary(ctx context.Context, notebookID, id, summary string, messages int) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE chat_sessions
+		SET metadata = json_set(COALESCE(NULLIF(metadata, ''), '{}'), '$.`+historySummaryKey+`', ?, '$.`+historySummaryMessagesKey+`', ?)
+		WHERE id = ? AND notebook_id = ?
+	`, summary, messages, id, notebookID)
+	return err
+}
+
 // GetChatSession retrieves a chat session by ID
 func (s *Store) GetChatSession(ctx context.Context, id string) (*ChatSession, error) {
 	var session ChatSession
@@ -1106,12 +2002,83 @@ func (s *Store) ListChatSessions(ctx context.Context, notebookID string) ([]Chat
 	return sessions, nil
 }
 
+// chatPreviewLength is the number of characters of the last message shown in session lists
+const chatPreviewLength = 120
+
+// ListChatSessionsWithStats retrieves a notebook's chat sessions with their message count and
+// a preview of the last message in a single query
+func (s *Store) ListChatSessionsWithStats(ctx context.Context, notebookID string) ([]ChatSessionWithStats, error) {
+	query := `
+		SELECT
+			cs.id, cs.notebook_id, cs.title, cs.created_at, cs.updated_at, cs.metadata,
+			COALESCE(m.message_count, 0), COALESCE(last.role, ''),
+			COALESCE(substr(last.content, 1, ?), ''), last.created_at
+		FROM chat_sessions cs
+		LEFT JOIN (
+			SELECT session_id, COUNT(*) AS message_count FROM chat_messages GROUP BY session_id
+		) m ON m.session_id = cs.id
+		LEFT JOIN chat_messages last ON last.id = (
+			SELECT id FROM chat_messages WHERE session_id = cs.id
+			ORDER BY created_at DESC, rowid DESC LIMIT 1
+		)
+		WHERE cs.notebook_id = ?
+		ORDER BY cs.updated_at DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, chatPreviewLength+1, notebookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]ChatSessionWithStats, 0)
+	for rows.Next() {
+		var session ChatSessionWithStats
+		var metadataJSON sql.NullString
+		var createdAt, updatedAt int64
+		var lastMessageAt sql.NullInt64
+
+		if err := rows.Scan(&session.ID, &session.NotebookID, &session.Title, &createdAt, &updatedAt, &metadataJSON,
+			&session.MessageCount, &session.LastMessageRole, &session.LastMessagePreview, &lastMessageAt); err != nil {
+			return nil, err
+		}
+
+		session.CreatedAt = time.Unix(createdAt, 0)
+		session.UpdatedAt = time.Unix(updatedAt, 0)
+		if lastMessageAt.Valid {
+			t := time.Unix(lastMessageAt.Int64, 0)
+			session.LastMessageAt = &t
+		}
+		if preview := []rune(session.LastMessagePreview); len(preview) > chatPreviewLength {
+			session.LastMessagePreview = string(preview[:chatPreviewLength]) + "…"
+		}
+
+		if metadataJSON.String != "" {
+			json.Unmarshal([]byte(metadataJSON.String), &session.Metadata)
+		} else {
+			session.Metadata = make(map[string]interface{})
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
 // AddChatMessage adds a message to a chat session
 func (s *Store) AddChatMessage(ctx context.Context, sessionID, role, content string, sources []string) (*ChatMessage, error) {
+	return s.AddChatMessageWithMetadata(ctx, sessionID, role, content, sources, nil)
+}
+
+// AddChatMessageWithMetadata adds a message to a chat session along with its metadata
+func (s *Store) AddChatMessageWithMetadata(ctx context.Context, sessionID, role, content string, sources []string, metadata map[string]interface{}) (*ChatMessage, error) {
 	id := uuid.New().String()
 	now := time.Now()
 
-	metadataJSON, _ := json.Marshal(map[string]interface{}{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadataJSON, _ := json.Marshal(metadata)
 	sourcesJSON, _ := json.Marshal(sources)
 
 	_, err := s.db.ExecContext(ctx, `
@@ -1134,7 +2101,7 @@ func (s *Store) AddChatMessage(ctx context.Context, sessionID, role, content str
 // listChatMessages retrieves all messages for a session
 func (s *Store) listChatMessages(ctx context.Context, sessionID string) ([]ChatMessage, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, session_id, role, content, sources, created_at, metadata
+		SELECT id, session_id, role, content, sources, created_at, metadata, feedback, feedback_comment, feedback_at
 		FROM chat_messages WHERE session_id = ? ORDER BY created_at ASC
 	`, sessionID)
 	if err != nil {
@@ -1147,12 +2114,14 @@ func (s *Store) listChatMessages(ctx context.Context, sessionID string) ([]ChatM
 		var msg ChatMessage
 		var metadataJSON, sourcesJSON string
 		var createdAt int64
+		var feedback feedbackColumns
 
-		if err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &sourcesJSON, &createdAt, &metadataJSON); err != nil {
+		if err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &sourcesJSON, &createdAt, &metadataJSON, &feedback.rating, &feedback.comment, &feedback.at); err != nil {
 			return nil, err
 		}
 
 		msg.CreatedAt = time.Unix(createdAt, 0)
+		msg.Feedback = feedback.value()
 
 		if metadataJSON != "" {
 			json.Unmarshal([]byte(metadataJSON), &msg.Metadata)
@@ -1175,11 +2144,12 @@ func (s *Store) getChatMessage(ctx context.Context, id string) (*ChatMessage, er
 	var msg ChatMessage
 	var metadataJSON, sourcesJSON string
 	var createdAt int64
+	var feedback feedbackColumns
 
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, session_id, role, content, sources, created_at, metadata
+		SELECT id, session_id, role, content, sources, created_at, metadata, feedback, feedback_comment, feedback_at
 		FROM chat_messages WHERE id = ?
-	`, id).Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &sourcesJSON, &createdAt, &metadataJSON)
+	`, id).Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &sourcesJSON, &createdAt, &metadataJSON, &feedback.rating, &feedback.comment, &feedback.at)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("chat message not found")
 	}
@@ -1188,6 +2158,7 @@ func (s *Store) getChatMessage(ctx context.Context, id string) (*ChatMessage, er
 	}
 
 	msg.CreatedAt = time.Unix(createdAt, 0)
+	msg.Feedback = feedback.value()
 
 	if metadataJSON != "" {
 		json.Unmarshal([]byte(metadataJSON), &msg.Metadata)
@@ -1202,24 +2173,273 @@ func (s *Store) getChatMessage(ctx context.Context, id string) (*ChatMessage, er
 	return &msg, nil
 }
 
-// DeleteChatSession deletes a chat session
-func (s *Store) DeleteChatSession(ctx context.Context, id string) error {
-	_, err := s.db.ExecContext(ctx, `DELETE FROM chat_sessions WHERE id = ?`, id)
-	return err
+// feedbackColumns scans the nullable feedback columns of a chat message
+type feedbackColumns struct {
+	rating  sql.NullInt64
+	comment sql.NullString
+	at      sql.NullInt64
 }
 
-// LogActivity logs a user activity to both database and audit log file
-func (s *Store) LogActivity(ctx context.Context, log *ActivityLog) error {
-	if log.ID == "" {
-		log.ID = uuid.New().String()
+// value returns the feedback, or nil when the message has not been rated
+func (f feedbackColumns) value() *MessageFeedback {
+	if !f.rating.Valid {
+		return nil
 	}
-	if log.CreatedAt.IsZero() {
-		log.CreatedAt = time.Now()
+	return &MessageFeedback{
+		Rating:    int(f.rating.Int64),
+		Comment:   f.comment.String,
+		CreatedAt: time.Unix(f.at.Int64, 0),
 	}
+}
 
-	// Write to database
-	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO activity_logs (id, user_id, action, resource_type, resource_id, resource_name, details, ip_address, user_agent, created_at)
+// GetChatMessage retrieves a single message by ID
+func (s *Store) GetChatMessage(ctx context.Context, id string) (*ChatMessage, error) {
+	return s.getChatMessage(ctx, id)
+}
+
+// SetMessageFeedback records a user's rating of a message, replacing any earlier one
+func (s *Store) SetMessageFeedback(ctx context.Context, messageID string, rating int, comment string) (*ChatMessage, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE chat_messages SET feedback = ?, feedback_comment = ?, feedback_at = ? WHERE id = ?
+	`, rating, comment, time.Now().Unix(), messageID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("chat message not found")
+	}
+	return s.getChatMessage(ctx, messageID)
+}
+
+// DeleteChatMessage deletes a message of a notebook's chat session. With withReply, deleting a
+// user message also deletes the assistant message that follows it. The session's history
+// summary is dropped, as it may describe the deleted messages; it is rebuilt from what remains.
+// It returns the IDs of the deleted messages.
+func (s *Store) DeleteChatMessage(ctx context.Context, notebookID, sessionID, messageID string, withReply bool) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var role string
+	var createdAt, rowID int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT m.role, m.created_at, m.rowid FROM chat_messages m
+		JOIN chat_sessions cs ON cs.id = m.session_id
+		WHERE m.id = ? AND m.session_id = ? AND cs.notebook_id = ?
+	`, messageID, sessionID, notebookID).Scan(&role, &createdAt, &rowID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("chat message not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	deleted := []string{messageID}
+
+	if withReply && role == "user" {
+		// Messages saved in the same second are ordered by insertion
+		var replyID, replyRole string
+		err := tx.QueryRowContext(ctx, `
+			SELECT id, role FROM chat_messages
+			WHERE session_id = ? AND (created_at > ? OR (created_at = ? AND rowid > ?))
+			ORDER BY created_at ASC, rowid ASC LIMIT 1
+		`, sessionID, createdAt, createdAt, rowID).Scan(&replyID, &replyRole)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if err == nil && replyRole == "assistant" {
+			deleted = append(deleted, replyID)
+		}
+	}
+
+	for _, id := range deleted {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM chat_messages WHERE id = ?`, id); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE chat_sessions
+		SET metadata = json_remove(metadata, '$.`+historySummaryKey+`', '$.`+historySummaryMessagesKey+`')
+		WHERE id = ? AND json_valid(metadata)
+	`, sessionID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// DeleteChatSession deletes a chat session
+func (s *Store) DeleteChatSession(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM chat_sessions WHERE id = ?`, id)
+	return err
+}
+
+// Generation operations
+
+// CreateGeneration records the start of a transformation run
+func (s *Store) CreateGeneration(ctx context.Context, gen *Generation) error {
+	gen.ID = uuid.New().String()
+	gen.CreatedAt = time.Now()
+	gen.Status = GenerationStatusRunning
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO generations (id, user_id, notebook_id, type, request, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, gen.ID, gen.UserID, gen.NotebookID, gen.Type, gen.Request, gen.Status, gen.CreatedAt.Unix())
+	return err
+}
+
+// FinishGeneration records the outcome of a transformation run
+func (s *Store) FinishGeneration(ctx context.Context, gen *Generation) error {
+	now := time.Now()
+	gen.CompletedAt = &now
+	gen.DurationMs = now.Sub(gen.CreatedAt).Milliseconds()
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE generations
+		SET note_id = ?, model = ?, prompt_tokens = ?, completion_tokens = ?, duration_ms = ?,
+			status = ?, error = ?, completed_at = ?
+		WHERE id = ?
+	`, gen.NoteID, gen.Model, gen.PromptTokens, gen.CompletionTokens, gen.DurationMs,
+		gen.Status, gen.Error, now.Unix(), gen.ID)
+	return err
+}
+
+// ListGenerations retrieves a user's transformation runs, newest first
+func (s *Store) ListGenerations(ctx context.Context, userID string, offset, limit int) ([]Generation, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, notebook_id, COALESCE(note_id, ''), type, COALESCE(request, ''), COALESCE(model, ''),
+			prompt_tokens, completion_tokens, duration_ms, status, COALESCE(error, ''), created_at, completed_at
+		FROM generations WHERE user_id = ?
+		ORDER BY created_at DESC LIMIT ? OFFSET ?
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	generations := make([]Generation, 0)
+	for rows.Next() {
+		var gen Generation
+		var createdAt int64
+		var completedAt sql.NullInt64
+
+		if err := rows.Scan(&gen.ID, &gen.UserID, &gen.NotebookID, &gen.NoteID, &gen.Type, &gen.Request, &gen.Model,
+			&gen.PromptTokens, &gen.CompletionTokens, &gen.DurationMs, &gen.Status, &gen.Error, &createdAt, &completedAt); err != nil {
+			return nil, err
+		}
+
+		gen.CreatedAt = time.Unix(createdAt, 0)
+		if completedAt.Valid {
+			t := time.Unix(completedAt.Int64, 0)
+			gen.CompletedAt = &t
+		}
+
+		generations = append(generations, gen)
+	}
+
+	return generations, rows.Err()
+}
+
+// GetGenerationUsage aggregates a user's transformation runs since the given time by type
+func (s *Store) GetGenerationUsage(ctx context.Context, userID string, since time.Time) ([]GenerationUsage, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT type, COUNT(*),
+			SUM(CASE WHEN status = ? THEN 1 ELSE 0 END),
+			COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0),
+			COALESCE(AVG(CASE WHEN status = ? THEN duration_ms END), 0)
+		FROM generations WHERE user_id = ? AND created_at >= ?
+		GROUP BY type ORDER BY COUNT(*) DESC
+	`, GenerationStatusFailed, GenerationStatusSucceeded, userID, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := make([]GenerationUsage, 0)
+	for rows.Next() {
+		var u GenerationUsage
+		if err := rows.Scan(&u.Type, &u.Count, &u.Failed, &u.PromptTokens, &u.CompletionTokens, &u.AvgDurationMs); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+
+	return usage, rows.Err()
+}
+
+// ConsumeDailyUsage counts one generation of the given kind against a user's usage for day,
+// unless the count already reached limit (0 means no limit). It reports whether it was counted.
+func (s *Store) ConsumeDailyUsage(ctx context.Context, userID, day, kind string, limit int) (bool, error) {
+	query := `
+		INSERT INTO daily_usage (user_id, day, kind, count) VALUES (?, ?, ?, 1)
+		ON CONFLICT(user_id, day, kind) DO UPDATE SET count = count + 1
+	`
+	args := []interface{}{userID, day, kind}
+	if limit > 0 {
+		query += ` WHERE count < ?`
+		args = append(args, limit)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ReleaseDailyUsage gives back one generation counted by ConsumeDailyUsage
+func (s *Store) ReleaseDailyUsage(ctx context.Context, userID, day, kind string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE daily_usage SET count = count - 1
+		WHERE user_id = ? AND day = ? AND kind = ? AND count > 0
+	`, userID, day, kind)
+	return err
+}
+
+// GetDailyUsage returns a user's generation counts for day keyed by kind
+func (s *Store) GetDailyUsage(ctx context.Context, userID, day string) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT kind, count FROM daily_usage WHERE user_id = ? AND day = ?
+	`, userID, day)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := make(map[string]int)
+	for rows.Next() {
+		var kind string
+		var count int
+		if err := rows.Scan(&kind, &count); err != nil {
+			return nil, err
+		}
+		usage[kind] = count
+	}
+
+	return usage, rows.Err()
+}
+
+// LogActivity logs a user activity to both database and audit log file
+func (s *Store) LogActivity(ctx context.Context, log *ActivityLog) error {
+	if log.ID == "" {
+		log.ID = uuid.New().String()
+	}
+	if log.CreatedAt.IsZero() {
+		log.CreatedAt = time.Now()
+	}
+
+	// Write to database
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO activity_logs (id, user_id, action, resource_type, resource_id, resource_name, details, ip_address, user_agent, created_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, log.ID, log.UserID, log.Action, log.ResourceType, log.ResourceID, log.ResourceName, log.Details, log.IPAddress, log.UserAgent, log.CreatedAt.Unix())
 
@@ -1229,7 +2449,630 @@ func (s *Store) LogActivity(ctx context.Context, log *ActivityLog) error {
 	return err
 }
 
+// Share operations
+
+// CreateShare stores a read-only share link of a notebook. expiresAt may be nil for a
+// link that stays valid until revoked.
+func (s *Store) CreateShare(ctx context.Context, share *NotebookShare) error {
+	if share.CreatedAt.IsZero() {
+		share.CreatedAt = time.Now()
+	}
+	var expiresAt sql.NullInt64
+	if share.ExpiresAt != nil {
+		expiresAt = sql.NullInt64{Int64: share.ExpiresAt.Unix(), Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO shares (token, notebook_id, user_id, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, share.Token, share.NotebookID, share.UserID, share.CreatedAt.Unix(), expiresAt)
+	return err
+}
+
+// scanShare scans a row of the shares table
+func scanShare(row interface{ Scan(...interface{}) error }) (*NotebookShare, error) {
+	var share NotebookShare
+	var createdAt int64
+	var expiresAt sql.NullInt64
+	if err := row.Scan(&share.Token, &share.NotebookID, &share.UserID, &createdAt, &expiresAt); err != nil {
+		return nil, err
+	}
+	share.CreatedAt = time.Unix(createdAt, 0)
+	if expiresAt.Valid {
+		t := time.Unix(expiresAt.Int64, 0)
+		share.ExpiresAt = &t
+	}
+	return &share, nil
+}
+
+// GetShare retrieves a share link by its token, including expired ones
+func (s *Store) GetShare(ctx context.Context, token string) (*NotebookShare, error) {
+	share, err := scanShare(s.db.QueryRowContext(ctx, `
+		SELECT token, notebook_id, user_id, created_at, expires_at FROM shares WHERE token = ?
+	`, token))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("share not found")
+	}
+	return share, err
+}
+
+// ListShares retrieves the share links of a notebook, newest first
+func (s *Store) ListShares(ctx context.Context, notebookID string) ([]NotebookShare, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT token, notebook_id, user_id, created_at, expires_at FROM shares
+		WHERE notebook_id = ? ORDER BY created_at DESC
+	`, notebookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := make([]NotebookShare, 0)
+	for rows.Next() {
+		share, err := scanShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, *share)
+	}
+	return shares, rows.Err()
+}
+
+// DeleteShare revokes a share link of a notebook
+func (s *Store) DeleteShare(ctx context.Context, notebookID, token string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM shares WHERE token = ? AND notebook_id = ?`, token, notebookID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("share not found")
+	}
+	return nil
+}
+
+// ListActivityLogs retrieves a user's most recent activity, newest first. When before is
+// the ID of an entry, only entries logged before it are returned, so pages neither skip
+// nor repeat entries logged within the same second.
+func (s *Store) ListActivityLogs(ctx context.Context, userID string, limit int, before string, filter ActivityLogFilter) ([]ActivityLog, error) {
+	query := `
+		SELECT id, user_id, action, COALESCE(resource_type, ''), COALESCE(resource_id, ''), COALESCE(resource_name, ''),
+			COALESCE(details, ''), COALESCE(ip_address, ''), COALESCE(user_agent, ''), created_at
+		FROM activity_logs WHERE user_id = ?`
+	args := []interface{}{userID}
+	if before != "" {
+		query += ` AND (created_at, rowid) < (SELECT created_at, rowid FROM activity_logs WHERE id = ? AND user_id = ?)`
+		args = append(args, before, userID)
+	}
+	if filter.Action != "" {
+		query += ` AND action = ?`
+		args = append(args, filter.Action)
+	}
+	if filter.ResourceType != "" {
+		query += ` AND resource_type = ?`
+		args = append(args, filter.ResourceType)
+	}
+	query += ` ORDER BY created_at DESC, rowid DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := make([]ActivityLog, 0)
+	for rows.Next() {
+		var log ActivityLog
+		var createdAt int64
+		if err := rows.Scan(&log.ID, &log.UserID, &log.Action, &log.ResourceType, &log.ResourceID, &log.ResourceName,
+			&log.Details, &log.IPAddress, &log.UserAgent, &createdAt); err != nil {
+			return nil, err
+		}
+		log.CreatedAt = time.Unix(createdAt, 0)
+		logs = append(logs, log)
+	}
+
+	return logs, rows.Err()
+}
+
+// Ping checks that the database answers queries
+func (s *Store) Ping(ctx context.Context) error {
+	var one int
+	return s.db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
+
 // Close closes the database connection
 func (s *Store) Close() error {
 	return s.db.Close()
 }
+
+// API key operations
+
+// CreateAPIKey stores a new service key for signing requests
+func (s *Store) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	key.ID = uuid.New().String()
+	key.CreatedAt = time.Now()
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO api_keys (id, user_id, name, secret, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, key.ID, key.UserID, key.Name, key.Secret, key.CreatedAt.Unix())
+	return err
+}
+
+// GetAPIKey retrieves a service key including its secret
+func (s *Store) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	var key APIKey
+	var createdAt int64
+	var lastUsedAt sql.NullInt64
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, user_id, name, secret, created_at, last_used_at
+		FROM api_keys WHERE id = ?
+	`, id).Scan(&key.ID, &key.UserID, &key.Name, &key.Secret, &createdAt, &lastUsedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("api key not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key.CreatedAt = time.Unix(createdAt, 0)
+	if lastUsedAt.Valid {
+		t := time.Unix(lastUsedAt.Int64, 0)
+		key.LastUsedAt = &t
+	}
+	return &key, nil
+}
+
+// ListAPIKeys retrieves a user's service keys without their secrets, newest first
+func (s *Store) ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, name, created_at, last_used_at
+		FROM api_keys WHERE user_id = ?
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]APIKey, 0)
+	for rows.Next() {
+		var key APIKey
+		var createdAt int64
+		var lastUsedAt sql.NullInt64
+
+		if err := rows.Scan(&key.ID, &key.UserID, &key.Name, &createdAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+
+		key.CreatedAt = time.Unix(createdAt, 0)
+		if lastUsedAt.Valid {
+			t := time.Unix(lastUsedAt.Int64, 0)
+			key.LastUsedAt = &t
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// TouchAPIKey records that a service key was just used
+func (s *Store) TouchAPIKey(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = ? WHERE id = ?`, time.Now().Unix(), id)
+	return err
+}
+
+// DeleteAPIKey revokes one of a user's service keys
+func (s *Store) DeleteAPIKey(ctx context.Context, userID, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM api_keys WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("api key not found")
+	}
+	return nil
+}
+
+// Session token revocation
+
+// RevokeToken adds a session token's ID to the revocation list until the token expires
+func (s *Store) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO revoked_tokens (jti, expires_at, revoked_at)
+		VALUES (?, ?, ?)
+	`, jti, expiresAt.Unix(), time.Now().Unix())
+	return err
+}
+
+// IsTokenRevoked reports whether a session token has been revoked
+func (s *Store) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?`, jti).Scan(&n)
+	return n > 0, err
+}
+
+// PruneRevokedTokens removes revocations of tokens that expired before the given time,
+// which would be rejected anyway, and returns how many were removed
+func (s *Store) PruneRevokedTokens(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < ?`, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Notebook template operations
+
+// CreateNotebookTemplate saves a named notebook configuration
+func (s *Store) CreateNotebookTemplate(ctx context.Context, tmpl *NotebookTemplate) error {
+	tmpl.ID = uuid.New().String()
+	tmpl.CreatedAt = time.Now()
+	if tmpl.Metadata == nil {
+		tmpl.Metadata = make(map[string]interface{})
+	}
+
+	metadataJSON, _ := json.Marshal(tmpl.Metadata)
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO notebook_templates (id, user_id, name, description, metadata, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, tmpl.ID, tmpl.UserID, tmpl.Name, tmpl.Description, string(metadataJSON), tmpl.CreatedAt.Unix())
+	return err
+}
+
+// GetNotebookTemplate retrieves a notebook template by ID
+func (s *Store) GetNotebookTemplate(ctx context.Context, id string) (*NotebookTemplate, error) {
+	var tmpl NotebookTemplate
+	var description, metadataJSON sql.NullString
+	var createdAt int64
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, user_id, name, description, metadata, created_at
+		FROM notebook_templates WHERE id = ?
+	`, id).Scan(&tmpl.ID, &tmpl.UserID, &tmpl.Name, &description, &metadataJSON, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("notebook template not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl.Description = description.String
+	tmpl.CreatedAt = time.Unix(createdAt, 0)
+	if metadataJSON.String != "" {
+		json.Unmarshal([]byte(metadataJSON.String), &tmpl.Metadata)
+	}
+	if tmpl.Metadata == nil {
+		tmpl.Metadata = make(map[string]interface{})
+	}
+
+	return &tmpl, nil
+}
+
+// ListNotebookTemplates retrieves a user's notebook templates ordered by name
+func (s *Store) ListNotebookTemplates(ctx context.Context, userID string) ([]NotebookTemplate, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, name, description, metadata, created_at
+		FROM notebook_templates WHERE user_id = ?
+		ORDER BY name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := make([]NotebookTemplate, 0)
+	for rows.Next() {
+		var tmpl NotebookTemplate
+		var description, metadataJSON sql.NullString
+		var createdAt int64
+
+		if err := rows.Scan(&tmpl.ID, &tmpl.UserID, &tmpl.Name, &description, &metadataJSON, &createdAt); err != nil {
+			return nil, err
+		}
+
+		tmpl.Description = description.String
+		tmpl.CreatedAt = time.Unix(createdAt, 0)
+		if metadataJSON.String != "" {
+			json.Unmarshal([]byte(metadataJSON.String), &tmpl.Metadata)
+		}
+		if tmpl.Metadata == nil {
+			tmpl.Metadata = make(map[string]interface{})
+		}
+
+		templates = append(templates, tmpl)
+	}
+
+	return templates, rows.Err()
+}
+
+// DeleteNotebookTemplate deletes one of a user's notebook templates
+func (s *Store) DeleteNotebookTemplate(ctx context.Context, userID, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM notebook_templates WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("notebook template not found")
+	}
+	return nil
+}
+
+// Note comment operations
+
+// CreateNoteComment adds a comment to a note
+func (s *Store) CreateNoteComment(ctx context.Context, comment *NoteComment) error {
+	comment.ID = uuid.New().String()
+	comment.CreatedAt = time.Now()
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO note_comments (id, note_id, notebook_id, user_id, body, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, comment.ID, comment.NoteID, comment.NotebookID, comment.UserID, comment.Body, comment.CreatedAt.Unix())
+	return err
+}
+
+// GetNoteComment retrieves a note comment by ID
+func (s *Store) GetNoteComment(ctx context.Context, id string) (*NoteComment, error) {
+	var comment NoteComment
+	var authorName sql.NullString
+	var createdAt int64
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT c.id, c.note_id, c.notebook_id, c.user_id, u.name, c.body, c.created_at
+		FROM note_comments c LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.id = ?
+	`, id).Scan(&comment.ID, &comment.NoteID, &comment.NotebookID, &comment.UserID, &authorName, &comment.Body, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("comment not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	comment.AuthorName = authorName.String
+	comment.CreatedAt = time.Unix(createdAt, 0)
+	return &comment, nil
+}
+
+// ListNoteComments retrieves the comments on a note, oldest first
+func (s *Store) ListNoteComments(ctx context.Context, noteID string) ([]NoteComment, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.id, c.note_id, c.notebook_id, c.user_id, u.name, c.body, c.created_at
+		FROM note_comments c LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.note_id = ?
+		ORDER BY c.created_at, c.rowid
+	`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := make([]NoteComment, 0)
+	for rows.Next() {
+		var comment NoteComment
+		var authorName sql.NullString
+		var createdAt int64
+
+		if err := rows.Scan(&comment.ID, &comment.NoteID, &comment.NotebookID, &comment.UserID, &authorName, &comment.Body, &createdAt); err != nil {
+			return nil, err
+		}
+
+		comment.AuthorName = authorName.String
+		comment.CreatedAt = time.Unix(createdAt, 0)
+		comments = append(comments, comment)
+	}
+
+	return comments, rows.Err()
+}
+
+// DeleteNoteComment deletes a note comment
+func (s *Store) DeleteNoteComment(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM note_comments WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("comment not found")
+	}
+	return nil
+}
+
+// CreatePodcast creates a podcast
+func (s *Store) CreatePodcast(ctx context.Context, podcast *Podcast) error {
+	podcast.ID = uuid.New().String()
+	now := time.Now()
+	podcast.CreatedAt = now
+	podcast.UpdatedAt = now
+
+	metadataJSON, _ := json.Marshal(podcast.Metadata)
+	sourceIDsJSON, _ := json.Marshal(podcast.SourceIDs)
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO podcasts (id, notebook_id, title, script, audio_url, duration, voice, status, source_ids, created_at, updated_at, metadata)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, podcast.ID, podcast.NotebookID, podcast.Title, podcast.Script, podcast.AudioURL, podcast.Duration,
+		podcast.Voice, podcast.Status, string(sourceIDsJSON), now.Unix(), now.Unix(), string(metadataJSON))
+	return err
+}
+
+// UpdatePodcast saves a podcast's progress: script, audio, duration, status and metadata
+func (s *Store) UpdatePodcast(ctx context.Context, podcast *Podcast) error {
+	podcast.UpdatedAt = time.Now()
+	metadataJSON, _ := json.Marshal(podcast.Metadata)
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE podcasts SET script = ?, audio_url = ?, duration = ?, status = ?, metadata = ?, updated_at = ?
+		WHERE id = ?
+	`, podcast.Script, podcast.AudioURL, podcast.Duration, podcast.Status, string(metadataJSON), podcast.UpdatedAt.Unix(), podcast.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("podcast not found")
+	}
+	return nil
+}
+
+// FailUnfinishedPodcasts sets the status of all pending and generating podcasts to error
+// with the given message, and returns how many there were
+func (s *Store) FailUnfinishedPodcasts(ctx context.Context, message string) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE podcasts
+		SET status = ?, metadata = json_set(COALESCE(NULLIF(metadata, ''), '{}'), '$.error', ?), updated_at = ?
+		WHERE status IN (?, ?)
+	`, PodcastStatusError, message, time.Now().Unix(), PodcastStatusPending, PodcastStatusGenerating)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// podcastColumns is the column list scanned by scanPodcast
+const podcastColumns = `id, notebook_id, title, script, audio_url, duration, voice, status, source_ids, created_at, updated_at, metadata`
+
+// scanPodcast scans a podcasts row selected with podcastColumns
+func scanPodcast(row interface{ Scan(...any) error }) (*Podcast, error) {
+	var podcast Podcast
+	var script, audioURL, sourceIDsJSON, metadataJSON sql.NullString
+	var createdAt, updatedAt int64
+
+	if err := row.Scan(&podcast.ID, &podcast.NotebookID, &podcast.Title, &script, &audioURL, &podcast.Duration,
+		&podcast.Voice, &podcast.Status, &sourceIDsJSON, &createdAt, &updatedAt, &metadataJSON); err != nil {
+		return nil, err
+	}
+
+	podcast.Script = script.String
+	podcast.AudioURL = audioURL.String
+	podcast.CreatedAt = time.Unix(createdAt, 0)
+	podcast.UpdatedAt = time.Unix(updatedAt, 0)
+	if sourceIDsJSON.String != "" {
+		json.Unmarshal([]byte(sourceIDsJSON.String), &podcast.SourceIDs)
+	}
+	if metadataJSON.String != "" {
+		json.Unmarshal([]byte(metadataJSON.String), &podcast.Metadata)
+	}
+	return &podcast, nil
+}
+
+// GetPodcast retrieves a podcast by ID
+func (s *Store) GetPodcast(ctx context.Context, id string) (*Podcast, error) {
+	podcast, err := scanPodcast(s.db.QueryRowContext(ctx, `SELECT `+podcastColumns+` FROM podcasts WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("podcast not found")
+	}
+	return podcast, err
+}
+
+// GetPodcastByAudioURL retrieves the podcast whose audio is served at url
+func (s *Store) GetPodcastByAudioURL(ctx context.Context, url string) (*Podcast, error) {
+	podcast, err := scanPodcast(s.db.QueryRowContext(ctx, `SELECT `+podcastColumns+` FROM podcasts WHERE audio_url = ?`, url))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("podcast not found")
+	}
+	return podcast, err
+}
+
+// ListPodcasts retrieves a notebook's podcasts, newest first
+func (s *Store) ListPodcasts(ctx context.Context, notebookID string) ([]Podcast, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+podcastColumns+` FROM podcasts
+		WHERE notebook_id = ?
+		ORDER BY created_at DESC
+	`, notebookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	podcasts := make([]Podcast, 0)
+	for rows.Next() {
+		podcast, err := scanPodcast(rows)
+		if err != nil {
+			return nil, err
+		}
+		podcasts = append(podcasts, *podcast)
+	}
+	return podcasts, rows.Err()
+}
+
+// Full-text search
+
+// likeEscaper escapes the LIKE wildcards in a search term
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchNotebook finds the sources and notes of a notebook whose title or content contain
+// all the terms, best matches first. Terms of three or more characters are looked up in
+// the FTS5 index; shorter ones are below the trigram size and are matched with LIKE.
+func (s *Store) SearchNotebook(ctx context.Context, notebookID string, terms []string, limit int) ([]SearchHit, error) {
+	var match []string
+	var short []string
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) >= 3 {
+			match = append(match, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+		} else {
+			short = append(short, term)
+		}
+	}
+
+	args := make([]interface{}, 0)
+	query := func(hitType, table, idColumn, titleColumn string) string {
+		where := "notebook_id = ?"
+		args = append(args, notebookID)
+		rank := "0.0"
+		if len(match) > 0 {
+			where += " AND " + table + " MATCH ?"
+			args = append(args, strings.Join(match, " "))
+			rank = "bm25(" + table + ")"
+		}
+		for _, term := range short {
+			where += fmt.Sprintf(` AND (%s LIKE ? ESCAPE '\' OR content LIKE ? ESCAPE '\')`, titleColumn)
+			pattern := "%" + likeEscaper.Replace(term) + "%"
+			args = append(args, pattern, pattern)
+		}
+		return fmt.Sprintf("SELECT '%s', %s, %s, content, %s FROM %s WHERE %s", hitType, idColumn, titleColumn, rank, table, where)
+	}
+
+	sqlQuery := query("source", "sources_fts", "source_id", "name") + " UNION ALL " +
+		query("note", "notes_fts", "note_id", "title") + " ORDER BY 5 LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := make([]SearchHit, 0)
+	for rows.Next() {
+		var hit SearchHit
+		var content string
+		var rank float64
+		if err := rows.Scan(&hit.Type, &hit.ID, &hit.Title, &content, &rank); err != nil {
+			return nil, err
+		}
+		// bm25 is lower for better matches; LIKE-only searches are unranked
+		if rank != 0 {
+			hit.Score = -rank
+		}
+		hit.Snippet = searchSnippet(content, terms)
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
@@ -0,0 +1,318 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kataras/golog"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Values of TransformationRequest.ResponseFormat
+const (
+	ResponseFormatMarkdown = "markdown"
+	ResponseFormatJSON     = "json"
+)
+
+// jsonSchema is the subset of JSON Schema used to describe structured transformation
+// output. It is shown to the model as is and checked by validate.
+type jsonSchema struct {
+	Type       string                 `json:"type"`
+	Properties map[string]*jsonSchema `json:"properties,omitempty"`
+	Required   []string               `json:"required,omitempty"`
+	Items      *jsonSchema            `json:"items,omitempty"`
+	MinItems   int                    `json:"minItems,omitempty"`
+
+	order []string // property order used when rendering markdown
+}
+
+// jsonField is a property of an object schema
+type jsonField struct {
+	name     string
+	schema   *jsonSchema
+	optional bool
+}
+
+func jsonString() *jsonSchema { return &jsonSchema{Type: "string"} }
+
+func jsonArray(items *jsonSchema) *jsonSchema {
+	return &jsonSchema{Type: "array", Items: items, MinItems: 1}
+}
+
+func jsonObject(fields ...jsonField) *jsonSchema {
+	schema := &jsonSchema{Type: "object", Properties: make(map[string]*jsonSchema, len(fields))}
+	for _, f := range fields {
+		schema.Properties[f.name] = f.schema
+		schema.order = append(schema.order, f.name)
+		if !f.optional {
+			schema.Required = append(schema.Required, f.name)
+		}
+	}
+	return schema
+}
+
+// structuredSchemas holds the JSON output schema of each transformation type that can
+// be generated as JSON. Glossary and quiz match the shape flashcard export reads.
+var structuredSchemas = map[string]*jsonSchema{
+	"summary": jsonObject(
+		jsonField{name: "title", schema: jsonString()},
+		jsonField{name: "summary", schema: jsonString()},
+		jsonField{name: "key_points", schema: jsonArray(jsonString())},
+	),
+	"faq": jsonObject(
+		jsonField{name: "questions", schema: jsonArray(jsonObject(
+			jsonField{name: "question", schema: jsonString()},
+			jsonField{name: "answer", schema: jsonString()},
+		))},
+	),
+	"study_guide": jsonObject(
+		jsonField{name: "title", schema: jsonString()},
+		jsonField{name: "topics", schema: jsonArray(jsonObject(
+			jsonField{name: "title", schema: jsonString()},
+			jsonField{name: "summary", schema: jsonString()},
+			jsonField{name: "key_concepts", schema: jsonArray(jsonString()), optional: true},
+		))},
+		jsonField{name: "review_questions", schema: jsonArray(jsonString()), optional: true},
+	),
+	"outline": jsonObject(
+		jsonField{name: "title", schema: jsonString()},
+		jsonField{name: "sections", schema: jsonArray(jsonObject(
+			jsonField{name: "heading", schema: jsonString()},
+			jsonField{name: "points", schema: jsonArray(jsonString())},
+		))},
+	),
+	"timeline": jsonObject(
+		jsonField{name: "events", schema: jsonArray(jsonObject(
+			jsonField{name: "date", schema: jsonString()},
+			jsonField{name: "event", schema: jsonString()},
+			jsonField{name: "description", schema: jsonString(), optional: true},
+		))},
+	),
+	"glossary": jsonObject(
+		jsonField{name: "terms", schema: jsonArray(jsonObject(
+			jsonField{name: "term", schema: jsonString()},
+			jsonField{name: "definition", schema: jsonString()},
+		))},
+	),
+	"quiz": jsonObject(
+		jsonField{name: "questions", schema: jsonArray(jsonObject(
+			jsonField{name: "question", schema: jsonString()},
+			jsonField{name: "options", schema: jsonArray(jsonString()), optional: true},
+			jsonField{name: "answer", schema: jsonString()},
+			jsonField{name: "explanation", schema: jsonString(), optional: true},
+		))},
+	),
+	"mindmap": jsonObject(
+		jsonField{name: "central_topic", schema: jsonString()},
+		jsonField{name: "branches", schema: jsonArray(jsonObject(
+			jsonField{name: "topic", schema: jsonString()},
+			jsonField{name: "subtopics", schema: jsonArray(jsonString()), optional: true},
+		))},
+	),
+	"podcast": jsonObject(
+		jsonField{name: "title", schema: jsonString()},
+		jsonField{name: "segments", schema: jsonArray(jsonObject(
+			jsonField{name: "speaker", schema: jsonString()},
+			jsonField{name: "text", schema: jsonString()},
+		))},
+	),
+	"custom": jsonObject(
+		jsonField{name: "title", schema: jsonString()},
+		jsonField{name: "sections", schema: jsonArray(jsonObject(
+			jsonField{name: "heading", schema: jsonString()},
+			jsonField{name: "content", schema: jsonString()},
+		))},
+	),
+}
+
+// structuredTypes lists the transformation types that support JSON output
+func structuredTypes() []string {
+	types := make([]string, 0, len(structuredSchemas))
+	for t := range structuredSchemas {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// StructuredOutputError reports model output that does not match the JSON schema of its
+// transformation type, even after a retry
+type StructuredOutputError struct {
+	Type   string
+	Errors []string
+}
+
+func (e *StructuredOutputError) Error() string {
+	return fmt.Sprintf("%s output does not match its JSON schema: %s", e.Type, strings.Join(e.Errors, "; "))
+}
+
+// validate checks value against the schema and returns the problems found, if any
+func (schema *jsonSchema) validate(value interface{}, path string) []string {
+	var errs []string
+	switch schema.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an object", path)}
+		}
+		for _, name := range schema.Required {
+			if v, ok := obj[name]; !ok || v == nil {
+				errs = append(errs, fmt.Sprintf("%s.%s: is required", path, name))
+			}
+		}
+		for _, name := range schema.order {
+			if v, ok := obj[name]; ok && v != nil {
+				errs = append(errs, schema.Properties[name].validate(v, path+"."+name)...)
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an array", path)}
+		}
+		if len(arr) < schema.MinItems {
+			errs = append(errs, fmt.Sprintf("%s: expected at least %d items", path, schema.MinItems))
+		}
+		for i, item := range arr {
+			errs = append(errs, schema.Items.validate(item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected a string", path)}
+		}
+		if strings.TrimSpace(s) == "" {
+			errs = append(errs, fmt.Sprintf("%s: must not be empty", path))
+		}
+	}
+	return errs
+}
+
+// parseStructuredOutput decodes the JSON object in a model response, tolerating code
+// fences and text around it, and validates it
+func parseStructuredOutput(schema *jsonSchema, response string) (map[string]interface{}, []string) {
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start == -1 || end < start {
+		return nil, []string{"response does not contain a JSON object"}
+	}
+
+	var value map[string]interface{}
+	if err := json.Unmarshal([]byte(response[start:end+1]), &value); err != nil {
+		return nil, []string{fmt.Sprintf("invalid JSON: %v", err)}
+	}
+	if errs := schema.validate(value, "$"); len(errs) > 0 {
+		return nil, errs
+	}
+	return value, nil
+}
+
+// generateStructured generates a transformation as JSON matching the schema of its type.
+// Output that does not conform is sent back to the model with the problems found, once.
+// It returns the markdown rendering, the parsed JSON and the finish reason.
+func (a *Agent) generateStructured(ctx context.Context, transformType, promptValue string, options ...llms.CallOption) (string, map[string]interface{}, string, error) {
+	schema, ok := structuredSchemas[transformType]
+	if !ok {
+		return "", nil, "", fmt.Errorf("%s transformations do not support JSON output", transformType)
+	}
+	schemaJSON, _ := json.MarshalIndent(schema, "", "  ")
+	prompt := promptValue + fmt.Sprintf(structuredOutputInstruction(), string(schemaJSON))
+
+	ctx, cancel := context.WithTimeout(ctx, 300*time.Second)
+	defer cancel()
+
+	var errs []string
+	for attempt := 1; attempt <= 2; attempt++ {
+		response, finishReason, err := a.generateWithFinishReason(ctx, a.llm, prompt, options...)
+		if err != nil {
+			return "", nil, "", err
+		}
+
+		var value map[string]interface{}
+		value, errs = parseStructuredOutput(schema, response)
+		if errs == nil {
+			return renderStructuredMarkdown(schema, value), value, finishReason, nil
+		}
+
+		golog.Warnf("%s JSON output failed validation (attempt %d/2): %s", transformType, attempt, strings.Join(errs, "; "))
+		prompt = prompt + "\n\n" + response + fmt.Sprintf(structuredRetryInstruction(), "- "+strings.Join(errs, "\n- "))
+	}
+	return "", nil, "", &StructuredOutputError{Type: transformType, Errors: errs}
+}
+
+// renderStructuredMarkdown renders structured output as markdown for the note content:
+// a title becomes the heading, other fields become sections, list items become bullets
+// and objects in a list become subsections headed by their first field
+func renderStructuredMarkdown(schema *jsonSchema, value map[string]interface{}) string {
+	var b strings.Builder
+	for _, name := range schema.order {
+		v, ok := value[name]
+		if !ok || v == nil {
+			continue
+		}
+		field := schema.Properties[name]
+		if name == "title" && field.Type == "string" {
+			b.WriteString("# " + v.(string) + "\n\n")
+			continue
+		}
+		b.WriteString("## " + fieldLabel(name) + "\n\n")
+		renderStructuredValue(&b, field, v)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// renderStructuredValue renders a field below its section heading
+func renderStructuredValue(b *strings.Builder, schema *jsonSchema, value interface{}) {
+	switch schema.Type {
+	case "string":
+		b.WriteString(value.(string) + "\n\n")
+	case "array":
+		items := value.([]interface{})
+		if schema.Items.Type != "object" {
+			for _, item := range items {
+				b.WriteString(fmt.Sprintf("- %v\n", item))
+			}
+			b.WriteString("\n")
+			return
+		}
+		for _, item := range items {
+			renderStructuredItem(b, schema.Items, item.(map[string]interface{}))
+		}
+	}
+}
+
+// renderStructuredItem renders an object in a list as a subsection
+func renderStructuredItem(b *strings.Builder, schema *jsonSchema, item map[string]interface{}) {
+	for i, name := range schema.order {
+		v, ok := item[name]
+		if !ok || v == nil {
+			continue
+		}
+		field := schema.Properties[name]
+		switch {
+		case i == 0:
+			b.WriteString(fmt.Sprintf("### %v\n\n", v))
+		case field.Type == "array":
+			b.WriteString("**" + fieldLabel(name) + "**:\n\n")
+			renderStructuredValue(b, field, v)
+		case len(schema.order) == 2:
+			b.WriteString(fmt.Sprintf("%v\n\n", v))
+		default:
+			b.WriteString(fmt.Sprintf("**%s**: %v\n\n", fieldLabel(name), v))
+		}
+	}
+}
+
+// fieldLabel turns a JSON field name into a heading, e.g. key_points -> Key points
+func fieldLabel(name string) string {
+	label := []rune(strings.ReplaceAll(name, "_", " "))
+	if len(label) > 0 {
+		label[0] = unicode.ToUpper(label[0])
+	}
+	return string(label)
+}
@@ -0,0 +1,231 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+	"github.com/tmc/langchaingo/prompts"
+)
+
+// templateIDKey is the notebook metadata key recording which template a notebook was created from.
+// It is not copied into templates.
+const templateIDKey = "template_id"
+
+// handleListTemplates lists the current user's notebook templates
+func (s *Server) handleListTemplates(c *gin.Context) {
+	ctx := context.Background()
+	userID := c.GetString("user_id")
+
+	templates, err := s.store.ListNotebookTemplates(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list templates"})
+		return
+	}
+	respondList(c, templates)
+}
+
+// handleCreateTemplate saves a notebook's configuration as a named template. Only the
+// notebook's metadata is copied, never its sources, notes or chats. Metadata given in the
+// request is applied on top, so a template can also be created without a notebook.
+func (s *Server) handleCreateTemplate(c *gin.Context) {
+	ctx := context.Background()
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Name        string                 `json:"name" binding:"required"`
+		Description string                 `json:"description"`
+		NotebookID  string                 `json:"notebook_id"`
+		Metadata    map[string]interface{} `json:"metadata"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.NotebookID == "" && req.Metadata == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "notebook_id or metadata required"})
+		return
+	}
+
+	metadata := make(map[string]interface{})
+	if req.NotebookID != "" {
+		if err := s.checkNotebookAccess(ctx, req.NotebookID, userID); err != nil {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+			return
+		}
+		notebook, err := s.store.GetNotebook(ctx, req.NotebookID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Notebook not found"})
+			return
+		}
+		for k, v := range notebook.Metadata {
+			metadata[k] = v
+		}
+	}
+	for k, v := range req.Metadata {
+		metadata[k] = v
+	}
+	delete(metadata, templateIDKey)
+
+	tmpl := &NotebookTemplate{
+		UserID:      userID,
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Metadata:    metadata,
+	}
+	if err := s.store.CreateNotebookTemplate(ctx, tmpl); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create template"})
+		return
+	}
+
+	// Log template creation activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "create_template",
+		ResourceType: "template",
+		ResourceID:   tmpl.ID,
+		ResourceName: tmpl.Name,
+		Details:      fmt.Sprintf(`{"notebook_id": "%s"}`, req.NotebookID),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log template creation activity: %v", err)
+	}
+
+	c.JSON(http.StatusCreated, tmpl)
+}
+
+// handleDeleteTemplate deletes one of the current user's templates. Notebooks created
+// from it keep their configuration.
+func (s *Server) handleDeleteTemplate(c *gin.Context) {
+	ctx := context.Background()
+	userID := c.GetString("user_id")
+
+	if err := s.store.DeleteNotebookTemplate(ctx, userID, c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Template not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// templateMetadata returns the notebook metadata for a new notebook created from one of
+// the user's templates, with the request's own metadata taking precedence
+func (s *Server) templateMetadata(ctx context.Context, userID, templateID string, overrides map[string]interface{}) (map[string]interface{}, error) {
+	tmpl, err := s.store.GetNotebookTemplate(ctx, templateID)
+	if err != nil || tmpl.UserID != userID {
+		return nil, fmt.Errorf("template not found")
+	}
+
+	metadata := make(map[string]interface{}, len(tmpl.Metadata)+len(overrides)+1)
+	for k, v := range tmpl.Metadata {
+		metadata[k] = v
+	}
+	for k, v := range overrides {
+		metadata[k] = v
+	}
+	metadata[templateIDKey] = tmpl.ID
+	return metadata, nil
+}
+
+// renderPromptPreview renders an f-string prompt template the way transformations do.
+// Variables the template references but values lacks are reported and left in the
+// prompt as {name}. A template that cannot be parsed returns an error.
+func renderPromptPreview(template string, values map[string]any) (string, []string, error) {
+	values = maps.Clone(values)
+	if values == nil {
+		values = make(map[string]any)
+	}
+
+	missing := make([]string, 0)
+	for _, name := range templateVariables(template) {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+			values[name] = "{" + name + "}"
+		}
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	prompt := prompts.NewPromptTemplate(template, keys)
+	prompt.TemplateFormat = prompts.TemplateFormatFString
+
+	rendered, err := prompt.Format(values)
+	if err != nil {
+		return "", missing, err
+	}
+	return rendered, missing, nil
+}
+
+// templateVariables lists the distinct variable names an f-string template references,
+// in order of first use. {{ and }} are literal braces; names are trimmed as the
+// formatter trims them. Malformed braces are left for the formatter to report.
+func templateVariables(template string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for i := 0; i < len(template); i++ {
+		switch template[i] {
+		case '}':
+			if i+1 < len(template) && template[i+1] == '}' {
+				i++
+			}
+		case '{':
+			if i+1 < len(template) && template[i+1] == '{' {
+				i++
+				continue
+			}
+			end := strings.IndexByte(template[i+1:], '}')
+			if end < 0 {
+				return names
+			}
+			name := strings.TrimSpace(template[i+1 : i+1+end])
+			if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+			i += end + 1
+		}
+	}
+	return names
+}
+
+// handlePreviewPrompt renders a prompt template with sample variables without calling
+// the model. The template is given directly, or taken from a transformation type.
+func (s *Server) handlePreviewPrompt(c *gin.Context) {
+	var req struct {
+		Template  string         `json:"template"`
+		Type      string         `json:"type"`
+		Variables map[string]any `json:"variables"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	template := req.Template
+	if template == "" {
+		if req.Type == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "template or type required"})
+			return
+		}
+		template = getTransformationPrompt(req.Type)
+	}
+
+	rendered, missing, err := renderPromptPreview(template, req.Variables)
+	resp := PromptPreviewResponse{
+		Prompt:           rendered,
+		MissingVariables: missing,
+		EstimatedTokens:  estimateTokens(rendered),
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,80 @@
+package backend
+
+import (
+	"math"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Reading speeds used for estimated reading time
+const (
+	wordsPerMinute    = 200 // space-delimited languages such as English
+	cjkCharsPerMinute = 300 // Chinese, Japanese and Korean characters
+)
+
+// TextStats holds length statistics for a piece of text
+type TextStats struct {
+	WordCount            int `json:"word_count"`
+	CharCount            int `json:"char_count"`
+	EstimatedReadingTime int `json:"estimated_reading_time"` // minutes
+}
+
+// computeTextStats counts words and characters and estimates reading time. CJK characters
+// are counted as one word each since those languages don't separate words with spaces.
+func computeTextStats(content string) TextStats {
+	var stats TextStats
+	stats.CharCount = utf8.RuneCountInString(content)
+
+	words, cjk := 0, 0
+	inWord := false
+	for _, r := range content {
+		switch {
+		case isCJK(r):
+			cjk++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				words++
+				inWord = true
+			}
+		case r == '\'' || r == '-' || r == '_':
+			// Keep contractions and hyphenated words together
+		default:
+			inWord = false
+		}
+	}
+	stats.WordCount = words + cjk
+
+	if stats.WordCount > 0 {
+		minutes := float64(words)/wordsPerMinute + float64(cjk)/cjkCharsPerMinute
+		stats.EstimatedReadingTime = int(math.Max(1, math.Ceil(minutes)))
+	}
+
+	return stats
+}
+
+// estimateTokens approximates the number of LLM tokens in text: roughly one token per
+// CJK character and one per four other characters. Providers don't report usage through
+// the common interface, so this is what usage reporting is based on.
+func estimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+// isCJK reports whether r is a Chinese, Japanese or Korean character
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// computeStats fills the note's computed length fields from its content
+func (n *Note) computeStats() {
+	n.TextStats = computeTextStats(n.Content)
+}
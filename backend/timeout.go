@@ -0,0 +1,94 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timeoutWriter drops what a handler writes after its deadline has passed, unless the
+// response was already started, so the middleware can answer 504 instead
+type timeoutWriter struct {
+	gin.ResponseWriter
+	base context.Context // request context before any deadline was set
+	ctx  context.Context // request context with the current deadline
+}
+
+// expired reports whether writes should be dropped
+func (w *timeoutWriter) expired() bool {
+	return w.ctx.Err() == context.DeadlineExceeded && !w.ResponseWriter.Written()
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if !w.expired() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	if !w.expired() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	if w.expired() {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	if w.expired() {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// TimeoutMiddleware gives the request context a deadline. Handlers that pass
+// c.Request.Context() to model calls stop working once it passes, and if they have not
+// started their response by then the client gets 504. Used on a single route after a
+// group-wide timeout, it replaces the group's deadline rather than nesting inside it,
+// so generation endpoints can be given more time than the rest of the API. A timeout of
+// 0 means no deadline.
+func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if w, ok := c.Writer.(*timeoutWriter); ok {
+			ctx := w.base
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(w.base, timeout)
+				defer cancel()
+			}
+			w.ctx = ctx
+			c.Request = c.Request.WithContext(ctx)
+			c.Next()
+			return
+		}
+
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		base := c.Request.Context()
+		ctx, cancel := context.WithTimeout(base, timeout)
+		defer cancel()
+
+		w := &timeoutWriter{ResponseWriter: c.Writer, base: base, ctx: ctx}
+		c.Writer = w
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		c.Writer = w.ResponseWriter
+		if w.ctx.Err() == context.DeadlineExceeded && !c.Writer.Written() {
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, ErrorResponse{
+				Error: "Request timed out",
+				Code:  "timeout",
+			})
+		}
+	}
+}
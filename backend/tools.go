@@ -0,0 +1,291 @@
+package backend
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxToolRounds limits how many times the model may call tools before it must answer
+const maxToolRounds = 3
+
+// ToolCall records one tool invocation made while answering a chat message
+type ToolCall struct {
+	Tool   string `json:"tool"`
+	Input  string `json:"input"`
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// chatTools are the deterministic tools the model can call in tool-use mode
+var chatTools = map[string]func(input string) (string, error){
+	"calculator": runCalculator,
+	"date_diff":  runDateDiff,
+	"date_add":   runDateAdd,
+}
+
+// toolCallPattern matches a tool call line such as: CALL calculator(1250 * 0.15)
+var toolCallPattern = regexp.MustCompile(`(?m)^\s*CALL\s+(\w+)\((.*)\)\s*$`)
+
+// parseToolCalls extracts the tool calls requested in a model response
+func parseToolCalls(response string) []ToolCall {
+	var calls []ToolCall
+	for _, match := range toolCallPattern.FindAllStringSubmatch(response, -1) {
+		calls = append(calls, ToolCall{Tool: match[1], Input: strings.TrimSpace(match[2])})
+	}
+	return calls
+}
+
+// executeToolCall runs a tool call and records its output or error
+func executeToolCall(call ToolCall) ToolCall {
+	tool, ok := chatTools[call.Tool]
+	if !ok {
+		call.Error = fmt.Sprintf("unknown tool: %s", call.Tool)
+		return call
+	}
+	output, err := tool(call.Input)
+	if err != nil {
+		call.Error = err.Error()
+	} else {
+		call.Output = output
+	}
+	return call
+}
+
+// runCalculator evaluates an arithmetic expression with + - * / % ^ and parentheses
+func runCalculator(input string) (string, error) {
+	p := &exprParser{input: strings.ReplaceAll(input, ",", "")}
+	value, err := p.parseExpr()
+	if err != nil {
+		return "", err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return "", fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos)
+	}
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return "", fmt.Errorf("result is not a finite number")
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64), nil
+}
+
+// exprParser is a small recursive-descent parser for arithmetic expressions
+type exprParser struct {
+	input string
+	pos   int
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *exprParser) peek() byte {
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+// parseExpr parses addition and subtraction
+func (p *exprParser) parseExpr() (float64, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			left += right
+		} else {
+			left -= right
+		}
+	}
+}
+
+// parseTerm parses multiplication, division and modulo
+func (p *exprParser) parseTerm() (float64, error) {
+	left, err := p.parsePower()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' && op != '%' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parsePower()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '*':
+			left *= right
+		case '/':
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			left /= right
+		case '%':
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			left = math.Mod(left, right)
+		}
+	}
+}
+
+// parsePower parses right-associative exponentiation
+func (p *exprParser) parsePower() (float64, error) {
+	base, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	if p.peek() == '^' {
+		p.pos++
+		exp, err := p.parsePower()
+		if err != nil {
+			return 0, err
+		}
+		return math.Pow(base, exp), nil
+	}
+	return base, nil
+}
+
+// parseUnary parses signs, parenthesized expressions and numbers
+func (p *exprParser) parseUnary() (float64, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		v, err := p.parseUnary()
+		return -v, err
+	case '+':
+		p.pos++
+		return p.parseUnary()
+	case '(':
+		p.pos++
+		v, err := p.parseExpr()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return v, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && (p.input[p.pos] >= '0' && p.input[p.pos] <= '9' || p.input[p.pos] == '.') {
+		p.pos++
+	}
+	if start == p.pos {
+		if p.pos >= len(p.input) {
+			return 0, fmt.Errorf("unexpected end of expression")
+		}
+		return 0, fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos)
+	}
+	value, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", p.input[start:p.pos])
+	}
+	// Allow a trailing percent sign meaning "divide by 100"
+	if p.pos < len(p.input) && p.input[p.pos] == '%' {
+		rest := strings.TrimSpace(p.input[p.pos+1:])
+		if rest == "" || strings.ContainsAny(rest[:1], "+-*/)^") {
+			p.pos++
+			value /= 100
+		}
+	}
+	return value, nil
+}
+
+// dateLayouts are the date formats accepted by the date tools
+var dateLayouts = []string{"2006-01-02", "2006/01/02", "2006.01.02", "2006年1月2日"}
+
+// parseToolDate parses a date in one of the supported layouts
+func parseToolDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+}
+
+// splitToolArgs splits "a, b" tool input into two trimmed arguments
+func splitToolArgs(input string) (string, string, error) {
+	parts := strings.SplitN(input, ",", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("expected two arguments separated by a comma")
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
+
+// runDateDiff returns the number of days between two dates: "2024-01-01, 2024-03-15"
+func runDateDiff(input string) (string, error) {
+	a, b, err := splitToolArgs(input)
+	if err != nil {
+		return "", err
+	}
+	start, err := parseToolDate(a)
+	if err != nil {
+		return "", err
+	}
+	end, err := parseToolDate(b)
+	if err != nil {
+		return "", err
+	}
+	days := int(math.Round(end.Sub(start).Hours() / 24))
+	return fmt.Sprintf("%d days", days), nil
+}
+
+// runDateAdd adds an offset to a date: "2024-01-01, 30d" (units d, w, m, y; may be negative)
+func runDateAdd(input string) (string, error) {
+	a, b, err := splitToolArgs(input)
+	if err != nil {
+		return "", err
+	}
+	date, err := parseToolDate(a)
+	if err != nil {
+		return "", err
+	}
+
+	unit := byte('d')
+	if n := len(b); n > 0 && strings.ContainsRune("dwmy", rune(b[n-1])) {
+		unit = b[n-1]
+		b = strings.TrimSpace(b[:n-1])
+	}
+	amount, err := strconv.Atoi(b)
+	if err != nil {
+		return "", fmt.Errorf("invalid offset %q", b)
+	}
+
+	switch unit {
+	case 'w':
+		date = date.AddDate(0, 0, 7*amount)
+	case 'm':
+		date = date.AddDate(0, amount, 0)
+	case 'y':
+		date = date.AddDate(amount, 0, 0)
+	default:
+		date = date.AddDate(0, 0, amount)
+	}
+	return date.Format("2006-01-02 (Monday)"), nil
+}
@@ -0,0 +1,251 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+// mediaExtensions are the audio and video formats the transcription API accepts
+var mediaExtensions = map[string]bool{
+	".mp3":  true,
+	".mpga": true,
+	".mpeg": true,
+	".m4a":  true,
+	".wav":  true,
+	".ogg":  true,
+	".flac": true,
+	".webm": true,
+	".mp4":  true,
+}
+
+// maxTranscriptionFileSize is the largest file the transcription API accepts
+const maxTranscriptionFileSize = 25 << 20
+
+// Source metadata keys set by transcription
+const (
+	sourceTranscriptionStatusKey = "transcription_status" // "pending", "done" or "failed"
+	sourceTranscriptionJobKey    = "transcription_job_id"
+	sourceTranscriptLanguageKey  = "transcript_language"
+	sourceTranscriptDurationKey  = "transcript_duration" // seconds
+	sourceTranscriptSegmentsKey  = "transcript_segments"
+)
+
+// isMediaFile reports whether a file is audio or video, by its extension
+func isMediaFile(name string) bool {
+	return mediaExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// TranscriptSegment is a timed piece of a transcript
+type TranscriptSegment struct {
+	Start float64 `json:"start"` // seconds
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// Transcript is the speech-to-text result of a media file
+type Transcript struct {
+	Language string              `json:"language"`
+	Duration float64             `json:"duration"`
+	Text     string              `json:"text"`
+	Segments []TranscriptSegment `json:"segments"`
+}
+
+// TranscriptionClient turns audio and video into text with the OpenAI transcription API
+type TranscriptionClient struct {
+	apiKey     string
+	baseURL    string
+	model      string
+	httpClient *http.Client
+}
+
+// NewTranscriptionClient creates a transcription client. An empty base URL uses the
+// OpenAI API.
+func NewTranscriptionClient(apiKey, baseURL, model string, transport http.RoundTripper) *TranscriptionClient {
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	return &TranscriptionClient{
+		apiKey:     apiKey,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		model:      model,
+		httpClient: providerHTTPClient(transport, 30*time.Minute),
+	}
+}
+
+// Transcribe transcribes a media file with segment timestamps
+func (t *TranscriptionClient) Transcribe(ctx context.Context, path string) (*Transcript, error) {
+	if t.apiKey == "" {
+		return nil, fmt.Errorf("transcription requires OPENAI_API_KEY")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, fmt.Errorf("failed to read media file: %w", err)
+	}
+	form.WriteField("model", t.model)
+	form.WriteField("response_format", "verbose_json")
+	form.WriteField("timestamp_granularities[]", "segment")
+	form.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+"/audio/transcriptions", &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+t.apiKey)
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("transcription API returned status %d: %s", resp.StatusCode, string(data[:min(len(data), 200)]))
+	}
+
+	var transcript Transcript
+	if err := json.Unmarshal(data, &transcript); err != nil {
+		return nil, fmt.Errorf("failed to parse transcription: %w", err)
+	}
+	return &transcript, nil
+}
+
+// formatTranscript renders a transcript as text with a [mm:ss] timestamp per segment
+func formatTranscript(t *Transcript) string {
+	if len(t.Segments) == 0 {
+		return strings.TrimSpace(t.Text)
+	}
+
+	var b strings.Builder
+	for _, seg := range t.Segments {
+		text := strings.TrimSpace(seg.Text)
+		if text == "" {
+			continue
+		}
+		b.WriteString("[" + formatTimestamp(seg.Start) + "] " + text + "\n")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// formatTimestamp formats seconds as mm:ss, or h:mm:ss from an hour on
+func formatTimestamp(seconds float64) string {
+	s := int(seconds)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
+
+// startTranscription creates the source of an uploaded media file and transcribes it in
+// a background job, because recordings take long to transcribe. The source has no
+// content until the job stores the transcript and indexes it.
+func (s *Server) startTranscription(c *gin.Context, source *Source, userID, stagedPath string) {
+	ctx := context.Background()
+
+	source.Metadata[sourceTranscriptionStatusKey] = "pending"
+	if err := s.store.CreateSource(ctx, source); err != nil {
+		golog.Errorf("failed to create source: %v", err)
+		os.Remove(stagedPath)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create source"})
+		return
+	}
+
+	key, _ := source.Metadata["path"].(string)
+	job := s.jobs.Start(userID, source.NotebookID, "transcription", func(ctx context.Context, job *Job) (interface{}, error) {
+		// The recording is stored whether or not it could be transcribed
+		defer func() {
+			if _, err := s.storeUpload(context.Background(), key, stagedPath); err != nil {
+				golog.Errorf("failed to store upload of source %s: %v", source.ID, err)
+			}
+		}()
+		return s.transcribeSource(ctx, job, source, stagedPath)
+	})
+
+	source.Metadata[sourceTranscriptionJobKey] = job.ID
+	if err := s.store.UpdateSourceMetadata(ctx, source.ID, source.Metadata); err != nil {
+		golog.Errorf("failed to record transcription job of source %s: %v", source.ID, err)
+	}
+
+	// Log file upload activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "upload_file",
+		ResourceType: "source",
+		ResourceID:   source.ID,
+		ResourceName: source.Name,
+		Details:      fmt.Sprintf(`{"notebook_id": "%s", "file_size": %d, "file_type": "%s", "transcription_job_id": "%s"}`, source.NotebookID, source.FileSize, filepath.Ext(source.Name), job.ID),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log file upload activity: %v", err)
+	}
+
+	c.JSON(http.StatusAccepted, source)
+}
+
+// transcribeSource transcribes a media source, stores the transcript as its content
+// and indexes it
+func (s *Server) transcribeSource(ctx context.Context, job *Job, source *Source, path string) (*Source, error) {
+	job.SetProgress("stage", "transcribing")
+	transcript, err := s.agent.transcriber.Transcribe(ctx, path)
+	if err != nil {
+		if ctx.Err() == nil {
+			source.Metadata[sourceTranscriptionStatusKey] = "failed"
+			source.Metadata["transcription_error"] = err.Error()
+			if err := s.store.UpdateSourceMetadata(context.Background(), source.ID, source.Metadata); err != nil {
+				golog.Errorf("failed to record transcription failure of source %s: %v", source.ID, err)
+			}
+		}
+		return nil, fmt.Errorf("failed to transcribe %s: %w", source.Name, err)
+	}
+
+	source.Content = formatTranscript(transcript)
+	source.Metadata[sourceTranscriptionStatusKey] = "done"
+	source.Metadata[sourceTranscriptLanguageKey] = transcript.Language
+	source.Metadata[sourceTranscriptDurationKey] = int(transcript.Duration)
+	source.Metadata[sourceTranscriptSegmentsKey] = transcript.Segments
+	delete(source.Metadata, "transcription_error")
+	s.vectorStore.AssignChunkStrategy(source)
+	if err := s.store.UpdateSourceContent(ctx, source.ID, source.Content, source.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to save transcript: %w", err)
+	}
+
+	job.SetProgress("stage", "indexing")
+	if source.Content != "" {
+		if _, err := s.indexSource(ctx, source); err != nil {
+			golog.Errorf("failed to ingest transcript of source %s: %v", source.ID, err)
+		}
+	}
+
+	golog.Infof("transcribed source %s: %ds of %s audio", source.ID, int(transcript.Duration), transcript.Language)
+	return source, nil
+}
@@ -0,0 +1,116 @@
+package backend
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// newProviderTransport builds the HTTP transport shared by all model provider clients,
+// so bursts of generation calls reuse pooled connections instead of paying for DNS
+// lookups and TLS handshakes each time
+func newProviderTransport(cfg Config) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          cfg.ProviderMaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.ProviderMaxIdleConnsPerHost,
+		IdleConnTimeout:       time.Duration(cfg.ProviderIdleConnTimeout) * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		// A custom DialContext turns off HTTP/2 unless it is asked for explicitly
+		ForceAttemptHTTP2: cfg.ProviderHTTP2,
+	}
+	if !cfg.ProviderHTTP2 {
+		// A non-nil empty map keeps the transport on HTTP/1.1
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	if cfg.ProviderDNSCacheTTL > 0 {
+		cache := &dnsCache{
+			ttl:     time.Duration(cfg.ProviderDNSCacheTTL) * time.Second,
+			entries: make(map[string]dnsCacheEntry),
+		}
+		transport.DialContext = cache.dialContext(dialer)
+	}
+	return transport
+}
+
+// providerHTTPClient returns a client on the shared transport with the given timeout
+func providerHTTPClient(transport http.RoundTripper, timeout time.Duration) *http.Client {
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// dnsCacheEntry holds the resolved addresses of a host
+type dnsCacheEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// dnsCache remembers host lookups for a fixed TTL. Provider APIs are a handful of hosts,
+// so entries are never evicted, only refreshed once expired.
+type dnsCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]dnsCacheEntry
+}
+
+// lookup returns the addresses of host, resolving it when the cached entry has expired
+func (d *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	d.mu.Lock()
+	entry, ok := d.entries[host]
+	d.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		// Keep using stale addresses while the resolver is failing
+		if ok {
+			return entry.addrs, nil
+		}
+		return nil, err
+	}
+
+	d.mu.Lock()
+	d.entries[host] = dnsCacheEntry{addrs: addrs, expires: time.Now().Add(d.ttl)}
+	d.mu.Unlock()
+	return addrs, nil
+}
+
+// dialContext dials through the cache, trying each resolved address in turn
+func (d *dnsCache) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		addrs, err := d.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+		for _, ip := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no addresses found for %s", host)
+		}
+		return nil, lastErr
+	}
+}
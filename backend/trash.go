@@ -0,0 +1,119 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+)
+
+// trashRetention is how long a deleted notebook stays in the trash before it is purged
+const trashRetention = 30 * 24 * time.Hour
+
+// purgeNotebook permanently deletes a notebook, drops its chunks from the vector index
+// and removes its uploaded files and generated images
+func (s *Server) purgeNotebook(ctx context.Context, notebookID string) error {
+	purge, err := s.store.PurgeNotebook(ctx, notebookID)
+	if err != nil {
+		return err
+	}
+
+	s.vectorMutex.Lock()
+	s.unloadNotebookIndex(ctx, notebookID)
+	s.vectorMutex.Unlock()
+
+	for _, key := range purge.FileKeys {
+		removeStored(ctx, s.storage, key, "file of notebook "+notebookID)
+	}
+	for i := range purge.Notes {
+		s.removeNoteImages(ctx, &purge.Notes[i], purge.UserID)
+	}
+	for _, key := range generatedFileKeys(purge.AudioURLs, purge.UserID) {
+		removeStored(ctx, s.storage, key, "podcast audio of notebook "+notebookID)
+	}
+	return nil
+}
+
+// purgeExpiredTrash permanently deletes the notebooks that have been in the trash
+// longer than trashRetention
+func (s *Server) purgeExpiredTrash(ctx context.Context) {
+	notebooks, err := s.store.ListNotebooksDeletedBefore(ctx, time.Now().Add(-trashRetention))
+	if err != nil {
+		golog.Errorf("failed to list expired notebooks in the trash: %v", err)
+		return
+	}
+
+	purged := 0
+	for _, nb := range notebooks {
+		if err := s.purgeNotebook(ctx, nb.ID); err != nil {
+			golog.Errorf("failed to purge notebook %s: %v", nb.ID, err)
+			continue
+		}
+		purged++
+	}
+	if purged > 0 {
+		golog.Infof("purged %d notebooks from the trash", purged)
+	}
+}
+
+// handleListTrash lists the current user's notebooks in the trash
+func (s *Server) handleListTrash(c *gin.Context) {
+	ctx := context.Background()
+	userID := c.GetString("user_id")
+
+	notebooks, err := s.store.ListDeletedNotebooks(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list notebooks in the trash"})
+		return
+	}
+	respondList(c, notebooks)
+}
+
+// handleRestoreNotebook takes a notebook out of the trash
+func (s *Server) handleRestoreNotebook(c *gin.Context) {
+	ctx := context.Background()
+	id := c.Param("id")
+	userID := c.GetString("user_id")
+
+	existing, err := s.store.GetNotebookIncludingDeleted(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Notebook not found"})
+		return
+	}
+	if existing.UserID != "" && existing.UserID != userID {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Access denied"})
+		return
+	}
+	if existing.DeletedAt == nil {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Notebook is not in the trash", Code: "not_deleted"})
+		return
+	}
+
+	if err := s.store.RestoreNotebook(ctx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to restore notebook"})
+		return
+	}
+
+	// Log notebook restore activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "restore_notebook",
+		ResourceType: "notebook",
+		ResourceID:   existing.ID,
+		ResourceName: existing.Name,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log notebook restore activity: %v", err)
+	}
+
+	notebook, err := s.store.GetNotebook(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load notebook"})
+		return
+	}
+	c.JSON(http.StatusOK, notebook)
+}
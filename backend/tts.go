@@ -0,0 +1,175 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kataras/golog"
+)
+
+// maxSpeechInput is the longest text the speech API accepts in one request
+const maxSpeechInput = 4000
+
+// SpeechClient turns podcast scripts into audio with the OpenAI speech API
+type SpeechClient struct {
+	apiKey     string
+	baseURL    string
+	model      string
+	httpClient *http.Client
+	storage    Storage
+}
+
+// NewSpeechClient creates a speech client. An empty base URL uses the OpenAI API.
+func NewSpeechClient(apiKey, baseURL, model string, transport http.RoundTripper, storage Storage) *SpeechClient {
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	return &SpeechClient{
+		apiKey:     apiKey,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		model:      model,
+		httpClient: providerHTTPClient(transport, 5*time.Minute),
+		storage:    storage,
+	}
+}
+
+// GenerateSpeech reads the text aloud in the given voice and saves the MP3 in the user's
+// files, returning its storage key. Text over the API limit is synthesized in parts,
+// and the MP3 streams are joined, which players handle as one file.
+func (s *SpeechClient) GenerateSpeech(ctx context.Context, text, voice, userID string) (string, error) {
+	if s.apiKey == "" {
+		return "", fmt.Errorf("text-to-speech requires OPENAI_API_KEY")
+	}
+
+	var audio bytes.Buffer
+	parts := splitSpeechText(text, maxSpeechInput)
+	for i, part := range parts {
+		golog.Infof("synthesizing speech part %d/%d (%d characters)...", i+1, len(parts), len([]rune(part)))
+		data, err := s.synthesize(ctx, part, voice)
+		if err != nil {
+			return "", fmt.Errorf("part %d/%d: %w", i+1, len(parts), err)
+		}
+		audio.Write(data)
+	}
+	if audio.Len() == 0 {
+		return "", fmt.Errorf("script has no text to read")
+	}
+
+	key := uploadKey(userID, fmt.Sprintf("podcast_%d.mp3", time.Now().UnixNano()))
+	if err := storeBytes(ctx, s.storage, key, audio.Bytes()); err != nil {
+		return "", fmt.Errorf("failed to save audio: %w", err)
+	}
+
+	golog.Infof("podcast audio saved to %s (%d bytes)", key, audio.Len())
+	return key, nil
+}
+
+// synthesize makes one speech API request
+func (s *SpeechClient) synthesize(ctx context.Context, text, voice string) ([]byte, error) {
+	body, _ := json.Marshal(map[string]string{
+		"model":           s.model,
+		"input":           text,
+		"voice":           voice,
+		"response_format": "mp3",
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/audio/speech", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("speech API returned status %d: %s", resp.StatusCode, string(data[:min(len(data), 200)]))
+	}
+	return data, nil
+}
+
+var (
+	stageDirectionPattern = regexp.MustCompile(`\[[^\]]*\]|（[^）]*）`)
+	speakerLabelPattern   = regexp.MustCompile(`(?m)^\s*(\*\*)?[^\s:：*]{1,20}( \d+)?(\*\*)?\s*[:：]\s*(\*\*)?`)
+	markdownMarkPattern   = regexp.MustCompile("[#*_>`]+")
+)
+
+// speechText prepares a podcast script to be read aloud: stage directions in [brackets],
+// speaker labels and markdown markup are removed
+func speechText(script string) string {
+	text := stageDirectionPattern.ReplaceAllString(script, "")
+	text = speakerLabelPattern.ReplaceAllString(text, "")
+	text = markdownMarkPattern.ReplaceAllString(text, "")
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// splitSpeechText splits text into parts of at most limit characters, breaking between
+// lines where possible
+func splitSpeechText(text string, limit int) []string {
+	var parts []string
+	var current []rune
+	for _, line := range strings.Split(text, "\n") {
+		runes := []rune(line)
+		if len(current) > 0 && len(current)+1+len(runes) > limit {
+			parts = append(parts, string(current))
+			current = nil
+		}
+		for len(runes) > limit {
+			parts = append(parts, string(runes[:limit]))
+			runes = runes[limit:]
+		}
+		if len(current) > 0 {
+			current = append(current, '\n')
+		}
+		current = append(current, runes...)
+	}
+	if strings.TrimSpace(string(current)) != "" {
+		parts = append(parts, string(current))
+	}
+	return parts
+}
+
+// estimateSpeechSeconds estimates how long text takes to read aloud, at about four
+// Chinese characters or 2.5 English words per second
+func estimateSpeechSeconds(text string) int {
+	han, words := 0, 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			han++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				words++
+			}
+			inWord = true
+		default:
+			inWord = false
+		}
+	}
+	return han/4 + words*2/5
+}
@@ -11,8 +11,27 @@ type User struct {
 	Name      string    `json:"name"`
 	AvatarURL string    `json:"avatar_url"`
 	Provider  string    `json:"provider"` // google, github
+	Locale    string    `json:"locale,omitempty"` // preferred UI/content locale, e.g. "zh", "en"
+	IsAdmin   bool      `json:"is_admin"` // updated on login from ADMIN_EMAILS, for display only
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Quota     *QuotaStatus `json:"quota,omitempty"` // filled in by the me endpoint, not stored
+}
+
+// QuotaStatus reports a user's daily generation usage
+type QuotaStatus struct {
+	Day     string                `json:"day"` // UTC date the counts apply to
+	ResetAt time.Time             `json:"reset_at"`
+	Exempt  bool                  `json:"exempt,omitempty"` // admins are never limited
+	Kinds   map[string]QuotaUsage `json:"kinds"`            // keyed by "transform", "chat", "image"
+}
+
+// QuotaUsage is the usage of one quota kind. Limit 0 and Remaining -1 mean unlimited.
+type QuotaUsage struct {
+	Limit     int `json:"limit"`
+	Used      int `json:"used"`
+	Remaining int `json:"remaining"`
 }
 
 // Source represents a document source added to a notebook
@@ -26,6 +45,7 @@ type Source struct {
 	FileName    string                 `json:"file_name,omitempty"`
 	FileSize    int64                  `json:"file_size,omitempty"`
 	ChunkCount  int                    `json:"chunk_count"`
+	ContentHash string                 `json:"content_hash,omitempty"` // identifies duplicate sources, see sourceContentHash
 	CreatedAt   time.Time              `json:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
@@ -33,15 +53,28 @@ type Source struct {
 
 // Note represents a note generated from sources
 type Note struct {
-	ID          string                 `json:"id"`
-	NotebookID  string                 `json:"notebook_id"`
-	Title       string                 `json:"title"`
-	Content     string                 `json:"content"`
-	Type        string                 `json:"type"` // "summary", "faq", "study_guide", "outline", "custom"
-	SourceIDs   []string               `json:"source_ids"`
-	CreatedAt   time.Time              `json:"created_at"`
-	UpdatedAt   time.Time              `json:"updated_at"`
-	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	ID           string                 `json:"id"`
+	NotebookID   string                 `json:"notebook_id"`
+	Title        string                 `json:"title"`
+	Content      string                 `json:"content"`
+	Type         string                 `json:"type"` // "summary", "faq", "study_guide", "outline", "custom"
+	SourceIDs    []string               `json:"source_ids"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	CommentCount int                    `json:"comment_count"`
+	TextStats                           // computed on read, not stored
+}
+
+// NoteComment is a comment left on a note by the notebook owner
+type NoteComment struct {
+	ID         string    `json:"id"`
+	NoteID     string    `json:"note_id"`
+	NotebookID string    `json:"notebook_id"`
+	UserID     string    `json:"user_id"`
+	AuthorName string    `json:"author_name,omitempty"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 // Notebook represents a collection of sources and notes
@@ -55,6 +88,18 @@ type Notebook struct {
 	CreatedAt   time.Time              `json:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	DeletedAt   *time.Time             `json:"deleted_at,omitempty"` // set while the notebook is in the trash
+}
+
+// NotebookTemplate is a saved notebook configuration (metadata such as default
+// transforms, system prompt and tags) used to set up new notebooks. It holds no content.
+type NotebookTemplate struct {
+	ID          string                 `json:"id"`
+	UserID      string                 `json:"user_id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata"`
+	CreatedAt   time.Time              `json:"created_at"`
 }
 
 // NotebookWithStats represents a notebook with statistics
@@ -73,6 +118,39 @@ type NotebookWithStats struct {
 	CoverImageURL string                 `json:"cover_image_url,omitempty"`
 }
 
+// SourceChunk is a single chunk of a source as stored in the vector store
+type SourceChunk struct {
+	Index   int    `json:"index"`
+	Content string `json:"content"`
+	Length  int    `json:"length"`
+}
+
+// SourceChunksResponse is a page of a source's chunks with its indexing status
+type SourceChunksResponse struct {
+	SourceID        string        `json:"source_id"`
+	SourceName      string        `json:"source_name"`
+	ChunkCount      int           `json:"chunk_count"`      // Count recorded on the source row
+	IndexedChunks   int           `json:"indexed_chunks"`   // Count actually present in the vector store
+	EmbeddingStatus string        `json:"embedding_status"` // "indexed", "missing", "empty"
+	Offset          int           `json:"offset"`
+	Limit           int           `json:"limit"`
+	Chunks          []SourceChunk `json:"chunks"`
+}
+
+// ContentRange describes the slice of a source's content returned, in characters
+type ContentRange struct {
+	Offset      int  `json:"offset"`
+	Length      int  `json:"length"`
+	TotalLength int  `json:"total_length"`
+	HasMore     bool `json:"has_more"`
+}
+
+// SourceResponse is a source whose content may be limited to a range
+type SourceResponse struct {
+	*Source
+	ContentRange *ContentRange `json:"content_range,omitempty"`
+}
+
 // ChatMessage represents a chat message
 type ChatMessage struct {
 	ID         string                 `json:"id"`
@@ -82,6 +160,20 @@ type ChatMessage struct {
 	Sources    []string               `json:"sources,omitempty"` // Source IDs referenced
 	CreatedAt  time.Time              `json:"created_at"`
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	Feedback   *MessageFeedback       `json:"feedback,omitempty"`
+}
+
+// ChatMessageDeletion lists the messages removed from a chat session
+type ChatMessageDeletion struct {
+	SessionID string   `json:"session_id"`
+	Deleted   []string `json:"deleted"` // IDs of the deleted messages, including a cascaded reply
+}
+
+// MessageFeedback is a user's rating of an assistant message
+type MessageFeedback struct {
+	Rating    int       `json:"rating"` // 1 (helpful) or -1 (not helpful)
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // ChatSession represents a chat session within a notebook
@@ -95,6 +187,20 @@ type ChatSession struct {
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
 }
 
+// ChatSessionWithStats represents a chat session with a summary of its messages
+type ChatSessionWithStats struct {
+	ID                 string                 `json:"id"`
+	NotebookID         string                 `json:"notebook_id"`
+	Title              string                 `json:"title"`
+	CreatedAt          time.Time              `json:"created_at"`
+	UpdatedAt          time.Time              `json:"updated_at"`
+	Metadata           map[string]interface{} `json:"metadata,omitempty"`
+	MessageCount       int                    `json:"message_count"`
+	LastMessageRole    string                 `json:"last_message_role,omitempty"`
+	LastMessagePreview string                 `json:"last_message_preview,omitempty"`
+	LastMessageAt      *time.Time             `json:"last_message_at,omitempty"`
+}
+
 // Podcast represents an audio podcast generated from sources
 type Podcast struct {
 	ID          string                 `json:"id"`
@@ -104,7 +210,7 @@ type Podcast struct {
 	AudioURL    string                 `json:"audio_url,omitempty"`
 	Duration    int                    `json:"duration,omitempty"` // in seconds
 	Voice       string                 `json:"voice"`
-	Status      string                 `json:"status"` // "pending", "generating", "completed", "error"
+	Status      string                 `json:"status"` // "pending", "generating", "ready", "error"
 	SourceIDs   []string               `json:"source_ids"`
 	CreatedAt   time.Time              `json:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at"`
@@ -113,11 +219,36 @@ type Podcast struct {
 
 // TransformationRequest represents a request to generate a note
 type TransformationRequest struct {
-	Type       string   `json:"type"`       // "summary", "faq", "study_guide", "outline", "podcast", "custom"
-	Prompt     string   `json:"prompt"`     // Custom prompt for "custom" type
-	SourceIDs  []string `json:"source_ids"` // Specific sources to use, empty = all
-	Length     string   `json:"length"`     // "short", "medium", "long"
-	Format     string   `json:"format"`     // "markdown", "bullet_points", "paragraphs"
+	Type           string           `json:"type"`              // "summary", "faq", "study_guide", "outline", "podcast", "custom"
+	Prompt         string           `json:"prompt"`            // Custom prompt for "custom" type
+	SourceIDs      []string         `json:"source_ids"`        // Specific sources to use, empty = all
+	NoteIDs        []string         `json:"note_ids"`          // Existing notes to use as input instead of sources
+	Length         string           `json:"length"`            // "short", "medium", "long"
+	Format         string           `json:"format"`            // "markdown", "bullet_points", "paragraphs"
+	ResponseFormat string           `json:"response_format"`   // "markdown" (default) or "json" for schema-validated structured output
+	Podcast        *PodcastSettings `json:"podcast,omitempty"` // Podcast settings, omitted fields use the notebook's defaults
+	Async          bool             `json:"async"`             // Run in the background and return a job instead of the note
+	Force          bool             `json:"force"`             // Replace existing notes of the type when only one note per type is allowed
+	WebhookURL     string           `json:"webhook_url"`       // Run in the background and POST the finished note here
+	OutputLanguage string           `json:"output_language"`   // Locale of the generated text, e.g. "en"; defaults to the notebook's
+	Model          string           `json:"model,omitempty"`   // Text model from GET /api/models, empty = the configured one
+}
+
+// PodcastSettings control podcast generation. Notebooks store their defaults in the
+// "podcast_defaults" metadata; zero fields are unset.
+type PodcastSettings struct {
+	Voice        string `json:"voice,omitempty"`
+	Speakers     int    `json:"speakers,omitempty"`
+	TargetLength int    `json:"target_length,omitempty"` // spoken length in minutes
+	Style        string `json:"style,omitempty"`         // "conversational", "interview", "debate", "lecture", "storytelling"
+}
+
+// PromptPreviewResponse is a prompt template rendered with sample variables
+type PromptPreviewResponse struct {
+	Prompt           string   `json:"prompt"`
+	MissingVariables []string `json:"missing_variables"` // referenced but not given, left as {name} in the prompt
+	Error            string   `json:"error,omitempty"`   // set when the template cannot be parsed
+	EstimatedTokens  int      `json:"estimated_tokens"`
 }
 
 // TransformationResponse represents the response from a transformation
@@ -137,11 +268,136 @@ type SourceSummary struct {
 	Type string `json:"type"`
 }
 
+// StaleNote describes a note whose sources changed after it was generated
+type StaleNote struct {
+	NoteID           string    `json:"note_id"`
+	Title            string    `json:"title"`
+	Type             string    `json:"type"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	UpdatedSourceIDs []string  `json:"updated_source_ids,omitempty"`
+	MissingSourceIDs []string  `json:"missing_source_ids,omitempty"`
+}
+
+// NotebookFreshness reports how current a notebook's sources and notes are
+type NotebookFreshness struct {
+	NotebookID            string          `json:"notebook_id"`
+	SourceCount           int             `json:"source_count"`
+	OldestSourceUpdatedAt *time.Time      `json:"oldest_source_updated_at,omitempty"`
+	NewestSourceUpdatedAt *time.Time      `json:"newest_source_updated_at,omitempty"`
+	StaleAfterDays        int             `json:"stale_after_days"`
+	URLSourceCount        int             `json:"url_source_count"`
+	StaleURLSourceCount   int             `json:"stale_url_source_count"`
+	StaleURLSources       []SourceSummary `json:"stale_url_sources"`
+	NoteCount             int             `json:"note_count"`
+	StaleNotes            []StaleNote     `json:"stale_notes"`
+}
+
+// IndexRepairReport describes what a vector index repair found and fixed in a notebook
+type IndexRepairReport struct {
+	NotebookID          string   `json:"notebook_id"`
+	SourcesChecked      int      `json:"sources_checked"`
+	ReindexedSources    []string `json:"reindexed_sources"`  // sources with missing or mismatched chunks
+	ChunkCountsFixed    []string `json:"chunk_counts_fixed"` // sources whose recorded chunk_count was corrected
+	OrphanSources       []string `json:"orphan_sources"`     // source IDs with chunks but no source row
+	OrphanChunksRemoved int      `json:"orphan_chunks_removed"`
+	NotebookDeleted     bool     `json:"notebook_deleted,omitempty"` // the notebook no longer exists; all its chunks were removed
+	Errors              []string `json:"errors,omitempty"`
+}
+
+// SearchHit is a source or note matched by a full-text notebook search
+type SearchHit struct {
+	Type    string  `json:"type"` // "source" or "note"
+	ID      string  `json:"id"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"` // content around the first match
+	Score   float64 `json:"score"`   // relevance, higher is better
+}
+
+// VectorSearchHit is a chunk returned by a vector search of a notebook
+type VectorSearchHit struct {
+	SourceID   string  `json:"source_id"`
+	SourceName string  `json:"source_name"`
+	Chunk      int     `json:"chunk"` // position of the chunk in its source
+	Content    string  `json:"content"`
+	Score      float32 `json:"score"` // similarity in [0, 1]; 0 for fallback chunks that did not match
+}
+
+// ChunkCountReport describes the source chunk counts corrected by a reconciliation
+type ChunkCountReport struct {
+	NotebooksChecked int      `json:"notebooks_checked"`
+	SourcesChecked   int      `json:"sources_checked"`
+	ChunkCountsFixed []string `json:"chunk_counts_fixed"` // sources whose recorded chunk_count was corrected
+}
+
+// IndexMemoryStats is an approximate memory footprint of a notebook's vector index
+type IndexMemoryStats struct {
+	NotebookID     string `json:"notebook_id"`
+	Loaded         bool   `json:"loaded"` // the notebook's sources have been loaded into the index
+	Chunks         int    `json:"chunks"`
+	Sources        int    `json:"sources"`
+	StoredChunks   int    `json:"stored_chunks"` // chunks recorded for the sources, held in the index once loaded
+	Dimension      int    `json:"dimension"`
+	VectorBytes    int64  `json:"vector_bytes"`    // chunks × dimension × 4 bytes (float32)
+	TextBytes      int64  `json:"text_bytes"`      // stored chunk text
+	EstimatedBytes int64  `json:"estimated_bytes"` // vector_bytes + text_bytes
+}
+
+// ResearchStep is one answered sub-question of a deep research run
+type ResearchStep struct {
+	Index    int             `json:"index"`
+	Question string          `json:"question"`
+	Answer   string          `json:"answer"`
+	Sources  []SourceSummary `json:"sources"`
+}
+
+// ListResponse is the /api/v1 envelope of list endpoints
+type ListResponse struct {
+	Data interface{} `json:"data"`
+	Meta ListMeta    `json:"meta"`
+}
+
+// ListMeta describes the page of items in a ListResponse
+type ListMeta struct {
+	Total   int  `json:"total"`
+	Limit   int  `json:"limit"`
+	Offset  int  `json:"offset"`
+	HasMore bool `json:"has_more"`
+}
+
+// ModelInfo describes a model available on this server and what it can do
+type ModelInfo struct {
+	ID             string   `json:"id"`
+	Provider       string   `json:"provider"`
+	Uses           []string `json:"uses"` // "chat", "transform", "image"
+	Default        bool     `json:"default"`
+	SupportsImages bool     `json:"supports_images"`
+	SupportsTools  bool     `json:"supports_tools"`
+	ContextWindow  int      `json:"context_window,omitempty"` // tokens, text models only
+	CostTier       string   `json:"cost_tier"`                // "local", "low", "medium", "high", "unknown"
+}
+
+// IndexMemorySummary totals the index memory estimate across loaded notebooks
+type IndexMemorySummary struct {
+	LoadedNotebooks int   `json:"loaded_notebooks"`
+	Chunks          int   `json:"chunks"`
+	EstimatedBytes  int64 `json:"estimated_bytes"`
+}
+
+// SourceUsage reports how often a source was cited in chat answers
+type SourceUsage struct {
+	SourceID    string     `json:"source_id"`
+	Name        string     `json:"name"`
+	Type        string     `json:"type"`
+	CitedCount  int        `json:"cited_count"`
+	LastCitedAt *time.Time `json:"last_cited_at,omitempty"`
+}
+
 // ChatRequest represents a chat request
 type ChatRequest struct {
 	Message   string                 `json:"message"`
 	SessionID string                 `json:"session_id,omitempty"`
 	Context   map[string]interface{} `json:"context,omitempty"`
+	Model     string                 `json:"model,omitempty"` // text model from GET /api/models, empty = the configured one
 }
 
 // ChatResponse represents a chat response
@@ -162,14 +418,117 @@ type ErrorResponse struct {
 
 // HealthResponse represents the health check response
 type HealthResponse struct {
-	Status    string            `json:"status"`
-	Version   string            `json:"version"`
-	Timestamp int64             `json:"timestamp"`
-	Services  map[string]string `json:"services"`
+	Status    string                 `json:"status"`
+	Version   string                 `json:"version"`
+	Timestamp int64                  `json:"timestamp"`
+	Services  map[string]string      `json:"services"`
+	Checks    map[string]HealthCheck `json:"checks"`          // database, vector_store and, with deep=true, llm
+	Index     *IndexMemorySummary    `json:"index,omitempty"` // estimated memory of loaded notebook indexes
+}
+
+// HealthCheck is the outcome of checking one dependency
+type HealthCheck struct {
+	Status    string `json:"status"` // "ok" or "error"
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
 }
 
 // ConfigResponse represents the client configuration
 type ConfigResponse struct {
+	// Chunk sizes are in words, or in characters for CJK text
+	ChunkSize     int    `json:"chunk_size"`
+	ChunkOverlap  int    `json:"chunk_overlap"`
+	ChunkStrategy string `json:"chunk_strategy"`
+}
+
+// Generation statuses
+const (
+	GenerationStatusRunning   = "running"
+	GenerationStatusSucceeded = "succeeded"
+	GenerationStatusFailed    = "failed"
+	GenerationStatusCancelled = "cancelled"
+)
+
+// UserErasure is the receipt of erasing a user and all of their data. It identifies the
+// user only by a hash so it can be kept as an audit record.
+type UserErasure struct {
+	SubjectHash  string    `json:"subject_hash"` // SHA-256 of the erased user ID
+	Notebooks    int       `json:"notebooks"`
+	Sources      int       `json:"sources"`
+	Notes        int       `json:"notes"`
+	ChatSessions int       `json:"chat_sessions"`
+	ChatMessages int       `json:"chat_messages"`
+	ActivityLogs int       `json:"activity_logs"`
+	Generations  int       `json:"generations"`
+	APIKeys      int       `json:"api_keys"`
+	Templates    int       `json:"templates"`
+	Files        int       `json:"files"`
+	VectorChunks int       `json:"vector_chunks"`
+	ErasedAt     time.Time `json:"erased_at"`
+
+	NotebookIDs []string `json:"-"` // for removing the notebooks' vectors
+	BlobFiles   []string `json:"-"` // content-addressed uploads no other user references
+}
+
+// AdminUser is a user as listed by the admin users endpoint, with their usage
+type AdminUser struct {
+	ID            string     `json:"id"`
+	Email         string     `json:"email"`
+	Name          string     `json:"name"`
+	AvatarURL     string     `json:"avatar_url"`
+	Provider      string     `json:"provider"`
+	IsAdmin       bool       `json:"is_admin"`
+	NotebookCount int        `json:"notebook_count"`
+	SourceCount   int        `json:"source_count"`
+	LastLoginAt   *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// APIKey is a per-user service key that machine clients use to sign requests
+type APIKey struct {
+	ID         string     `json:"id"` // sent as the key ID header
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Secret     string     `json:"secret,omitempty"` // only returned when the key is created
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Generation records a single transformation run
+type Generation struct {
+	ID               string     `json:"id"`
+	UserID           string     `json:"user_id"`
+	NotebookID       string     `json:"notebook_id"`
+	NoteID           string     `json:"note_id,omitempty"`
+	Type             string     `json:"type"`
+	Request          string     `json:"request"` // TransformationRequest as JSON
+	Model            string     `json:"model,omitempty"`
+	PromptTokens     int        `json:"prompt_tokens"`     // estimated
+	CompletionTokens int        `json:"completion_tokens"` // estimated
+	DurationMs       int64      `json:"duration_ms"`
+	Status           string     `json:"status"`
+	Error            string     `json:"error,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+}
+
+// GenerationUsage aggregates generations of one type
+type GenerationUsage struct {
+	Type             string  `json:"type"`
+	Count            int     `json:"count"`
+	Failed           int     `json:"failed"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	AvgDurationMs    float64 `json:"avg_duration_ms"`
+}
+
+// GenerationsResponse is returned by the generation usage endpoint
+type GenerationsResponse struct {
+	Generations []Generation      `json:"generations"`
+	Usage       []GenerationUsage `json:"usage"`
+	Days        int               `json:"days"`
+	Offset      int               `json:"offset"`
+	Limit       int               `json:"limit"`
 }
 
 // ActivityLog represents a user activity log entry
@@ -185,3 +544,17 @@ type ActivityLog struct {
 	UserAgent    string    `json:"user_agent"`
 	CreatedAt    time.Time `json:"created_at"`
 }
+
+// ActivityLogFilter narrows a listing of activity logs; empty fields match everything
+type ActivityLogFilter struct {
+	Action       string
+	ResourceType string
+}
+
+// ActivityResponse is returned by the activity endpoint. NextBefore is the before value
+// of the next page, empty when there are no older entries.
+type ActivityResponse struct {
+	Activities []ActivityLog `json:"activities"`
+	Limit      int           `json:"limit"`
+	NextBefore string        `json:"next_before,omitempty"`
+}
@@ -0,0 +1,173 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kataras/golog"
+)
+
+// Stages an upload job reports in its "stage" progress value
+const (
+	UploadStageExtracting = "extracting"
+	UploadStageIngesting  = "ingesting"
+	UploadStageDone       = "done"
+)
+
+// UploadJobResponse is returned when an uploaded document has been saved and its
+// extraction and ingestion continue in a background job
+type UploadJobResponse struct {
+	JobID string `json:"job_id"`
+	Job   *Job   `json:"job"`
+}
+
+// stagedUpload is a file received in full and staged on local disk
+type stagedUpload struct {
+	notebookID  string
+	userID      string
+	name        string // file name given by the client
+	size        int64
+	fileName    string // unique or content-addressed name it is stored under
+	path        string // staged file
+	contentHash string // set in hash storage mode, where it names the file
+	fileHash    string // SHA-256 of the file, to find duplicates
+}
+
+// uniqueUploadName adds a random suffix to an uploaded file name, so files uploaded
+// under the same name do not replace each other
+func uniqueUploadName(name string) string {
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s_%s%s", name[:len(name)-len(ext)], uuid.New().String()[:8], ext)
+}
+
+// checkUploadFile rejects oversized and unsupported files, and audio and video while
+// transcription is disabled. It writes the error response and returns false.
+func (s *Server) checkUploadFile(c *gin.Context, name string, size int64, contentType string) bool {
+	if s.cfg.MaxUploadBytes > 0 && size > s.cfg.MaxUploadBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: uploadSizeMessage(s.cfg.MaxUploadBytes), Code: "file_too_large"})
+		return false
+	}
+	if !uploadExtensionAllowed(s.cfg, name) || !uploadMIMEAllowed(s.cfg, contentType) {
+		c.JSON(http.StatusUnsupportedMediaType, ErrorResponse{
+			Error:   "File type is not supported",
+			Code:    "unsupported_file_type",
+			Details: fmt.Sprintf("extension %q, content type %q", filepath.Ext(name), contentType),
+		})
+		return false
+	}
+
+	if isMediaFile(name) {
+		if !s.cfg.EnableTranscription {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Audio and video uploads are not enabled", Code: "transcription_disabled"})
+			return false
+		}
+		if size > maxTranscriptionFileSize {
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: fmt.Sprintf("Audio and video files can be at most %d MB", maxTranscriptionFileSize>>20)})
+			return false
+		}
+	}
+	return true
+}
+
+// uploadRequest carries what the upload job needs from the request that started it
+type uploadRequest struct {
+	source    *Source
+	path      string // staged file
+	key       string // where the file is stored once extracted
+	userID    string
+	locale    string
+	ipAddress string
+	userAgent string
+}
+
+// storeUpload moves a staged upload to storage. A content-addressed blob that is already
+// stored is kept as is, since other sources reference it; created reports whether the
+// file was stored now.
+func (s *Server) storeUpload(ctx context.Context, key, stagedPath string) (created bool, err error) {
+	if isContentHashFileName(path.Base(key)) && storageExists(ctx, s.storage, key) {
+		os.Remove(stagedPath)
+		return false, nil
+	}
+	if err := storeFile(ctx, s.storage, key, stagedPath); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// processUpload extracts the text of a staged upload, moves the file to storage, creates
+// its source and indexes it. The job progress holds the current stage and, once ingested,
+// the number of chunks. The file is removed when the source could not be created.
+func (s *Server) processUpload(ctx context.Context, job *Job, req uploadRequest) (*Source, error) {
+	source := req.source
+	discard := func() {
+		os.Remove(req.path)
+	}
+
+	job.SetProgress("stage", UploadStageExtracting)
+	content, encoding, err := s.vectorStore.ExtractDocumentWithEncoding(ctx, req.path)
+	if err != nil {
+		golog.Errorf("failed to extract document content: %v", err)
+		discard()
+		return nil, fmt.Errorf("failed to extract document content: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		discard()
+		return nil, err
+	}
+	source.Content = content
+	if encoding != "" {
+		source.Metadata["encoding"] = encoding
+	}
+
+	// Once the file is stored the job no longer stops for cancellation, so the source is
+	// not left without its file or chunks
+	created, err := s.storeUpload(context.Background(), req.key, req.path)
+	if err != nil {
+		golog.Errorf("failed to store upload %s: %v", req.key, err)
+		discard()
+		return nil, fmt.Errorf("failed to store file")
+	}
+
+	s.vectorStore.AssignChunkStrategy(source)
+	if err := s.store.CreateSource(context.Background(), source); err != nil {
+		golog.Errorf("failed to create source: %v", err)
+		if created {
+			removeStored(context.Background(), s.storage, req.key, "upload")
+		}
+		return nil, fmt.Errorf("failed to create source")
+	}
+	job.SetProgress("source_id", source.ID)
+
+	// Log file upload activity
+	activityLog := &ActivityLog{
+		UserID:       req.userID,
+		Action:       "upload_file",
+		ResourceType: "source",
+		ResourceID:   source.ID,
+		ResourceName: source.Name,
+		Details:      fmt.Sprintf(`{"notebook_id": "%s", "file_size": %d, "file_type": "%s", "job_id": "%s"}`, source.NotebookID, source.FileSize, filepath.Ext(source.Name), job.ID),
+		IPAddress:    req.ipAddress,
+		UserAgent:    req.userAgent,
+	}
+	if err := s.store.LogActivity(context.Background(), activityLog); err != nil {
+		golog.Errorf("failed to log file upload activity: %v", err)
+	}
+
+	if source.Content != "" {
+		job.SetProgress("stage", UploadStageIngesting)
+		if _, err := s.indexSource(context.Background(), source); err != nil {
+			golog.Errorf("failed to ingest document: %v", err)
+		}
+	}
+	job.SetProgress("chunks", source.ChunkCount)
+	job.SetProgress("stage", UploadStageDone)
+
+	s.maybeRefreshAutoSummary(source.NotebookID, req.userID, req.locale)
+	return source, nil
+}
@@ -0,0 +1,139 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultUploadExtensions are the document formats the extractor handles; audio and
+// video formats are added when transcription is enabled
+var defaultUploadExtensions = []string{
+	".pdf", ".txt", ".md", ".markdown", ".csv", ".json",
+	".html", ".htm", ".docx", ".doc", ".pptx", ".ppt", ".xlsx", ".xls",
+}
+
+// errUploadTooLarge is returned when more bytes arrive than the upload limit allows
+var errUploadTooLarge = errors.New("file exceeds the upload size limit")
+
+// multipartOverhead is the room allowed for form fields and part headers around an
+// uploaded file
+const multipartOverhead = 1 << 20
+
+// parseLimitedMultipartForm parses a multipart request whose file may be at most limit
+// bytes. The body is capped before parsing, so an oversized request is cut off instead
+// of being spooled to disk, and errUploadTooLarge is returned. Other parse errors are
+// ignored and left to the form lookups that follow. A limit of 0 or less reads everything.
+func parseLimitedMultipartForm(c *gin.Context, limit int64) error {
+	if limit > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+multipartOverhead)
+	}
+	if _, err := c.MultipartForm(); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return errUploadTooLarge
+		}
+	}
+	return nil
+}
+
+// uploadExtensionAllowed reports whether the extension of name is in the allowlist.
+// Audio and video files are always allowed here; whether they are accepted depends
+// on transcription being enabled.
+func uploadExtensionAllowed(cfg Config, name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return false
+	}
+	if mediaExtensions[ext] {
+		return true
+	}
+	for _, allowed := range cfg.UploadAllowedExtensions {
+		if strings.EqualFold(allowed, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadMIMEAllowed reports whether the Content-Type the client declared for the file is
+// in the allowlist. An empty allowlist accepts any type. Entries may end in "/*" to match
+// a whole family, e.g. "text/*".
+func uploadMIMEAllowed(cfg Config, contentType string) bool {
+	if len(cfg.UploadAllowedMIMETypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range cfg.UploadAllowedMIMETypes {
+		allowed = strings.ToLower(allowed)
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// copyUploadLimited copies an upload to dst, failing with errUploadTooLarge once more
+// than limit bytes have been read. The declared size of a multipart file comes from the
+// client, so it is not trusted for the limit. A limit of 0 or less copies everything.
+func copyUploadLimited(dst io.Writer, src io.Reader, limit int64) (int64, error) {
+	if limit <= 0 {
+		return io.Copy(dst, src)
+	}
+	n, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	if err == nil && n > limit {
+		err = errUploadTooLarge
+	}
+	return n, err
+}
+
+// saveUploadLimited writes an uploaded file to path, enforcing the size limit while
+// copying, and returns the SHA-256 of its content. A partially written file is removed
+// on error.
+func saveUploadLimited(file *multipart.FileHeader, path string, limit int64) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	out, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	hasher := sha256.New()
+	_, err = copyUploadLimited(io.MultiWriter(out, hasher), src, limit)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// uploadSizeMessage describes the upload size limit for error responses
+func uploadSizeMessage(limit int64) string {
+	if limit >= 1<<20 {
+		return fmt.Sprintf("Files can be at most %d MB", limit>>20)
+	}
+	return fmt.Sprintf("Files can be at most %d bytes", limit)
+}
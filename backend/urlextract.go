@@ -0,0 +1,503 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kataras/golog"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// URL extraction modes, stored in source metadata under "extraction_mode"
+const (
+	URLExtractFullText    = "full-text"    // the whole page converted by markitdown
+	URLExtractMainContent = "main-content" // the page's <main> or <article>, without navigation and boilerplate
+	URLExtractReadability = "readability"  // the block with the densest paragraph text
+)
+
+// maxURLFetchSize bounds how much of a page is read for extraction
+const maxURLFetchSize = 10 << 20
+
+// urlFetchTimeout bounds fetching and reading a page for extraction
+const urlFetchTimeout = 60 * time.Second
+
+// maxURLRedirects bounds the redirects followed when fetching a URL source
+const maxURLRedirects = 10
+
+// newURLFetchClient returns the client URL sources are fetched with. It pools connections
+// but, unlike the provider transport, does not cache DNS: user-supplied hosts are
+// unbounded and must be resolved afresh on every fetch. Every redirect is checked with
+// checkPublicURL, and connections only go to public addresses, so neither a redirect nor
+// a host that resolves differently after the check reaches the server's network. No
+// proxy is used, it would hide the address actually connected to.
+func newURLFetchClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		DialContext:           publicDialContext(dialer),
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   2,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   urlFetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxURLRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxURLRedirects)
+			}
+			return checkPublicURL(req.Context(), req.URL.String())
+		},
+	}
+}
+
+// publicDialContext resolves the host once and connects only to public addresses, so the
+// address checked is the address dialed
+func publicDialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+		}
+		for _, a := range addrs {
+			if !isPublicIP(a.IP) {
+				return nil, fmt.Errorf("%s resolves to a non-public address", host)
+			}
+		}
+
+		var lastErr error
+		for _, a := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(a.IP.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no addresses found for %s", host)
+		}
+		return nil, lastErr
+	}
+}
+
+// isPublicIP reports whether ip is outside loopback, private, link-local and other
+// internal ranges
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// checkPublicURL rejects URLs that are not http(s) or whose host resolves to a loopback,
+// private, link-local or otherwise internal address, so user-supplied links cannot be
+// used to reach services on the server's network
+func checkPublicURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("invalid URL")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme: %s", u.Scheme)
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", u.Hostname(), err)
+	}
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return fmt.Errorf("%s resolves to a non-public address", u.Hostname())
+		}
+	}
+	return nil
+}
+
+// validURLExtractionMode reports whether mode is a known URL extraction mode
+func validURLExtractionMode(mode string) bool {
+	switch mode {
+	case URLExtractFullText, URLExtractMainContent, URLExtractReadability:
+		return true
+	}
+	return false
+}
+
+// fetchURL gets a URL with the URL source client. The caller closes the body.
+func (vs *VectorStore) fetchURL(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; notex)")
+	resp, err := vs.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch URL: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// convertFetchedDocument saves a fetched document to a temporary file and converts it
+// whole with markitdown. The file extension, which markitdown picks its converter by, is
+// taken from the URL path or else the media type.
+func (vs *VectorStore) convertFetchedDocument(resp *http.Response, mediaType string) (string, error) {
+	if !vs.cfg.EnableMarkitdown {
+		return "", fmt.Errorf("markitdown is disabled, cannot fetch URL content")
+	}
+
+	ext := ".html"
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		ext = filepath.Ext(resp.Request.URL.Path)
+		if exts, _ := mime.ExtensionsByType(mediaType); ext == "" && len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	tmp, err := os.CreateTemp("", "notex-url-*"+ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to save URL content: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = copyUploadLimited(tmp, resp.Body, maxURLFetchSize)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if errors.Is(err, errUploadTooLarge) {
+		return "", fmt.Errorf("URL content is larger than %d MB", maxURLFetchSize>>20)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read URL content: %w", err)
+	}
+	return vs.convertWithMarkitdown(tmp.Name())
+}
+
+// ExtractFromURLWithMode fetches a URL and extracts its text with the given mode. Pages
+// that are not HTML are always converted whole by markitdown.
+func (vs *VectorStore) ExtractFromURLWithMode(ctx context.Context, url, mode string) (string, error) {
+	resp, err := vs.fetchURL(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	mediaType, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mode == URLExtractFullText {
+		return vs.convertFetchedDocument(resp, mediaType)
+	}
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		golog.Infof("%s is %s, not HTML; converting the whole document", url, mediaType)
+		return vs.convertFetchedDocument(resp, mediaType)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxURLFetchSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read URL content: %w", err)
+	}
+	text, _ := toUTF8(body, params["charset"])
+	doc, err := html.Parse(strings.NewReader(text))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	var root *html.Node
+	if mode == URLExtractReadability {
+		root = readableNode(doc)
+	}
+	if root == nil {
+		root = mainContentNode(doc)
+	}
+
+	content := strings.TrimSpace(renderHTMLText(root))
+	if content == "" {
+		return "", fmt.Errorf("no text content found with %s extraction", mode)
+	}
+	return content, nil
+}
+
+// boilerplateElements are skipped when extracting the content of a page
+var boilerplateElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Svg: true, atom.Iframe: true, atom.Form: true, atom.Button: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+	atom.Head: true,
+}
+
+// findElement returns the first element below n matching the predicate, depth first
+func findElement(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if n.Type == html.ElementNode && match(n) {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// htmlAttr returns an attribute of an element
+func htmlAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// mainContentNode returns the page's main landmark: <main>, role="main", <article>, or
+// the body as a last resort
+func mainContentNode(doc *html.Node) *html.Node {
+	for _, match := range []func(*html.Node) bool{
+		func(n *html.Node) bool { return n.DataAtom == atom.Main },
+		func(n *html.Node) bool { return htmlAttr(n, "role") == "main" },
+		func(n *html.Node) bool { return n.DataAtom == atom.Article },
+		func(n *html.Node) bool { return n.DataAtom == atom.Body },
+	} {
+		if n := findElement(doc, match); n != nil {
+			return n
+		}
+	}
+	return doc
+}
+
+// readableNode picks the element holding the page's article text, in the spirit of
+// Readability: every substantial paragraph scores its parent fully and its grandparent
+// by half, and link-heavy blocks are penalized. It returns nil when no paragraph qualifies.
+func readableNode(doc *html.Node) *html.Node {
+	scores := make(map[*html.Node]float64)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && boilerplateElements[n.DataAtom] {
+			return
+		}
+		if n.Type == html.ElementNode && (n.DataAtom == atom.P || n.DataAtom == atom.Pre || n.DataAtom == atom.Blockquote) {
+			text := strings.TrimSpace(nodeText(n))
+			length := utf8.RuneCountInString(text)
+			if length >= 25 && n.Parent != nil {
+				score := 1 + float64(strings.Count(text, ",")+strings.Count(text, "，")) + math.Min(float64(length)/100, 3)
+				scores[n.Parent] += score
+				if n.Parent.Parent != nil {
+					scores[n.Parent.Parent] += score / 2
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	var best *html.Node
+	bestScore := 0.0
+	for n, score := range scores {
+		score *= 1 - linkDensity(n)
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	return best
+}
+
+// linkDensity returns the share of an element's text that is link text
+func linkDensity(n *html.Node) float64 {
+	total := utf8.RuneCountInString(nodeText(n))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			linked += utf8.RuneCountInString(nodeText(n))
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return float64(linked) / float64(total)
+}
+
+// nodeText returns the text below a node, skipping boilerplate elements
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			return
+		}
+		if n.Type == html.ElementNode && boilerplateElements[n.DataAtom] {
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+// renderHTMLText converts an element to plain text with light Markdown: headings, list
+// items and paragraphs separated by blank lines. Boilerplate elements are skipped.
+func renderHTMLText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			sb.WriteString(strings.Join(strings.Fields(n.Data), " "))
+			if strings.HasSuffix(n.Data, " ") || strings.HasSuffix(n.Data, "\n") {
+				sb.WriteString(" ")
+			}
+			return
+		case html.ElementNode:
+			if boilerplateElements[n.DataAtom] {
+				return
+			}
+		}
+
+		switch n.DataAtom {
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			sb.WriteString("\n\n" + strings.Repeat("#", int(n.Data[1]-'0')) + " ")
+		case atom.Li:
+			sb.WriteString("\n- ")
+		case atom.Br:
+			sb.WriteString("\n")
+		case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Blockquote, atom.Pre,
+			atom.Ul, atom.Ol, atom.Table, atom.Tr, atom.Figure:
+			sb.WriteString("\n\n")
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if n.DataAtom == atom.Td || n.DataAtom == atom.Th {
+			sb.WriteString(" | ")
+		}
+	}
+	walk(n)
+
+	// Trim each line and collapse runs of blank lines
+	lines := strings.Split(sb.String(), "\n")
+	out := make([]string, 0, len(lines))
+	blank := true
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if !blank {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		out = append(out, line)
+		blank = false
+	}
+	return strings.Join(out, "\n")
+}
+
+// handleReprocessSource re-fetches a URL source with another extraction mode and
+// re-ingests it
+func (s *Server) handleReprocessSource(c *gin.Context) {
+	ctx := context.Background()
+	notebookID := c.Param("id")
+	sourceID := c.Param("sourceId")
+	userID := c.GetString("user_id")
+
+	if err := s.checkNotebookAccess(ctx, notebookID, userID); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var req struct {
+		ExtractionMode string `json:"extraction_mode" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !validURLExtractionMode(req.ExtractionMode) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("unknown extraction_mode: %s (supported: readability, full-text, main-content)", req.ExtractionMode)})
+		return
+	}
+
+	source, err := s.store.GetSource(ctx, sourceID)
+	if err != nil || source.NotebookID != notebookID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Source not found"})
+		return
+	}
+	if source.URL == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Only URL sources can be reprocessed"})
+		return
+	}
+
+	// Sources added before URLs were checked may point at internal addresses
+	if err := checkPublicURL(ctx, source.URL); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	golog.Infof("reprocessing %s with %s extraction", source.URL, req.ExtractionMode)
+	content, err := s.vectorStore.ExtractFromURLWithMode(ctx, source.URL, req.ExtractionMode)
+	if err != nil {
+		golog.Errorf("failed to fetch URL content: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: fmt.Sprintf("Failed to fetch URL content: %v", err)})
+		return
+	}
+
+	if source.Metadata == nil {
+		source.Metadata = make(map[string]interface{})
+	}
+	source.Metadata["extraction_mode"] = req.ExtractionMode
+	source.Content = content
+	if err := s.store.UpdateSourceContent(ctx, sourceID, content, source.Metadata); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update source"})
+		return
+	}
+
+	if _, err := s.reindexChangedSource(ctx, source); err != nil {
+		golog.Errorf("failed to ingest reprocessed source: %v", err)
+	}
+
+	// Log source reprocessing activity
+	activityLog := &ActivityLog{
+		UserID:       userID,
+		Action:       "reprocess_source",
+		ResourceType: "source",
+		ResourceID:   sourceID,
+		ResourceName: source.Name,
+		Details:      fmt.Sprintf(`{"notebook_id": "%s", "extraction_mode": "%s", "chunk_count": %d}`, notebookID, req.ExtractionMode, source.ChunkCount),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+	}
+	if err := s.store.LogActivity(ctx, activityLog); err != nil {
+		golog.Errorf("failed to log source reprocessing activity: %v", err)
+	}
+
+	c.JSON(http.StatusOK, source)
+}
@@ -3,11 +3,16 @@ package backend
 import (
 	"context"
 	"fmt"
+	"math"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/kataras/golog"
 	"github.com/tmc/langchaingo/schema"
@@ -18,6 +23,8 @@ type VectorStore struct {
 	cfg  Config
 	docs []schema.Document
 	mu   sync.RWMutex
+
+	httpClient *http.Client // fetches URL sources over a pooled transport
 }
 
 // VectorStats contains statistics about the vector store
@@ -35,8 +42,9 @@ func NewVectorStore(cfg Config) (*VectorStore, error) {
 	}
 
 	return &VectorStore{
-		cfg:  cfg,
-		docs: make([]schema.Document, 0),
+		cfg:        cfg,
+		docs:       make([]schema.Document, 0),
+		httpClient: newURLFetchClient(),
 	}, nil
 }
 
@@ -51,7 +59,7 @@ func (vs *VectorStore) IngestDocuments(ctx context.Context, notebookID string, p
 		}
 
 		fmt.Printf("[VectorStore] File loaded, size: %d bytes\n", len(content))
-		if _, err := vs.IngestText(ctx, notebookID, filepath.Base(path), content); err != nil {
+		if _, err := vs.IngestText(ctx, notebookID, "", filepath.Base(path), content); err != nil {
 			return err
 		}
 	}
@@ -61,24 +69,45 @@ func (vs *VectorStore) IngestDocuments(ctx context.Context, notebookID string, p
 
 // ExtractDocument reads and converts a document to text/markdown
 func (vs *VectorStore) ExtractDocument(ctx context.Context, path string) (string, error) {
+	content, _, err := vs.ExtractDocumentWithEncoding(ctx, path)
+	return content, err
+}
+
+// ExtractDocumentWithEncoding is ExtractDocument that also returns the detected encoding of
+// plain text files, which are converted to UTF-8 with normalized line endings. The encoding
+// is empty for other file types.
+func (vs *VectorStore) ExtractDocumentWithEncoding(ctx context.Context, path string) (string, string, error) {
 	// Check if file needs markitdown conversion
 	ext := strings.ToLower(filepath.Ext(path))
 	if vs.cfg.EnableMarkitdown && vs.needsMarkitdown(ext) {
-		return vs.convertWithMarkitdown(path)
+		content, err := vs.convertWithMarkitdown(path)
+		return content, "", err
 	}
 
 	// Direct read for text files or when markitdown is disabled
 	bytes, err := os.ReadFile(path)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
-	return string(bytes), nil
+	if ext == ".txt" {
+		content, encoding := decodeText(bytes, "")
+		return content, encoding, nil
+	}
+	return string(bytes), "", nil
 }
 
-// IngestText ingests raw text content
-func (vs *VectorStore) IngestText(ctx context.Context, notebookID, sourceName, content string) (int, error) {
+// IngestText ingests raw text content using the default chunking strategy.
+// Use IngestSource for stored sources so per-source strategies apply.
+func (vs *VectorStore) IngestText(ctx context.Context, notebookID, sourceID, sourceName, content string) (int, error) {
 	// Split content into chunks
-	chunks := vs.splitText(content, vs.cfg.ChunkSize, vs.cfg.ChunkOverlap)
+	chunks := vs.chunkText(content, vs.cfg.ChunkStrategy)
+	return vs.addChunks(notebookID, sourceID, sourceName, vs.cfg.ChunkStrategy, content, chunks), nil
+}
+
+// addChunks adds the chunks of a source to the index and returns how many were added.
+// Chunks found in content record their character range in it, for citations.
+func (vs *VectorStore) addChunks(notebookID, sourceID, sourceName, strategy, content string, chunks []string) int {
+	offsets := chunkOffsets(content, chunks)
 
 	vs.mu.Lock()
 	defer vs.mu.Unlock()
@@ -88,16 +117,22 @@ func (vs *VectorStore) IngestText(ctx context.Context, notebookID, sourceName, c
 		doc := schema.Document{
 			PageContent: chunk,
 			Metadata: map[string]any{
-				"notebook_id": notebookID,
-				"source":      sourceName,
-				"chunk":       i,
+				"notebook_id":    notebookID,
+				"source_id":      sourceID,
+				"source":         sourceName,
+				"chunk":          i,
+				"chunk_strategy": strategy,
 			},
 		}
+		if offsets[i][0] >= 0 {
+			doc.Metadata["start"] = offsets[i][0]
+			doc.Metadata["end"] = offsets[i][1]
+		}
 		vs.docs = append(vs.docs, doc)
 	}
 
-	golog.Infof("[VectorStore] Ingested %d chunks from source '%s' (total docs: %d)\n", len(chunks), sourceName, len(vs.docs))
-	return len(chunks), nil
+	golog.Infof("[VectorStore] Ingested %d chunks from source '%s' using %s chunking (total docs: %d)\n", len(chunks), sourceName, strategy, len(vs.docs))
+	return len(chunks)
 }
 
 // splitText splits text into chunks
@@ -211,6 +246,14 @@ func (vs *VectorStore) SimilaritySearch(ctx context.Context, notebookID, query s
 		score float64
 	}
 
+	// Highest score a chunk can reach, used to report scores in [0, 1]
+	maxScore := 10.0 + 5.0 + 1.0
+	for _, word := range strings.Fields(queryLower) {
+		if len(word) > 2 {
+			maxScore += 2.0
+		}
+	}
+
 	scores := make([]docScore, 0, len(candidateDocs))
 	for _, doc := range candidateDocs {
 		content := strings.ToLower(doc.PageContent)
@@ -283,12 +326,157 @@ func (vs *VectorStore) SimilaritySearch(ctx context.Context, notebookID, query s
 	// Return top results
 	result := make([]schema.Document, 0, numDocs)
 	for i := 0; i < len(scores) && i < numDocs; i++ {
-		result = append(result, scores[i].doc)
+		doc := scores[i].doc
+		doc.Score = float32(scores[i].score / maxScore)
+		result = append(result, doc)
 	}
 
 	return result, nil
 }
 
+// KeywordSearch ranks a notebook's chunks by exact term matches with the query, weighting
+// rare terms higher. Latin words are matched whole and CJK text by character bigrams.
+// Scores are in [0, 1]; chunks without any matching term are not returned.
+func (vs *VectorStore) KeywordSearch(ctx context.Context, notebookID, query string, numDocs int) ([]schema.Document, error) {
+	if numDocs <= 0 {
+		numDocs = 5
+	}
+
+	terms := keywordTerms(query)
+	if len(terms) == 0 {
+		return []schema.Document{}, nil
+	}
+
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	type docTerms struct {
+		doc    schema.Document
+		counts map[string]int
+	}
+	candidates := make([]docTerms, 0)
+	docFreq := make(map[string]int, len(terms))
+	for _, doc := range vs.docs {
+		if nid, ok := doc.Metadata["notebook_id"].(string); !ok || nid != notebookID {
+			continue
+		}
+		content := strings.ToLower(doc.PageContent)
+		counts := make(map[string]int)
+		for _, term := range terms {
+			if n := countTerm(content, term); n > 0 {
+				counts[term] = n
+				docFreq[term]++
+			}
+		}
+		if len(counts) > 0 {
+			candidates = append(candidates, docTerms{doc: doc, counts: counts})
+		}
+	}
+	if len(candidates) == 0 {
+		return []schema.Document{}, nil
+	}
+
+	// Inverse document frequency over the matching chunks, so terms found everywhere count less
+	idf := make(map[string]float64, len(terms))
+	totalWeight := 0.0
+	for _, term := range terms {
+		idf[term] = math.Log(1 + float64(len(candidates)+1)/float64(docFreq[term]+1))
+		totalWeight += idf[term]
+	}
+
+	results := make([]schema.Document, 0, len(candidates))
+	for _, c := range candidates {
+		score := 0.0
+		for term, n := range c.counts {
+			// Saturate repeated occurrences of a term
+			score += idf[term] * float64(n) / (float64(n) + 1.2) * 2.2
+		}
+		doc := c.doc
+		doc.Score = float32(math.Min(score/(totalWeight*2.2), 1))
+		results = append(results, doc)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > numDocs {
+		results = results[:numDocs]
+	}
+	return results, nil
+}
+
+// countTerm counts the occurrences of a keyword term in lowercase text. CJK bigrams match
+// anywhere; other terms only as whole words, so "cat" does not match "category".
+func countTerm(content, term string) int {
+	if first, _ := utf8.DecodeRuneInString(term); isCJK(first) {
+		return strings.Count(content, term)
+	}
+	n := 0
+	for i := 0; ; {
+		j := strings.Index(content[i:], term)
+		if j < 0 {
+			return n
+		}
+		start, end := i+j, i+j+len(term)
+		before, _ := utf8.DecodeLastRuneInString(content[:start])
+		after, _ := utf8.DecodeRuneInString(content[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			n++
+		}
+		i = start + 1
+	}
+}
+
+// isWordRune reports whether r continues a non-CJK word
+func isWordRune(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsDigit(r)) && !isCJK(r)
+}
+
+// keywordTerms extracts the distinct lowercase search terms of a query: words of at least
+// two letters or digits, and character bigrams of CJK runs
+func keywordTerms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	add := func(term string) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+
+	var word, cjk []rune
+	flush := func() {
+		if len(word) >= 2 {
+			add(string(word))
+		}
+		if len(cjk) == 1 {
+			add(string(cjk))
+		}
+		for i := 0; i+1 < len(cjk); i++ {
+			add(string(cjk[i : i+2]))
+		}
+		word, cjk = word[:0], cjk[:0]
+	}
+	for _, r := range strings.ToLower(query) {
+		switch {
+		case isCJK(r):
+			if len(word) > 0 {
+				flush()
+			}
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if len(cjk) > 0 {
+				flush()
+			}
+			word = append(word, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return terms
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -296,6 +484,90 @@ func min(a, b int) int {
 	return b
 }
 
+// ListChunks returns the stored chunks of a source in a notebook, ordered by chunk index
+func (vs *VectorStore) ListChunks(ctx context.Context, notebookID, sourceID string) []schema.Document {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	chunks := make([]schema.Document, 0)
+	for _, doc := range vs.docs {
+		if nid, ok := doc.Metadata["notebook_id"].(string); !ok || nid != notebookID {
+			continue
+		}
+		if sid, ok := doc.Metadata["source_id"].(string); ok && sid == sourceID {
+			chunks = append(chunks, doc)
+		}
+	}
+
+	sort.SliceStable(chunks, func(i, j int) bool {
+		ci, _ := chunks[i].Metadata["chunk"].(int)
+		cj, _ := chunks[j].Metadata["chunk"].(int)
+		return ci < cj
+	})
+
+	return chunks
+}
+
+// SourceChunkCounts returns the number of stored chunks per source ID in a notebook.
+// Chunks ingested without a source ID are counted under the empty key.
+func (vs *VectorStore) SourceChunkCounts(ctx context.Context, notebookID string) map[string]int {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, doc := range vs.docs {
+		if nid, ok := doc.Metadata["notebook_id"].(string); !ok || nid != notebookID {
+			continue
+		}
+		sid, _ := doc.Metadata["source_id"].(string)
+		counts[sid]++
+	}
+	return counts
+}
+
+// NotebookIDs returns the IDs of all notebooks that have chunks in the index
+func (vs *VectorStore) NotebookIDs(ctx context.Context) []string {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	ids := make([]string, 0)
+	for _, doc := range vs.docs {
+		if nid, ok := doc.Metadata["notebook_id"].(string); ok && !seen[nid] {
+			seen[nid] = true
+			ids = append(ids, nid)
+		}
+	}
+	return ids
+}
+
+// DeleteSourceChunks removes the chunks of a source in a notebook and returns how many were removed.
+// An empty sourceID removes every chunk of the notebook.
+func (vs *VectorStore) DeleteSourceChunks(ctx context.Context, notebookID, sourceID string) int {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	filtered := make([]schema.Document, 0, len(vs.docs))
+	for _, doc := range vs.docs {
+		nid, _ := doc.Metadata["notebook_id"].(string)
+		sid, _ := doc.Metadata["source_id"].(string)
+		if nid == notebookID && (sourceID == "" || sid == sourceID) {
+			continue
+		}
+		filtered = append(filtered, doc)
+	}
+	removed := len(vs.docs) - len(filtered)
+	vs.docs = filtered
+
+	return removed
+}
+
+// Unload drops a notebook's chunks from memory and returns how many were dropped. The
+// notebook's sources are untouched, so its index can be loaded again from them.
+func (vs *VectorStore) Unload(ctx context.Context, notebookID string) int {
+	return vs.DeleteSourceChunks(ctx, notebookID, "")
+}
+
 // Delete removes documents by source
 func (vs *VectorStore) Delete(ctx context.Context, source string) error {
 	vs.mu.Lock()
@@ -319,14 +591,42 @@ func (vs *VectorStore) GetStats(ctx context.Context) (VectorStats, error) {
 
 	stats := VectorStats{
 		TotalDocuments: len(vs.docs),
-		Dimension:      1536, // Default for OpenAI embeddings
+		Dimension:      vs.dimension(),
 	}
 
+	return stats, nil
+}
+
+// dimension returns the embedding vector dimension of the configured provider
+func (vs *VectorStore) dimension() int {
 	if vs.cfg.IsOllama() {
-		stats.Dimension = 768 // Common for Ollama models
+		return 768 // Common for Ollama models
 	}
+	return 1536 // Default for OpenAI embeddings
+}
 
-	return stats, nil
+// GetNotebookStats estimates how much memory a notebook's chunks take in the index:
+// one float32 vector per chunk plus the stored chunk text. Map and metadata overhead
+// is not counted, so treat the result as a lower bound.
+func (vs *VectorStore) GetNotebookStats(ctx context.Context, notebookID string) IndexMemoryStats {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	stats := IndexMemoryStats{
+		NotebookID: notebookID,
+		Dimension:  vs.dimension(),
+	}
+	for _, doc := range vs.docs {
+		if nid, ok := doc.Metadata["notebook_id"].(string); !ok || nid != notebookID {
+			continue
+		}
+		stats.Chunks++
+		stats.TextBytes += int64(len(doc.PageContent))
+	}
+	stats.VectorBytes = int64(stats.Chunks) * int64(stats.Dimension) * 4
+	stats.EstimatedBytes = stats.VectorBytes + stats.TextBytes
+
+	return stats
 }
 
 // needsMarkitdown checks if a file extension requires markitdown conversion
@@ -345,34 +645,7 @@ func (vs *VectorStore) needsMarkitdown(ext string) bool {
 
 // ExtractFromURL fetches and converts content from a URL using markitdown
 func (vs *VectorStore) ExtractFromURL(ctx context.Context, url string) (string, error) {
-	fmt.Printf("[VectorStore] Fetching content from URL: %s\n", url)
-
-	if !vs.cfg.EnableMarkitdown {
-		return "", fmt.Errorf("markitdown is disabled, cannot fetch URL content")
-	}
-
-	// Create temporary output file
-	tmpFile := filepath.Join(os.TempDir(), fmt.Sprintf("markitdown_url_%d.md", os.Getpid()))
-
-	// Run markitdown command with URL
-	cmd := exec.Command("markitdown", url, "-o", tmpFile)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		fmt.Printf("[VectorStore] markitdown error: %s\n", string(output))
-		return "", fmt.Errorf("failed to fetch URL content: %w, output: %s", err, string(output))
-	}
-
-	// Read the converted markdown content
-	content, err := os.ReadFile(tmpFile)
-	if err != nil {
-		return "", fmt.Errorf("failed to read markitdown output: %w", err)
-	}
-
-	// Clean up temporary file
-	os.Remove(tmpFile)
-
-	fmt.Printf("[VectorStore] URL content fetched successfully, output size: %d bytes\n", len(content))
-	return string(content), nil
+	return vs.ExtractFromURLWithMode(ctx, url, URLExtractFullText)
 }
 
 // convertWithMarkitdown converts a document to Markdown using the markitdown CLI tool
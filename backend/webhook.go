@@ -0,0 +1,150 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kataras/golog"
+)
+
+// webhookSignatureHeader carries the HMAC-SHA256 of a webhook body, keyed with WEBHOOK_SECRET
+const webhookSignatureHeader = "X-Notex-Signature"
+
+// webhookAttempts is how often a webhook is posted before giving up
+const webhookAttempts = 4
+
+// Webhook events
+const (
+	WebhookTransformCompleted = "transform.completed"
+	WebhookTransformFailed    = "transform.failed"
+)
+
+// TransformWebhook is the body posted to the webhook_url of a transformation
+type TransformWebhook struct {
+	Event      string    `json:"event"`
+	NoteID     string    `json:"note_id"`
+	NotebookID string    `json:"notebook_id"`
+	JobID      string    `json:"job_id"`
+	Note       *Note     `json:"note,omitempty"`  // the finished note, on transform.completed
+	Error      string    `json:"error,omitempty"` // why it failed, on transform.failed
+	SentAt     time.Time `json:"sent_at"`
+}
+
+// TransformAccepted answers a transformation with a webhook_url: its job, plus the ID
+// the note will be saved under
+type TransformAccepted struct {
+	*Job
+	NoteID string `json:"note_id"`
+}
+
+// webhookClient posts webhooks. Redirects are not followed, they could lead to internal
+// addresses checkPublicURL has not seen.
+var webhookClient = &http.Client{
+	Timeout: 15 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// signWebhook returns the signature header value of a webhook body
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// startWebhookTransform runs a transformation in the background and answers 202 with the
+// ID of its note. The outcome is posted to the request's webhook_url.
+func (s *Server) startWebhookTransform(c *gin.Context, task *transformTask) {
+	task.NoteID = uuid.New().String()
+	webhookURL := task.Req.WebhookURL
+
+	job := s.jobs.Start(task.UserID, task.NotebookID, "transform", func(ctx context.Context, job *Job) (interface{}, error) {
+		note, err := s.runTransform(ctx, job, task)
+
+		event := &TransformWebhook{
+			Event:      WebhookTransformCompleted,
+			NoteID:     task.NoteID,
+			NotebookID: task.NotebookID,
+			JobID:      job.ID,
+			Note:       note,
+		}
+		if err != nil {
+			event.Event = WebhookTransformFailed
+			event.Error = err.Error()
+		}
+		// Retries must not hold the job open
+		go s.deliverWebhook(webhookURL, event)
+
+		return note, err
+	})
+
+	c.JSON(http.StatusAccepted, TransformAccepted{Job: job, NoteID: task.NoteID})
+}
+
+// deliverWebhook posts a transformation event, retrying with backoff until the receiver
+// answers with a 2xx status or the attempts run out
+func (s *Server) deliverWebhook(webhookURL string, event *TransformWebhook) {
+	event.SentAt = time.Now()
+	body, err := json.Marshal(event)
+	if err != nil {
+		golog.Errorf("failed to encode webhook of note %s: %v", event.NoteID, err)
+		return
+	}
+	signature := signWebhook(s.cfg.WebhookSecret, body)
+
+	backoff := 2 * time.Second
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		err := postWebhook(webhookURL, body, signature, event.Event)
+		if err == nil {
+			golog.Infof("delivered %s webhook of note %s", event.Event, event.NoteID)
+			return
+		}
+		if attempt == webhookAttempts {
+			golog.Errorf("giving up on %s webhook of note %s after %d attempts: %v", event.Event, event.NoteID, attempt, err)
+			return
+		}
+		golog.Warnf("webhook of note %s failed (attempt %d/%d), retrying in %s: %v", event.NoteID, attempt, webhookAttempts, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// postWebhook makes one delivery attempt
+func postWebhook(webhookURL string, body []byte, signature, event string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookClient.Timeout)
+	defer cancel()
+
+	// Checked again on every attempt, the host may resolve differently by now
+	if err := checkPublicURL(ctx, webhookURL); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "notex-webhook")
+	req.Header.Set("X-Notex-Event", event)
+	req.Header.Set(webhookSignatureHeader, signature)
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return nil
+}
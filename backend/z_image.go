@@ -6,8 +6,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -20,21 +18,16 @@ type ZImageClient struct {
 	apiKey     string
 	baseURL    string
 	httpClient *http.Client
+	storage    Storage
 }
 
 // NewZImageClient creates a new ZImage client
-func NewZImageClient(apiKey string) *ZImageClient {
+func NewZImageClient(apiKey string, transport http.RoundTripper, storage Storage) *ZImageClient {
 	return &ZImageClient{
 		apiKey: apiKey,
 		baseURL: "https://dashscope.aliyuncs.com/api/v1/services/aigc/image-generation/generation",
-		httpClient: &http.Client{
-			Timeout: 5 * time.Minute,
-			Transport: &http.Transport{
-				DisableKeepAlives: false,
-				MaxIdleConns:      100,
-				IdleConnTimeout:   5 * time.Minute,
-			},
-		},
+		httpClient: providerHTTPClient(transport, 5*time.Minute),
+		storage: storage,
 	}
 }
 
@@ -135,27 +128,8 @@ func (z *ZImageClient) GenerateImage(ctx context.Context, model, prompt string,
 
 	golog.Infof("image data received successfully (%d bytes), saving...", len(imageData))
 
-	// Save the image to user-specific directory
-	fileName := fmt.Sprintf("infograph_%d.png", time.Now().UnixNano())
-	var uploadDir string
-	if userID != "" {
-		uploadDir = filepath.Join("./data/uploads", userID)
-	} else {
-		uploadDir = "./data/uploads"
-	}
-
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create upload directory: %w", err)
-	}
-
-	filePath := filepath.Join(uploadDir, fileName)
-	if err := os.WriteFile(filePath, imageData, 0644); err != nil {
-		golog.Errorf("failed to save image to %s: %v", filePath, err)
-		return "", fmt.Errorf("failed to save image: %w", err)
-	}
-
-	golog.Infof("infographic saved to %s", filePath)
-	return filePath, nil
+	// Save the image to the user's files
+	return saveGeneratedImage(ctx, z.storage, userID, imageData)
 }
 
 // GenerateTextWithModel generates text using Z-Image (optional, for compatibility)
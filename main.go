@@ -154,12 +154,13 @@ func runIngestMode(ctx context.Context, cfg backend.Config, filePath, notebookNa
 		Metadata:   map[string]interface{}{"path": filePath},
 	}
 
+	vectorStore.AssignChunkStrategy(source)
 	if err := store.CreateSource(ctx, source); err != nil {
 		golog.Fatalf("failed to create source: %v", err)
 	}
 
 	// Ingest document
-	if _, err := vectorStore.IngestText(ctx, notebookID, source.Name, content); err != nil {
+	if _, err := vectorStore.IngestSource(ctx, source); err != nil {
 		golog.Fatalf("ingestion failed: %v", err)
 	}
 